@@ -0,0 +1,287 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: walletmigrate.proto
+
+package API
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// MigrationClient is the client API for Migration service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MigrationClient interface {
+	//queue a scan and answer its job
+	StartScan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*Job, error)
+	//the plan a finished scan wrote
+	GetPlan(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*PlanReply, error)
+	//keep an approval signed by one of the approvers next to the scan's plan
+	ApprovePlan(ctx context.Context, in *ApproveRequest, opts ...grpc.CallOption) (*Approval, error)
+	//queue broadcasting a scan's plan, refused while it isn't approved when approvers are set
+	Execute(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error)
+	//everything the job printed so far and from then on as it prints it, the last message has the finished job
+	StreamProgress(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (Migration_StreamProgressClient, error)
+}
+
+type migrationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMigrationClient(cc grpc.ClientConnInterface) MigrationClient {
+	return &migrationClient{cc}
+}
+
+func (c *migrationClient) StartScan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/walletmigrate.Migration/StartScan", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *migrationClient) GetPlan(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*PlanReply, error) {
+	out := new(PlanReply)
+	err := c.cc.Invoke(ctx, "/walletmigrate.Migration/GetPlan", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *migrationClient) ApprovePlan(ctx context.Context, in *ApproveRequest, opts ...grpc.CallOption) (*Approval, error) {
+	out := new(Approval)
+	err := c.cc.Invoke(ctx, "/walletmigrate.Migration/ApprovePlan", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *migrationClient) Execute(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/walletmigrate.Migration/Execute", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *migrationClient) StreamProgress(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (Migration_StreamProgressClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Migration_ServiceDesc.Streams[0], "/walletmigrate.Migration/StreamProgress", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &migrationStreamProgressClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Migration_StreamProgressClient interface {
+	Recv() (*Progress, error)
+	grpc.ClientStream
+}
+
+type migrationStreamProgressClient struct {
+	grpc.ClientStream
+}
+
+func (x *migrationStreamProgressClient) Recv() (*Progress, error) {
+	m := new(Progress)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MigrationServer is the server API for Migration service.
+// All implementations must embed UnimplementedMigrationServer
+// for forward compatibility
+type MigrationServer interface {
+	//queue a scan and answer its job
+	StartScan(context.Context, *ScanRequest) (*Job, error)
+	//the plan a finished scan wrote
+	GetPlan(context.Context, *JobRequest) (*PlanReply, error)
+	//keep an approval signed by one of the approvers next to the scan's plan
+	ApprovePlan(context.Context, *ApproveRequest) (*Approval, error)
+	//queue broadcasting a scan's plan, refused while it isn't approved when approvers are set
+	Execute(context.Context, *JobRequest) (*Job, error)
+	//everything the job printed so far and from then on as it prints it, the last message has the finished job
+	StreamProgress(*JobRequest, Migration_StreamProgressServer) error
+	mustEmbedUnimplementedMigrationServer()
+}
+
+// UnimplementedMigrationServer must be embedded to have forward compatible implementations.
+type UnimplementedMigrationServer struct {
+}
+
+func (UnimplementedMigrationServer) StartScan(context.Context, *ScanRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartScan not implemented")
+}
+func (UnimplementedMigrationServer) GetPlan(context.Context, *JobRequest) (*PlanReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPlan not implemented")
+}
+func (UnimplementedMigrationServer) ApprovePlan(context.Context, *ApproveRequest) (*Approval, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApprovePlan not implemented")
+}
+func (UnimplementedMigrationServer) Execute(context.Context, *JobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Execute not implemented")
+}
+func (UnimplementedMigrationServer) StreamProgress(*JobRequest, Migration_StreamProgressServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamProgress not implemented")
+}
+func (UnimplementedMigrationServer) mustEmbedUnimplementedMigrationServer() {}
+
+// UnsafeMigrationServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MigrationServer will
+// result in compilation errors.
+type UnsafeMigrationServer interface {
+	mustEmbedUnimplementedMigrationServer()
+}
+
+func RegisterMigrationServer(s grpc.ServiceRegistrar, srv MigrationServer) {
+	s.RegisterService(&Migration_ServiceDesc, srv)
+}
+
+func _Migration_StartScan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationServer).StartScan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/walletmigrate.Migration/StartScan",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationServer).StartScan(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Migration_GetPlan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationServer).GetPlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/walletmigrate.Migration/GetPlan",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationServer).GetPlan(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Migration_ApprovePlan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApproveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationServer).ApprovePlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/walletmigrate.Migration/ApprovePlan",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationServer).ApprovePlan(ctx, req.(*ApproveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Migration_Execute_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationServer).Execute(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/walletmigrate.Migration/Execute",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationServer).Execute(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Migration_StreamProgress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(JobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MigrationServer).StreamProgress(m, &migrationStreamProgressServer{stream})
+}
+
+type Migration_StreamProgressServer interface {
+	Send(*Progress) error
+	grpc.ServerStream
+}
+
+type migrationStreamProgressServer struct {
+	grpc.ServerStream
+}
+
+func (x *migrationStreamProgressServer) Send(m *Progress) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Migration_ServiceDesc is the grpc.ServiceDesc for Migration service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Migration_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "walletmigrate.Migration",
+	HandlerType: (*MigrationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "StartScan",
+			Handler:    _Migration_StartScan_Handler,
+		},
+		{
+			MethodName: "GetPlan",
+			Handler:    _Migration_GetPlan_Handler,
+		},
+		{
+			MethodName: "ApprovePlan",
+			Handler:    _Migration_ApprovePlan_Handler,
+		},
+		{
+			MethodName: "Execute",
+			Handler:    _Migration_Execute_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamProgress",
+			Handler:       _Migration_StreamProgress_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "walletmigrate.proto",
+}
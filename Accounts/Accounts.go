@@ -2,19 +2,23 @@ package Accounts
 
 import (
 	"crypto/ecdsa"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/tyler-smith/go-bip39"
 	"log"
-	"math"
 	"math/big"
 	"strings"
+	"walletMigrate/Errors"
+	"walletMigrate/Redaction"
 )
 
 type Account struct {
@@ -27,6 +31,16 @@ type Account struct {
 	Available          *big.Int
 	Nonce              uint64
 	ChainId            *big.Int
+	Path               string        //derivation path of a mnemonic account, empty for a private key
+	DynamicFees        bool          //the chain has activated London so transactions are sent as EIP-1559 (type 2)
+	Homestead          bool          //the chain predates EIP-155 so transactions are signed without a chain id
+	TransferGas        uint64        //gas limit of a plain ETH transfer on the chain, above 21000 where L1 calldata costs L2 gas
+	MinGasPrice        *big.Int      //lowest gas price a transaction is still mined at, for sweeping balances too small for the run's gas price
+	Code               []byte        //code at the address, a contract (the key doesn't control it) or an EIP-7702 delegation
+	Remote             *RemoteSigner //the sign-server holding the key of an account listed without one
+	Used               bool          //sent a transaction or received a token, found by the scan even when it is empty now
+	WatchOnly          bool          //derived from an extended public key, it is scanned and planned but never signed for
+	Candidate          string        //the passphrase candidate the account was derived with by position, e.g. mnemonics[0].passphrases[1]
 }
 
 type Token struct {
@@ -35,23 +49,170 @@ type Token struct {
 	Symbol   string
 	Decimals uint8
 	GasLimit uint64
+	ERC777   bool     //moved with send() rather than transfer() so the token's hooks run
+	TokenID  *big.Int //set for a single collectible, moved with its contract's own transfer function
+	Fallback bool     //the collectible's transfer function would revert, it is moved with its contract's fallback one
+
+	DecimalsUnknown bool   //decimals() failed so the balance can only be shown in base units
+	Unsupported     string //why a plain transfer can't move this token, it is reported but never transferred
+	GasSimulated    bool   //eth_estimateGas failed, the gas limit is the lowest one eth_call ran the transfer with
+	Manual          bool   //transfer() returns false, only approve and transferFrom or a transaction made by hand moves it
 }
 
 func (self Token) TotalTransferPrice(gasPrice *big.Int) *big.Int {
 	return new(big.Int).Mul(gasPrice, big.NewInt(int64(self.GasLimit)))
 }
 
-func (self Token) DecimalBalance() *big.Float {
+//DecimalBalance is the exact balance in whole tokens, float math would round balances of tokens with more than 15 or so
+//significant digits, tokens whose decimals() failed are shown as ? and only their base units are known
+func (self Token) DecimalBalance() string {
+	if self.DecimalsUnknown {
+		return "?"
+	}
 	if self.Decimals == 0 {
-		return new(big.Float).SetInt(self.Balance)
+		return self.Balance.String()
 	}
-	return new(big.Float).Quo(new(big.Float).SetInt(self.Balance), big.NewFloat(math.Pow10(int(self.Decimals))))
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(self.Decimals)), nil)
+	text := new(big.Rat).SetFrac(self.Balance, scale).FloatString(int(self.Decimals))
+	return strings.TrimSuffix(strings.TrimRight(text, "0"), ".")
 }
 
 func (self Account) TotalAssetTransferPrice(gasPrice *big.Int) *big.Int {
 	return new(big.Int).Mul(gasPrice, self.TotalAssetTransfer)
 }
 
+//Copy returns a deep copy of the account so plans can be built without changing the balances of the original
+func (self Account) Copy() Account {
+	account := self
+	account.Balance = copyInt(self.Balance)
+	account.TotalAssetTransfer = copyInt(self.TotalAssetTransfer)
+	account.Available = copyInt(self.Available)
+	account.ChainId = copyInt(self.ChainId)
+	account.MinGasPrice = copyInt(self.MinGasPrice)
+	account.Tokens = make([]Token, len(self.Tokens))
+	for i, token := range self.Tokens {
+		token.Balance = copyInt(token.Balance)
+		account.Tokens[i] = token
+	}
+	return account
+}
+
+//SignTx signs a transaction from the account with the signer of the chain's latest fork, after London it is an EIP-1559
+//transaction whose fee cap and tip are both the gas price so it never costs more than the legacy transaction would have
+func (self Account) SignTx(nonce uint64, to common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte) (*types.Transaction, error) {
+	return self.SignTxWithFees(nonce, to, value, gasLimit, gasPrice, gasPrice, data)
+}
+
+//SignTxWithFees signs with a separate tip and fee cap, a chain without dynamic fees pays the fee cap as its gas price
+func (self Account) SignTxWithFees(nonce uint64, to common.Address, value *big.Int, gasLimit uint64, tipCap *big.Int, feeCap *big.Int, data []byte) (*types.Transaction, error) {
+	if self.Homestead {
+		return self.Sign(types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: feeCap, Gas: gasLimit, To: &to, Value: value, Data: data}), nil)
+	}
+	var tx *types.Transaction
+	if self.DynamicFees {
+		tx = types.NewTx(&types.DynamicFeeTx{ChainID: self.ChainId, Nonce: nonce, GasTipCap: tipCap, GasFeeCap: feeCap, Gas: gasLimit, To: &to, Value: value, Data: data})
+	} else {
+		tx = types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: feeCap, Gas: gasLimit, To: &to, Value: value, Data: data})
+	}
+	return self.Sign(tx, self.ChainId)
+}
+
+//TransactOpts has a generated contract binding sign a transaction with the account's key (or its sign-server) rather
+//than send it, with the nonce, gas limit and gas price decided by the run so the binding asks the node for none of them
+func (self Account) TransactOpts(nonce uint64, gasLimit uint64, gasPrice *big.Int) *bind.TransactOpts {
+	opts := &bind.TransactOpts{
+		From:     self.Address,
+		Nonce:    new(big.Int).SetUint64(nonce),
+		GasLimit: gasLimit,
+		NoSend:   true,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != self.Address {
+				return nil, bind.ErrNotAuthorized
+			}
+			if self.Homestead {
+				return self.Sign(tx, nil)
+			}
+			return self.Sign(tx, self.ChainId)
+		},
+	}
+	if self.DynamicFees && !self.Homestead {
+		opts.GasTipCap, opts.GasFeeCap = gasPrice, gasPrice
+	} else {
+		opts.GasPrice = gasPrice
+	}
+	return opts
+}
+
+//Sign signs a prepared transaction with the account's key, or has its sign-server sign it when the key is kept there.
+//A nil chainID signs without replay protection for chains that predate EIP-155
+func (self Account) Sign(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if self.PrivateKey == nil {
+		if self.Remote == nil {
+			return nil, Errors.New(Errors.SignError, fmt.Errorf("%s has no key to sign with", self.Address.Hex()))
+		}
+		signedTx, err := self.Remote.SignTx(self.Address, tx, chainID)
+		return signedTx, Errors.New(Errors.SignError, err)
+	}
+	var signer types.Signer = types.HomesteadSigner{}
+	if chainID != nil {
+		signer = types.LatestSignerForChainID(chainID)
+	}
+	signedTx, err := types.SignTx(tx, signer, self.PrivateKey)
+	return signedTx, Errors.New(Errors.SignError, err)
+}
+
+//SignMessage signs an EIP-191 personal message, what personal_sign and a wallet's "sign message" make, with v as 27
+//or 28.  A sign-server only signs transactions so its accounts can't sign messages
+func (self Account) SignMessage(message string) ([]byte, error) {
+	if self.PrivateKey == nil {
+		return nil, Errors.New(Errors.SignError, fmt.Errorf("%s has no key to sign messages with", self.Address.Hex()))
+	}
+	signature, err := crypto.Sign(accounts.TextHash([]byte(message)), self.PrivateKey)
+	if err != nil {
+		return nil, Errors.New(Errors.SignError, err)
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return signature, nil
+}
+
+//Delegate is the contract an EIP-7702 delegated account runs, the key still controls the account
+func (self Account) Delegate() (common.Address, bool) {
+	if len(self.Code) != 23 || self.Code[0] != 0xef || self.Code[1] != 0x01 || self.Code[2] != 0x00 {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(self.Code[3:]), true
+}
+
+func copyInt(value *big.Int) *big.Int {
+	if value == nil {
+		return nil
+	}
+	return new(big.Int).Set(value)
+}
+
+//Currency is the native currency of a chain, its amounts are printed in its own symbol and decimals instead of ETH
+type Currency struct {
+	Symbol   string
+	Decimals int
+}
+
+var Ether = Currency{Symbol: "ETH", Decimals: 18}
+
+//Format prints an amount of the smallest unit in whole coins
+func (self Currency) Format(amount *big.Int) string {
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(self.Decimals)), nil))
+	return fmt.Sprintf("%.8f %s", new(big.Float).Quo(new(big.Float).SetInt(amount), scale), self.Symbol)
+}
+
+//FormatGasPrice prints a gas price in Gwei when the currency has 18 decimals like ETH, in whole coins otherwise
+func (self Currency) FormatGasPrice(price *big.Int) string {
+	if self.Decimals == 18 {
+		return fmt.Sprintf("%.2f Gwei", Gwei(price))
+	}
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(self.Decimals)), nil))
+	return fmt.Sprintf("%.4g %s", new(big.Float).Quo(new(big.Float).SetInt(price), scale), self.Symbol)
+}
+
 func Gwei(amount *big.Int) *big.Float {
 	return new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(big.NewInt(params.GWei)))
 }
@@ -59,11 +220,92 @@ func Eth(amount *big.Int) *big.Float {
 	return new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(big.NewInt(params.Ether)))
 }
 
-func GetAccounts(mnemonics []string, privateKeys []string, numberOfAccounts int) []Account {
+//ValidateMnemonic explains what is wrong with a mnemonic without ever including its words in the error
+func ValidateMnemonic(mnemonic string) error {
+	words := strings.Fields(mnemonic)
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return fmt.Errorf("has %d words, expected 12, 15, 18, 21 or 24", len(words))
+	}
+	for i, word := range words {
+		if _, ok := bip39.GetWordIndex(word); !ok {
+			return fmt.Errorf("word %d is not in the BIP-39 english word list", i+1)
+		}
+	}
+	if !bip39.IsMnemonicValid(strings.Join(words, " ")) {
+		return errors.New("checksum is invalid, check the order and spelling of the words")
+	}
+	return nil
+}
+
+//ValidateSeed explains what is wrong with a hex BIP-32 seed without ever including it in the error, the seed bip39
+//derives from a phrase is 64 bytes and BIP-32 allows 16 to 64
+func ValidateSeed(seedString string) error {
+	seed, err := hex.DecodeString(strings.TrimPrefix(seedString, "0x"))
+	if err != nil {
+		return errors.New("is not valid hex")
+	}
+	if len(seed) < hdkeychain.MinSeedBytes || len(seed) > hdkeychain.MaxSeedBytes {
+		return fmt.Errorf("has %d bytes, expected %d to %d (64 for the seed of a phrase)", len(seed), hdkeychain.MinSeedBytes, hdkeychain.MaxSeedBytes)
+	}
+	if _, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams); err != nil {
+		return errors.New("derives an invalid master key, use another seed")
+	}
+	return nil
+}
+
+//ValidatePrivateKey explains what is wrong with a hex private key without ever including it in the error
+func ValidatePrivateKey(pkString string) error {
+	pkString = strings.Replace(pkString, "0x", "", 1)
+	if len(pkString) != 64 {
+		return fmt.Errorf("has %d hex characters, expected 64", len(pkString))
+	}
+	if _, err := hex.DecodeString(pkString); err != nil {
+		return errors.New("is not valid hex")
+	}
+	if _, err := crypto.HexToECDSA(pkString); err != nil {
+		return errors.New("is not a valid secp256k1 private key")
+	}
+	return nil
+}
+
+//Mnemonic is a seed phrase and the part of the m/44'/60'/account'/change/index derivation path grid to scan for it
+type Mnemonic struct {
+	Phrase      string
+	Seed        string   //hex BIP-32 seed used instead of the phrase, for wallets generated from entropy without one
+	Shares      []string //SLIP-39 shares used instead of the phrase, combined into the seed
+	Passphrases []string //candidate passphrases of the phrase or shares, each derives its own grid, none is the empty one
+	Accounts    int      //number of hardened account values to derive (Ledger Live and several mobile wallets increment this one)
+	Changes     int      //number of change values to derive
+	Indexes     int      //number of address indexes to derive for each change value
+	FirstIndex  int      //address index to start deriving from, for when the funds are known to sit further along the path
+}
+
+//ExtendedKey is an account level BIP-32 extended key (of m/44'/60'/account') and the {key}/change/index grid to scan
+//below it.  An xprv signs like a mnemonic, the accounts of an xpub are watch-only
+type ExtendedKey struct {
+	Key        string
+	Changes    int //number of change values to derive
+	Indexes    int //number of address indexes to derive for each change value
+	FirstIndex int //address index to start deriving from
+}
+
+func GetAccounts(mnemonics []Mnemonic, privateKeys []string, extendedKeys []ExtendedKey, brainWallets []string) []Account {
 	mapAccounts := make(map[string]Account, 0)
 
-	for _, mnemonic := range mnemonics {
-		_accounts, err := accountsFromMnemonic(mnemonic, numberOfAccounts)
+	for i, mnemonic := range mnemonics {
+		_accounts, err := accountsFromMnemonic(i, mnemonic)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, account := range _accounts {
+			mapAccounts[account.Address.Hex()] = account
+		}
+	}
+
+	for i, extendedKey := range extendedKeys {
+		_accounts, err := accountsFromExtendedKey(i+1, extendedKey)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -80,6 +322,15 @@ func GetAccounts(mnemonics []string, privateKeys []string, numberOfAccounts int)
 		mapAccounts[account.Address.Hex()] = *account
 	}
 
+	for i, passphrase := range brainWallets {
+		account, err := accountFromBrainWallet(passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		account.Path = fmt.Sprintf("brain wallet %d", i+1)
+		mapAccounts[account.Address.Hex()] = *account
+	}
+
 	allAccounts := make([]Account, 0)
 
 	for _, account := range mapAccounts {
@@ -89,65 +340,244 @@ func GetAccounts(mnemonics []string, privateKeys []string, numberOfAccounts int)
 }
 
 //because there is no standard used in ethereum on whether to vary the change or address_index to create new accounts
-//(i.e. metamask uses one method and commonly mobile wallets use another) this will actually generate numberOfAccounts squared
+//(i.e. metamask uses one method and commonly mobile wallets use another) this will actually generate Accounts x Changes x Indexes accounts
 //we will then have to check the balance or nonce to determine if they are used.
-func accountsFromMnemonic(mnemonic string, numberOfAccounts int) ([]Account, error) {
-	if mnemonic == "" {
+func accountsFromMnemonic(position int, mnemonic Mnemonic) ([]Account, error) {
+	if len(mnemonic.Passphrases) == 0 {
+		masterKey, err := masterKeyOf(mnemonic, "")
+		if err != nil {
+			return nil, err
+		}
+		return accountsFromMasterKey(masterKey, mnemonic)
+	}
+	allAccounts := make([]Account, 0)
+	for i, passphrase := range mnemonic.Passphrases {
+		Redaction.Secret(passphrase)
+		masterKey, err := masterKeyOf(mnemonic, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		_accounts, err := accountsFromMasterKey(masterKey, mnemonic)
+		if err != nil {
+			return nil, err
+		}
+		//the passphrase is only ever referred to by its position
+		candidate := fmt.Sprintf("mnemonics[%d].passphrases[%d]", position, i)
+		for _, account := range _accounts {
+			account.Path, account.Candidate = fmt.Sprintf("%s passphrase %d", account.Path, i+1), candidate
+			allAccounts = append(allAccounts, account)
+		}
+	}
+	return allAccounts, nil
+}
+
+//the grid of the mnemonic below one of its master keys
+func accountsFromMasterKey(masterKey *hdkeychain.ExtendedKey, mnemonic Mnemonic) ([]Account, error) {
+	allAccounts := make([]Account, 0)
+	for account := 0; account < mnemonic.Accounts; account++ {
+		for change := 0; change < mnemonic.Changes; change++ {
+			for addressIndex := mnemonic.FirstIndex; addressIndex < mnemonic.FirstIndex+mnemonic.Indexes; addressIndex++ {
+				//https://github.com/bitcoin/bips/blob/master/bip-0044.mediawiki#Path_levels
+				dPath, err := accounts.ParseDerivationPath(fmt.Sprintf("m/44'/60'/%d'/%d/%d", account, change, addressIndex))
+				if err != nil {
+					return nil, err
+				}
+				account, err := accountFromPath(masterKey, dPath)
+				if err != nil {
+					return nil, err
+				}
+				allAccounts = append(allAccounts, account)
+			}
+		}
+	}
+
+	return allAccounts, nil
+}
+
+//the grid below an extended key, the path of each account is the key's kind and position in the settings followed by
+//the change and index, e.g. xpub 2/0/5, the key itself is never shown
+func accountsFromExtendedKey(position int, extended ExtendedKey) ([]Account, error) {
+	Redaction.Secret(extended.Key)
+	key, err := hdkeychain.NewKeyFromString(extended.Key)
+	if err != nil {
+		return nil, err
+	}
+	kind := "xpub"
+	if key.IsPrivate() {
+		kind = "xprv"
+	}
+	allAccounts := make([]Account, 0)
+	for change := 0; change < extended.Changes; change++ {
+		for addressIndex := extended.FirstIndex; addressIndex < extended.FirstIndex+extended.Indexes; addressIndex++ {
+			path := accounts.DerivationPath{uint32(change), uint32(addressIndex)}
+			var account Account
+			if key.IsPrivate() {
+				account, err = accountFromPath(key, path)
+			} else {
+				account, err = watchOnlyAccount(key, path)
+			}
+			if err != nil {
+				return nil, err
+			}
+			account.Path = fmt.Sprintf("%s %d/%d/%d", kind, position, change, addressIndex)
+			allAccounts = append(allAccounts, account)
+		}
+	}
+	return allAccounts, nil
+}
+
+//the account at the path below an extended public key, its address is known but there is no key to sign with
+func watchOnlyAccount(key *hdkeychain.ExtendedKey, path accounts.DerivationPath) (Account, error) {
+	var err error
+	for _, n := range path {
+		key, err = key.Child(n)
+		if err != nil {
+			return Account{}, err
+		}
+	}
+	publicKey, err := key.ECPubKey()
+	if err != nil {
+		return Account{}, err
+	}
+	address, err := deriveAddress(publicKey.ToECDSA())
+	if err != nil {
+		return Account{}, err
+	}
+	return Account{PublicKey: publicKey.ToECDSA(), Address: address, WatchOnly: true, Tokens: make([]Token, 0), TotalAssetTransfer: big.NewInt(0), Balance: big.NewInt(0), Available: big.NewInt(0)}, nil
+}
+
+//DeriveAccount derives the single account at the path, e.g. m/44'/60'/0'/1/3
+func DeriveAccount(phrase string, path string) (Account, error) {
+	masterKey, err := masterKeyFromMnemonic(phrase, "")
+	if err != nil {
+		return Account{}, err
+	}
+	dPath, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return Account{}, err
+	}
+	return accountFromPath(masterKey, dPath)
+}
+
+//the master key of the SLIP-39 shares or the seed when one is given, of the phrase otherwise.  The passphrase (BIP-39's
+//or SLIP-39's, they are different) doesn't apply to a seed
+func masterKeyOf(mnemonic Mnemonic, passphrase string) (*hdkeychain.ExtendedKey, error) {
+	if len(mnemonic.Shares) > 0 {
+		seed, err := SLIP39Secret(mnemonic.Shares, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	}
+	if mnemonic.Seed == "" {
+		return masterKeyFromMnemonic(mnemonic.Phrase, passphrase)
+	}
+	Redaction.Secret(mnemonic.Seed)
+	seed, err := hex.DecodeString(strings.TrimPrefix(mnemonic.Seed, "0x"))
+	if err != nil {
+		return nil, errors.New("seed is not valid hex")
+	}
+	return hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+}
+
+func masterKeyFromMnemonic(phrase string, passphrase string) (*hdkeychain.ExtendedKey, error) {
+	if phrase == "" {
 		return nil, errors.New("mnemonic is required")
 	}
 
-	if !bip39.IsMnemonicValid(mnemonic) {
-		return nil, errors.New("mnemonic is invalid:" + mnemonic)
+	Redaction.Secret(phrase)
+	if !bip39.IsMnemonicValid(phrase) {
+		return nil, errors.New("mnemonic is invalid")
 
 	}
 
-	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	seed, err := bip39.NewSeedWithErrorChecking(phrase, passphrase)
 
 	if err != nil {
 		return nil, err
 	}
 
-	masterKey, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	return hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+}
+
+func accountFromPath(masterKey *hdkeychain.ExtendedKey, dPath accounts.DerivationPath) (Account, error) {
+	privateKey, err := derivePrivateKey(masterKey, dPath)
 	if err != nil {
-		return nil, err
+		return Account{}, err
 	}
+	Redaction.Key(privateKey)
+	publicKey, err := derivePublicKey(privateKey)
+	if err != nil {
+		return Account{}, err
+	}
+	address, err := deriveAddress(publicKey)
+	if err != nil {
+		return Account{}, err
+	}
+	return Account{PrivateKey: privateKey, PublicKey: publicKey, Address: address, Tokens: make([]Token, 0), TotalAssetTransfer: big.NewInt(0), Balance: big.NewInt(0), Available: big.NewInt(0), Path: dPath.String()}, nil
+}
 
-	allAccounts := make([]Account, 0)
-	for account := 0; account <= 0; account++ {
-		for change := 0; change < numberOfAccounts; change++ {
-			for addressIndex := 0; addressIndex < numberOfAccounts; addressIndex++ {
-				//https://github.com/bitcoin/bips/blob/master/bip-0044.mediawiki#Path_levels
-				dPath, err := accounts.ParseDerivationPath(fmt.Sprintf("m/44'/60'/%d'/%d/%d", account, change, addressIndex))
-				if err != nil {
-					return nil, err
-				}
-				privateKey, err := derivePrivateKey(masterKey, dPath)
-				if err != nil {
-					return nil, err
-				}
-				publicKey, err := derivePublicKey(privateKey)
-				if err != nil {
-					return nil, err
-				}
-				address, err := deriveAddress(publicKey)
-				if err != nil {
-					return nil, err
-				}
+//ValidateExtendedPublicKey checks an account level extended public key (m/44'/60'/0') that receiving addresses are derived from
+func ValidateExtendedPublicKey(xpub string) error {
+	key, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil {
+		return fmt.Errorf("is not an extended public key: %v", err)
+	}
+	if key.IsPrivate() {
+		return errors.New("is an extended private key, only the public key (xpub) is needed")
+	}
+	return nil
+}
 
-				allAccounts = append(allAccounts, Account{PrivateKey: privateKey, PublicKey: publicKey, Address: address, Tokens: make([]Token, 0), TotalAssetTransfer: big.NewInt(0), Balance: big.NewInt(0), Available: big.NewInt(0)})
-			}
+//ValidateExtendedKey explains what is wrong with an xprv or xpub without ever including it in the error, private tells
+//which one it is
+func ValidateExtendedKey(extended string) (private bool, err error) {
+	key, err := hdkeychain.NewKeyFromString(extended)
+	if err != nil {
+		return false, errors.New("is not a BIP-32 extended key (xprv or xpub)")
+	}
+	if key.Depth() != 3 {
+		return key.IsPrivate(), fmt.Errorf("is a key of depth %d, expected the account level key of m/44'/60'/account' (depth 3)", key.Depth())
+	}
+	return key.IsPrivate(), nil
+}
+
+//DeriveReceivingAddress derives the address at {xpub}/0/index, the receiving addresses wallets show for the account
+func DeriveReceivingAddress(xpub string, index uint32) (common.Address, error) {
+	key, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil {
+		return common.Address{}, err
+	}
+	for _, n := range []uint32{0, index} {
+		key, err = key.Child(n)
+		if err != nil {
+			return common.Address{}, err
 		}
 	}
+	publicKey, err := key.ECPubKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return deriveAddress(publicKey.ToECDSA())
+}
 
-	return allAccounts, nil
+//FromPrivateKey is the account of a single private key hex, with or without 0x prefix
+func FromPrivateKey(pkString string) (Account, error) {
+	account, err := accountFromPrivateKey(pkString)
+	if err != nil {
+		return Account{}, err
+	}
+	return *account, nil
 }
 
 func accountFromPrivateKey(pkString string) (*Account, error) {
 	pkString = strings.Replace(pkString, "0x", "", 1)
+	Redaction.Secret(pkString)
 	privateKey, err := crypto.HexToECDSA(pkString)
 	if err != nil {
 		return nil, err
 	}
+	Redaction.Key(privateKey)
 	publicKey, err := derivePublicKey(privateKey)
 	if err != nil {
 		return nil, err
@@ -160,14 +590,24 @@ func accountFromPrivateKey(pkString string) (*Account, error) {
 	return &Account{PrivateKey: privateKey, PublicKey: publicKey, Address: address, Tokens: make([]Token, 0), TotalAssetTransfer: big.NewInt(0), Balance: big.NewInt(0), Available: big.NewInt(0)}, nil
 }
 
+//the key of a brain wallet is the keccak256 hash of its passphrase, as wallets of 2015 and 2016 made them.  Anyone can
+//hash a guess, so bots hold the keys of every passphrase in a leaked or common list and sweep whatever arrives
+func accountFromBrainWallet(passphrase string) (*Account, error) {
+	Redaction.Secret(passphrase)
+	return accountFromPrivateKey(hex.EncodeToString(crypto.Keccak256([]byte(passphrase))))
+}
+
 // DerivePrivateKey derives the private key of the derivation path.
+//every key along the path is registered with the redaction, %v of an ExtendedKey prints its key bytes
 func derivePrivateKey(key *hdkeychain.ExtendedKey, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
 	var err error
+	Redaction.ExtendedKey(key)
 	for _, n := range path {
 		key, err = key.Child(n)
 		if err != nil {
 			return nil, err
 		}
+		Redaction.ExtendedKey(key)
 	}
 
 	privateKey, err := key.ECPrivKey()
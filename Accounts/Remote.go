@@ -0,0 +1,294 @@
+package Accounts
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//the sign-server's requests and answers, transactions travel as their binary encoding in hex
+type listedAccount struct {
+	Address string `json:"address"`
+	Path    string `json:"path,omitempty"`
+}
+
+type signRequest struct {
+	From    string `json:"from"`
+	ChainID string `json:"chain_id,omitempty"` //empty signs without replay protection
+	Tx      string `json:"tx"`                 //the unsigned transaction
+}
+
+type signResponse struct {
+	Raw   string `json:"raw,omitempty"` //the signed transaction
+	Error string `json:"error,omitempty"`
+}
+
+//RemoteSigner signs the transactions of accounts whose keys are kept by a sign-server, so the accounts can be scanned
+//and the migration planned on a machine that never holds the keys
+type RemoteSigner struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewRemoteSigner(url string, token string) *RemoteSigner {
+	return &RemoteSigner{url: strings.TrimSuffix(url, "/"), token: token, client: &http.Client{Timeout: 2 * time.Minute}}
+}
+
+//Accounts lists the accounts the sign-server holds keys for, without their keys
+func (self *RemoteSigner) Accounts() ([]Account, error) {
+	var listed []listedAccount
+	if err := self.call(http.MethodGet, "/accounts", nil, &listed); err != nil {
+		return nil, err
+	}
+	accounts := make([]Account, 0, len(listed))
+	for _, entry := range listed {
+		if !common.IsHexAddress(entry.Address) {
+			return nil, fmt.Errorf("the sign-server listed %q, which isn't an address", entry.Address)
+		}
+		accounts = append(accounts, Account{Address: common.HexToAddress(entry.Address), Path: entry.Path, Remote: self, Tokens: make([]Token, 0), TotalAssetTransfer: big.NewInt(0), Balance: big.NewInt(0), Available: big.NewInt(0)})
+	}
+	return accounts, nil
+}
+
+//SignTx has the sign-server sign tx for from, the answer is only accepted when it is tx signed by from
+func (self *RemoteSigner) SignTx(from common.Address, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	unsigned, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	request := signRequest{From: from.Hex(), Tx: "0x" + hex.EncodeToString(unsigned)}
+	if chainID != nil {
+		request.ChainID = chainID.String()
+	}
+	var response signResponse
+	if err := self.call(http.MethodPost, "/sign", request, &response); err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimPrefix(response.Raw, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("the sign-server answered with an invalid transaction: %v", err)
+	}
+	signedTx := new(types.Transaction)
+	if err := signedTx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("the sign-server answered with an invalid transaction: %v", err)
+	}
+	if err := checkSigned(tx, signedTx, from, chainID); err != nil {
+		return nil, fmt.Errorf("the sign-server answered with another transaction: %v", err)
+	}
+	return signedTx, nil
+}
+
+func (self *RemoteSigner) call(method string, path string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	request, err := http.NewRequest(method, self.url+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+self.token)
+	request.Header.Set("Content-Type", "application/json")
+	response, err := self.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("sign-server: %v", err)
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("sign-server: %v", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		var failure signResponse
+		if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("sign-server: %s", failure.Error)
+		}
+		return fmt.Errorf("sign-server: %s", response.Status)
+	}
+	return json.Unmarshal(data, result)
+}
+
+//a signed transaction must be the prepared one (its hash without the signature matches) and signed by from
+func checkSigned(tx *types.Transaction, signedTx *types.Transaction, from common.Address, chainID *big.Int) error {
+	var signer types.Signer = types.HomesteadSigner{}
+	if chainID != nil {
+		signer = types.LatestSignerForChainID(chainID)
+	}
+	if signer.Hash(tx) != signer.Hash(signedTx) {
+		return fmt.Errorf("%s isn't the transaction that was prepared", signedTx.Hash().Hex())
+	}
+	sender, err := types.Sender(signer, signedTx)
+	if err != nil {
+		return err
+	}
+	if sender != from {
+		return fmt.Errorf("%s is signed by %s, not %s", signedTx.Hash().Hex(), sender.Hex(), from.Hex())
+	}
+	return nil
+}
+
+//SignPolicy is what a sign-server agrees to sign, so whoever gets hold of the token can only move the funds where the
+//migration would have
+type SignPolicy struct {
+	Recipients map[common.Address]bool //the destinations, the accounts signed for are added by SignHandler
+	Homestead  bool                    //a configured chain takes transactions without a chain id
+}
+
+//the token and collectible transfers the migration signs (RPC's TransferData), by selector, and which of the 32 byte
+//arguments is the recipient
+var transferRecipients = map[string]int{
+	"transfer(address,uint256)":                 0,
+	"send(address,uint256,bytes)":               0,
+	"transferPunk(address,uint256)":             0,
+	"transferFrom(address,address,uint256)":     1,
+	"safeTransferFrom(address,address,uint256)": 1,
+}
+
+var recipientArguments = make(map[[4]byte]int)
+
+func init() {
+	for signature, argument := range transferRecipients {
+		var selector [4]byte
+		copy(selector[:], crypto.Keccak256([]byte(signature)))
+		recipientArguments[selector] = argument
+	}
+}
+
+//a transaction is signed when it sends to a recipient (a destination, or one of the accounts for gas and cancellations)
+//or is a transfer of a token or collectible to one, whatever contract it calls
+func (self SignPolicy) allows(tx *types.Transaction) error {
+	if tx.To() == nil {
+		return errors.New("contract creations are never signed")
+	}
+	if self.Recipients[*tx.To()] {
+		return nil
+	}
+	data := tx.Data()
+	if len(data) >= 4 {
+		var selector [4]byte
+		copy(selector[:], data)
+		if argument, found := recipientArguments[selector]; found && len(data) >= 4+32*(argument+1) {
+			word := data[4+32*argument : 4+32*(argument+1)]
+			recipient := common.BytesToAddress(word)
+			if common.BytesToHash(word) == common.BytesToHash(recipient.Bytes()) && self.Recipients[recipient] {
+				return nil
+			}
+			return fmt.Errorf("the transfer to %s on %s isn't to a destination", recipient.Hex(), tx.To().Hex())
+		}
+	}
+	return fmt.Errorf("%s isn't a destination", tx.To().Hex())
+}
+
+//SignHandler serves the keys of accounts to RemoteSigners: GET /accounts lists the addresses and POST /sign signs a
+//prepared transaction for one of them when policy allows it.  Every request must carry token as its bearer token,
+//signed is told of each transaction before it is returned
+func SignHandler(accounts []Account, token string, policy SignPolicy, signed func(from common.Address, tx *types.Transaction)) http.Handler {
+	keys := make(map[common.Address]Account, len(accounts))
+	listed := make([]listedAccount, 0, len(accounts))
+	recipients := make(map[common.Address]bool, len(policy.Recipients)+len(accounts))
+	for recipient := range policy.Recipients {
+		recipients[recipient] = true
+	}
+	for _, account := range accounts {
+		if account.PrivateKey == nil {
+			continue
+		}
+		keys[account.Address] = account
+		recipients[account.Address] = true
+		listed = append(listed, listedAccount{Address: account.Address.Hex(), Path: account.Path})
+	}
+	policy.Recipients = recipients
+	mux := http.NewServeMux()
+	mux.HandleFunc("/accounts", func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet {
+			answer(writer, http.StatusMethodNotAllowed, signResponse{Error: "GET only"})
+			return
+		}
+		answer(writer, http.StatusOK, listed)
+	})
+	mux.HandleFunc("/sign", func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			answer(writer, http.StatusMethodNotAllowed, signResponse{Error: "POST only"})
+			return
+		}
+		var body signRequest
+		if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, 1<<20)).Decode(&body); err != nil {
+			answer(writer, http.StatusBadRequest, signResponse{Error: err.Error()})
+			return
+		}
+		account, found := keys[common.HexToAddress(body.From)]
+		if !common.IsHexAddress(body.From) || !found {
+			answer(writer, http.StatusNotFound, signResponse{Error: fmt.Sprintf("no key for %s", body.From)})
+			return
+		}
+		var chainID *big.Int
+		if body.ChainID != "" {
+			var ok bool
+			if chainID, ok = new(big.Int).SetString(body.ChainID, 10); !ok {
+				answer(writer, http.StatusBadRequest, signResponse{Error: fmt.Sprintf("chain id %q isn't a number", body.ChainID)})
+				return
+			}
+		} else if !policy.Homestead {
+			answer(writer, http.StatusForbidden, signResponse{Error: "no chain id was given, only a chain set to homestead is signed for without replay protection"})
+			return
+		}
+		raw, err := hex.DecodeString(strings.TrimPrefix(body.Tx, "0x"))
+		if err != nil {
+			answer(writer, http.StatusBadRequest, signResponse{Error: err.Error()})
+			return
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(raw); err != nil {
+			answer(writer, http.StatusBadRequest, signResponse{Error: err.Error()})
+			return
+		}
+		if chainID != nil && tx.Type() != types.LegacyTxType && tx.ChainId().Cmp(chainID) != 0 {
+			answer(writer, http.StatusBadRequest, signResponse{Error: fmt.Sprintf("the transaction is for chain %s, not %s", tx.ChainId(), chainID)})
+			return
+		}
+		if err := policy.allows(tx); err != nil {
+			answer(writer, http.StatusForbidden, signResponse{Error: err.Error()})
+			return
+		}
+		signedTx, err := account.Sign(tx, chainID)
+		if err != nil {
+			answer(writer, http.StatusInternalServerError, signResponse{Error: err.Error()})
+			return
+		}
+		signedRaw, err := signedTx.MarshalBinary()
+		if err != nil {
+			answer(writer, http.StatusInternalServerError, signResponse{Error: err.Error()})
+			return
+		}
+		signed(account.Address, signedTx)
+		answer(writer, http.StatusOK, signResponse{Raw: "0x" + hex.EncodeToString(signedRaw)})
+	})
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(request.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			answer(writer, http.StatusUnauthorized, signResponse{Error: "unauthorized"})
+			return
+		}
+		mux.ServeHTTP(writer, request)
+	})
+}
+
+func answer(writer http.ResponseWriter, status int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(body)
+}
@@ -0,0 +1,361 @@
+package Accounts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"strings"
+	"walletMigrate/Redaction"
+)
+
+//SLIP-39 splits a master secret into shares (https://github.com/satoshilabs/slips/blob/master/slip-0039.md), Trezor
+//Model T and later back up their wallets as these.  Each share is a phrase of 20 or 33 words from its own list of 1024,
+//enough of the shares of enough groups give back the encrypted master secret, the passphrase decrypts it and the result
+//is the BIP-32 seed
+
+const (
+	slip39RadixBits      = 10 //each word is 10 bits
+	slip39ChecksumWords  = 3
+	slip39MinWords       = 20 //a 128 bit secret
+	slip39SecretIndex    = 255
+	slip39DigestIndex    = 254
+	slip39DigestLength   = 4
+	slip39BaseIterations = 10000
+	slip39Rounds         = 4
+)
+
+var slip39Words = strings.Fields(`
+academic acid acne acquire acrobat activity actress adapt adequate adjust admit adorn adult advance advocate
+afraid again agency agree aide aircraft airline airport ajar alarm album alcohol alien alive alpha already
+alto aluminum always amazing ambition amount amuse analysis anatomy ancestor ancient angel angry animal answer
+antenna anxiety apart aquatic arcade arena argue armed artist artwork aspect auction august aunt average
+aviation avoid award away axis axle beam beard beaver become bedroom behavior being believe belong benefit
+best beyond bike biology birthday bishop black blanket blessing blimp blind blue body bolt boring born both
+boundary bracelet branch brave breathe briefing broken brother browser bucket budget building bulb bulge bumpy
+bundle burden burning busy buyer cage calcium camera campus canyon capacity capital capture carbon cards
+careful cargo carpet carve category cause ceiling center ceramic champion change charity check chemical chest
+chew chubby cinema civil class clay cleanup client climate clinic clock clogs closet clothes club cluster coal
+coastal coding column company corner costume counter course cover cowboy cradle craft crazy credit cricket
+criminal crisis critical crowd crucial crunch crush crystal cubic cultural curious curly custody cylinder
+daisy damage dance darkness database daughter deadline deal debris debut decent decision declare decorate
+decrease deliver demand density deny depart depend depict deploy describe desert desire desktop destroy
+detailed detect device devote diagnose dictate diet dilemma diminish dining diploma disaster discuss disease
+dish dismiss display distance dive divorce document domain domestic dominant dough downtown dragon dramatic
+dream dress drift drink drove drug dryer duckling duke duration dwarf dynamic early earth easel easy echo
+eclipse ecology edge editor educate either elbow elder election elegant element elephant elevator elite else
+email emerald emission emperor emphasis employer empty ending endless endorse enemy energy enforce engage
+enjoy enlarge entrance envelope envy epidemic episode equation equip eraser erode escape estate estimate
+evaluate evening evidence evil evoke exact example exceed exchange exclude excuse execute exercise exhaust
+exotic expand expect explain express extend extra eyebrow facility fact failure faint fake false family famous
+fancy fangs fantasy fatal fatigue favorite fawn fiber fiction filter finance findings finger firefly firm
+fiscal fishing fitness flame flash flavor flea flexible flip float floral fluff focus forbid force forecast
+forget formal fortune forward founder fraction fragment frequent freshman friar fridge friendly frost froth
+frozen fumes funding furl fused galaxy game garbage garden garlic gasoline gather general genius genre genuine
+geology gesture glad glance glasses glen glimpse goat golden graduate grant grasp gravity gray greatest grief
+grill grin grocery gross group grownup grumpy guard guest guilt guitar gums hairy hamster hand hanger harvest
+have havoc hawk hazard headset health hearing heat helpful herald herd hesitate hobo holiday holy home hormone
+hospital hour huge human humidity hunting husband hush husky hybrid idea identify idle image impact imply
+improve impulse include income increase index indicate industry infant inform inherit injury inmate insect
+inside install intend intimate invasion involve iris island isolate item ivory jacket jerky jewelry join
+judicial juice jump junction junior junk jury justice kernel keyboard kidney kind kitchen knife knit laden
+ladle ladybug lair lamp language large laser laundry lawsuit leader leaf learn leaves lecture legal legend
+legs lend length level liberty library license lift likely lilac lily lips liquid listen literary living
+lizard loan lobe location losing loud loyalty luck lunar lunch lungs luxury lying lyrics machine magazine
+maiden mailman main makeup making mama manager mandate mansion manual marathon march market marvel mason
+material math maximum mayor meaning medal medical member memory mental merchant merit method metric midst mild
+military mineral minister miracle mixed mixture mobile modern modify moisture moment morning mortgage mother
+mountain mouse move much mule multiple muscle museum music mustang nail national necklace negative nervous
+network news nuclear numb numerous nylon oasis obesity object observe obtain ocean often olympic omit oral
+orange orbit order ordinary organize ounce oven overall owner paces pacific package paid painting pajamas
+pancake pants papa paper parcel parking party patent patrol payment payroll peaceful peanut peasant pecan
+penalty pencil percent perfect permit petition phantom pharmacy photo phrase physics pickup picture piece pile
+pink pipeline pistol pitch plains plan plastic platform playoff pleasure plot plunge practice prayer preach
+predator pregnant premium prepare presence prevent priest primary priority prisoner privacy prize problem
+process profile program promise prospect provide prune public pulse pumps punish puny pupal purchase purple
+python quantity quarter quick quiet race racism radar railroad rainbow raisin random ranked rapids raspy
+reaction realize rebound rebuild recall receiver recover regret regular reject relate remember remind remove
+render repair repeat replace require rescue research resident response result retailer retreat reunion revenue
+review reward rhyme rhythm rich rival river robin rocky romantic romp roster round royal ruin ruler rumor sack
+safari salary salon salt satisfy satoshi saver says scandal scared scatter scene scholar science scout
+scramble screw script scroll seafood season secret security segment senior shadow shaft shame shaped sharp
+shelter sheriff short should shrimp sidewalk silent silver similar simple single sister skin skunk slap
+slavery sled slice slim slow slush smart smear smell smirk smith smoking smug snake snapshot sniff society
+software soldier solution soul source space spark speak species spelling spend spew spider spill spine spirit
+spit spray sprinkle square squeeze stadium staff standard starting station stay steady step stick stilt story
+strategy strike style subject submit sugar suitable sunlight superior surface surprise survive sweater
+swimming swing switch symbolic sympathy syndrome system tackle tactics tadpole talent task taste taught taxi
+teacher teammate teaspoon temple tenant tendency tension terminal testify texture thank that theater theory
+therapy thorn threaten thumb thunder ticket tidy timber timely ting tofu together tolerate total toxic tracks
+traffic training transfer trash traveler treat trend trial tricycle trip triumph trouble true trust twice twin
+type typical ugly ultimate umbrella uncover undergo unfair unfold unhappy union universe unkind unknown
+unusual unwrap upgrade upstairs username usher usual valid valuable vampire vanish various vegan velvet
+venture verdict verify very veteran vexed victim video view vintage violence viral visitor visual vitamins
+vocal voice volume voter voting walnut warmth warn watch wavy wealthy weapon webcam welcome welfare western
+width wildlife window wine wireless wisdom withdraw wits wolf woman work worthy wrap wrist writing wrote year
+yelp yield yoga zero`)
+
+var slip39Index = func() map[string]int {
+	index := make(map[string]int, len(slip39Words))
+	for i, word := range slip39Words {
+		index[word] = i
+	}
+	return index
+}()
+
+//GF(256) with the AES polynomial x^8 + x^4 + x^3 + x + 1, the shares are points of polynomials over it
+var slip39Exp, slip39Log = func() ([255]byte, [256]int) {
+	var exp [255]byte
+	var log [256]int
+	poly := 1
+	for i := 0; i < 255; i++ {
+		exp[i], log[poly] = byte(poly), i
+		poly = (poly << 1) ^ poly
+		if poly&0x100 != 0 {
+			poly ^= 0x11b
+		}
+	}
+	return exp, log
+}()
+
+//a decoded share, the words of the mnemonic are never kept
+type slip39Share struct {
+	identifier      int
+	extendable      bool
+	exponent        int
+	groupIndex      int
+	groupThreshold  int
+	groupCount      int
+	memberIndex     int
+	memberThreshold int
+	value           []byte
+}
+
+//the RS1024 checksum of the words after the customization string that ties it to the kind of share, 1 when valid
+func slip39Polymod(values []int) int {
+	generator := [10]int{0xe0e040, 0x1c1c080, 0x3838100, 0x7070200, 0xe0e0009, 0x1c0c2412, 0x38086c24, 0x3090fc48, 0x21b1f890, 0x3f3f120}
+	checksum := 1
+	for _, value := range values {
+		top := checksum >> 20
+		checksum = (checksum&0xfffff)<<10 ^ value
+		for i := 0; i < 10; i++ {
+			if (top>>i)&1 != 0 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+func slip39Customization(extendable bool) []int {
+	customization := "shamir"
+	if extendable {
+		customization = "shamir_extendable"
+	}
+	values := make([]int, 0, len(customization))
+	for _, c := range customization {
+		values = append(values, int(c))
+	}
+	return values
+}
+
+//decode a share mnemonic, position is its place in the list for errors since the words are never shown
+func decodeSLIP39Share(position int, mnemonic string) (slip39Share, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if len(words) < slip39MinWords {
+		return slip39Share{}, fmt.Errorf("share %d has %d words, expected at least %d", position, len(words), slip39MinWords)
+	}
+	indexes := make([]int, len(words))
+	for i, word := range words {
+		index, ok := slip39Index[word]
+		if !ok {
+			return slip39Share{}, fmt.Errorf("share %d word %d is not in the SLIP-39 word list", position, i+1)
+		}
+		indexes[i] = index
+	}
+	share := slip39Share{
+		identifier: indexes[0]<<5 | indexes[1]>>5,
+		extendable: indexes[1]>>4&1 == 1,
+		exponent:   indexes[1] & 0xf,
+	}
+	if slip39Polymod(append(slip39Customization(share.extendable), indexes...)) != 1 {
+		return slip39Share{}, fmt.Errorf("share %d checksum is invalid, check the order and spelling of its words", position)
+	}
+	share.groupIndex = indexes[2] >> 6
+	share.groupThreshold = indexes[2]>>2&0xf + 1
+	share.groupCount = (indexes[2]&3)<<2 | indexes[3]>>8 + 1
+	share.memberIndex = indexes[3] >> 4 & 0xf
+	share.memberThreshold = indexes[3]&0xf + 1
+	if share.groupThreshold > share.groupCount {
+		return slip39Share{}, fmt.Errorf("share %d needs %d groups of only %d", position, share.groupThreshold, share.groupCount)
+	}
+
+	//the value words hold the share's bytes after up to 8 bits of zero padding
+	valueWords := indexes[4 : len(indexes)-slip39ChecksumWords]
+	bits := len(valueWords) * slip39RadixBits
+	padding := bits % 16
+	if padding > 8 {
+		return slip39Share{}, fmt.Errorf("share %d has %d words, which is not a valid length", position, len(words))
+	}
+	var accumulator, held uint
+	value := make([]byte, 0, bits/8)
+	skip := padding
+	for _, index := range valueWords {
+		accumulator, held = accumulator<<slip39RadixBits|uint(index), held+slip39RadixBits
+		if skip > 0 {
+			if accumulator>>(held-uint(skip)) != 0 {
+				return slip39Share{}, fmt.Errorf("share %d has a non-zero padding", position)
+			}
+			held -= uint(skip)
+			accumulator &= 1<<held - 1
+			skip = 0
+		}
+		for held >= 8 {
+			held -= 8
+			value = append(value, byte(accumulator>>held))
+			accumulator &= 1<<held - 1
+		}
+	}
+	share.value = value
+	return share, nil
+}
+
+//the value of the polynomial through the points at x
+func slip39Interpolate(xs []int, values [][]byte, x int) []byte {
+	for i, at := range xs {
+		if at == x {
+			return values[i]
+		}
+	}
+	logProduct := 0
+	for _, at := range xs {
+		logProduct += slip39Log[at^x]
+	}
+	result := make([]byte, len(values[0]))
+	for i, at := range xs {
+		logBasis := logProduct - slip39Log[at^x]
+		for _, other := range xs {
+			logBasis -= slip39Log[at^other]
+		}
+		logBasis = ((logBasis % 255) + 255) % 255
+		for j, b := range values[i] {
+			if b != 0 {
+				result[j] ^= slip39Exp[(slip39Log[b]+logBasis)%255]
+			}
+		}
+	}
+	return result
+}
+
+//the secret the threshold of points hide, checked against the digest share
+func slip39Recover(threshold int, xs []int, values [][]byte) ([]byte, error) {
+	if threshold == 1 {
+		return values[0], nil
+	}
+	secret := slip39Interpolate(xs, values, slip39SecretIndex)
+	digestShare := slip39Interpolate(xs, values, slip39DigestIndex)
+	mac := hmac.New(sha256.New, digestShare[slip39DigestLength:])
+	mac.Write(secret)
+	if !bytes.Equal(mac.Sum(nil)[:slip39DigestLength], digestShare[:slip39DigestLength]) {
+		return nil, errors.New("the shares don't combine, one of them is of another backup or mistyped")
+	}
+	return secret, nil
+}
+
+//combine the shares into the encrypted master secret, every share has to be of the same backup and each group used
+//needs its member threshold of shares
+func combineSLIP39(mnemonics []string) (slip39Share, []byte, error) {
+	if len(mnemonics) == 0 {
+		return slip39Share{}, nil, errors.New("no shares")
+	}
+	var first slip39Share
+	groups := make(map[int][]slip39Share)
+	var order []int
+	for i, mnemonic := range mnemonics {
+		share, err := decodeSLIP39Share(i+1, mnemonic)
+		if err != nil {
+			return slip39Share{}, nil, err
+		}
+		if i == 0 {
+			first = share
+		}
+		if share.identifier != first.identifier || share.extendable != first.extendable || share.exponent != first.exponent || share.groupThreshold != first.groupThreshold || share.groupCount != first.groupCount || len(share.value) != len(first.value) {
+			return slip39Share{}, nil, fmt.Errorf("share %d is of another backup than share 1", i+1)
+		}
+		if _, ok := groups[share.groupIndex]; !ok {
+			order = append(order, share.groupIndex)
+		}
+		for _, member := range groups[share.groupIndex] {
+			if member.memberIndex == share.memberIndex {
+				return slip39Share{}, nil, fmt.Errorf("share %d is listed twice", i+1)
+			}
+			if member.memberThreshold != share.memberThreshold {
+				return slip39Share{}, nil, fmt.Errorf("share %d has another member threshold than the rest of group %d", i+1, share.groupIndex+1)
+			}
+		}
+		groups[share.groupIndex] = append(groups[share.groupIndex], share)
+	}
+
+	var groupXs []int
+	var groupValues [][]byte
+	for _, group := range order {
+		members := groups[group]
+		if len(members) < members[0].memberThreshold {
+			continue //a group short of shares can't be used, enough other groups may still be
+		}
+		var xs []int
+		var values [][]byte
+		for _, member := range members[:members[0].memberThreshold] {
+			xs, values = append(xs, member.memberIndex), append(values, member.value)
+		}
+		value, err := slip39Recover(members[0].memberThreshold, xs, values)
+		if err != nil {
+			return slip39Share{}, nil, fmt.Errorf("group %d: %v", group+1, err)
+		}
+		groupXs, groupValues = append(groupXs, group), append(groupValues, value)
+	}
+	if len(groupXs) < first.groupThreshold {
+		return slip39Share{}, nil, fmt.Errorf("%d complete groups of shares, the backup needs %d", len(groupXs), first.groupThreshold)
+	}
+	encrypted, err := slip39Recover(first.groupThreshold, groupXs[:first.groupThreshold], groupValues[:first.groupThreshold])
+	return first, encrypted, err
+}
+
+//decrypt the master secret with the passphrase, a 4 round Feistel network of PBKDF2-HMAC-SHA256
+func decryptSLIP39(share slip39Share, encrypted []byte, passphrase string) []byte {
+	half := len(encrypted) / 2
+	left, right := append([]byte(nil), encrypted[:half]...), append([]byte(nil), encrypted[half:]...)
+	var salt []byte
+	if !share.extendable {
+		salt = []byte{'s', 'h', 'a', 'm', 'i', 'r', byte(share.identifier >> 8), byte(share.identifier)}
+	}
+	iterations := (slip39BaseIterations << share.exponent) / slip39Rounds
+	for round := slip39Rounds - 1; round >= 0; round-- {
+		key := pbkdf2.Key(append([]byte{byte(round)}, passphrase...), append(append([]byte(nil), salt...), right...), iterations, len(right), sha256.New)
+		for i := range key {
+			key[i] ^= left[i]
+		}
+		left, right = right, key
+	}
+	return append(right, left...)
+}
+
+//SLIP39Secret combines SLIP-39 shares and decrypts them with the passphrase ("" when none was set) into the master
+//secret, which is the wallet's BIP-32 seed
+func SLIP39Secret(shares []string, passphrase string) ([]byte, error) {
+	Redaction.Secret(shares...)
+	share, encrypted, err := combineSLIP39(shares)
+	if err != nil {
+		return nil, err
+	}
+	return decryptSLIP39(share, encrypted, passphrase), nil
+}
+
+//ValidateSLIP39 explains what is wrong with a set of SLIP-39 shares without ever including their words in the error,
+//whether the passphrase is right can't be told from the shares
+func ValidateSLIP39(shares []string) error {
+	_, _, err := combineSLIP39(shares)
+	return err
+}
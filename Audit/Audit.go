@@ -0,0 +1,244 @@
+package Audit
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"os"
+	"time"
+	"walletMigrate/Encryption"
+)
+
+//Entry is a single line of the audit log, Hash covers every other field plus the hash of the previous entry
+//so any edit, insertion or removal breaks the chain from that point on.  Fields added later are omitted when empty so
+//the entries written before them keep their hashes
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Event       string    `json:"event"`
+	From        string    `json:"from,omitempty"`
+	Nonce       uint64    `json:"nonce"`
+	TxHash      string    `json:"tx_hash,omitempty"`
+	RawTx       string    `json:"raw_tx,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	GasUsed     uint64    `json:"gas_used,omitempty"`
+	BlockNumber string    `json:"block_number,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Phase       string    `json:"phase,omitempty"`     //gas, token, balance or clear, for planned and repriced transactions
+	Replaces    string    `json:"replaces,omitempty"`  //the transaction a replacement was sent to take the nonce of, or a repriced one was planned as
+	PlanHash    string    `json:"plan_hash,omitempty"` //the plan file written or executed
+	PrevHash    string    `json:"prev_hash"`
+	Hash        string    `json:"hash"`
+}
+
+//Log is an append only file of hash chained entries, a nil Log records nothing
+type Log struct {
+	path string
+	last string
+}
+
+//Open the audit log at path (creating it if necessary) and continue the chain from its last entry
+func Open(path string) (*Log, error) {
+	if path == "" {
+		return nil, nil
+	}
+	last, err := Verify(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &Log{path: path, last: last}, nil
+}
+
+//Verify walks the chain in the audit log at path and returns the hash of the last entry,
+//an error is returned for the first entry that does not match its hash or the previous entry
+func Verify(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	last := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024) //raw transactions with large calldata can make long lines
+	for line := 1; scanner.Scan(); line++ {
+		data, err := Encryption.DecryptLine(scanner.Bytes())
+		if err != nil {
+			return "", fmt.Errorf("audit log line %d: %v", line, err)
+		}
+		var entry Entry
+		err = json.Unmarshal(data, &entry)
+		if err != nil {
+			return "", fmt.Errorf("audit log line %d: %v", line, err)
+		}
+		if entry.PrevHash != last {
+			return "", fmt.Errorf("audit log line %d: previous hash %s does not match %s", line, entry.PrevHash, last)
+		}
+		hash, err := entry.hash()
+		if err != nil {
+			return "", err
+		}
+		if hash != entry.Hash {
+			return "", fmt.Errorf("audit log line %d: entry has been modified", line)
+		}
+		last = entry.Hash
+	}
+	return last, scanner.Err()
+}
+
+//Last returns the hash of the last entry, kept somewhere else it proves later that no entry was cut off the end
+func (self *Log) Last() string {
+	if self == nil {
+		return ""
+	}
+	return self.last
+}
+
+func (self Entry) hash() (string, error) {
+	self.Hash = ""
+	data, err := json.Marshal(self)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(crypto.Keccak256(data)), nil
+}
+
+//Planned records a signed transaction the run decided on, before it is broadcast (or only printed when simulating)
+func (self *Log) Planned(phase string, from common.Address, transaction *types.Transaction) error {
+	if self == nil {
+		return nil
+	}
+	raw, err := transaction.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return self.append(Entry{Event: "planned", Phase: phase, From: from.Hex(), Nonce: transaction.Nonce(), TxHash: transaction.Hash().Hex(), RawTx: "0x" + hex.EncodeToString(raw)})
+}
+
+//Replacement records that the transaction is sent to take the nonce of the original one, still pending
+func (self *Log) Replacement(from common.Address, transaction *types.Transaction, original common.Hash) error {
+	if self == nil {
+		return nil
+	}
+	return self.append(Entry{Event: "replacement", From: from.Hex(), Nonce: transaction.Nonce(), TxHash: transaction.Hash().Hex(), Replaces: original.Hex()})
+}
+
+//Repriced records that the planned transaction was signed again at the price of the moment it was broadcast, with
+//the same nonce, recipient and calldata
+func (self *Log) Repriced(phase string, from common.Address, transaction *types.Transaction, planned common.Hash) error {
+	if self == nil {
+		return nil
+	}
+	raw, err := transaction.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return self.append(Entry{Event: "repriced", Phase: phase, From: from.Hex(), Nonce: transaction.Nonce(), TxHash: transaction.Hash().Hex(), RawTx: "0x" + hex.EncodeToString(raw), Replaces: planned.Hex()})
+}
+
+//PlanWritten records the hash of a plan file a simulated run wrote for the execute command
+func (self *Log) PlanWritten(hash string) error {
+	if self == nil {
+		return nil
+	}
+	return self.append(Entry{Event: "plan written", PlanHash: hash})
+}
+
+//PlanExecuted records the hash of the plan file the execute command is about to broadcast
+func (self *Log) PlanExecuted(hash string) error {
+	if self == nil {
+		return nil
+	}
+	return self.append(Entry{Event: "plan executed", PlanHash: hash})
+}
+
+//Broadcast records a signed transaction and the result of sending it
+func (self *Log) Broadcast(from common.Address, transaction *types.Transaction, sendErr error) error {
+	if self == nil {
+		return nil
+	}
+	raw, err := transaction.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	entry := Entry{Event: "broadcast", From: from.Hex(), Nonce: transaction.Nonce(), TxHash: transaction.Hash().Hex(), RawTx: "0x" + hex.EncodeToString(raw)}
+	if sendErr != nil {
+		entry.Event = "broadcast failed"
+		entry.Error = sendErr.Error()
+	}
+	return self.append(entry)
+}
+
+//Signed records a transaction the sign-server signed for a run planning elsewhere, which broadcasts it itself
+func (self *Log) Signed(from common.Address, transaction *types.Transaction) error {
+	if self == nil {
+		return nil
+	}
+	raw, err := transaction.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return self.append(Entry{Event: "signed", From: from.Hex(), Nonce: transaction.Nonce(), TxHash: transaction.Hash().Hex(), RawTx: "0x" + hex.EncodeToString(raw)})
+}
+
+//Receipt records the final receipt of a broadcast transaction, a nil receipt records that it was never mined
+func (self *Log) Receipt(from common.Address, transaction *types.Transaction, receipt *types.Receipt) error {
+	if self == nil {
+		return nil
+	}
+	entry := Entry{Event: "receipt", From: from.Hex(), Nonce: transaction.Nonce(), TxHash: transaction.Hash().Hex(), Status: "not mined"}
+	if receipt != nil {
+		entry.Status = "success"
+		if receipt.Status == types.ReceiptStatusFailed {
+			entry.Status = "reverted"
+		}
+		entry.GasUsed = receipt.GasUsed
+		if receipt.BlockNumber != nil {
+			entry.BlockNumber = receipt.BlockNumber.String()
+		}
+	}
+	return self.append(entry)
+}
+
+func (self *Log) append(entry Entry) error {
+	if self == nil {
+		return errors.New("audit log is not open")
+	}
+	entry.Time = time.Now().UTC()
+	entry.PrevHash = self.last
+	hash, err := entry.hash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	//each entry is encrypted on its own line so the file is still appended to, the hash covers the plain entry
+	data, err = Encryption.EncryptLine(data)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(self.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	//make sure the entry is on disk before the next broadcast happens
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+	self.last = hash
+	return nil
+}
@@ -0,0 +1,152 @@
+package Encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+//Tools encrypt with an external program, age (https://age-encryption.org) or gpg
+var Tools = []string{"age", "gpg"}
+
+//the armor every encrypted file starts with, files without it are read as they are
+var armors = map[string]string{
+	"age": "-----BEGIN AGE ENCRYPTED FILE-----",
+	"gpg": "-----BEGIN PGP MESSAGE-----",
+}
+
+//the prefix of a line EncryptLine encrypted, followed by the tool's binary output in base64
+var linePrefixes = map[string]string{
+	"age": "age-encrypted:",
+	"gpg": "gpg-encrypted:",
+}
+
+var (
+	tool       string
+	recipients []string
+	identity   string
+)
+
+//Configure encrypts every file written through WriteFile to the recipients with tool.  identity is the age identity
+//file that decrypts them, gpg finds its secret key in the keyring.  No recipients turns encryption off
+func Configure(encryptWith string, to []string, identityFile string) {
+	tool, recipients, identity = encryptWith, to, identityFile
+	if tool == "" {
+		tool = "age"
+	}
+}
+
+//Enabled reports whether files are written encrypted
+func Enabled() bool {
+	return len(recipients) > 0
+}
+
+//WriteFile writes data to path, encrypted to the configured recipients when encryption is on.  Files are written
+//armored so ReadFile can tell them apart from plain ones
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	if !Enabled() {
+		return ioutil.WriteFile(path, data, perm)
+	}
+	encrypted, err := encrypt(data, true)
+	if err != nil {
+		return fmt.Errorf("can't encrypt %s: %v", path, err)
+	}
+	return ioutil.WriteFile(path, encrypted, perm)
+}
+
+//EncryptLine encrypts a line of a file that is appended to, like the audit log, to the configured recipients and
+//returns it as a single line.  It is returned as it is when encryption is off
+func EncryptLine(line []byte) ([]byte, error) {
+	if !Enabled() {
+		return line, nil
+	}
+	encrypted, err := encrypt(line, false)
+	if err != nil {
+		return nil, fmt.Errorf("can't encrypt a line: %v", err)
+	}
+	return []byte(linePrefixes[tool] + base64.StdEncoding.EncodeToString(encrypted)), nil
+}
+
+//DecryptLine decrypts a line EncryptLine wrote, by age or gpg whichever made it, plain lines are returned as they are
+func DecryptLine(line []byte) ([]byte, error) {
+	for program, prefix := range linePrefixes {
+		if !bytes.HasPrefix(line, []byte(prefix)) {
+			continue
+		}
+		encrypted, err := base64.StdEncoding.DecodeString(string(line[len(prefix):]))
+		if err != nil {
+			return nil, fmt.Errorf("can't decode an encrypted line: %v", err)
+		}
+		args := []string{"--batch", "--quiet", "--decrypt"}
+		if program == "age" {
+			if identity == "" {
+				return nil, errors.New("the line is encrypted with age, set encryption.identity to the identity file that decrypts it")
+			}
+			args = []string{"--decrypt", "--identity", identity}
+		}
+		decrypted, err := run(program, args, encrypted)
+		if err != nil {
+			return nil, fmt.Errorf("can't decrypt a line: %v", err)
+		}
+		return decrypted, nil
+	}
+	return line, nil
+}
+
+//encrypt data to the recipients with the configured tool, armored or in the tool's binary format
+func encrypt(data []byte, armor bool) ([]byte, error) {
+	var args []string
+	if tool == "gpg" {
+		args = []string{"--batch", "--yes", "--trust-model", "always", "--encrypt"}
+	}
+	if armor {
+		args = append(args, "--armor")
+	}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	return run(tool, args, data)
+}
+
+//ReadFile reads path and decrypts it when it was written encrypted, by age or gpg whichever made it
+func ReadFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte(armors["age"])):
+		if identity == "" {
+			return nil, fmt.Errorf("%s is encrypted with age, set encryption.identity to the identity file that decrypts it", path)
+		}
+		data, err = run("age", []string{"--decrypt", "--identity", identity}, data)
+	case bytes.HasPrefix(trimmed, []byte(armors["gpg"])):
+		data, err = run("gpg", []string{"--batch", "--quiet", "--decrypt"}, data)
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt %s: %v", path, err)
+	}
+	return data, nil
+}
+
+//run the program with input on stdin, its stderr becomes the error when it fails
+func run(program string, args []string, input []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.Command(program, args...)
+	command.Stdin, command.Stdout, command.Stderr = bytes.NewReader(input), &stdout, &stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, errors.New(message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,101 @@
+package Errors
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+//Category groups failures by what went wrong so callers can react to a kind of failure instead of parsing log lines
+type Category string
+
+const (
+	RPCError        Category = "rpc"              //the node failed or rejected a request
+	InsufficientGas Category = "insufficient_gas" //an account couldn't pay for a transfer, its asset was left behind
+	SignError       Category = "sign"             //a transaction couldn't be signed
+	RevertedTx      Category = "reverted"         //a transaction was mined but reverted
+	DiscoveryError  Category = "discovery"        //an account or asset couldn't be read during the scan
+	FileError       Category = "file"             //the state, audit, status or retry file couldn't be written
+)
+
+//Error is a failure with its category and the code it is logged under (M1, C5...)
+type Error struct {
+	Category Category
+	Code     string
+	Err      error
+}
+
+func (self *Error) Error() string {
+	return self.Err.Error()
+}
+
+func (self *Error) Unwrap() error {
+	return self.Err
+}
+
+//New wraps err returned to a caller with its category, the caller gives it a code when logging it.  A nil err stays nil
+func New(category Category, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Category: category, Err: err}
+}
+
+//Of returns the category of err, errors that were never categorized have none
+func Of(err error) (Category, bool) {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Category, true
+	}
+	return "", false
+}
+
+var (
+	lock     sync.Mutex
+	recorded []*Error
+)
+
+//Log prints the failure the way every error is printed (ERROR(code): context message) and records it for the final
+//report, an err that already carries a category keeps it
+func Log(category Category, code string, err error, context ...interface{}) {
+	log.Println(append(append([]interface{}{fmt.Sprintf("ERROR(%s):", code)}, context...), err)...)
+	Record(category, code, err)
+}
+
+//Record keeps a failure for the final report without printing it, for failures the run already reports its own way
+func Record(category Category, code string, err error) {
+	if known, ok := Of(err); ok {
+		category = known
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	recorded = append(recorded, &Error{Category: category, Code: code, Err: err})
+}
+
+//Recorded returns every failure logged or recorded so far in order
+func Recorded() []*Error {
+	lock.Lock()
+	defer lock.Unlock()
+	return append([]*Error{}, recorded...)
+}
+
+//Summary counts the failures recorded so far by category
+func Summary() map[Category]int {
+	counts := make(map[Category]int)
+	for _, failure := range Recorded() {
+		counts[failure.Category]++
+	}
+	return counts
+}
+
+//Categories returns the categories of the summary in a stable order for printing
+func Categories(summary map[Category]int) []Category {
+	categories := make([]Category, 0, len(summary))
+	for category := range summary {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i] < categories[j] })
+	return categories
+}
@@ -0,0 +1,273 @@
+package Plan
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+	"walletMigrate/Encryption"
+)
+
+//Version of the plan file format, a plan written in any other version is refused rather than guessed at
+const Version = 1
+
+//Plan is the migration a simulated run signed, with what it assumed about the chain when it was made.  Hash covers
+//every other field so a plan edited after it was written is refused
+type Plan struct {
+	Version      int           `json:"version"`
+	Created      time.Time     `json:"created"`
+	ChainID      string        `json:"chain_id"`
+	Block        uint64        `json:"block"`     //the head block when the balances were read
+	GasPrice     string        `json:"gas_price"` //wei, every transaction was priced from it
+	Accounts     []Assumption  `json:"accounts"`
+	Transactions []Transaction `json:"transactions"`
+	Hash         string        `json:"hash"`
+}
+
+//Assumption is the state of an account the plan was made for, the plan is stale once it changed
+type Assumption struct {
+	Address string         `json:"address"`
+	Nonce   uint64         `json:"nonce"`   //the nonce of its first planned transaction
+	Balance string         `json:"balance"` //wei
+	Tokens  []TokenBalance `json:"tokens,omitempty"`
+	Funder  bool           `json:"funder,omitempty"` //pays for gas without being swept, it only has to hold at least its balance
+}
+
+type TokenBalance struct {
+	Contract string `json:"contract"`
+	Balance  string `json:"balance"`
+}
+
+//Transaction is a signed transaction of the plan in the order it is sent, its fields are the decoded raw transaction
+//so the plan can be reviewed without decoding it
+type Transaction struct {
+	Phase     string `json:"phase"` //gas, token or balance
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Nonce     uint64 `json:"nonce"`
+	Value     string `json:"value"`
+	Gas       uint64 `json:"gas"`
+	GasFeeCap string `json:"gas_fee_cap"` //the gas price of a legacy transaction
+	GasTipCap string `json:"gas_tip_cap"`
+	Data      string `json:"data,omitempty"`
+	TxHash    string `json:"tx_hash"`
+	Raw       string `json:"raw"`
+}
+
+//Add a signed transaction to the plan
+func (self *Plan) Add(phase string, from common.Address, transaction *types.Transaction) error {
+	raw, err := transaction.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	entry := decoded(transaction)
+	entry.Phase, entry.From, entry.Raw = phase, from.Hex(), "0x"+hex.EncodeToString(raw)
+	self.Transactions = append(self.Transactions, entry)
+	return nil
+}
+
+//the fields of a plan entry that are read from the transaction itself
+func decoded(transaction *types.Transaction) Transaction {
+	entry := Transaction{Nonce: transaction.Nonce(), Value: transaction.Value().String(), Gas: transaction.Gas(), GasFeeCap: transaction.GasFeeCap().String(), GasTipCap: transaction.GasTipCap().String(), TxHash: transaction.Hash().Hex()}
+	if transaction.To() != nil {
+		entry.To = transaction.To().Hex()
+	}
+	if len(transaction.Data()) > 0 {
+		entry.Data = "0x" + hex.EncodeToString(transaction.Data())
+	}
+	return entry
+}
+
+//the first field shown for review that isn't what the raw transaction holds, empty when they all match
+func (self Transaction) mismatch(transaction *types.Transaction) string {
+	expected := decoded(transaction)
+	switch {
+	case !strings.EqualFold(self.TxHash, expected.TxHash):
+		return "tx_hash"
+	case !strings.EqualFold(self.To, expected.To):
+		return "to"
+	case self.Nonce != expected.Nonce:
+		return "nonce"
+	case self.Value != expected.Value:
+		return "value"
+	case self.Gas != expected.Gas:
+		return "gas"
+	case self.GasFeeCap != expected.GasFeeCap:
+		return "gas_fee_cap"
+	case self.GasTipCap != expected.GasTipCap:
+		return "gas_tip_cap"
+	case !strings.EqualFold(self.Data, expected.Data):
+		return "data"
+	}
+	return ""
+}
+
+//Signed decodes the raw transaction and checks it is the one described by the other fields and signed by From, so
+//what a reviewer or approver read is what gets broadcast
+func (self Transaction) Signed(chainID *big.Int) (*types.Transaction, error) {
+	raw, err := hex.DecodeString(trim0x(self.Raw))
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s: %v", self.TxHash, err)
+	}
+	transaction := new(types.Transaction)
+	if err := transaction.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("transaction %s: %v", self.TxHash, err)
+	}
+	if field := self.mismatch(transaction); field != "" {
+		return nil, fmt.Errorf("transaction %s doesn't match its raw transaction, its %s was changed", self.TxHash, field)
+	}
+	var signer types.Signer = types.HomesteadSigner{}
+	if transaction.Protected() {
+		signer = types.LatestSignerForChainID(chainID)
+	}
+	from, err := types.Sender(signer, transaction)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s: %v", self.TxHash, err)
+	}
+	if from != common.HexToAddress(self.From) {
+		return nil, fmt.Errorf("transaction %s is signed by %s, not %s", self.TxHash, from.Hex(), self.From)
+	}
+	return transaction, nil
+}
+
+func (self Plan) hash() (string, error) {
+	self.Hash = ""
+	data, err := json.Marshal(self)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(crypto.Keccak256(data)), nil
+}
+
+//Write seals the plan with its hash and writes it to path
+func Write(path string, plan *Plan) error {
+	plan.Version = Version
+	hash, err := plan.hash()
+	if err != nil {
+		return err
+	}
+	plan.Hash = hash
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return Encryption.WriteFile(path, data, 0600)
+}
+
+//Read the plan at path, a plan of another version or one that no longer matches its hash is refused
+func Read(path string) (*Plan, error) {
+	data, err := Encryption.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if plan.Version != Version {
+		return nil, fmt.Errorf("%s is a version %d plan, expected version %d", path, plan.Version, Version)
+	}
+	hash, err := plan.hash()
+	if err != nil {
+		return nil, err
+	}
+	if hash != plan.Hash {
+		return nil, fmt.Errorf("%s has been modified since it was written, its hash doesn't match", path)
+	}
+	return &plan, nil
+}
+
+func trim0x(value string) string {
+	if len(value) >= 2 && value[0] == '0' && (value[1] == 'x' || value[1] == 'X') {
+		return value[2:]
+	}
+	return value
+}
+
+//Approval is a second party's detached signature of a plan, kept next to the plan file.  Signature is an EIP-191
+//personal message signature of the plan's hash, the same a wallet makes when asked to sign the hash as text
+type Approval struct {
+	PlanHash  string `json:"plan_hash"`
+	Approver  string `json:"approver"`
+	Signature string `json:"signature"`
+}
+
+//ApprovalPath is where the approval of the plan at path is kept
+func ApprovalPath(path string) string {
+	return path + ".approval"
+}
+
+//Approve signs the hash of the plan at path (after checking it is intact) with the approval key and writes the
+//approval next to it
+func Approve(path string, key *ecdsa.PrivateKey) (*Approval, error) {
+	plan, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := crypto.Sign(accounts.TextHash([]byte(plan.Hash)), key)
+	if err != nil {
+		return nil, err
+	}
+	signature[crypto.RecoveryIDOffset] += 27 //wallets sign with v of 27 or 28
+	approval := &Approval{PlanHash: plan.Hash, Approver: crypto.PubkeyToAddress(key.PublicKey).Hex(), Signature: "0x" + hex.EncodeToString(signature)}
+	return approval, WriteApproval(path, approval)
+}
+
+//WriteApproval keeps an approval made elsewhere next to the plan at path
+func WriteApproval(path string, approval *Approval) error {
+	data, err := json.MarshalIndent(approval, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ApprovalPath(path), data, 0600)
+}
+
+//VerifyApproval checks the plan's approval was signed over its hash by one of the approvers and returns who signed it
+func VerifyApproval(path string, plan *Plan, approvers []common.Address) (common.Address, error) {
+	data, err := ioutil.ReadFile(ApprovalPath(path))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%s isn't approved: %v", path, err)
+	}
+	var approval Approval
+	if err := json.Unmarshal(data, &approval); err != nil {
+		return common.Address{}, fmt.Errorf("%s: %v", ApprovalPath(path), err)
+	}
+	signer, err := approval.Verify(plan, approvers)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%s: %v", ApprovalPath(path), err)
+	}
+	return signer, nil
+}
+
+//Verify checks the approval was signed over the plan's hash by one of the approvers and returns who signed it
+func (self Approval) Verify(plan *Plan, approvers []common.Address) (common.Address, error) {
+	if self.PlanHash != plan.Hash {
+		return common.Address{}, fmt.Errorf("the approval is of another plan (hash %s), not %s", self.PlanHash, plan.Hash)
+	}
+	signature, err := hex.DecodeString(trim0x(self.Signature))
+	if err != nil || len(signature) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("the signature isn't a 65 byte signature")
+	}
+	if signature[crypto.RecoveryIDOffset] >= 27 {
+		signature[crypto.RecoveryIDOffset] -= 27
+	}
+	key, err := crypto.SigToPub(accounts.TextHash([]byte(plan.Hash)), signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	signer := crypto.PubkeyToAddress(*key)
+	for _, approver := range approvers {
+		if signer == approver {
+			return signer, nil
+		}
+	}
+	return common.Address{}, fmt.Errorf("the approval is signed by %s, which isn't one of the approvers", signer.Hex())
+}
@@ -0,0 +1,60 @@
+package RPC
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"walletMigrate/Errors"
+)
+
+//Arbitrum charges the L1 calldata of a transaction as extra L2 gas, eth_estimateGas leaves it out on some nodes and it
+//moves with the L1 base fee, the NodeInterface precompile estimates both parts together
+var nodeInterface = common.HexToAddress("0x00000000000000000000000000000000000000C8")
+
+//Arbitrum One, Nova, Goerli and Sepolia
+var arbitrumChains = map[int64]bool{42161: true, 42170: true, 421613: true, 421614: true}
+
+func isArbitrum(chainID *big.Int) bool {
+	return chainID != nil && chainID.IsInt64() && arbitrumChains[chainID.Int64()]
+}
+
+//estimate the gas of a call, on Arbitrum including its L1 part
+func (self Client) estimateGas(chainID *big.Int, msg ethereum.CallMsg) (uint64, error) {
+	if !isArbitrum(chainID) {
+		return self.client.EstimateGas(context.Background(), msg)
+	}
+	result, err := self.client.CallContract(context.Background(), ethereum.CallMsg{From: msg.From, To: &nodeInterface, Data: pack(extensionsABI, "gasEstimateComponents", *msg.To, false, msg.Data)}, nil)
+	if err != nil {
+		self.logf(VerbosityDebug, "rpc gasEstimateComponents: %s err: %v\n", msg.To.Hex(), err)
+		return 0, err
+	}
+	values, err := extensionsABI.Unpack("gasEstimateComponents", result)
+	if err != nil {
+		return 0, err
+	}
+	self.logf(VerbosityDebug, "rpc gasEstimateComponents: %s gas: %d of which l1: %d\n", msg.To.Hex(), values[0], values[1])
+	return values[0].(uint64), nil
+}
+
+//estimates are padded because they are sometimes lower than necessary, the NodeInterface estimate is exact apart from
+//the L1 base fee moving before the transaction is mined so it needs less, as does zkSync which refunds unused gas
+func gasPadding(chainID *big.Int) float64 {
+	if isArbitrum(chainID) || isZkSync(chainID) {
+		return 1.2
+	}
+	return 1.7
+}
+
+//the gas limit of a plain ETH transfer, 21000 except where L1 calldata or published data is paid for in L2 gas
+func (self Client) ethTransferGas(chainID *big.Int, from common.Address) uint64 {
+	if !isArbitrum(chainID) && !isZkSync(chainID) {
+		return 21000
+	}
+	gas, err := self.estimateGas(chainID, ethereum.CallMsg{From: from, To: &from})
+	if err != nil {
+		Errors.Log(Errors.RPCError, "C13", err)
+		return 21000
+	}
+	return uint64(float64(gas) * gasPadding(chainID))
+}
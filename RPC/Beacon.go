@@ -0,0 +1,70 @@
+package RPC
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//beaconValidator is the part of a validator in the beacon API's validator list that is needed
+type beaconValidator struct {
+	Index     string `json:"index"`
+	Status    string `json:"status"`
+	Validator struct {
+		WithdrawalCredentials string `json:"withdrawal_credentials"`
+	} `json:"validator"`
+}
+
+//withdrawal credentials of 0x01 (or 0x02 compounding) validators are the prefix, 11 zero bytes and the execution address
+func withdrawalAddress(credentials string) (common.Address, bool) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(credentials, "0x"))
+	if err != nil || len(raw) != 32 || (raw[0] != 0x01 && raw[0] != 0x02) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(raw[12:]), true
+}
+
+//FindWithdrawalValidators lists the validators (index and status) whose withdrawals go to one of the addresses, the
+//beacon API can't filter by withdrawal address so every validator of the head state is streamed through once
+func FindWithdrawalValidators(beaconURL string, addresses map[common.Address]bool) (map[common.Address][]string, error) {
+	client := http.Client{Timeout: 10 * time.Minute}
+	response, err := client.Get(strings.TrimSuffix(beaconURL, "/") + "/eth/v1/beacon/states/head/validators")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("beacon node returned %s", response.Status)
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	//walk to the data array of {"data": [...], ...}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("beacon validators response: %v", err)
+		}
+		if key, ok := token.(string); ok && key == "data" {
+			break
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("beacon validators response: %v", err)
+	}
+	found := make(map[common.Address][]string)
+	for decoder.More() {
+		var validator beaconValidator
+		if err := decoder.Decode(&validator); err != nil {
+			return nil, fmt.Errorf("beacon validators response: %v", err)
+		}
+		address, ok := withdrawalAddress(validator.Validator.WithdrawalCredentials)
+		if ok && addresses[address] {
+			found[address] = append(found[address], fmt.Sprintf("%s (%s)", validator.Index, validator.Status))
+		}
+	}
+	return found, nil
+}
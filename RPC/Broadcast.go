@@ -0,0 +1,63 @@
+package RPC
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"strings"
+	"sync"
+)
+
+//broadcastEndpoint is an extra node or public broadcast service every raw transaction is also sent to
+type broadcastEndpoint struct {
+	url    string
+	client bind.ContractTransactor
+}
+
+//AddBroadcastEndpoints dials the endpoints that raw transactions are sent to alongside the node, a sweep then still
+//propagates when the node is flaky
+func (self *Client) AddBroadcastEndpoints(urls []string) error {
+	for _, url := range urls {
+		client, err := ethclient.Dial(url)
+		if err != nil {
+			return fmt.Errorf("broadcast endpoint %s: %v", url, err)
+		}
+		self.broadcast = append(self.broadcast, broadcastEndpoint{url: url, client: client})
+	}
+	return nil
+}
+
+//send the transaction to the node and every broadcast endpoint at once, it is sent when any of them accepted it
+func (self Client) multiBroadcast(transaction *types.Transaction) error {
+	endpoints := append([]broadcastEndpoint{{url: "node", client: self.client}}, self.broadcast...)
+	errs := make([]error, len(endpoints))
+	var wait sync.WaitGroup
+	for i := range endpoints {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			errs[i] = endpoints[i].client.SendTransaction(context.Background(), transaction)
+			//an endpoint that already has it heard about it from another one
+			if errs[i] != nil && strings.Contains(strings.ToLower(errs[i].Error()), "already known") {
+				errs[i] = nil
+			}
+		}(i)
+	}
+	wait.Wait()
+
+	accepted := 0
+	for i, err := range errs {
+		if err != nil {
+			self.logf(VerbosityVerbose, "Broadcast: %s rejected %s: %v\n", endpoints[i].url, transaction.Hash().Hex(), err)
+			continue
+		}
+		accepted++
+	}
+	self.logf(VerbosityDebug, "rpc eth_sendRawTransaction: %s accepted by %d/%d endpoints\n", transaction.Hash().Hex(), accepted, len(endpoints))
+	if accepted > 0 {
+		return nil
+	}
+	return errs[0]
+}
@@ -0,0 +1,89 @@
+package RPC
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/crypto/sha3"
+	"log"
+	"strings"
+	"walletMigrate/Accounts"
+)
+
+//every call made to a token contract is packed here from an abi rather than appended by hand
+
+//functions used beyond the ERC-20 ones in TokenABI, from ERC-777, ERC-1820, ERC-165, the collectible contracts, old tokens, price feeds and Arbitrum's NodeInterface
+const extensionABI = `[
+	{"type":"function","name":"send","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"},{"name":"data","type":"bytes"}],"outputs":[]},
+	{"type":"function","name":"getInterfaceImplementer","inputs":[{"name":"account","type":"address"},{"name":"interfaceHash","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"balanceOf","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"symbol","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+	{"type":"function","name":"transferPunk","inputs":[{"name":"to","type":"address"},{"name":"punkIndex","type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"punkIndexToAddress","inputs":[{"name":"punkIndex","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"tokensOfOwner","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256[]"}]},
+	{"type":"function","name":"tokenOfOwnerByIndex","inputs":[{"name":"owner","type":"address"},{"name":"index","type":"uint256"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"transferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"safeTransferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"ownerOf","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"supportsInterface","inputs":[{"name":"interfaceId","type":"bytes4"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"gasEstimateComponents","inputs":[{"name":"to","type":"address"},{"name":"contractCreation","type":"bool"},{"name":"data","type":"bytes"}],"outputs":[{"name":"gasEstimate","type":"uint64"},{"name":"gasEstimateForL1","type":"uint64"},{"name":"baseFee","type":"uint256"},{"name":"l1BaseFeeEstimate","type":"uint256"}]},
+	{"type":"function","name":"latestRoundData","inputs":[],"outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}]}
+]`
+
+var (
+	erc20ABI      = parseABI(TokenABI)
+	extensionsABI = parseABI(extensionABI)
+)
+
+func parseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return parsed
+}
+
+//the arguments are fixed by the callers so a packing error is a bug
+func pack(contract abi.ABI, method string, args ...interface{}) []byte {
+	data, err := contract.Pack(method, args...)
+	if err != nil {
+		log.Fatal(method, ": ", err)
+	}
+	return data
+}
+
+func keccak(data string) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(data))
+	return hash.Sum(nil)
+}
+
+//TransferData builds the data that moves the whole token balance (or the single collectible) from one account to another,
+//gas estimates and the signed transfers both use it so they always agree
+func TransferData(token Accounts.Token, from common.Address, to common.Address) []byte {
+	switch {
+	case token.TokenID != nil && token.Fallback:
+		return collectibleOf(token.Contract).fallback(from, to, token.TokenID)
+	case token.TokenID != nil:
+		return collectibleOf(token.Contract).transfer(from, to, token.TokenID)
+	case token.ERC777:
+		//send(), unlike the ERC-20 transfer(), runs the tokensToSend and tokensReceived hooks
+		return pack(extensionsABI, "send", to, token.Balance, []byte{})
+	default:
+		return pack(erc20ABI, "transfer", to, token.Balance)
+	}
+}
+
+//an ERC-20 transfer that returns false rather than reverting moved nothing, no return data at all is fine since many
+//early tokens (USDT, BNB) declared transfer() without one
+func transferReturnedFalse(result []byte) bool {
+	if len(result) == 0 {
+		return false
+	}
+	values, err := erc20ABI.Unpack("transfer", result)
+	if err != nil || len(values) != 1 {
+		return false
+	}
+	success, ok := values[0].(bool)
+	return ok && !success
+}
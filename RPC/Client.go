@@ -2,17 +2,22 @@ package RPC
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"golang.org/x/crypto/sha3"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 	"log"
 	"math/big"
+	"sort"
+	"strings"
 	"time"
 	"walletMigrate/Accounts"
+	"walletMigrate/Errors"
 )
 
 type TransactionWithOriginator struct {
@@ -20,21 +25,92 @@ type TransactionWithOriginator struct {
 	SignedTx *types.Transaction
 }
 
+//output levels shared with the command line -q/-v/-vv flags
+const (
+	VerbosityQuiet   = -1 //only transactions and errors
+	VerbosityNormal  = 0
+	VerbosityVerbose = 1 //include skipped tokens and per account scan results
+	VerbosityDebug   = 2 //include raw rpc interactions and gas math
+)
+
+//Backend is the node the client reads from and sends to, an ethclient connection or any other implementation
+//(like Mock) with the same methods
+type Backend interface {
+	bind.ContractBackend
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	ChainID(ctx context.Context) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+//RawCaller sends the requests ethclient has no wrapper for (txpool_contentFrom), a backend that also implements it
+//is used for them
+type RawCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
 type Client struct {
-	client *ethclient.Client
+	client    Backend
+	rpc       RawCaller //for the methods ethclient has no wrapper for
+	broadcast []broadcastEndpoint
+	Verbosity int
+	KnownGas  map[common.Address]uint64 //gas limits of ERC-20 transfers learned by earlier runs, used instead of estimates
 }
 
 func NewClient(rpcURL string) Client {
-	client, err := ethclient.Dial(rpcURL)
+	rpcClient, err := rpc.Dial(rpcURL)
 	if err != nil {
 		log.Fatal(err)
 	}
-	return Client{client: client}
+	return newRPCClient(rpcClient)
+}
+
+func newRPCClient(rpcClient *rpc.Client) Client {
+	return Client{client: ethclient.NewClient(rpcClient), rpc: rpcClient}
+}
+
+//NewBackendClient uses the backend instead of a node, requests it can't serve fail the way a node without them does
+func NewBackendClient(backend Backend) Client {
+	caller, ok := backend.(RawCaller)
+	if !ok {
+		caller = unsupportedCaller{}
+	}
+	return Client{client: backend, rpc: caller}
+}
+
+//a RawCaller for backends without raw requests
+type unsupportedCaller struct{}
+
+func (unsupportedCaller) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return fmt.Errorf("the method %s does not exist/is not available", method)
+}
+
+//print a message when the client verbosity is at least level
+func (self Client) logf(level int, format string, args ...interface{}) {
+	if self.Verbosity >= level {
+		fmt.Printf(format, args...)
+	}
 }
 
 func (self Client) SendTx(transaction *types.Transaction) error {
 	// Connect the client
-	return self.client.SendTransaction(context.Background(), transaction)
+	if len(self.broadcast) > 0 {
+		return Errors.New(Errors.RPCError, self.multiBroadcast(transaction))
+	}
+	self.logf(VerbosityDebug, "rpc eth_sendRawTransaction: %s\n", transaction.Hash().Hex())
+	return Errors.New(Errors.RPCError, self.client.SendTransaction(context.Background(), transaction))
+}
+
+//get the id of the chain the node is on
+func (self Client) GetChainID() (*big.Int, error) {
+	chainID, err := self.client.ChainID(context.Background())
+	self.logf(VerbosityDebug, "rpc eth_chainId: %v err: %v\n", chainID, err)
+	return chainID, err
 }
 
 func (self Client) GetGasPrice(modifier float64) *big.Int {
@@ -43,52 +119,244 @@ func (self Client) GetGasPrice(modifier float64) *big.Int {
 		log.Fatal(err)
 	}
 
+	self.logf(VerbosityDebug, "rpc eth_gasPrice: %s wei\n", gasPrice)
+
 	floatGasPrice := new(big.Float).SetInt(gasPrice)
 	floatGasPrice.Mul(floatGasPrice, big.NewFloat(modifier))
 	floatGasPrice.Int(gasPrice)
+	self.logf(VerbosityDebug, "gas price: suggested x %v = %s wei\n", modifier, gasPrice)
 
 	return gasPrice
 }
 
-func (self Client) GetUsedAccounts(accounts []Accounts.Account, pendingNonce bool, gasLimit int64) []Accounts.Account {
+func (self Client) GetUsedAccounts(accounts []Accounts.Account, destination common.Address, pendingNonce bool, gasLimit int64) []Accounts.Account {
 	allAccounts := self.getBalances(accounts, pendingNonce)
-	return self.getTokenTransfers(allAccounts, gasLimit)
+	used := self.getTokenTransfers(allAccounts, destination, gasLimit)
+	//the caller's accounts keep what the scan found, the empty ones that were used are reported from them
+	for x := range accounts {
+		accounts[x].Used = allAccounts[x].Used
+	}
+	return used
 }
 
-func (self Client) AwaitTransactions(transactions []TransactionWithOriginator) {
+//AwaitTransactions polls until every transaction is mined or its nonce was mined by another transaction (one that
+//replaced it), or the timeout passes.  Returns the transactions that were still unsettled at the timeout
+func (self Client) AwaitTransactions(transactions []TransactionWithOriginator, timeout time.Duration) []TransactionWithOriginator {
+	deadline := time.Now().Add(timeout)
 	time.Sleep(2 * time.Second) //wait a few seconds initially for the transactions to get propagated
 	//can't do subscriptions with Infura so just poll every 15 seconds to check if transactions are mined
+	waiting := transactions
+	for {
+		var unsettled []TransactionWithOriginator
+		for _, transaction := range waiting {
+			if !self.settled(transaction) {
+				unsettled = append(unsettled, transaction)
+			}
+		}
+		if len(unsettled) == 0 || !time.Now().Before(deadline) {
+			return unsettled
+		}
+		self.logf(VerbosityVerbose, "Waiting for %d of %d transactions to be mined\n", len(unsettled), len(transactions))
+		time.Sleep(15 * time.Second) //about a block
+		waiting = unsettled
+	}
+}
+
+//a transaction is settled once it has a receipt or its nonce is mined, a replaced transaction is gone from the pool
+//and only the nonce shows that the replacement (or whatever else took the nonce) won
+func (self Client) settled(transaction TransactionWithOriginator) bool {
+	_, err := self.client.TransactionReceipt(context.Background(), transaction.SignedTx.Hash())
+	self.logf(VerbosityDebug, "rpc eth_getTransactionReceipt: %s err: %v\n", transaction.SignedTx.Hash().Hex(), err)
+	if err == nil {
+		return true
+	}
+	nonce, err := self.client.NonceAt(context.Background(), transaction.Address, nil)
+	self.logf(VerbosityDebug, "rpc eth_getTransactionCount: %s nonce: %d err: %v\n", transaction.Address.Hex(), nonce, err)
+	return err == nil && nonce > transaction.SignedTx.Nonce()
+}
+
+//get the receipts of mined transactions, transactions that were not mined (or failed to send) are missing from the result
+func (self Client) GetReceipts(transactions []TransactionWithOriginator) map[common.Hash]*types.Receipt {
+	receipts := make(map[common.Hash]*types.Receipt)
 	for _, transaction := range transactions {
-		_, isPending, err := self.client.TransactionByHash(context.Background(), transaction.SignedTx.Hash())
+		receipt, err := self.client.TransactionReceipt(context.Background(), transaction.SignedTx.Hash())
+		self.logf(VerbosityDebug, "rpc eth_getTransactionReceipt: %s err: %v\n", transaction.SignedTx.Hash().Hex(), err)
+		if err != nil {
+			continue
+		}
+		receipts[transaction.SignedTx.Hash()] = receipt
+	}
+	return receipts
+}
+
+//the gas price a mined transaction paid: its price when legacy, its fee cap capped base fee plus tip of the block it
+//was mined in when dynamic (a type-2 transaction rarely pays its whole cap).  nil when the block can't be read
+func (self Client) EffectiveGasPrice(transaction *types.Transaction, receipt *types.Receipt) *big.Int {
+	if transaction.Type() == types.LegacyTxType || transaction.Type() == types.AccessListTxType {
+		return transaction.GasPrice()
+	}
+	header, err := self.client.HeaderByNumber(context.Background(), receipt.BlockNumber)
+	self.logf(VerbosityDebug, "rpc eth_getBlockByNumber: %s err: %v\n", receipt.BlockNumber, err)
+	if err != nil || header.BaseFee == nil {
+		return nil
+	}
+	price := new(big.Int).Add(header.BaseFee, transaction.GasTipCap())
+	if price.Cmp(transaction.GasFeeCap()) > 0 {
+		price.Set(transaction.GasFeeCap())
+	}
+	return price
+}
+
+//get the receipt of a transaction, when it is not mined yet pending tells whether the node still has it in its pool
+func (self Client) GetTransactionStatus(hash common.Hash) (receipt *types.Receipt, pending bool) {
+	receipt, err := self.client.TransactionReceipt(context.Background(), hash)
+	self.logf(VerbosityDebug, "rpc eth_getTransactionReceipt: %s err: %v\n", hash.Hex(), err)
+	if err == nil {
+		return receipt, false
+	}
+	_, pending, err = self.client.TransactionByHash(context.Background(), hash)
+	self.logf(VerbosityDebug, "rpc eth_getTransactionByHash: %s pending: %v err: %v\n", hash.Hex(), pending, err)
+	return nil, err == nil && pending
+}
+
+//call the transfer without sending it and report whether the token returned false, which signals a failed transfer
+//the same way a revert does on tokens that predate reverting
+func (self Client) simulateTransfer(from common.Address, token Accounts.Token, destination common.Address) bool {
+	result, err := self.client.CallContract(context.Background(), ethereum.CallMsg{From: from, To: &token.Contract, Value: new(big.Int), Data: TransferData(token, from, destination)}, nil)
+	self.logf(VerbosityDebug, "rpc eth_call transfer(): %s from %s result: %x err: %v\n", token.Contract.Hex(), from.Hex(), result, err)
+	return err == nil && transferReturnedFalse(result)
+}
+
+//SignTokenTransfer signs (without sending) the transfer of the token's balance (or the single collectible) from the
+//account to another at its next nonce.  ERC-20 transfers go through the generated Token binding, ERC-777 sends and
+//collectibles have no binding and are signed from TransferData
+func (self Client) SignTokenTransfer(account Accounts.Account, token Accounts.Token, to common.Address, gasPrice *big.Int) (*types.Transaction, error) {
+	if token.TokenID != nil || token.ERC777 {
+		return account.SignTx(account.Nonce, token.Contract, big.NewInt(0), token.GasLimit, gasPrice, TransferData(token, account.Address, to))
+	}
+	instance, err := NewToken(token.Contract, self.client)
+	if err != nil {
+		return nil, Errors.New(Errors.SignError, err)
+	}
+	signedTx, err := instance.Transfer(account.TransactOpts(account.Nonce, token.GasLimit, gasPrice), to, token.Balance)
+	return signedTx, Errors.New(Errors.SignError, err)
+}
+
+//the most gas a transfer is run with when its estimate failed, one that needs more is taken to revert
+const simulatedGasCap = 1000000
+
+//simulateGas finds the gas of a transfer eth_estimateGas failed for by running it with eth_call, the lowest limit (to
+//within 1000 gas) it succeeds with.  reverted is set when it fails even with simulatedGasCap because the contract
+//reverted rather than the node failing the call
+func (self Client) simulateGas(from common.Address, token Accounts.Token, destination common.Address) (uint64, bool, error) {
+	call := ethereum.CallMsg{From: from, To: &token.Contract, Gas: simulatedGasCap, Value: new(big.Int), Data: TransferData(token, from, destination)}
+	_, err := self.client.CallContract(context.Background(), call, nil)
+	self.logf(VerbosityDebug, "rpc eth_call transfer(): %s from %s gas: %d err: %v\n", token.Contract.Hex(), from.Hex(), call.Gas, err)
+	if err != nil {
+		var data rpc.DataError
+		return 0, errors.As(err, &data) || strings.Contains(err.Error(), "revert"), err
+	}
+	low, high := uint64(params.TxGas), uint64(simulatedGasCap)
+	for high-low > 1000 {
+		call.Gas = (low + high) / 2
+		_, err := self.client.CallContract(context.Background(), call, nil)
+		self.logf(VerbosityDebug, "rpc eth_call transfer(): %s from %s gas: %d err: %v\n", token.Contract.Hex(), from.Hex(), call.Gas, err)
 		if err != nil {
-			//log.Println("ERROR(C1):", err)
-			isPending = true
+			low = call.Gas
+		} else {
+			high = call.Gas
 		}
-		if isPending { //if any are still pending then wait break and wait ~for next block
-			time.Sleep(15 * time.Second)
+	}
+	return high, false, nil
+}
+
+//an account with transactions waiting in the pool, the nonces from Account.Nonce up to Pending-1 are taken
+type QueuedAccount struct {
+	Account Accounts.Account
+	Pending uint64
+}
+
+//GetQueuedAccounts scans the accounts from their last mined nonce and returns the ones whose pending nonce is ahead of it
+func (self Client) GetQueuedAccounts(accounts []Accounts.Account) []QueuedAccount {
+	var queued []QueuedAccount
+	for _, account := range self.getBalances(accounts, false) {
+		pending, err := self.client.PendingNonceAt(context.Background(), account.Address)
+		if err != nil {
+			Errors.Log(Errors.RPCError, "C3", err)
 			continue
 		}
+		self.logf(VerbosityDebug, "rpc eth_getTransactionCount(pending): %s nonce: %d\n", account.Address.Hex(), pending)
+		if pending > account.Nonce {
+			queued = append(queued, QueuedAccount{Account: account, Pending: pending})
+		}
+	}
+	return queued
+}
+
+//read the number of mined transactions of an account
+func (self Client) GetNonce(address common.Address) (uint64, error) {
+	nonce, err := self.client.NonceAt(context.Background(), address, nil)
+	self.logf(VerbosityDebug, "rpc eth_getTransactionCount: %s nonce: %d err: %v\n", address.Hex(), nonce, err)
+	return nonce, err
+}
+
+//read the number of the latest block
+func (self Client) GetBlockNumber() (uint64, error) {
+	number, err := self.client.BlockNumber(context.Background())
+	self.logf(VerbosityDebug, "rpc eth_blockNumber: %d err: %v\n", number, err)
+	return number, err
+}
+
+//read the current eth balance of an account
+func (self Client) GetBalance(address common.Address) (*big.Int, error) {
+	balance, err := self.client.BalanceAt(context.Background(), address, nil)
+	self.logf(VerbosityDebug, "rpc eth_getBalance: %s %s wei err: %v\n", address.Hex(), balance, err)
+	return balance, err
+}
+
+//read the current token balance of an account
+func (self Client) GetTokenBalance(contract common.Address, owner common.Address) (*big.Int, error) {
+	tokenInstance, err := NewToken(contract, self.client)
+	if err != nil {
+		return nil, err
 	}
+	balance, err := tokenInstance.BalanceOf(&bind.CallOpts{}, owner)
+	self.logf(VerbosityDebug, "rpc balanceOf: %s %s %s err: %v\n", contract.Hex(), owner.Hex(), balance, err)
+	return balance, err
 }
 
 func (self Client) GetPendingBalances(accounts []Accounts.Account) []Accounts.Account {
 	for x := range accounts {
 		bal, err := self.client.PendingBalanceAt(context.Background(), accounts[x].Address)
 		if err != nil {
-			log.Println("ERROR(M3):", err)
+			Errors.Log(Errors.RPCError, "M3", err)
 			continue
 		}
+		self.logf(VerbosityDebug, "rpc eth_getBalance(pending): %s %s wei\n", accounts[x].Address.Hex(), bal)
 		accounts[x].Balance.Set(bal)
 	}
 	return accounts
 }
 
+//GetBalances reads the balance, nonce and chain details of the accounts without looking for tokens
+func (self Client) GetBalances(accounts []Accounts.Account, pendingNonce bool) []Accounts.Account {
+	return self.getBalances(accounts, pendingNonce)
+}
+
 func (self Client) getBalances(accounts []Accounts.Account, pendingNonce bool) []Accounts.Account {
+	//transactions are signed for the chain id, the network id some nodes report differs from it (61 vs 1 on ethereum classic)
+	chainID, err := self.client.ChainID(context.Background())
+	if err != nil {
+		Errors.Log(Errors.RPCError, "C4", err)
+	}
+	dynamicFees := self.londonActive()
+	minGasPrice := self.minedGasPrice(chainID)
+	var transferGas uint64
 	allAccounts := make([]Accounts.Account, 0)
 	for x := range accounts {
 		bal, err := self.client.BalanceAt(context.Background(), accounts[x].Address, nil)
 		if err != nil {
-			log.Println("ERROR(C2):", err)
+			Errors.Log(Errors.DiscoveryError, "C2", err)
 		}
 
 		var nonce uint64
@@ -98,87 +366,189 @@ func (self Client) getBalances(accounts []Accounts.Account, pendingNonce bool) [
 			nonce, err = self.client.NonceAt(context.Background(), accounts[x].Address, nil)
 		}
 		if err != nil {
-			log.Println("ERROR(C3):", err)
+			Errors.Log(Errors.RPCError, "C3", err)
 		}
 
-		chainID, err := self.client.NetworkID(context.Background())
+		self.logf(VerbosityDebug, "rpc eth_getBalance/eth_getTransactionCount/eth_chainId: %s balance: %s wei nonce: %d chain: %s\n", accounts[x].Address.Hex(), bal, nonce, chainID)
+		self.logf(VerbosityVerbose, "Scanned: %s, Balance: %s wei, Nonce: %d\n", accounts[x].Address.Hex(), bal, nonce)
+
+		code, err := self.client.CodeAt(context.Background(), accounts[x].Address, nil)
 		if err != nil {
-			log.Println("ERROR(C4):", err)
+			Errors.Log(Errors.DiscoveryError, "C14", err)
 		}
+		self.logf(VerbosityDebug, "rpc eth_getCode: %s %d bytes\n", accounts[x].Address.Hex(), len(code))
 
 		accounts[x].Balance = bal
 		accounts[x].Nonce = nonce
+		accounts[x].Code = code
 		accounts[x].ChainId = chainID
+		accounts[x].DynamicFees = dynamicFees
+		accounts[x].MinGasPrice = minGasPrice
+		if transferGas == 0 {
+			transferGas = self.ethTransferGas(chainID, accounts[x].Address)
+		}
+		accounts[x].TransferGas = transferGas
+		accounts[x].Used = nonce > 0 || (bal != nil && bal.Sign() != 0)
 		allAccounts = append(allAccounts, accounts[x])
 	}
 	return allAccounts
 }
 
-func (self Client) getTokenTransfers(accounts []Accounts.Account, overrideGasLimit int64) []Accounts.Account {
+//the latest block has a base fee once the chain has activated London
+func (self Client) londonActive() bool {
+	header, err := self.client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		Errors.Log(Errors.RPCError, "C12", err)
+		return false
+	}
+	self.logf(VerbosityDebug, "rpc eth_getBlockByNumber(latest): base fee %v\n", header.BaseFee)
+	return header.BaseFee != nil
+}
+
+//the lowest gas price a transaction can be mined at in the next block, the base fee rises by at most 1/8 per block,
+//plus the chain's minimum tip where one is known
+func (self Client) minedGasPrice(chainID *big.Int) *big.Int {
+	price := new(big.Int)
+	header, err := self.client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		Errors.Log(Errors.RPCError, "C12", err)
+		return price
+	}
+	if header.BaseFee != nil {
+		price.Add(header.BaseFee, new(big.Int).Div(header.BaseFee, big.NewInt(8)))
+	}
+	if chainID != nil && chainID.IsInt64() {
+		price.Add(price, big.NewInt(minimumTips[chainID.Int64()]))
+	}
+	self.logf(VerbosityDebug, "lowest mined gas price: %s wei\n", price)
+	return price
+}
+
+func (self Client) getTokenTransfers(accounts []Accounts.Account, destination common.Address, overrideGasLimit int64) []Accounts.Account {
 	allAccounts := make([]Accounts.Account, 0)
 
 	for x := range accounts {
+		var detected []common.Address //ERC-721 contracts among the transfers
 		logsArray, err := self.client.FilterLogs(context.Background(), ethereum.FilterQuery{Topics: [][]common.Hash{
 			{common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")}, //topic_0 is transfer
 			{}, //anything in topic_1 (could have sent tokens but we are concerned with every token received)
 			{accounts[x].Address.Hash()}}}) //topic_2 is recipient of transfer
+		self.logf(VerbosityDebug, "rpc eth_getLogs: %s %d transfer logs err: %v\n", accounts[x].Address.Hex(), len(logsArray), err)
 		if err != nil {
-			log.Println("ERROR(C5):", err)
+			Errors.Log(Errors.DiscoveryError, "C5", err)
 		} else if len(logsArray) > 0 {
 			tokens := make(map[string]Accounts.Token)
 			logsArray = unique(logsArray)
 			for _, logEntry := range logsArray {
-				fmt.Printf("Querying: %s, Token Address: %s\n", accounts[x].Address.String(), logEntry.Address.String())
+				if isCollectible(logEntry.Address) {
+					continue //scanned with its own handler below
+				}
+				if self.isERC721(logEntry) {
+					detected = append(detected, logEntry.Address)
+					continue //its items are scanned with the collectibles below
+				}
+				if isZkSync(accounts[x].ChainId) && logEntry.Address == zkSyncBaseToken {
+					continue //ETH itself, swept with the balance
+				}
+				self.logf(VerbosityNormal, "Querying: %s, Token Address: %s\n", accounts[x].Address.String(), logEntry.Address.String())
 				tokenInstance, err := NewToken(logEntry.Address, self.client)
 				if err != nil {
-					log.Println("ERROR(C6):", logEntry.Address.String(), err)
+					Errors.Log(Errors.DiscoveryError, "C6", err, logEntry.Address.String())
 					continue
 				}
 				bal, err := tokenInstance.BalanceOf(&bind.CallOpts{}, accounts[x].Address)
+				self.logf(VerbosityDebug, "rpc balanceOf: %s %s err: %v\n", logEntry.Address.Hex(), bal, err)
 				if err != nil {
-					//log.Println("ERROR(C7):", logEntry.Address.String(), err)
+					self.logf(VerbosityVerbose, "Skipped: %s, Token Address: %s, balanceOf failed: %v\n", accounts[x].Address.String(), logEntry.Address.String(), err)
 					continue
 				}
-				symbol, err := tokenInstance.Symbol(&bind.CallOpts{})
+				symbol, err := self.getSymbol(logEntry.Address, tokenInstance)
 				if err != nil {
-					//log.Println("ERROR(C8):", logEntry.Address.String(), err)
+					self.logf(VerbosityVerbose, "Token Address: %s, symbol() failed: %v\n", logEntry.Address.String(), err)
 					symbol = "???"
 				}
 
 				decimals, err := tokenInstance.Decimals(&bind.CallOpts{})
+				decimalsUnknown := err != nil
 				if err != nil {
-					//log.Println("ERROR(C9):", logEntry.Address.String(), err)
+					self.logf(VerbosityVerbose, "Token Address: %s, decimals() failed: %v\n", logEntry.Address.String(), err)
 					decimals = 0
 				}
 				if bal != nil && bal.Cmp(big.NewInt(0)) != 0 {
-					hash := sha3.NewLegacyKeccak256()
-					hash.Write([]byte("transfer(address,uint256)"))
-					methodID := hash.Sum(nil)[:4]
-
-					var data []byte
-					data = append(data, methodID...)
-					data = append(data, accounts[x].Address.Hash().String()...)
-					data = append(data, common.LeftPadBytes(bal.Bytes(), 32)...)
-
-					gasLimit, err := self.client.EstimateGas(context.Background(), ethereum.CallMsg{To: &logEntry.Address, Data: data})
+					token := Accounts.Token{Contract: logEntry.Address, Symbol: symbol, Decimals: decimals, Balance: bal, ERC777: self.isERC777(logEntry.Address), DecimalsUnknown: decimalsUnknown}
+					var gasLimit uint64
+					var err error
+					known := self.KnownGas[logEntry.Address]
+					if known == 0 || token.ERC777 {
+						gasLimit, err = self.estimateTransferGas(accounts[x], ethereum.CallMsg{From: accounts[x].Address, To: &logEntry.Address, Value: new(big.Int), Data: TransferData(token, accounts[x].Address, destination)})
+					}
+					if err != nil && token.ERC777 {
+						self.logf(VerbosityNormal, "Skipped: %s, Token Address: %s, ERC-777 send to the destination would revert: %v\n", accounts[x].Address.String(), logEntry.Address.String(), err)
+						continue
+					}
 					if err != nil {
-						//if we can't get an accurate estimate then we are going to have to guess,
-						gasLimit = 40000
+						//the transfer is run with eth_call instead, which tells a transfer that reverts from one the node
+						//couldn't estimate, and only when that fails too are we going to have to guess
+						simulated, reverted, simulateErr := self.simulateGas(accounts[x].Address, token, destination)
+						switch {
+						case simulateErr == nil:
+							self.logf(VerbosityVerbose, "Token Address: %s, eth_estimateGas failed (%v), the transfer runs with %d gas\n", logEntry.Address.String(), err, simulated)
+							gasLimit, token.GasSimulated = simulated, true
+						case reverted:
+							self.logf(VerbosityNormal, "Skipped: %s, Token Address: %s, transfer to the destination reverts: %v\n", accounts[x].Address.String(), logEntry.Address.String(), simulateErr)
+							token.Unsupported = "transfer() reverts"
+						default:
+							gasLimit = 40000
+						}
+					}
+					padding := gasPadding(accounts[x].ChainId)
+					transferGas := int64(float64(gasLimit) * padding) //gas estimates are not always correct and sometimes lower than necessary
+					if known > 0 && !token.ERC777 {
+						transferGas = int64(known) //what the token's mined transfers used, with a margin already
 					}
-					transferGas := int64(float64(gasLimit) * 1.7) //gas estimates are not always correct and sometimes lower than necessary
 					if overrideGasLimit > 0 {
 						transferGas = overrideGasLimit
 					}
-					accounts[x].TotalAssetTransfer.Add(accounts[x].TotalAssetTransfer, big.NewInt(transferGas))
-					tokens[logEntry.Address.Hex()] = Accounts.Token{Contract: logEntry.Address, Symbol: symbol, Decimals: decimals, Balance: bal, GasLimit: uint64(transferGas)}
+					self.logf(VerbosityDebug, "gas limit: %s estimate %d (err: %v) x %v = %d, override: %d, using: %d\n", logEntry.Address.Hex(), gasLimit, err, padding, int64(float64(gasLimit)*padding), overrideGasLimit, transferGas)
+					token.GasLimit = uint64(transferGas)
+					if token.Unsupported != "" {
+						token.GasLimit = 0
+					} else if !token.ERC777 && self.simulateTransfer(accounts[x].Address, token, destination) {
+						self.logf(VerbosityNormal, "Needs manual action: %s, Token Address: %s, transfer() returns false without reverting\n", accounts[x].Address.String(), logEntry.Address.String())
+						token.Unsupported = "transfer() returns false"
+						token.Manual = true
+						token.GasLimit = 0
+					}
+					tokens[logEntry.Address.Hex()] = token
 				}
 			}
-			fmt.Printf("\n")
+			self.logf(VerbosityNormal, "\n")
+			if len(tokens) > 1 {
+				tokens = self.dedupeProxies(accounts[x].Address, tokens)
+			}
 			if len(tokens) > 0 {
-				for _, token := range tokens {
+				//in contract order, the map's order changes from run to run
+				contracts := make([]string, 0, len(tokens))
+				for contract := range tokens {
+					contracts = append(contracts, contract)
+				}
+				sort.Strings(contracts)
+				for _, contract := range contracts {
+					token := tokens[contract]
+					accounts[x].TotalAssetTransfer.Add(accounts[x].TotalAssetTransfer, new(big.Int).SetUint64(token.GasLimit))
 					accounts[x].Tokens = append(accounts[x].Tokens, token)
 				}
 			}
+		}
+
+		//some collectibles emit no indexed transfer events so they are looked up on every account
+		collectibles := self.getCollectibles(accounts[x], destination, overrideGasLimit, detected)
+		for _, token := range collectibles {
+			accounts[x].TotalAssetTransfer.Add(accounts[x].TotalAssetTransfer, new(big.Int).SetUint64(token.GasLimit))
+			accounts[x].Tokens = append(accounts[x].Tokens, token)
+		}
+		if len(logsArray) > 0 || len(collectibles) > 0 {
+			accounts[x].Used = true
 			if len(accounts[x].Tokens) > 0 || accounts[x].Balance.Cmp(big.NewInt(0)) != 0 {
 				allAccounts = append(allAccounts, accounts[x])
 			}
@@ -0,0 +1,278 @@
+package RPC
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"walletMigrate/Accounts"
+	"walletMigrate/Errors"
+)
+
+//collectible handles a contract from before ERC-721 was finalized (or a wrapper of one) where treating it as a
+//token reverts, each owned item is found with the contract's own functions and events and moved with its own transfer,
+//or with the fallback when there is one and the transfer would revert
+type collectible struct {
+	symbol   string
+	find     func(self Client, contract common.Address, owner common.Address, balance *big.Int) ([]*big.Int, error)
+	transfer func(from common.Address, to common.Address, id *big.Int) []byte
+	fallback func(from common.Address, to common.Address, id *big.Int) []byte
+}
+
+//mainnet contracts only, every other chain is scanned for tokens as usual
+var collectibles = map[common.Address]collectible{
+	common.HexToAddress("0xb47e3cd837dDF8e4c57F05d70Ab865de6e193BBB"): {symbol: "PUNK", find: findPunks, transfer: transferPunk},                                    //CryptoPunks
+	common.HexToAddress("0x6Ba6f2207e343923BA692e5Cae646Fb0F566DB8D"): {symbol: "PUNKV1", find: findPunks, transfer: transferPunk},                                  //CryptoPunks V1
+	common.HexToAddress("0x06012c8cf97BEaD5deAe237070F9587f8E7A266d"): {symbol: "CK", find: findKitties, transfer: transferDraft721},                                //CryptoKitties
+	common.HexToAddress("0xb7F7F6C52F2e2fdb1963Eab30438024864c313F6"): {symbol: "WPUNKS", find: findEnumerable, transfer: safeTransferFrom, fallback: transferFrom}, //Wrapped CryptoPunks
+}
+
+//the ERC-165 interface id of ERC-721
+var erc721Interface = [4]byte{0x80, 0xac, 0x58, 0xcd}
+
+//any other ERC-721, found in the account's Transfer logs on every chain: the items it received and still owns are
+//moved with safeTransferFrom, or transferFrom when the contract has no safeTransferFrom
+var erc721 = collectible{find: findTransferred, transfer: safeTransferFrom, fallback: transferFrom}
+
+func isCollectible(contract common.Address) bool {
+	_, ok := collectibles[contract]
+	return ok
+}
+
+func collectibleOf(contract common.Address) collectible {
+	if known, ok := collectibles[contract]; ok {
+		return known
+	}
+	return erc721
+}
+
+//an ERC-721's Transfer event indexes the item id where an ERC-20's carries the amount as data.  Some ERC-20s index
+//every argument, so the contract has to confirm it: through ERC-165, or for the drafts that predate it and don't
+//answer supportsInterface, by knowing the owner of the id in the log
+func (self Client) isERC721(logEntry types.Log) bool {
+	if len(logEntry.Topics) != 4 {
+		return false
+	}
+	result, err := self.call(logEntry.Address, pack(extensionsABI, "supportsInterface", erc721Interface))
+	self.logf(VerbosityDebug, "rpc supportsInterface(ERC-721): %s result: %x err: %v\n", logEntry.Address.Hex(), result, err)
+	if err == nil && new(big.Int).SetBytes(result[:32]).Cmp(big.NewInt(1)) == 0 {
+		return true
+	}
+	result, err = self.call(logEntry.Address, pack(extensionsABI, "ownerOf", logEntry.Topics[3].Big()))
+	self.logf(VerbosityDebug, "rpc ownerOf(%s): %s result: %x err: %v\n", logEntry.Topics[3].Big(), logEntry.Address.Hex(), result, err)
+	return err == nil && common.BytesToAddress(result[:32]) != (common.Address{})
+}
+
+func (self Client) call(contract common.Address, data []byte) ([]byte, error) {
+	result, err := self.client.CallContract(context.Background(), ethereum.CallMsg{To: &contract, Data: data}, nil)
+	self.logf(VerbosityDebug, "rpc eth_call: %s %x result: %x err: %v\n", contract.Hex(), data[:4], result, err)
+	if err == nil && len(result) < 32 {
+		err = fmt.Errorf("%s returned %d bytes", contract.Hex(), len(result))
+	}
+	return result, err
+}
+
+//find the collectibles held by the account on the known contracts and the ERC-721s detected in its Transfer logs, the
+//gas of each transfer is estimated and any that can't be moved to the destination are skipped
+func (self Client) getCollectibles(account Accounts.Account, destination common.Address, overrideGasLimit int64, detected []common.Address) []Accounts.Token {
+	found := make([]Accounts.Token, 0)
+	handlers := make(map[common.Address]collectible)
+	if account.ChainId != nil && account.ChainId.Cmp(big.NewInt(1)) == 0 {
+		for contract, handler := range collectibles {
+			handlers[contract] = handler
+		}
+	}
+	for _, contract := range detected {
+		handler := erc721
+		handler.symbol = self.collectionSymbol(contract)
+		handlers[contract] = handler
+	}
+	for contract, handler := range handlers {
+		result, err := self.call(contract, pack(extensionsABI, "balanceOf", account.Address))
+		if err != nil {
+			Errors.Log(Errors.DiscoveryError, "C10", err, contract.Hex())
+			continue
+		}
+		balance := new(big.Int).SetBytes(result[:32])
+		if balance.Sign() == 0 {
+			continue
+		}
+		ids, err := handler.find(self, contract, account.Address, balance)
+		if err != nil {
+			Errors.Log(Errors.DiscoveryError, "C11", err, contract.Hex())
+			continue
+		}
+		if int64(len(ids)) < balance.Int64() {
+			self.logf(VerbosityNormal, "Warning: %s, Collectible Address: %s, found %d of %d %s, the rest must be moved by hand\n", account.Address.String(), contract.String(), len(ids), balance, handler.symbol)
+		}
+		for _, id := range ids {
+			token := Accounts.Token{Contract: contract, Symbol: fmt.Sprintf("%s #%s", handler.symbol, id), Balance: big.NewInt(1), TokenID: id}
+			gasLimit, err := self.estimateTransferGas(account, ethereum.CallMsg{From: account.Address, To: &contract, Value: new(big.Int), Data: TransferData(token, account.Address, destination)})
+			self.logf(VerbosityDebug, "rpc eth_estimateGas: %s %s #%s gas: %d err: %v\n", contract.Hex(), handler.symbol, id, gasLimit, err)
+			if err != nil && handler.fallback != nil && self.receiverRejects(account, contract, handler, id, destination) {
+				self.logf(VerbosityNormal, "Skipped: %s, Collectible Address: %s, the destination can't receive %s #%s (no onERC721Received): %v\n", account.Address.String(), contract.String(), handler.symbol, id, err)
+				continue
+			}
+			if err != nil && handler.fallback != nil {
+				//the contract predates the preferred transfer, the fallback is simulated the same way
+				token.Fallback = true
+				var fallbackErr error
+				gasLimit, fallbackErr = self.estimateTransferGas(account, ethereum.CallMsg{From: account.Address, To: &contract, Value: new(big.Int), Data: TransferData(token, account.Address, destination)})
+				self.logf(VerbosityDebug, "rpc eth_estimateGas (fallback): %s %s #%s gas: %d err: %v\n", contract.Hex(), handler.symbol, id, gasLimit, fallbackErr)
+				if fallbackErr == nil {
+					self.logf(VerbosityVerbose, "Collectible Address: %s, %s #%s preferred transfer would revert (%v), using the fallback\n", contract.String(), handler.symbol, id, err)
+				}
+				err = fallbackErr
+			}
+			if err != nil {
+				self.logf(VerbosityNormal, "Skipped: %s, Collectible Address: %s, %s #%s transfer would revert: %v\n", account.Address.String(), contract.String(), handler.symbol, id, err)
+				continue
+			}
+			transferGas := int64(float64(gasLimit) * 1.7)
+			if overrideGasLimit > 0 {
+				transferGas = overrideGasLimit
+			}
+			token.GasLimit = uint64(transferGas)
+			found = append(found, token)
+		}
+	}
+	return found
+}
+
+//a preferred transfer to the destination that reverts while the same transfer to the owner itself goes through was
+//refused by the destination, a contract that doesn't take the item.  transferFrom would leave it stuck there, only a
+//contract without safeTransferFrom falls back to it
+func (self Client) receiverRejects(account Accounts.Account, contract common.Address, handler collectible, id *big.Int, destination common.Address) bool {
+	code, err := self.client.CodeAt(context.Background(), destination, nil)
+	if err != nil || len(code) == 0 {
+		return false //only a contract is asked whether it takes the item
+	}
+	_, err = self.estimateTransferGas(account, ethereum.CallMsg{From: account.Address, To: &contract, Value: new(big.Int), Data: handler.transfer(account.Address, account.Address, id)})
+	self.logf(VerbosityDebug, "rpc eth_estimateGas (to the owner): %s %s #%s err: %v\n", contract.Hex(), handler.symbol, id, err)
+	return err == nil
+}
+
+//the symbol a detected collection's items are shown with, its address when it has none
+func (self Client) collectionSymbol(contract common.Address) string {
+	tokenInstance, err := NewToken(contract, self.client)
+	if err == nil {
+		var symbol string
+		if symbol, err = self.getSymbol(contract, tokenInstance); err == nil && symbol != "" {
+			return symbol
+		}
+	}
+	self.logf(VerbosityVerbose, "Collectible Address: %s, symbol() failed: %v\n", contract.String(), err)
+	return contract.Hex()
+}
+
+//punks have no enumeration, candidates come from every event that can hand one to the owner and are kept if the owner still holds them
+func findPunks(self Client, contract common.Address, owner common.Address, balance *big.Int) ([]*big.Int, error) {
+	queries := []struct {
+		topics [][]common.Hash
+		id     func(topics []common.Hash, data []byte) *big.Int
+	}{
+		{[][]common.Hash{{common.BytesToHash(keccak("Assign(address,uint256)"))}, {owner.Hash()}}, func(topics []common.Hash, data []byte) *big.Int { return new(big.Int).SetBytes(data[:32]) }},
+		{[][]common.Hash{{common.BytesToHash(keccak("PunkTransfer(address,address,uint256)"))}, {}, {owner.Hash()}}, func(topics []common.Hash, data []byte) *big.Int { return new(big.Int).SetBytes(data[:32]) }},
+		{[][]common.Hash{{common.BytesToHash(keccak("PunkBought(uint256,uint256,address,address)"))}, {}, {}, {owner.Hash()}}, func(topics []common.Hash, data []byte) *big.Int { return topics[1].Big() }},
+	}
+	candidates := make(map[string]*big.Int)
+	for _, query := range queries {
+		logsArray, err := self.client.FilterLogs(context.Background(), ethereum.FilterQuery{Addresses: []common.Address{contract}, Topics: query.topics})
+		self.logf(VerbosityDebug, "rpc eth_getLogs: %s %s %d logs err: %v\n", contract.Hex(), owner.Hex(), len(logsArray), err)
+		if err != nil {
+			return nil, err
+		}
+		for _, logEntry := range logsArray {
+			if len(logEntry.Topics) < len(query.topics) || len(logEntry.Data) < 32 {
+				continue
+			}
+			id := query.id(logEntry.Topics, logEntry.Data)
+			candidates[id.String()] = id
+		}
+	}
+
+	ids := make([]*big.Int, 0)
+	for _, id := range candidates {
+		result, err := self.call(contract, pack(extensionsABI, "punkIndexToAddress", id))
+		if err != nil {
+			return nil, err
+		}
+		if common.BytesToAddress(result[:32]) == owner {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+//CryptoKitties predates ERC-721 enumeration but lists an owner's kitties itself
+func findKitties(self Client, contract common.Address, owner common.Address, balance *big.Int) ([]*big.Int, error) {
+	result, err := self.call(contract, pack(extensionsABI, "tokensOfOwner", owner))
+	if err != nil {
+		return nil, err
+	}
+	values, err := extensionsABI.Unpack("tokensOfOwner", result)
+	if err != nil {
+		return nil, err
+	}
+	return values[0].([]*big.Int), nil
+}
+
+//any ERC-721: the items of every Transfer to the owner, kept if the owner still holds them
+func findTransferred(self Client, contract common.Address, owner common.Address, balance *big.Int) ([]*big.Int, error) {
+	logsArray, err := self.client.FilterLogs(context.Background(), ethereum.FilterQuery{Addresses: []common.Address{contract}, Topics: [][]common.Hash{{common.BytesToHash(keccak("Transfer(address,address,uint256)"))}, {}, {owner.Hash()}}})
+	self.logf(VerbosityDebug, "rpc eth_getLogs: %s %s %d logs err: %v\n", contract.Hex(), owner.Hex(), len(logsArray), err)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make(map[string]*big.Int)
+	for _, logEntry := range logsArray {
+		if len(logEntry.Topics) == 4 {
+			id := logEntry.Topics[3].Big()
+			candidates[id.String()] = id
+		}
+	}
+	ids := make([]*big.Int, 0)
+	for _, id := range candidates {
+		result, err := self.call(contract, pack(extensionsABI, "ownerOf", id))
+		if err != nil {
+			continue //burned since
+		}
+		if common.BytesToAddress(result[:32]) == owner {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func findEnumerable(self Client, contract common.Address, owner common.Address, balance *big.Int) ([]*big.Int, error) {
+	ids := make([]*big.Int, 0)
+	for i := int64(0); i < balance.Int64(); i++ {
+		result, err := self.call(contract, pack(extensionsABI, "tokenOfOwnerByIndex", owner, big.NewInt(i)))
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, new(big.Int).SetBytes(result[:32]))
+	}
+	return ids, nil
+}
+
+func transferPunk(from common.Address, to common.Address, id *big.Int) []byte {
+	return pack(extensionsABI, "transferPunk", to, id)
+}
+
+//draft ERC-721 contracts only have transfer(to, id)
+func transferDraft721(from common.Address, to common.Address, id *big.Int) []byte {
+	return pack(extensionsABI, "transfer", to, id)
+}
+
+//ERC-721 safeTransferFrom, which checks that a contract destination can receive the item
+func safeTransferFrom(from common.Address, to common.Address, id *big.Int) []byte {
+	return pack(extensionsABI, "safeTransferFrom", from, to, id)
+}
+
+//the fallback of safeTransferFrom, for contracts that predate it
+func transferFrom(from common.Address, to common.Address, id *big.Int) []byte {
+	return pack(extensionsABI, "transferFrom", from, to, id)
+}
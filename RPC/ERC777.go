@@ -0,0 +1,22 @@
+package RPC
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//the ERC-1820 registry is deployed at the same address on every chain (https://eips.ethereum.org/EIPS/eip-1820)
+var erc1820Registry = common.HexToAddress("0x1820a4B7618BdE71Dce8cdc73aAB6C95905faD24")
+
+//a token is ERC-777 when it registered itself as the ERC777Token implementer with the ERC-1820 registry
+func (self Client) isERC777(token common.Address) bool {
+	data := pack(extensionsABI, "getInterfaceImplementer", token, [32]byte(common.BytesToHash(keccak("ERC777Token"))))
+
+	result, err := self.client.CallContract(context.Background(), ethereum.CallMsg{To: &erc1820Registry, Data: data}, nil)
+	self.logf(VerbosityDebug, "rpc getInterfaceImplementer(ERC777Token): %s result: %x err: %v\n", token.Hex(), result, err)
+	if err != nil || len(result) != 32 {
+		return false //chains without the registry have no ERC-777 tokens
+	}
+	return common.BytesToAddress(result) == token
+}
@@ -0,0 +1,53 @@
+package RPC
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+	"sort"
+)
+
+//the eth_feeHistory answer, reward holds the tip at each requested percentile of every block
+type feeHistory struct {
+	BaseFeePerGas []*hexutil.Big   `json:"baseFeePerGas"` //one more than the blocks, the last is the next block's
+	Reward        [][]*hexutil.Big `json:"reward"`
+}
+
+//GetFeeHistoryPrice prices a transaction from the last blocks instead of a single eth_gasPrice sample: every block's
+//base fee plus the tip paid at percentile in it, the percentile of those over the blocks.  The price is never below
+//the next block's base fee plus the median of the tips so it stays minable when fees are rising
+func (self Client) GetFeeHistoryPrice(blocks int, percentile float64) (*big.Int, error) {
+	var history feeHistory
+	err := self.rpc.CallContext(context.Background(), &history, "eth_feeHistory", hexutil.Uint64(blocks), "latest", []float64{percentile})
+	self.logf(VerbosityDebug, "rpc eth_feeHistory: %d blocks at the %vth percentile: %d base fees err: %v\n", blocks, percentile, len(history.BaseFeePerGas), err)
+	if err != nil {
+		return nil, err
+	}
+	if len(history.Reward) == 0 || len(history.BaseFeePerGas) <= len(history.Reward) {
+		return nil, fmt.Errorf("eth_feeHistory returned no fee history")
+	}
+	var prices, tips []*big.Int
+	for i, reward := range history.Reward {
+		tip := new(big.Int)
+		if len(reward) > 0 && reward[0] != nil {
+			tip.Set(reward[0].ToInt())
+		}
+		price := new(big.Int).Add(tip, history.BaseFeePerGas[i].ToInt())
+		tips, prices = append(tips, tip), append(prices, price)
+	}
+	price := new(big.Int).Set(atPercentile(prices, percentile))
+	next := new(big.Int).Add(history.BaseFeePerGas[len(history.Reward)].ToInt(), atPercentile(tips, 50))
+	self.logf(VerbosityDebug, "gas price: %vth percentile of %d blocks %s wei, next base fee plus the median tip %s wei\n", percentile, len(prices), price, next)
+	if next.Cmp(price) > 0 {
+		price = next
+	}
+	return price, nil
+}
+
+//the value at percentile of the values, sorted in place
+func atPercentile(values []*big.Int, percentile float64) *big.Int {
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	index := int(percentile / 100 * float64(len(values)-1))
+	return values[index]
+}
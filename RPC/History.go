@@ -0,0 +1,106 @@
+package RPC
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"sort"
+)
+
+//a transaction to or from one of the scanned addresses in a recent block
+type RecentTransfer struct {
+	Block uint64
+	Hash  common.Hash
+	From  common.Address
+	To    common.Address
+	Value *big.Int
+}
+
+//GetRecentTransfers reads the last blocks and returns the transactions sent to or from the addresses, nodes can't
+//list the history of an address so every block is downloaded
+func (self Client) GetRecentTransfers(addresses map[common.Address]bool, blocks uint64) ([]RecentTransfer, error) {
+	chainID, err := self.GetChainID()
+	if err != nil {
+		return nil, err
+	}
+	head, err := self.client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	var transfers []RecentTransfer
+	for number := head; number+blocks > head && number > 0; number-- {
+		block, err := self.client.BlockByNumber(context.Background(), new(big.Int).SetUint64(number))
+		if err != nil {
+			return nil, err
+		}
+		self.logf(VerbosityDebug, "rpc eth_getBlockByNumber: %d %d transactions\n", number, len(block.Transactions()))
+		for _, tx := range block.Transactions() {
+			if tx.To() == nil {
+				continue
+			}
+			from, err := types.Sender(signer, tx)
+			if err != nil {
+				continue
+			}
+			if addresses[from] || addresses[*tx.To()] {
+				transfers = append(transfers, RecentTransfer{Block: number, Hash: tx.Hash(), From: from, To: *tx.To(), Value: tx.Value()})
+			}
+		}
+	}
+	return transfers, nil
+}
+
+//an address a scanned account sent tokens or collectibles to
+type Counterparty struct {
+	Address   common.Address
+	Transfers int    //transfer events from the account to the address
+	Tokens    int    //contracts the transfers were made on
+	LastBlock uint64 //block of the latest of them
+}
+
+//GetCounterparties returns the addresses the account sent tokens and collectibles to, the most used first.  ERC-20 and
+//ERC-721 transfers share the Transfer event so one log query finds both, ETH sends leave no log and nodes can't list them
+func (self Client) GetCounterparties(address common.Address) ([]Counterparty, error) {
+	logsArray, err := self.client.FilterLogs(context.Background(), ethereum.FilterQuery{Topics: [][]common.Hash{
+		{common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")}, //topic_0 is transfer
+		{address.Hash()}}}) //topic_1 is sender of transfer
+	self.logf(VerbosityDebug, "rpc eth_getLogs: %s %d outbound transfer logs err: %v\n", address.Hex(), len(logsArray), err)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[common.Address]*Counterparty)
+	contracts := make(map[common.Address]map[common.Address]bool)
+	for _, logEntry := range logsArray {
+		if len(logEntry.Topics) < 3 {
+			continue //not a standard transfer, the recipient isn't indexed
+		}
+		to := common.BytesToAddress(logEntry.Topics[2].Bytes())
+		counterparty, ok := found[to]
+		if !ok {
+			counterparty = &Counterparty{Address: to}
+			found[to] = counterparty
+			contracts[to] = make(map[common.Address]bool)
+		}
+		counterparty.Transfers++
+		contracts[to][logEntry.Address] = true
+		if logEntry.BlockNumber > counterparty.LastBlock {
+			counterparty.LastBlock = logEntry.BlockNumber
+		}
+	}
+	counterparties := make([]Counterparty, 0, len(found))
+	for to, counterparty := range found {
+		counterparty.Tokens = len(contracts[to])
+		counterparties = append(counterparties, *counterparty)
+	}
+	//ties by address so the report is the same on every run
+	sort.Slice(counterparties, func(i, j int) bool {
+		if counterparties[i].Transfers != counterparties[j].Transfers {
+			return counterparties[i].Transfers > counterparties[j].Transfers
+		}
+		return counterparties[i].Address.Hex() < counterparties[j].Address.Hex()
+	})
+	return counterparties, nil
+}
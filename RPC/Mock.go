@@ -0,0 +1,332 @@
+package RPC
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"math/big"
+	"sync"
+	"time"
+)
+
+//the gas a transaction to a MockContract uses, plain transfers use 21000
+const mockCallGas = 60000
+
+//MockContract answers the calls to one address of a Mock.  commit is false for eth_call and gas estimates and true
+//when a transaction is mined, only then should the handler apply its effects (move token balances); an error
+//reverts the transaction
+type MockContract func(from common.Address, data []byte, commit bool) ([]byte, error)
+
+//Mock is an in-memory Backend for exercising planning and gas redistribution without a node: every transaction sent
+//is checked like a node would (nonce, balance, intrinsic gas) and mined at once in a block of its own.  Fill in the
+//exported fields before using it through NewBackendClient
+type Mock struct {
+	ChainId   *big.Int //default 1
+	GasPrice  *big.Int //suggested gas price and tip, default 1 gwei
+	BaseFee   *big.Int //nil for a chain without dynamic fees, blocks mined after it is set carry it
+	Balances  map[common.Address]*big.Int
+	Nonces    map[common.Address]uint64
+	Code      map[common.Address][]byte
+	Storage   map[common.Address]map[common.Hash]common.Hash
+	Contracts map[common.Address]MockContract
+	Logs      []types.Log //returned by eth_getLogs when they match the filter
+
+	lock     sync.Mutex
+	blocks   []*types.Block
+	txs      map[common.Hash]*types.Transaction
+	receipts map[common.Hash]*types.Receipt
+}
+
+//NewMock returns an empty chain with only its genesis block
+func NewMock(chainID *big.Int) *Mock {
+	mock := &Mock{ChainId: chainID, GasPrice: big.NewInt(params.GWei), Balances: make(map[common.Address]*big.Int), Nonces: make(map[common.Address]uint64), Code: make(map[common.Address][]byte), Storage: make(map[common.Address]map[common.Hash]common.Hash), Contracts: make(map[common.Address]MockContract)}
+	if mock.ChainId == nil {
+		mock.ChainId = big.NewInt(1)
+	}
+	mock.mine(nil)
+	return mock
+}
+
+//add a block holding the transactions, the caller holds the lock
+func (self *Mock) mine(transactions []*types.Transaction) *types.Block {
+	header := &types.Header{Number: big.NewInt(int64(len(self.blocks))), Time: uint64(time.Now().Unix()), GasLimit: 30000000}
+	if self.BaseFee != nil {
+		header.BaseFee = new(big.Int).Set(self.BaseFee)
+	}
+	if len(self.blocks) > 0 {
+		header.ParentHash = self.blocks[len(self.blocks)-1].Hash()
+	}
+	block := types.NewBlockWithHeader(header).WithBody(transactions, nil)
+	self.blocks = append(self.blocks, block)
+	return block
+}
+
+func (self *Mock) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if balance, ok := self.Balances[account]; ok {
+		return new(big.Int).Set(balance), nil
+	}
+	return new(big.Int), nil
+}
+
+func (self *Mock) PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	return self.BalanceAt(ctx, account, nil)
+}
+
+func (self *Mock) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.Nonces[account], nil
+}
+
+func (self *Mock) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return self.NonceAt(ctx, account, nil)
+}
+
+func (self *Mock) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.Code[account], nil
+}
+
+func (self *Mock) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return self.CodeAt(ctx, account, nil)
+}
+
+func (self *Mock) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	value := self.Storage[account][key]
+	return value.Bytes(), nil
+}
+
+func (self *Mock) ChainID(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(self.ChainId), nil
+}
+
+func (self *Mock) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(self.GasPrice), nil
+}
+
+func (self *Mock) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(self.GasPrice), nil
+}
+
+func (self *Mock) BlockNumber(ctx context.Context) (uint64, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return uint64(len(self.blocks) - 1), nil
+}
+
+//the latest block for a nil number, transactions are mined as they are sent so the pending block (-1) is always empty
+func (self *Mock) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	latest := self.blocks[len(self.blocks)-1]
+	switch {
+	case number == nil:
+		return latest, nil
+	case number.Sign() < 0:
+		header := types.CopyHeader(latest.Header())
+		header.Number.Add(header.Number, big.NewInt(1))
+		header.ParentHash = latest.Hash()
+		return types.NewBlockWithHeader(header), nil
+	case number.IsUint64() && number.Uint64() < uint64(len(self.blocks)):
+		return self.blocks[number.Uint64()], nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (self *Mock) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	block, err := self.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return block.Header(), nil
+}
+
+func (self *Mock) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if call.To == nil {
+		return nil, nil
+	}
+	self.lock.Lock()
+	contract := self.Contracts[*call.To]
+	self.lock.Unlock()
+	if contract == nil {
+		return nil, nil
+	}
+	return contract(call.From, call.Data, false)
+}
+
+func (self *Mock) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	if call.To == nil {
+		return 0, errors.New("the mock can't deploy contracts")
+	}
+	self.lock.Lock()
+	contract := self.Contracts[*call.To]
+	self.lock.Unlock()
+	if contract == nil {
+		return params.TxGas, nil
+	}
+	if _, err := contract(call.From, call.Data, false); err != nil {
+		return 0, errors.New("execution reverted: " + err.Error())
+	}
+	return mockCallGas, nil
+}
+
+func (self *Mock) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var matched []types.Log
+	for _, entry := range self.Logs {
+		if query.FromBlock != nil && entry.BlockNumber < query.FromBlock.Uint64() || query.ToBlock != nil && entry.BlockNumber > query.ToBlock.Uint64() {
+			continue
+		}
+		if len(query.Addresses) > 0 && !containsAddress(query.Addresses, entry.Address) {
+			continue
+		}
+		if matchTopics(query.Topics, entry.Topics) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched, nil
+}
+
+func (self *Mock) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("the mock doesn't support subscriptions")
+}
+
+//check and mine the transaction the way a node would, a failing contract reverts it but still charges its gas
+func (self *Mock) SendTransaction(ctx context.Context, transaction *types.Transaction) error {
+	var signer types.Signer = types.HomesteadSigner{}
+	if transaction.Protected() {
+		signer = types.LatestSignerForChainID(self.ChainId)
+	}
+	from, err := types.Sender(signer, transaction)
+	if err != nil {
+		return err
+	}
+	if transaction.To() == nil {
+		return errors.New("the mock can't deploy contracts")
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, known := self.txs[transaction.Hash()]; known {
+		return errors.New("already known")
+	}
+	switch nonce := self.Nonces[from]; {
+	case transaction.Nonce() < nonce:
+		return errors.New("nonce too low")
+	case transaction.Nonce() > nonce:
+		return errors.New("nonce too high")
+	}
+	price := transaction.GasPrice()
+	if self.BaseFee != nil {
+		if transaction.GasFeeCap().Cmp(self.BaseFee) < 0 {
+			return errors.New("max fee per gas less than block base fee")
+		}
+		price = new(big.Int).Add(self.BaseFee, transaction.GasTipCap())
+		if price.Cmp(transaction.GasFeeCap()) > 0 {
+			price = transaction.GasFeeCap()
+		}
+	}
+	balance := self.Balances[from]
+	if balance == nil {
+		balance = new(big.Int)
+	}
+	cost := new(big.Int).Mul(transaction.GasFeeCap(), new(big.Int).SetUint64(transaction.Gas()))
+	if balance.Cmp(cost.Add(cost, transaction.Value())) < 0 {
+		return errors.New("insufficient funds for gas * price + value")
+	}
+	contract := self.Contracts[*transaction.To()]
+	gasUsed := params.TxGas
+	if contract != nil {
+		gasUsed = mockCallGas
+	}
+	if transaction.Gas() < params.TxGas {
+		return errors.New("intrinsic gas too low")
+	}
+	if gasUsed > transaction.Gas() {
+		gasUsed = transaction.Gas()
+	}
+
+	status := types.ReceiptStatusSuccessful
+	if contract != nil {
+		if gasUsed < mockCallGas {
+			status = types.ReceiptStatusFailed //out of gas
+		} else if _, err := contract(from, transaction.Data(), true); err != nil {
+			status = types.ReceiptStatusFailed
+		}
+	}
+	balance = new(big.Int).Sub(balance, new(big.Int).Mul(price, new(big.Int).SetUint64(gasUsed)))
+	if status == types.ReceiptStatusSuccessful {
+		balance.Sub(balance, transaction.Value())
+		received := self.Balances[*transaction.To()]
+		if received == nil {
+			received = new(big.Int)
+		}
+		self.Balances[*transaction.To()] = received.Add(received, transaction.Value())
+	}
+	self.Balances[from] = balance
+	self.Nonces[from]++
+
+	block := self.mine([]*types.Transaction{transaction})
+	if self.txs == nil {
+		self.txs, self.receipts = make(map[common.Hash]*types.Transaction), make(map[common.Hash]*types.Receipt)
+	}
+	self.txs[transaction.Hash()] = transaction
+	self.receipts[transaction.Hash()] = &types.Receipt{Type: transaction.Type(), Status: status, CumulativeGasUsed: gasUsed, GasUsed: gasUsed, TxHash: transaction.Hash(), BlockHash: block.Hash(), BlockNumber: block.Number()}
+	return nil
+}
+
+func (self *Mock) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if transaction, ok := self.txs[hash]; ok {
+		return transaction, false, nil
+	}
+	return nil, false, ethereum.NotFound
+}
+
+func (self *Mock) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if receipt, ok := self.receipts[hash]; ok {
+		return receipt, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func containsAddress(addresses []common.Address, address common.Address) bool {
+	for _, candidate := range addresses {
+		if candidate == address {
+			return true
+		}
+	}
+	return false
+}
+
+//a log matches when every position of the filter is empty (anything) or lists the log's topic at that position
+func matchTopics(filter [][]common.Hash, topics []common.Hash) bool {
+	for i, allowed := range filter {
+		if len(allowed) == 0 {
+			continue
+		}
+		if i >= len(topics) {
+			return false
+		}
+		found := false
+		for _, topic := range allowed {
+			found = found || topic == topics[i]
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
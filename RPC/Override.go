@@ -0,0 +1,50 @@
+package RPC
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/params"
+	"math/big"
+	"walletMigrate/Accounts"
+)
+
+//the balance an account without ETH is given for its estimates, far beyond what any transfer costs
+var fundedBalance = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))
+
+//the state override of one account, only its balance is replaced
+type overrideAccount struct {
+	Balance *hexutil.Big `json:"balance"`
+}
+
+//the eth_estimateGas call object, ethclient has no wrapper that takes a state override
+func callArgs(msg ethereum.CallMsg) map[string]interface{} {
+	args := map[string]interface{}{"from": msg.From, "to": msg.To}
+	if len(msg.Data) > 0 {
+		args["data"] = hexutil.Bytes(msg.Data)
+	}
+	if msg.Value != nil {
+		args["value"] = (*hexutil.Big)(msg.Value)
+	}
+	if msg.Gas != 0 {
+		args["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	return args
+}
+
+//estimate the gas of a transfer out of the account.  An account without ETH is estimated as if it held fundedBalance
+//with a state override (geth 1.13+, erigon, nethermind and most providers), nodes that price the estimate refuse one
+//for a sender that can't pay for it, which left the planner guessing its transfers' gas.  Nodes without overrides and
+//Arbitrum, whose estimate goes through its NodeInterface, are asked for a plain estimate
+func (self Client) estimateTransferGas(account Accounts.Account, msg ethereum.CallMsg) (uint64, error) {
+	if account.Balance != nil && account.Balance.Sign() == 0 && !isArbitrum(account.ChainId) {
+		var gas hexutil.Uint64
+		err := self.rpc.CallContext(context.Background(), &gas, "eth_estimateGas", callArgs(msg), "latest", map[common.Address]overrideAccount{msg.From: {Balance: (*hexutil.Big)(fundedBalance)}})
+		self.logf(VerbosityDebug, "rpc eth_estimateGas (funded %s): %s gas: %d err: %v\n", msg.From.Hex(), msg.To.Hex(), gas, err)
+		if err == nil {
+			return uint64(gas), nil
+		}
+	}
+	return self.estimateGas(account.ChainId, msg)
+}
@@ -0,0 +1,69 @@
+package RPC
+
+import (
+	"bytes"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+)
+
+//a transfer to a source address that is waiting in the pending pool
+type IncomingTransfer struct {
+	To    common.Address
+	From  common.Address
+	Hash  common.Hash
+	Value *big.Int        //wei, or token units when Token is set
+	Token *common.Address //nil for ETH
+}
+
+var (
+	transferSelector     = []byte{0xa9, 0x05, 0x9c, 0xbb} //transfer(address,uint256)
+	transferFromSelector = []byte{0x23, 0xb8, 0x72, 0xdd} //transferFrom(address,address,uint256)
+)
+
+//GetPendingIncoming looks through the node's pending block for ETH and token transfers to the addresses, only
+//transfers made directly by a transaction are seen, not ones made inside another contract call
+func (self Client) GetPendingIncoming(addresses map[common.Address]bool) ([]IncomingTransfer, error) {
+	chainID, err := self.GetChainID()
+	if err != nil {
+		return nil, err
+	}
+	//-1 asks the node for the pending block
+	block, err := self.client.BlockByNumber(context.Background(), big.NewInt(-1))
+	if err != nil {
+		return nil, err
+	}
+	self.logf(VerbosityDebug, "rpc eth_getBlockByNumber(pending): %d transactions\n", len(block.Transactions()))
+	signer := types.LatestSignerForChainID(chainID)
+
+	var incoming []IncomingTransfer
+	for _, tx := range block.Transactions() {
+		if tx.To() == nil {
+			continue
+		}
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			continue
+		}
+		if addresses[*tx.To()] && tx.Value().Sign() > 0 {
+			incoming = append(incoming, IncomingTransfer{To: *tx.To(), From: from, Hash: tx.Hash(), Value: tx.Value()})
+		}
+		if to, value, ok := tokenRecipient(tx.Data()); ok && addresses[to] {
+			token := *tx.To()
+			incoming = append(incoming, IncomingTransfer{To: to, From: from, Hash: tx.Hash(), Value: value, Token: &token})
+		}
+	}
+	return incoming, nil
+}
+
+//the recipient and amount of a transfer or transferFrom call, erc-721 transferFrom has the same layout with a token id
+func tokenRecipient(data []byte) (common.Address, *big.Int, bool) {
+	switch {
+	case len(data) == 68 && bytes.Equal(data[:4], transferSelector):
+		return common.BytesToAddress(data[4:36]), new(big.Int).SetBytes(data[36:68]), true
+	case len(data) == 100 && bytes.Equal(data[:4], transferFromSelector):
+		return common.BytesToAddress(data[36:68]), new(big.Int).SetBytes(data[68:100]), true
+	}
+	return common.Address{}, nil, false
+}
@@ -0,0 +1,77 @@
+package RPC
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/params"
+	"math"
+	"math/big"
+	"net/http"
+	"time"
+	"walletMigrate/Errors"
+)
+
+//gas stations of the chains that run one, by chain id
+var gasStations = map[int64]string{
+	137:   "https://gasstation.polygon.technology/v2",
+	80002: "https://gasstation.polygon.technology/amoy",
+}
+
+//validators on these chains drop transactions tipping less than this, whatever eth_gasPrice says
+var minimumTips = map[int64]int64{
+	137:   30 * params.GWei,
+	80002: 25 * params.GWei,
+}
+
+//GetGasStationPrice reads the fast max fee (base fee plus tip) from the chain's gas station
+func (self Client) GetGasStationPrice() (*big.Int, error) {
+	chainID, err := self.GetChainID()
+	if err != nil {
+		return nil, err
+	}
+	station, found := gasStations[chainID.Int64()]
+	if !chainID.IsInt64() || !found {
+		return nil, fmt.Errorf("no gas station is known on chain %s", chainID)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.Get(station)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gas station %s returned %s", station, response.Status)
+	}
+	var prices struct {
+		Fast struct {
+			MaxFee float64 `json:"maxFee"` //gwei
+		} `json:"fast"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&prices); err != nil {
+		return nil, fmt.Errorf("gas station %s: %v", station, err)
+	}
+	if prices.Fast.MaxFee <= 0 || math.IsInf(prices.Fast.MaxFee, 0) {
+		return nil, fmt.Errorf("gas station %s returned no fast price", station)
+	}
+	price, _ := new(big.Float).Mul(big.NewFloat(prices.Fast.MaxFee), big.NewFloat(params.GWei)).Int(nil)
+	self.logf(VerbosityDebug, "gas station %s: fast max fee %v gwei\n", station, prices.Fast.MaxFee)
+	return price, nil
+}
+
+//MinimumGasPrice is the lowest gas price the chain's validators accept, the latest base fee plus the chain's minimum
+//tip, 0 where no minimum tip is known
+func (self Client) MinimumGasPrice() *big.Int {
+	chainID, err := self.GetChainID()
+	if err != nil || !chainID.IsInt64() || minimumTips[chainID.Int64()] == 0 {
+		return new(big.Int)
+	}
+	minimum := big.NewInt(minimumTips[chainID.Int64()])
+	header, err := self.client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		Errors.Log(Errors.RPCError, "C12", err)
+	} else if header.BaseFee != nil {
+		minimum.Add(minimum, header.BaseFee)
+	}
+	return minimum
+}
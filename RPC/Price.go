@@ -0,0 +1,74 @@
+package RPC
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+)
+
+//the Chainlink ETH/USD aggregator on mainnet, its answer has 8 decimals
+var ethUsdFeed = common.HexToAddress("0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419")
+
+const ethUsdFeedDecimals = 8
+
+//GetEthUsdPrice reads the latest ETH price in USD from the Chainlink feed, only mainnet has a known feed
+func (self Client) GetEthUsdPrice() (*big.Rat, error) {
+	chainID, err := self.GetChainID()
+	if err != nil {
+		return nil, err
+	}
+	if chainID.Cmp(big.NewInt(1)) != 0 {
+		return nil, fmt.Errorf("no ETH/USD price feed is known on chain %s", chainID)
+	}
+	result, err := self.call(ethUsdFeed, pack(extensionsABI, "latestRoundData"))
+	if err != nil {
+		return nil, err
+	}
+	values, err := extensionsABI.Unpack("latestRoundData", result)
+	if err != nil {
+		return nil, err
+	}
+	answer := values[1].(*big.Int)
+	if answer.Sign() <= 0 {
+		return nil, errors.New("the ETH/USD price feed returned no price")
+	}
+	return new(big.Rat).SetFrac(answer, new(big.Int).Exp(big.NewInt(10), big.NewInt(ethUsdFeedDecimals), nil)), nil
+}
+
+//Chainlink's Feed Registry on mainnet looks up the price feed of a token by its address
+var (
+	feedRegistry    = common.HexToAddress("0x47Fb2585D2C56Fe188D0E6ec628a38b74fCeeeDf")
+	usdDenomination = common.HexToAddress("0x0000000000000000000000000000000000000348")
+	feedRegistryABI = parseABI(`[
+	{"type":"function","name":"decimals","inputs":[{"name":"base","type":"address"},{"name":"quote","type":"address"}],"outputs":[{"name":"","type":"uint8"}]},
+	{"type":"function","name":"latestRoundData","inputs":[{"name":"base","type":"address"},{"name":"quote","type":"address"}],"outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}]}
+]`)
+)
+
+//GetTokenUsdPrice reads the USD price of one whole token from the Feed Registry, only tokens with a Chainlink feed on
+//mainnet have a price (the caller checks the chain)
+func (self Client) GetTokenUsdPrice(token common.Address) (*big.Rat, error) {
+	result, err := self.call(feedRegistry, pack(feedRegistryABI, "decimals", token, usdDenomination))
+	if err != nil {
+		return nil, fmt.Errorf("no USD price feed for %s: %v", token.Hex(), err)
+	}
+	values, err := feedRegistryABI.Unpack("decimals", result)
+	if err != nil {
+		return nil, err
+	}
+	decimals := values[0].(uint8)
+	result, err = self.call(feedRegistry, pack(feedRegistryABI, "latestRoundData", token, usdDenomination))
+	if err != nil {
+		return nil, err
+	}
+	values, err = feedRegistryABI.Unpack("latestRoundData", result)
+	if err != nil {
+		return nil, err
+	}
+	answer := values[1].(*big.Int)
+	if answer.Sign() <= 0 {
+		return nil, fmt.Errorf("the USD price feed of %s returned no price", token.Hex())
+	}
+	return new(big.Rat).SetFrac(answer, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)), nil
+}
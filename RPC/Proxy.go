@@ -0,0 +1,61 @@
+package RPC
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"sort"
+	"walletMigrate/Accounts"
+)
+
+//storage slots upgradeable proxies keep their implementation address in
+var implementationSlots = []common.Hash{
+	common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"), //EIP-1967 keccak256("eip1967.proxy.implementation") - 1
+	common.HexToHash("0x7050c9e0f4ca769c69bd3a8ef740bc37934f8e2c036e5a723fd8ee048ed3f8c3"), //OpenZeppelin (zos) keccak256("org.zeppelinos.proxy.implementation")
+}
+
+//the contract a token's code really lives in, the implementation for a proxy or the token itself
+func (self Client) canonicalContract(token common.Address) common.Address {
+	for _, slot := range implementationSlots {
+		value, err := self.client.StorageAt(context.Background(), token, slot, nil)
+		self.logf(VerbosityDebug, "rpc eth_getStorageAt: %s %s %x err: %v\n", token.Hex(), slot.Hex(), value, err)
+		if err != nil || len(value) != 32 {
+			continue
+		}
+		if implementation := common.BytesToAddress(value); implementation != (common.Address{}) {
+			return implementation
+		}
+	}
+	return token
+}
+
+//drop tokens that are another address of the same token (a proxy and the implementation it points to, or two proxies
+//of one implementation) so a balance isn't planned for transfer twice, requiring the same symbol, decimals and balance
+//keeps distinct tokens that merely share an implementation, the proxy address is kept since that's the one meant to be used
+func (self Client) dedupeProxies(account common.Address, tokens map[string]Accounts.Token) map[string]Accounts.Token {
+	addresses := make([]string, 0, len(tokens))
+	for address := range tokens {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	kept := make(map[string]string) //canonical token key to the address kept for it
+	canonical := make(map[string]common.Address)
+	for _, address := range addresses {
+		token := tokens[address]
+		canonical[address] = self.canonicalContract(token.Contract)
+		key := fmt.Sprintf("%s|%s|%d|%s", canonical[address].Hex(), token.Symbol, token.Decimals, token.Balance)
+		previous, found := kept[key]
+		if !found {
+			kept[key] = address
+			continue
+		}
+		drop := address
+		if canonical[previous] == tokens[previous].Contract && canonical[address] != token.Contract {
+			kept[key], drop = address, previous //prefer the proxy over the implementation it points to
+		}
+		self.logf(VerbosityVerbose, "Skipped: %s, Token Address: %s, same token as %s\n", account.String(), tokens[drop].Contract.String(), tokens[kept[key]].Contract.String())
+		delete(tokens, drop)
+	}
+	return tokens
+}
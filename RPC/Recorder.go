@@ -0,0 +1,248 @@
+package RPC
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"walletMigrate/Encryption"
+)
+
+//Recording holds the node's answer to every json-rpc request of a run so the run can be replayed without the node.
+//Only requests and answers are kept: addresses, balances, contract calls and blocks, never keys
+type Recording struct {
+	Calls []*recordedCall `json:"calls"`
+
+	path   string
+	lock   sync.Mutex
+	index  map[string]*recordedCall
+	served map[string]int
+}
+
+//the answers to one method and parameters in the order the node gave them, a balance or receipt that changed during
+//the run is answered the same way when replayed
+type recordedCall struct {
+	Method  string            `json:"method"`
+	Params  json.RawMessage   `json:"params"`
+	Answers []json.RawMessage `json:"answers"` //the response without its id, a result or an error
+}
+
+//one request or response of a json-rpc body
+type jsonrpcMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+//NewRecording starts an empty recording that Save writes to path
+func NewRecording(path string) *Recording {
+	return &Recording{path: path, index: make(map[string]*recordedCall), served: make(map[string]int)}
+}
+
+//LoadRecording reads a recording written by Save for replaying
+func LoadRecording(path string) (*Recording, error) {
+	data, err := Encryption.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	recording := NewRecording(path)
+	if err := json.Unmarshal(data, recording); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, call := range recording.Calls {
+		recording.index[callKey(call.Method, call.Params)] = call
+	}
+	return recording, nil
+}
+
+//Save writes every request recorded so far to the recording's file
+func (self *Recording) Save() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	data, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		return err
+	}
+	return Encryption.WriteFile(self.path, data, 0600)
+}
+
+//requests without parameters are saved with null ones
+func callKey(method string, params json.RawMessage) string {
+	if len(params) == 0 {
+		params = json.RawMessage("null")
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, params) != nil {
+		return method + " " + string(params)
+	}
+	return method + " " + compact.String()
+}
+
+//a body holds a single message or a batch of them
+func parseMessages(body []byte) ([]jsonrpcMessage, bool, error) {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []jsonrpcMessage
+		err := json.Unmarshal(trimmed, &batch)
+		return batch, true, err
+	}
+	var message jsonrpcMessage
+	err := json.Unmarshal(body, &message)
+	return []jsonrpcMessage{message}, false, err
+}
+
+//keep the answers of a request body, matched to their requests by id
+func (self *Recording) add(request []byte, response []byte) {
+	requests, _, err := parseMessages(request)
+	if err != nil {
+		return
+	}
+	var answers []map[string]json.RawMessage
+	if trimmed := bytes.TrimSpace(response); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &answers)
+	} else {
+		var answer map[string]json.RawMessage
+		err = json.Unmarshal(response, &answer)
+		answers = append(answers, answer)
+	}
+	if err != nil {
+		return
+	}
+	byID := make(map[string]map[string]json.RawMessage)
+	for _, answer := range answers {
+		byID[string(answer["id"])] = answer
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, message := range requests {
+		answer, found := byID[string(message.ID)]
+		if !found {
+			continue
+		}
+		delete(answer, "id")
+		data, err := json.Marshal(answer)
+		if err != nil {
+			continue
+		}
+		key := callKey(message.Method, message.Params)
+		call, known := self.index[key]
+		if !known {
+			call = &recordedCall{Method: message.Method, Params: message.Params}
+			self.index[key] = call
+			self.Calls = append(self.Calls, call)
+		}
+		call.Answers = append(call.Answers, data)
+	}
+}
+
+//the next answer to the request, the last one is repeated once they are used up
+func (self *Recording) answer(message jsonrpcMessage) map[string]json.RawMessage {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	answer := make(map[string]json.RawMessage)
+	key := callKey(message.Method, message.Params)
+	call, found := self.index[key]
+	if found && len(call.Answers) > 0 {
+		next := self.served[key]
+		if next >= len(call.Answers) {
+			next = len(call.Answers) - 1
+		}
+		self.served[key]++
+		if json.Unmarshal(call.Answers[next], &answer) == nil {
+			answer["id"] = message.ID
+			return answer
+		}
+	}
+	missing, _ := json.Marshal(map[string]interface{}{"code": -32000, "message": fmt.Sprintf("%s %s is not in the recording", message.Method, message.Params)})
+	answer["jsonrpc"], answer["id"], answer["error"] = json.RawMessage(`"2.0"`), message.ID, missing
+	return answer
+}
+
+//recorder passes requests on to the node and keeps its answers
+type recorder struct {
+	next      http.RoundTripper
+	recording *Recording
+}
+
+func (self recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	response, err := self.next.RoundTrip(request)
+	if err != nil || response.StatusCode != http.StatusOK {
+		return response, err
+	}
+	answer, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(answer))
+	self.recording.add(body, answer)
+	return response, nil
+}
+
+//replayer answers every request from the recording, nothing reaches a network
+type replayer struct {
+	recording *Recording
+}
+
+func (self replayer) RoundTrip(request *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	messages, batch, err := parseMessages(body)
+	if err != nil {
+		return nil, err
+	}
+	var answers []map[string]json.RawMessage
+	for _, message := range messages {
+		answers = append(answers, self.recording.answer(message))
+	}
+	var data []byte
+	if batch {
+		data, err = json.Marshal(answers)
+	} else {
+		data, err = json.Marshal(answers[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1, Header: http.Header{"Content-Type": []string{"application/json"}}, Body: ioutil.NopCloser(bytes.NewReader(data)), ContentLength: int64(len(data)), Request: request}, nil
+}
+
+//NewRecordingClient connects to the node like NewClient and keeps every request and answer in the recording, only
+//http nodes can be recorded
+func NewRecordingClient(rpcURL string, recording *Recording) (Client, error) {
+	if !strings.HasPrefix(rpcURL, "http://") && !strings.HasPrefix(rpcURL, "https://") {
+		return Client{}, fmt.Errorf("only http node urls can be recorded, %s isn't one", rpcURL)
+	}
+	rpcClient, err := rpc.DialHTTPWithClient(rpcURL, &http.Client{Transport: recorder{next: http.DefaultTransport, recording: recording}})
+	if err != nil {
+		return Client{}, err
+	}
+	return newRPCClient(rpcClient), nil
+}
+
+//NewReplayClient answers every request from the recording instead of a node, a request that wasn't recorded fails
+func NewReplayClient(recording *Recording) Client {
+	rpcClient, err := rpc.DialHTTPWithClient("http://replay.invalid", &http.Client{Transport: replayer{recording: recording}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return newRPCClient(rpcClient)
+}
@@ -0,0 +1,126 @@
+package RPC
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"walletMigrate/Accounts"
+)
+
+//the storage slots searched for a token's balance mapping when seeding a simulated chain
+const balanceSlotSearch = 20
+
+//Simulated is a local chain (go-ethereum's simulated backend) that mines every transaction as soon as it is sent,
+//nothing it does reaches a real network
+type Simulated struct {
+	*backends.SimulatedBackend
+}
+
+//NewSimulated starts a simulated chain holding the accounts of alloc
+func NewSimulated(alloc core.GenesisAlloc) *Simulated {
+	return &Simulated{SimulatedBackend: backends.NewSimulatedBackend(alloc, 30000000)}
+}
+
+func (self *Simulated) ChainID(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(self.Blockchain().Config().ChainID), nil
+}
+
+func (self *Simulated) BlockNumber(ctx context.Context) (uint64, error) {
+	return self.Blockchain().CurrentBlock().NumberU64(), nil
+}
+
+func (self *Simulated) PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	return self.BalanceAt(ctx, account, nil)
+}
+
+//send and mine the transaction in a block of its own
+func (self *Simulated) SendTransaction(ctx context.Context, transaction *types.Transaction) error {
+	err := self.SimulatedBackend.SendTransaction(ctx, transaction)
+	if err == nil {
+		self.Commit()
+	}
+	return err
+}
+
+//mine empty blocks until the base fee is at most the gas price, the simulated chain starts at 1 gwei which is more
+//than cheap chains pay.  Returns false when it can't get there
+func (self *Simulated) LowerBaseFee(gasPrice *big.Int) bool {
+	for i := 0; i < 1000; i++ {
+		baseFee := self.Blockchain().CurrentBlock().BaseFee()
+		if baseFee == nil || baseFee.Cmp(gasPrice) <= 0 {
+			return true
+		}
+		self.Commit()
+	}
+	return false
+}
+
+//SimulatedAlloc seeds a simulated chain with the balances and nonces found by the scan.  The code of every token
+//(and the implementation behind an upgradeable proxy) is copied from the node with the balance of each holder, found by
+//searching the first storage slots for the mapping holding it.  Returns the tokens whose balances couldn't be found,
+//their transfers revert on the simulated chain
+func (self Client) SimulatedAlloc(accounts []Accounts.Account) (core.GenesisAlloc, []common.Address) {
+	alloc := make(core.GenesisAlloc)
+	var unseeded []common.Address
+	copied := make(map[common.Address]bool)
+	for _, account := range accounts {
+		alloc[account.Address] = core.GenesisAccount{Balance: new(big.Int).Set(account.Balance), Nonce: account.Nonce}
+		for _, token := range account.Tokens {
+			if token.Unsupported != "" {
+				continue
+			}
+			if !copied[token.Contract] {
+				copied[token.Contract] = true
+				self.copyContract(alloc, token.Contract)
+			}
+			key, ok := self.balanceKey(token.Contract, account.Address, token.Balance)
+			if !ok {
+				unseeded = append(unseeded, token.Contract)
+				continue
+			}
+			alloc[token.Contract].Storage[key] = common.BigToHash(token.Balance)
+		}
+	}
+	return alloc, unseeded
+}
+
+//copy the code of a contract and of the implementation it points to, keeping the proxy's implementation slot
+func (self Client) copyContract(alloc core.GenesisAlloc, contract common.Address) {
+	code, err := self.client.CodeAt(context.Background(), contract, nil)
+	self.logf(VerbosityDebug, "rpc eth_getCode: %s %d bytes err: %v\n", contract.Hex(), len(code), err)
+	storage := make(map[common.Hash]common.Hash)
+	implementation := self.canonicalContract(contract)
+	if implementation != contract {
+		for _, slot := range implementationSlots {
+			value, err := self.client.StorageAt(context.Background(), contract, slot, nil)
+			if err == nil && len(value) == 32 {
+				storage[slot] = common.BytesToHash(value)
+			}
+		}
+		implementationCode, err := self.client.CodeAt(context.Background(), implementation, nil)
+		self.logf(VerbosityDebug, "rpc eth_getCode: %s %d bytes err: %v\n", implementation.Hex(), len(implementationCode), err)
+		alloc[implementation] = core.GenesisAccount{Balance: new(big.Int), Code: implementationCode}
+	}
+	alloc[contract] = core.GenesisAccount{Balance: new(big.Int), Code: code, Storage: storage}
+}
+
+//find the storage key of the holder's balance in the token's balance mapping, laid out by solidity
+//(keccak256(holder . slot)) or vyper (keccak256(slot . holder))
+func (self Client) balanceKey(token common.Address, holder common.Address, balance *big.Int) (common.Hash, bool) {
+	want := common.BigToHash(balance)
+	for slot := int64(0); slot < balanceSlotSearch; slot++ {
+		position := common.BigToHash(big.NewInt(slot))
+		padded := common.BytesToHash(holder.Bytes())
+		for _, key := range []common.Hash{crypto.Keccak256Hash(padded.Bytes(), position.Bytes()), crypto.Keccak256Hash(position.Bytes(), padded.Bytes())} {
+			value, err := self.client.StorageAt(context.Background(), token, key, nil)
+			if err == nil && common.BytesToHash(value) == want {
+				return key, true
+			}
+		}
+	}
+	return common.Hash{}, false
+}
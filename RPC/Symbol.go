@@ -0,0 +1,33 @@
+package RPC
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"unicode/utf8"
+)
+
+//get the token symbol, falling back to the bytes32 return type of tokens deployed before string returns were
+//settled on (MKR, SAI and others) since the generated binding can only decode a string
+func (self Client) getSymbol(contract common.Address, tokenInstance *Token) (string, error) {
+	symbol, err := tokenInstance.Symbol(&bind.CallOpts{})
+	if err == nil {
+		return symbol, nil
+	}
+	result, callErr := self.call(contract, pack(extensionsABI, "symbol"))
+	if callErr != nil || len(result) != 32 {
+		return "", err
+	}
+	self.logf(VerbosityDebug, "symbol(): %s decoded as bytes32\n", contract.Hex())
+	return bytes32String(result)
+}
+
+//decode a right zero padded bytes32 string
+func bytes32String(data []byte) (string, error) {
+	text := bytes.TrimRight(data, "\x00")
+	if len(text) == 0 || bytes.IndexByte(text, 0) != -1 || !utf8.Valid(text) {
+		return "", fmt.Errorf("bytes32 %x is not a string", data)
+	}
+	return string(text), nil
+}
@@ -0,0 +1,76 @@
+package RPC
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+	"sort"
+)
+
+//a transaction of a source address waiting in the node's pool
+type PoolTransaction struct {
+	From   common.Address
+	Hash   common.Hash
+	Nonce  uint64
+	To     *common.Address
+	Value  *big.Int
+	Cost   *big.Int //value plus the most it can pay for gas
+	Queued bool     //behind a nonce gap, it can't be mined until the gap is filled
+	TipCap *big.Int //tip per gas, both caps are the gas price of a legacy transaction
+	FeeCap *big.Int //most it pays per gas
+}
+
+//the fields of a txpool transaction that are needed, fee caps are missing from legacy transactions
+type poolEntry struct {
+	Hash                 common.Hash     `json:"hash"`
+	Nonce                hexutil.Uint64  `json:"nonce"`
+	To                   *common.Address `json:"to"`
+	Value                *hexutil.Big    `json:"value"`
+	Gas                  hexutil.Uint64  `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+}
+
+//GetPoolTransactions lists the pool transactions of the address with txpool_contentFrom (geth, erigon, nethermind and
+//some providers), the pending ones in nonce order first
+func (self Client) GetPoolTransactions(address common.Address) ([]PoolTransaction, error) {
+	var content map[string]map[string]poolEntry
+	err := self.rpc.CallContext(context.Background(), &content, "txpool_contentFrom", address)
+	self.logf(VerbosityDebug, "rpc txpool_contentFrom: %s pending: %d queued: %d err: %v\n", address.Hex(), len(content["pending"]), len(content["queued"]), err)
+	if err != nil {
+		return nil, err
+	}
+	var transactions []PoolTransaction
+	for _, pool := range []string{"pending", "queued"} {
+		var entries []PoolTransaction
+		for _, entry := range content[pool] {
+			price := entry.MaxFeePerGas
+			if price == nil {
+				price = entry.GasPrice
+			}
+			tip := entry.MaxPriorityFeePerGas
+			if tip == nil {
+				tip = entry.GasPrice
+			}
+			cost, feeCap, tipCap := new(big.Int), new(big.Int), new(big.Int)
+			if price != nil {
+				feeCap.Set(price.ToInt())
+				cost.Mul(feeCap, new(big.Int).SetUint64(uint64(entry.Gas)))
+			}
+			if tip != nil {
+				tipCap.Set(tip.ToInt())
+			}
+			value := new(big.Int)
+			if entry.Value != nil {
+				value = entry.Value.ToInt()
+			}
+			cost.Add(cost, value)
+			entries = append(entries, PoolTransaction{From: address, Hash: entry.Hash, Nonce: uint64(entry.Nonce), To: entry.To, Value: value, Cost: cost, Queued: pool == "queued", TipCap: tipCap, FeeCap: feeCap})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Nonce < entries[j].Nonce })
+		transactions = append(transactions, entries...)
+	}
+	return transactions, nil
+}
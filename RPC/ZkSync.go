@@ -0,0 +1,20 @@
+package RPC
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+)
+
+//zkSync Era accepts ordinary legacy and EIP-1559 transactions from accounts with the same keys and addresses, but charges
+//the published data as gas so even a plain ETH transfer needs more than 21000, unused gas is refunded after the transaction
+
+//zkSync Era mainnet and Sepolia
+var zkSyncChains = map[int64]bool{324: true, 300: true}
+
+//the system contract holding ETH balances, it emits ERC-20 Transfer events for every ETH transfer but ETH is swept as
+//the balance and not as a token
+var zkSyncBaseToken = common.HexToAddress("0x000000000000000000000000000000000000800A")
+
+func isZkSync(chainID *big.Int) bool {
+	return chainID != nil && chainID.IsInt64() && zkSyncChains[chainID.Int64()]
+}
@@ -0,0 +1,269 @@
+package Redaction
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"fmt"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/tyler-smith/go-bip39/wordlists"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//what secrets are replaced with
+const (
+	keyMask      = "[REDACTED KEY]"
+	mnemonicMask = "[REDACTED MNEMONIC]"
+)
+
+//the shortest run of seed phrase words that is taken for a seed phrase, the shortest BIP-39 phrase has 12 words
+const mnemonicWords = 12
+
+var (
+	lock    sync.RWMutex
+	secrets = make(map[string]bool) //lowercase hex keys and decimal key scalars
+	phrases []string                //registered seed phrases and passphrases, whatever their words
+	lists   = make(map[string]bool) //keys as the space separated bytes %v prints for a []byte, without the brackets
+
+	hexRun     = regexp.MustCompile(`[0-9a-fA-F]{64,}`)
+	decimalRun = regexp.MustCompile(`[0-9]{60,}`)
+	byteRun    = regexp.MustCompile(`\b[0-9]{1,3}(?: [0-9]{1,3}){15,}\b`)
+	word       = regexp.MustCompile(`[a-zA-Z]+`)
+	english    = make(map[string]bool)
+
+	//a serialized extended private key, base58 of 82 bytes, masked whether it was registered or not
+	extendedPrivate = regexp.MustCompile(`\b[xt]prv[1-9A-HJ-NP-Za-km-z]{107}\b`)
+)
+
+func init() {
+	for _, entry := range wordlists.English {
+		english[entry] = true
+	}
+}
+
+//Secret registers values that must never be printed: private keys in hex, seed phrases, passphrases.  Every
+//non-empty value is registered however short, a short passphrase is masked wherever it appears
+func Secret(values ...string) {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		hex := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X"))
+		switch {
+		case value == "":
+		case len(hex) == 64 && hexRun.MatchString(hex):
+			secrets[hex] = true
+		case !contains(phrases, value):
+			phrases = append(phrases, value)
+		}
+	}
+	//the longest first, a short phrase inside a longer one mustn't leave the rest of the longer one printed
+	sort.SliceStable(phrases, func(i, j int) bool { return len(phrases[i]) > len(phrases[j]) })
+}
+
+func contains(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+//Key registers a private key as hex, as the decimal scalar %v prints for an ecdsa.PrivateKey and as the byte list %v
+//prints for its bytes, both padded to 32 bytes (crypto.FromECDSA) and unpadded (an hdkeychain key)
+func Key(key *ecdsa.PrivateKey) {
+	if key == nil || key.D == nil {
+		return
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	secrets[fmt.Sprintf("%064x", key.D)] = true
+	secrets[key.D.String()] = true
+	padded := make([]byte, 32)
+	key.D.FillBytes(padded)
+	for _, bytes := range [][]byte{padded, key.D.Bytes()} {
+		lists[strings.Trim(fmt.Sprint(bytes), "[]")] = true
+	}
+}
+
+//ExtendedKey registers the private key of an extended key, a public one has nothing to hide
+func ExtendedKey(key *hdkeychain.ExtendedKey) {
+	if key == nil || !key.IsPrivate() {
+		return
+	}
+	private, err := key.ECPrivKey()
+	if err != nil {
+		return
+	}
+	Key(private.ToECDSA())
+}
+
+//String replaces every registered secret in text, and any run of 12 or more BIP-39 words or extended private key
+//whether it was registered or not, so a seed phrase never reaches the output even when it was never configured
+func String(text string) string {
+	lock.RLock()
+	defer lock.RUnlock()
+	for _, phrase := range phrases {
+		if strings.Contains(text, phrase) {
+			text = strings.ReplaceAll(text, phrase, mnemonicMask)
+		}
+	}
+	if len(secrets) > 0 {
+		text = hexRun.ReplaceAllStringFunc(text, maskHex)
+		text = decimalRun.ReplaceAllStringFunc(text, func(run string) string {
+			if secrets[run] {
+				return keyMask
+			}
+			return run
+		})
+		text = byteRun.ReplaceAllStringFunc(text, maskList)
+	}
+	text = extendedPrivate.ReplaceAllString(text, keyMask)
+	return maskMnemonics(text)
+}
+
+//a key's bytes can sit anywhere in a longer byte list (an ExtendedKey printed with %v), a match must start and end on
+//whole numbers
+func maskList(run string) string {
+	masked := " " + run + " "
+	for list := range lists {
+		masked = strings.ReplaceAll(masked, " "+list+" ", " "+keyMask+" ")
+	}
+	return masked[1 : len(masked)-1]
+}
+
+//a key can sit anywhere in a longer run of hex (calldata, a raw dump), every 64 character window is checked
+func maskHex(run string) string {
+	lower := strings.ToLower(run)
+	var masked strings.Builder
+	last := 0
+	for i := 0; i+64 <= len(lower); i++ {
+		if i >= last && secrets[lower[i:i+64]] {
+			masked.WriteString(run[last:i])
+			masked.WriteString(keyMask)
+			last = i + 64
+		}
+	}
+	if last == 0 {
+		return run
+	}
+	masked.WriteString(run[last:])
+	return masked.String()
+}
+
+//replace runs of seed phrase words separated only by spaces
+func maskMnemonics(text string) string {
+	words := word.FindAllStringIndex(text, -1)
+	var masked strings.Builder
+	last := 0
+	for start := 0; start < len(words); {
+		end := start
+		for end < len(words) && english[strings.ToLower(text[words[end][0]:words[end][1]])] && (end == start || strings.TrimSpace(text[words[end-1][1]:words[end][0]]) == "") {
+			end++
+		}
+		if end-start >= mnemonicWords {
+			masked.WriteString(text[last:words[start][0]])
+			masked.WriteString(mnemonicMask)
+			last = words[end-1][1]
+		}
+		if end == start {
+			end++
+		}
+		start = end
+	}
+	if last == 0 {
+		return text
+	}
+	masked.WriteString(text[last:])
+	return masked.String()
+}
+
+//Writer redacts everything written to out
+func Writer(out io.Writer) io.Writer {
+	return redactingWriter{out: out}
+}
+
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (self redactingWriter) Write(data []byte) (int, error) {
+	if _, err := io.WriteString(self.out, String(string(data))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+//marks the point Flush waits for, it can't be printed by anything else
+const flushMarker = "\x00redaction-flush\x00\n"
+
+//a redirected standard stream, redacted a line at a time so a secret split across writes is still caught
+type stream struct {
+	lock        sync.Mutex
+	writer      *os.File
+	destination *os.File //the original stream
+	flushed     chan bool
+}
+
+var streams []*stream
+
+//Install redirects stdout, stderr and the log through the redaction so nothing printed anywhere in the program can
+//reveal a registered secret.  Call Flush before exiting, output still in the pipes is lost otherwise
+func Install() error {
+	for _, file := range []**os.File{&os.Stdout, &os.Stderr} {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		redirected := &stream{writer: writer, destination: *file, flushed: make(chan bool)}
+		go redirected.copy(reader)
+		streams = append(streams, redirected)
+		*file = writer
+	}
+	//log.Fatal exits right after writing, the pipes are flushed before its message is written straight out
+	log.SetOutput(flushingWriter{out: Writer(streams[1].destination)})
+	return nil
+}
+
+func (self *stream) copy(reader *os.File) {
+	out := self.destination
+	lines := bufio.NewReader(reader)
+	for {
+		line, err := lines.ReadString('\n')
+		if strings.HasSuffix(line, flushMarker) {
+			io.WriteString(out, String(strings.TrimSuffix(line, flushMarker)))
+			self.flushed <- true
+			continue
+		}
+		io.WriteString(out, String(line))
+		if err != nil {
+			return
+		}
+	}
+}
+
+//Flush waits until everything written to stdout and stderr so far has been printed
+func Flush() {
+	for _, redirected := range streams {
+		redirected.lock.Lock()
+		if _, err := io.WriteString(redirected.writer, flushMarker); err == nil {
+			<-redirected.flushed
+		}
+		redirected.lock.Unlock()
+	}
+}
+
+type flushingWriter struct {
+	out io.Writer
+}
+
+func (self flushingWriter) Write(data []byte) (int, error) {
+	Flush()
+	return self.out.Write(data)
+}
@@ -0,0 +1,149 @@
+package Redaction_test
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+	"strings"
+	"testing"
+	"walletMigrate/Accounts"
+	"walletMigrate/Redaction"
+)
+
+//every form of the key that must not survive the redaction
+func keyForms(key *ecdsa.PrivateKey) []string {
+	padded := crypto.FromECDSA(key)
+	return []string{fmt.Sprintf("%x", padded), key.D.String(), strings.Trim(fmt.Sprint(padded), "[]"), strings.Trim(fmt.Sprint(key.D.Bytes()), "[]")}
+}
+
+func checkRedacted(t *testing.T, name string, printed string, forms []string) {
+	t.Helper()
+	redacted := Redaction.String(printed)
+	for _, form := range forms {
+		if strings.Contains(strings.ToLower(redacted), strings.ToLower(form)) {
+			t.Errorf("%s: %q survived the redaction of %q", name, form, redacted)
+		}
+	}
+}
+
+func TestAccountAndPrivateKey(t *testing.T) {
+	generated, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//a key with a leading zero byte, hdkeychain and big.Int drop it where crypto.FromECDSA keeps it
+	for _, hex := range []string{fmt.Sprintf("%x", crypto.FromECDSA(generated)), "00" + strings.Repeat("7e", 31)} {
+		account, err := Accounts.FromPrivateKey(hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := account.PrivateKey
+		forms := keyForms(key)
+		printed := map[string]string{
+			"%v account":          fmt.Sprintf("%v", account),
+			"%+v account":         fmt.Sprintf("%+v", account),
+			"%v key":              fmt.Sprintf("%v", key),
+			"%+v key":             fmt.Sprintf("%+v", *key),
+			"%x bytes":            fmt.Sprintf("%x", crypto.FromECDSA(key)),
+			"%X bytes":            fmt.Sprintf("%X", crypto.FromECDSA(key)),
+			"%v bytes":            fmt.Sprint(crypto.FromECDSA(key)),
+			"%d unpadded bytes":   fmt.Sprintf("%d", key.D.Bytes()),
+			"%v bytes in a list":  fmt.Sprint(append([]byte{1, 2, 3}, crypto.FromECDSA(key)...)),
+			"%v key in a message": fmt.Sprintf("signing with %v failed", key.D),
+		}
+		for name, text := range printed {
+			checkRedacted(t, name, text, forms)
+		}
+	}
+}
+
+func TestByteListsOfOtherValues(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Redaction.Key(key)
+	//only the whole list matches, one that differs in a single byte is printed as it is
+	changed := crypto.FromECDSA(key)
+	changed[0]++
+	changed[31]++
+	for _, list := range [][]byte{changed, []byte("an ordinary byte slice printed as numbers")} {
+		if printed := fmt.Sprint(list); Redaction.String(printed) != printed {
+			t.Errorf("%q was changed to %q", printed, Redaction.String(printed))
+		}
+	}
+}
+
+func TestExtendedKey(t *testing.T) {
+	entropy, err := bip39.NewEntropy(128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phrase, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := []uint32{hdkeychain.HardenedKeyStart + 44, hdkeychain.HardenedKeyStart + 60, hdkeychain.HardenedKeyStart, 0, 0}
+	if _, err := Accounts.DeriveAccount(phrase, "m/44'/60'/0'/0/0"); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := hdkeychain.NewMaster(bip39.NewSeed(phrase, ""), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for depth := 0; depth <= len(path); depth++ {
+		if depth > 0 {
+			if key, err = key.Child(path[depth-1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		private, err := key.ECPrivKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		forms := append(keyForms(private.ToECDSA()), key.String())
+		printed := map[string]string{
+			"%v":         fmt.Sprintf("%v", key),
+			"%s":         fmt.Sprintf("%s", key),
+			"%+v":        fmt.Sprintf("%+v", *key),
+			"%v value":   fmt.Sprintf("%v", *key),
+			"%x private": fmt.Sprintf("%x", private.Serialize()),
+		}
+		for name, text := range printed {
+			checkRedacted(t, fmt.Sprintf("depth %d %s", depth, name), text, forms)
+		}
+	}
+}
+
+func TestUnregisteredExtendedPrivateKey(t *testing.T) {
+	seed := make([]byte, 32)
+	key, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := key.Neuter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := fmt.Sprintf("keys %v and %v", key, public)
+	redacted := Redaction.String(text)
+	if strings.Contains(redacted, key.String()) {
+		t.Errorf("the xprv survived: %q", redacted)
+	}
+	if !strings.Contains(redacted, public.String()) {
+		t.Errorf("the xpub was redacted: %q", redacted)
+	}
+}
+
+func TestShortPassphrase(t *testing.T) {
+	Redaction.Secret("pw7", "pw7 and more")
+	for _, text := range []string{"passphrase pw7 failed", "phrase: pw7 and more words"} {
+		if redacted := Redaction.String(text); strings.Contains(redacted, "pw7") || strings.Contains(redacted, "and more") {
+			t.Errorf("%q was redacted to %q", text, redacted)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package State
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"os"
+	"strings"
+	"time"
+	"walletMigrate/Encryption"
+)
+
+//transaction statuses recorded in the state file
+const (
+	StatusSent     = "sent"     //broadcast but not yet confirmed
+	StatusFailed   = "failed"   //the node rejected the broadcast
+	StatusMined    = "mined"    //mined successfully
+	StatusReverted = "reverted" //mined but reverted
+	StatusDropped  = "dropped"  //no longer known to the node and never mined
+	StatusReplaced = "replaced" //never mined, another transaction took its nonce
+	StatusPending  = "pending"  //waiting in the node's pool, only shown by the status command
+)
+
+//Transaction is a transaction broadcast by a (possibly earlier) run
+type Transaction struct {
+	Phase    string    `json:"phase"` //gas, token, balance or clear
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Nonce    uint64    `json:"nonce"`
+	Value    string    `json:"value"`
+	TxHash   string    `json:"tx_hash"`
+	RawTx    string    `json:"raw_tx"`
+	Status   string    `json:"status"`
+	Sent     time.Time `json:"sent"`
+	Replaces string    `json:"replaces,omitempty"` //the hash of the transaction this one was sent to replace
+}
+
+//State is persisted between runs so a re-run can tell what previous runs already did
+type State struct {
+	Destination  string            `json:"destination"`
+	Routes       map[string]string `json:"routes,omitempty"`      //the destination each source account was rotated to
+	HopIndexes   map[string]uint32 `json:"hop_indexes,omitempty"` //the address index of each source account's intermediate hops
+	Transactions []Transaction     `json:"transactions"`
+	path         string
+}
+
+//Load the state file at path, a missing file is an empty state
+func Load(path string) (*State, error) {
+	state := &State{path: path, Transactions: make([]Transaction, 0)}
+	data, err := Encryption.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+//Detach stops saving the state, a rehearsal reads what previous runs recorded but must not add its own transactions
+func (self *State) Detach() {
+	self.path = ""
+}
+
+func (self *State) Save() error {
+	if self.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		return err
+	}
+	//write then rename so an interrupted save never leaves a truncated state file behind
+	err = Encryption.WriteFile(self.path+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(self.path+".tmp", self.path)
+}
+
+//Record a broadcast transaction, sendErr marks it as failed
+func (self *State) Record(phase string, from common.Address, transaction *types.Transaction, sendErr error) {
+	raw, _ := transaction.MarshalBinary()
+	entry := Transaction{Phase: phase, From: from.Hex(), To: transaction.To().Hex(), Nonce: transaction.Nonce(), Value: transaction.Value().String(), TxHash: transaction.Hash().Hex(), RawTx: "0x" + hex.EncodeToString(raw), Status: StatusSent, Sent: time.Now().UTC()}
+	if sendErr != nil {
+		entry.Status = StatusFailed
+	}
+	self.Transactions = append(self.Transactions, entry)
+}
+
+//Route returns the destination a previous run rotated the account to
+func (self *State) Route(from common.Address) (common.Address, bool) {
+	to, found := self.Routes[from.Hex()]
+	return common.HexToAddress(to), found
+}
+
+func (self *State) SetRoute(from common.Address, to common.Address) {
+	if self.Routes == nil {
+		self.Routes = make(map[string]string)
+	}
+	self.Routes[from.Hex()] = to.Hex()
+}
+
+//HopIndex returns the address index a previous run gave the account's intermediate hops
+func (self *State) HopIndex(from common.Address) (uint32, bool) {
+	index, found := self.HopIndexes[from.Hex()]
+	return index, found
+}
+
+func (self *State) SetHopIndex(from common.Address, index uint32) {
+	if self.HopIndexes == nil {
+		self.HopIndexes = make(map[string]uint32)
+	}
+	self.HopIndexes[from.Hex()] = index
+}
+
+//SetStatus updates the status of every recorded transaction with the hash
+func (self *State) SetStatus(hash common.Hash, status string) {
+	for i := range self.Transactions {
+		if strings.EqualFold(self.Transactions[i].TxHash, hash.Hex()) {
+			self.Transactions[i].Status = status
+		}
+	}
+}
+
+//SetReplaces marks the transaction with the hash as the replacement of the original one
+func (self *State) SetReplaces(hash common.Hash, original common.Hash) {
+	for i := range self.Transactions {
+		if strings.EqualFold(self.Transactions[i].TxHash, hash.Hex()) {
+			self.Transactions[i].Replaces = original.Hex()
+		}
+	}
+}
+
+//Replacements returns the transactions linked to the hash by replaces, in either direction and through chains of
+//replacements.  When the transaction itself was never mined one of them may have taken its nonce
+func (self *State) Replacements(hash common.Hash) []Transaction {
+	linked := map[string]bool{strings.ToLower(hash.Hex()): true}
+	for added := true; added; {
+		added = false
+		for _, transaction := range self.Transactions {
+			txHash, replaces := strings.ToLower(transaction.TxHash), strings.ToLower(transaction.Replaces)
+			if replaces == "" || linked[txHash] == linked[replaces] {
+				continue
+			}
+			linked[txHash], linked[replaces], added = true, true, true
+		}
+	}
+	var replacements []Transaction
+	seen := map[string]bool{strings.ToLower(hash.Hex()): true}
+	for _, transaction := range self.Transactions {
+		txHash := strings.ToLower(transaction.TxHash)
+		if linked[txHash] && !seen[txHash] {
+			seen[txHash] = true
+			replacements = append(replacements, transaction)
+		}
+	}
+	return replacements
+}
+
+//Latest returns the last transaction recorded for the nonce of the address that may still be mined, the one a
+//replacement has to outbid
+func (self *State) Latest(from common.Address, nonce uint64) (Transaction, bool) {
+	for i := len(self.Transactions) - 1; i >= 0; i-- {
+		transaction := self.Transactions[i]
+		if transaction.Nonce == nonce && strings.EqualFold(transaction.From, from.Hex()) && transaction.Status == StatusSent {
+			return transaction, true
+		}
+	}
+	return Transaction{}, false
+}
+
+//Settle marks every other transaction sent with the nonce of the mined one as replaced, only one transaction per nonce
+//is ever mined so the rest lost to it
+func (self *State) Settle(from common.Address, nonce uint64, winner common.Hash) {
+	for i := range self.Transactions {
+		transaction := &self.Transactions[i]
+		if transaction.Nonce != nonce || !strings.EqualFold(transaction.From, from.Hex()) || strings.EqualFold(transaction.TxHash, winner.Hex()) {
+			continue
+		}
+		if transaction.Status == StatusSent || transaction.Status == StatusDropped {
+			transaction.Status = StatusReplaced
+		}
+	}
+}
+
+//Pending returns the transactions that were broadcast but have not been confirmed or dropped yet
+func (self *State) Pending() []Transaction {
+	pending := make([]Transaction, 0)
+	for _, transaction := range self.Transactions {
+		if transaction.Status == StatusSent {
+			pending = append(pending, transaction)
+		}
+	}
+	return pending
+}
+
+//Emptied returns the accounts whose final balance sweep was mined
+func (self *State) Emptied() map[common.Address]bool {
+	emptied := make(map[common.Address]bool)
+	for _, transaction := range self.Transactions {
+		if transaction.Phase == "balance" && transaction.Status == StatusMined {
+			emptied[common.HexToAddress(transaction.From)] = true
+		}
+	}
+	return emptied
+}
+
+//Decode the signed transaction that was broadcast
+func (self Transaction) Decode() (*types.Transaction, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(self.RawTx, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	transaction := new(types.Transaction)
+	err = transaction.UnmarshalBinary(raw)
+	return transaction, err
+}
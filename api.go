@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	grpcStatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"walletMigrate/API"
+	"walletMigrate/Plan"
+)
+
+//go:generate protoc -I API --go_out=API --go_opt=paths=source_relative --go-grpc_out=API --go-grpc_opt=paths=source_relative walletmigrate.proto
+
+//where the grpc command listens and its jobs are kept unless the api settings say otherwise
+const (
+	defaultGRPCListen = "127.0.0.1:8646"
+	defaultJobsDir    = "jobs"
+)
+
+//apiSettings let other programs drive migrations through the grpc and serve commands, and people through the
+//dashboard command
+type apiSettings struct {
+	Listen          string `json:"listen"`           //address the serve command listens on (default 127.0.0.1:8647)
+	GRPCListen      string `json:"grpc_listen"`      //address the grpc command listens on (default 127.0.0.1:8646)
+	DashboardListen string `json:"dashboard_listen"` //loopback address the dashboard command serves its page on (default 127.0.0.1:8648)
+	Token           string `json:"token"`            //bearer token every request must carry
+	TLSCert         string `json:"tls_cert"`         //certificate and key the api is served over tls with
+	TLSKey          string `json:"tls_key"`
+	JobsDir         string `json:"jobs_dir"` //where each job keeps its plan and status file (default jobs)
+}
+
+func (self apiSettings) validate(field string) []error {
+	var errs []error
+	if (self.Listen != "" || self.GRPCListen != "") && len(self.Token) < 16 {
+		errs = append(errs, fmt.Errorf("%s.token of at least 16 characters is required", field))
+	}
+	if (self.TLSCert == "") != (self.TLSKey == "") {
+		errs = append(errs, fmt.Errorf("%s.tls_cert and %s.tls_key are required together", field, field))
+	}
+	if self.Listen != "" {
+		if err := validateListen(field+".listen", self.Listen, self.TLSCert != "", field); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if self.GRPCListen != "" {
+		if err := validateListen(field+".grpc_listen", self.GRPCListen, self.TLSCert != "", field); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if self.DashboardListen != "" {
+		//the dashboard's token is in the url it prints, it is only ever served to this machine
+		if host, _, err := net.SplitHostPort(self.DashboardListen); err != nil {
+			errs = append(errs, fmt.Errorf("%s.dashboard_listen %q is not a host:port address", field, self.DashboardListen))
+		} else if !loopback(host) {
+			errs = append(errs, fmt.Errorf("%s.dashboard_listen %s must be a loopback address, the dashboard is only served to this machine", field, self.DashboardListen))
+		}
+	}
+	return errs
+}
+
+//a server only listens beyond the loopback interface over tls, its token would be sent in the clear otherwise
+func validateListen(field string, listen string, tls bool, tlsField string) error {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("%s %q is not a host:port address", field, listen)
+	}
+	if !loopback(host) && !tls {
+		return fmt.Errorf("%s %s is reachable from other hosts, set %s.tls_cert and %s.tls_key", field, listen, tlsField, tlsField)
+	}
+	return nil
+}
+
+//migrationService drives migrations for the api: a scan is a simulated run that writes a plan, which can be fetched,
+//approved and executed, and every job's output can be followed as it runs
+type migrationService struct {
+	API.UnimplementedMigrationServer
+	in   settings
+	jobs *jobQueue
+}
+
+func (self *migrationService) StartScan(ctx context.Context, request *API.ScanRequest) (*API.Job, error) {
+	chain, err := self.in.jobChain(request.Chain)
+	if err != nil {
+		return nil, grpcStatus.Error(codes.InvalidArgument, err.Error())
+	}
+	if request.Assets != "" {
+		if errs := validateAssets(strings.Split(request.Assets, ",")); len(errs) > 0 {
+			return nil, grpcStatus.Error(codes.InvalidArgument, errs[0].Error())
+		}
+	}
+	started, err := self.jobs.scan(chain, request.Assets)
+	if err != nil {
+		return nil, grpcStatus.Error(codes.Internal, err.Error())
+	}
+	return started.message(), nil
+}
+
+//the plan of a finished scan
+func (self *migrationService) scanPlan(id string) (job, *Plan.Plan, error) {
+	scan, found := self.jobs.get(id)
+	switch {
+	case !found:
+		return job{}, nil, grpcStatus.Errorf(codes.NotFound, "there is no job %s", id)
+	case scan.Command != "migrate":
+		return job{}, nil, grpcStatus.Errorf(codes.InvalidArgument, "job %s is not a scan", id)
+	case scan.State != jobFinished:
+		return job{}, nil, grpcStatus.Errorf(codes.FailedPrecondition, "scan %s is still %s", id, scan.State)
+	}
+	plan, err := Plan.Read(scan.Plan)
+	if err != nil {
+		return job{}, nil, grpcStatus.Errorf(codes.FailedPrecondition, "scan %s has no plan (exit code %d): %v", id, scan.ExitCode, err)
+	}
+	return scan, plan, nil
+}
+
+func (self *migrationService) GetPlan(ctx context.Context, request *API.JobRequest) (*API.PlanReply, error) {
+	_, plan, err := self.scanPlan(request.JobId)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return nil, grpcStatus.Error(codes.Internal, err.Error())
+	}
+	return &API.PlanReply{Hash: plan.Hash, Plan: data}, nil
+}
+
+//keep an approval signed by one of the approvers next to the scan's plan, see Approving a Plan
+func (self *migrationService) ApprovePlan(ctx context.Context, request *API.ApproveRequest) (*API.Approval, error) {
+	if len(self.in.Approvers) == 0 {
+		return nil, grpcStatus.Error(codes.FailedPrecondition, "no approvers are set, plans are executed without an approval")
+	}
+	if request.Approval == nil {
+		return nil, grpcStatus.Error(codes.InvalidArgument, "the approval is missing")
+	}
+	scan, plan, err := self.scanPlan(request.JobId)
+	if err != nil {
+		return nil, err
+	}
+	approval := Plan.Approval{PlanHash: request.Approval.PlanHash, Approver: request.Approval.Approver, Signature: request.Approval.Signature}
+	if _, err := approval.Verify(plan, self.in.approvers()); err != nil {
+		return nil, grpcStatus.Error(codes.PermissionDenied, err.Error())
+	}
+	if err := Plan.WriteApproval(scan.Plan, &approval); err != nil {
+		return nil, grpcStatus.Error(codes.Internal, err.Error())
+	}
+	return request.Approval, nil
+}
+
+func (self *migrationService) Execute(ctx context.Context, request *API.JobRequest) (*API.Job, error) {
+	scan, plan, err := self.scanPlan(request.JobId)
+	if err != nil {
+		return nil, err
+	}
+	if len(self.in.Approvers) > 0 {
+		if _, err := Plan.VerifyApproval(scan.Plan, plan, self.in.approvers()); err != nil {
+			return nil, grpcStatus.Error(codes.FailedPrecondition, err.Error())
+		}
+	}
+	started, err := self.jobs.followUp("execute", request.JobId)
+	if err != nil {
+		return nil, grpcStatus.Error(codes.FailedPrecondition, err.Error())
+	}
+	return started.message(), nil
+}
+
+//everything the job printed so far and from then on as it prints it, the last message has the finished job
+func (self *migrationService) StreamProgress(request *API.JobRequest, stream API.Migration_StreamProgressServer) error {
+	if _, found := self.jobs.get(request.JobId); !found {
+		return grpcStatus.Errorf(codes.NotFound, "there is no job %s", request.JobId)
+	}
+	return self.jobs.follow(request.JobId, 0, stream.Context().Done(), func(line string, current job) error {
+		return stream.Send(&API.Progress{Job: current.message(), Line: line})
+	})
+}
+
+//the job as the api answers it
+func (self job) message() *API.Job {
+	message := &API.Job{
+		Id:       self.ID,
+		Command:  self.Command,
+		Chain:    self.Chain,
+		Assets:   self.Assets,
+		Simulate: self.Simulate,
+		Plan:     self.Plan,
+		Previous: self.Previous,
+		State:    self.State,
+		ExitCode: int32(self.ExitCode),
+		Created:  timestamppb.New(self.Created),
+	}
+	if self.Finished != nil {
+		message.Finished = timestamppb.New(*self.Finished)
+	}
+	return message
+}
+
+//every request must carry the token as its bearer token
+func (self *migrationService) authorize(ctx context.Context) error {
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range incoming.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte("Bearer "+self.in.API.Token)) == 1 {
+			return nil
+		}
+	}
+	return grpcStatus.Error(codes.Unauthenticated, "a valid bearer token is required")
+}
+
+//the chain a job runs on, the only one of the settings unless one is named
+func (self settings) jobChain(name string) (string, error) {
+	switch {
+	case len(self.Chains) == 0 && name != "":
+		return "", fmt.Errorf("chain %s was given but the settings have no chains", name)
+	case len(self.Chains) == 0:
+		return "", nil
+	case name == "" && len(self.Chains) == 1:
+		for only := range self.Chains {
+			return only, nil
+		}
+	case name == "":
+		return "", fmt.Errorf("the settings have several chains, name the one to scan")
+	}
+	if _, found := self.Chains[name]; !found {
+		return "", fmt.Errorf("chain %s is not one of the configured chains", name)
+	}
+	return name, nil
+}
+
+func (self settings) approvers() []common.Address {
+	var approvers []common.Address
+	for _, approver := range self.Approvers {
+		approvers = append(approvers, common.HexToAddress(approver))
+	}
+	return approvers
+}
+
+//the grpc command: serve the api until interrupted, running its jobs with the settings and overrides the server was
+//started with
+func serveGRPC(in settings, settingsArg string, overrides []string, status *runStatus) int {
+	if len(in.API.Token) < 16 {
+		status.abort(fmt.Errorf("the grpc command needs an api.token of at least 16 characters"))
+	}
+	listen, dir := in.API.GRPCListen, in.API.JobsDir
+	if listen == "" {
+		listen = defaultGRPCListen
+	}
+	if dir == "" {
+		dir = defaultJobsDir
+	}
+	jobs, err := newJobQueue(settingsArg, overrides, dir)
+	if err != nil {
+		status.abort(err)
+	}
+	defer jobs.unlock()
+	service := &migrationService{in: in, jobs: jobs}
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handle grpc.UnaryHandler) (interface{}, error) {
+			if err := service.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handle(ctx, request)
+		}),
+		grpc.StreamInterceptor(func(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handle grpc.StreamHandler) error {
+			if err := service.authorize(stream.Context()); err != nil {
+				return err
+			}
+			return handle(server, stream)
+		}),
+	}
+	scheme := "http"
+	if in.API.TLSCert != "" {
+		tls, err := credentials.NewServerTLSFromFile(in.API.TLSCert, in.API.TLSKey)
+		if err != nil {
+			status.abort(err)
+		}
+		options, scheme = append(options, grpc.Creds(tls)), "https"
+	}
+	server := grpc.NewServer(options...)
+	API.RegisterMigrationServer(server, service)
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		status.abort(err)
+	}
+	stopped := make(chan os.Signal, 1)
+	signal.Notify(stopped, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stopped
+		server.Stop()
+	}()
+	fmt.Printf("Serving the walletmigrate.Migration grpc api at %s://%s, jobs are kept in %s, interrupt to stop\n", scheme, listen, dir)
+	if err := server.Serve(listener); err != nil {
+		status.abort(err)
+	}
+	return exitCompleted
+}
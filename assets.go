@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//asset classes the assets setting can select, all of them are migrated when it's empty
+var assetClasses = []string{"eth", "tokens", "nfts"}
+
+func validateAssets(assets []string) []error {
+	var errs []error
+	for i, asset := range assets {
+		if !contains(assetClasses, asset) {
+			errs = append(errs, fmt.Errorf("assets[%d] %q is not supported, expected one of %s", i, asset, strings.Join(assetClasses, ", ")))
+		}
+	}
+	return errs
+}
+
+func (self settings) migrates(asset string) bool {
+	return len(self.Assets) == 0 || contains(self.Assets, asset)
+}
+
+//drop the tokens and collectibles of classes that aren't migrated this run along with the gas reserved to move them,
+//accounts left with nothing to move are dropped too unless their ETH is swept
+func (self settings) selectAssets(accounts []Accounts.Account) []Accounts.Account {
+	if len(self.Assets) == 0 {
+		return accounts
+	}
+	selected := make([]Accounts.Account, 0, len(accounts))
+	for _, account := range accounts {
+		tokens := make([]Accounts.Token, 0, len(account.Tokens))
+		for _, token := range account.Tokens {
+			class := "tokens"
+			if token.TokenID != nil {
+				class = "nfts"
+			}
+			if self.migrates(class) {
+				tokens = append(tokens, token)
+				continue
+			}
+			display.logf(RPC.VerbosityVerbose, "Skipping: %s %s, %s aren't selected by assets\n", account.Address.Hex(), token.Symbol, class)
+			account.TotalAssetTransfer = new(big.Int).Sub(account.TotalAssetTransfer, new(big.Int).SetUint64(token.GasLimit))
+		}
+		account.Tokens = tokens
+		if len(account.Tokens) == 0 && !self.migrates("eth") {
+			continue
+		}
+		selected = append(selected, account)
+	}
+	return selected
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"walletMigrate/Accounts"
+	"walletMigrate/Audit"
+	"walletMigrate/Errors"
+	"walletMigrate/RPC"
+	"walletMigrate/State"
+)
+
+const defaultStateFile = "migration_state.json"
+
+//how long a phase's transactions are awaited, the ones still unmined after it are left as sent for the next run to check
+const awaitTimeout = 30 * time.Minute
+
+//broadcaster holds everything needed to send transactions and keep a record of them
+type broadcaster struct {
+	client      RPC.Client
+	audit       *Audit.Log
+	state       *State.State
+	simulate    bool
+	chain       chainProfile
+	chainID     *big.Int //reported by the node, every transaction must be signed for it
+	privacy     privacySettings
+	schedule    scheduleSettings
+	throttle    *throttle
+	repricer    *repricer
+	maxInFlight int //transactions of one account in the pool at once, 0 sends and awaits each phase as a whole
+}
+
+func (self broadcaster) saveState() {
+	err := self.state.Save()
+	if err != nil {
+		Errors.Log(Errors.FileError, "M7", err)
+	}
+}
+
+//record the final outcome of the transactions in the state file and audit log
+func (self broadcaster) recordReceipts(transactions []RPC.TransactionWithOriginator, receipts map[common.Hash]*types.Receipt) {
+	reverted, unmined := 0, 0
+	for _, transaction := range transactions {
+		receipt := receipts[transaction.SignedTx.Hash()]
+		switch {
+		case receipt == nil:
+			unmined++
+			//leave it as sent (or failed), the next run checks it again before planning
+		case receipt.Status == types.ReceiptStatusFailed:
+			self.state.SetStatus(transaction.SignedTx.Hash(), State.StatusReverted)
+			self.state.Settle(transaction.Address, transaction.SignedTx.Nonce(), transaction.SignedTx.Hash())
+			Errors.Record(Errors.RevertedTx, "M15", fmt.Errorf("%s nonce %d reverted in %s", transaction.Address.Hex(), transaction.SignedTx.Nonce(), transaction.SignedTx.Hash().Hex()))
+			reverted++
+		default:
+			self.state.SetStatus(transaction.SignedTx.Hash(), State.StatusMined)
+			self.state.Settle(transaction.Address, transaction.SignedTx.Nonce(), transaction.SignedTx.Hash())
+			self.repricer.observe(transaction.SignedTx, receipt)
+		}
+		err := self.audit.Receipt(transaction.Address, transaction.SignedTx, receipt)
+		if err != nil {
+			Errors.Log(Errors.FileError, "M5", err)
+		}
+	}
+	self.saveState()
+	if reverted > 0 {
+		desktop.notify("walletMigrate transactions reverted", "%d of %d transactions reverted%s", reverted, len(transactions), onChain(self.chain))
+		mailer.alert("walletMigrate transactions reverted", "%d of %d transactions reverted%s, see the run's output", reverted, len(transactions), onChain(self.chain))
+		oncall.page("reverted", true, "%d of %d migration transactions reverted%s", reverted, len(transactions), onChain(self.chain))
+	}
+	if unmined > 0 {
+		oncall.page("unmined", false, "%d of %d migration transactions were not mined%s", unmined, len(transactions), onChain(self.chain))
+	}
+}
+
+//await the transactions until each one is mined or its nonce was taken.  A transaction that was never mined is swapped in
+//place for the replacement (or the original it replaced, see the state file's replaces) that took its nonce, so the
+//receipts read afterwards are those of what was actually mined
+func (self broadcaster) await(transactions []RPC.TransactionWithOriginator) {
+	if unsettled := self.client.AwaitTransactions(transactions, awaitTimeout); len(unsettled) > 0 {
+		fmt.Println(display.paint(colorRed, fmt.Sprintf("WARNING: %d transactions were still unmined after %s, they are left as sent and checked again by the next run", len(unsettled), awaitTimeout)))
+	}
+	receipts := self.client.GetReceipts(transactions)
+	for i, transaction := range transactions {
+		if receipts[transaction.SignedTx.Hash()] != nil {
+			continue
+		}
+		for _, recorded := range self.state.Replacements(transaction.SignedTx.Hash()) {
+			if receipt, _ := self.client.GetTransactionStatus(common.HexToHash(recorded.TxHash)); receipt == nil {
+				continue
+			}
+			signedTx, err := recorded.Decode()
+			if err != nil {
+				Errors.Log(Errors.FileError, "M8", err)
+				continue
+			}
+			display.logf(RPC.VerbosityNormal, "Replaced: %s nonce %d was mined as %s in place of %s\n", transaction.Address.Hex(), signedTx.Nonce(), signedTx.Hash().Hex(), transaction.SignedTx.Hash().Hex())
+			transactions[i].SignedTx = signedTx
+			break
+		}
+	}
+}
+
+//the number of transactions that reverted or have no receipt, transactions that failed to send are never mined so
+//the receipts give the complete count of failures
+func countFailed(executed []RPC.TransactionWithOriginator, receipts map[common.Hash]*types.Receipt) int {
+	failed := 0
+	for _, transaction := range executed {
+		if receipt := receipts[transaction.SignedTx.Hash()]; receipt == nil || receipt.Status == types.ReceiptStatusFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+//check the transactions a previous run left unconfirmed, when running live any that are still pending
+//are awaited so the balances used for planning include them and nothing is sent twice
+func (self broadcaster) settlePrevious(destinationAddress common.Address) {
+	if self.state.Destination != "" && !strings.EqualFold(self.state.Destination, destinationAddress.Hex()) {
+		fmt.Printf("WARNING: the state file was written for destination %s, this run sends to %s\n", self.state.Destination, destinationAddress.Hex())
+	}
+	if !self.simulate {
+		self.state.Destination = destinationAddress.Hex()
+	}
+
+	previous := self.state.Pending()
+	if len(previous) == 0 {
+		return
+	}
+	display.logf(RPC.VerbosityNormal, "Checking %d unconfirmed transactions from a previous run\n", len(previous))
+
+	//a replaced transaction is never mined, once the nonce is known to be taken it is marked replaced instead of dropped
+	var mined []State.Transaction
+	var waiting []RPC.TransactionWithOriginator
+	for _, transaction := range previous {
+		receipt, pending := self.client.GetTransactionStatus(common.HexToHash(transaction.TxHash))
+		switch {
+		case receipt != nil && receipt.Status == types.ReceiptStatusFailed:
+			self.state.SetStatus(common.HexToHash(transaction.TxHash), State.StatusReverted)
+			mined = append(mined, transaction)
+		case receipt != nil:
+			self.state.SetStatus(common.HexToHash(transaction.TxHash), State.StatusMined)
+			mined = append(mined, transaction)
+		case pending:
+			signedTx, err := transaction.Decode()
+			if err != nil {
+				Errors.Log(Errors.FileError, "M8", err)
+				continue
+			}
+			waiting = append(waiting, RPC.TransactionWithOriginator{Address: common.HexToAddress(transaction.From), SignedTx: signedTx})
+		default:
+			self.state.SetStatus(common.HexToHash(transaction.TxHash), State.StatusDropped)
+		}
+	}
+	for _, transaction := range mined {
+		self.state.Settle(common.HexToAddress(transaction.From), transaction.Nonce, common.HexToHash(transaction.TxHash))
+	}
+
+	if len(waiting) > 0 {
+		if self.simulate {
+			fmt.Printf("WARNING: %d transactions from a previous run are still pending, the plan below does not include them\n", len(waiting))
+			return
+		}
+		display.logf(RPC.VerbosityNormal, "Waiting for %d pending transactions from a previous run\n", len(waiting))
+		stop := oncall.watch("%d transactions of a previous run%s", len(waiting), onChain(self.chain))
+		self.await(waiting)
+		stop()
+		receipts := self.client.GetReceipts(waiting)
+		for _, transaction := range waiting {
+			receipt := receipts[transaction.SignedTx.Hash()]
+			if receipt == nil {
+				continue
+			}
+			if receipt.Status == types.ReceiptStatusFailed {
+				self.state.SetStatus(transaction.SignedTx.Hash(), State.StatusReverted)
+			} else {
+				self.state.SetStatus(transaction.SignedTx.Hash(), State.StatusMined)
+			}
+			self.state.Settle(transaction.Address, transaction.SignedTx.Nonce(), transaction.SignedTx.Hash())
+		}
+	}
+	if !self.simulate {
+		self.saveState()
+	}
+}
+
+//report accounts a previous run already emptied, the scan leaves them out unless they have received something new since
+func reportEmptied(scanned []Accounts.Account, state *State.State) {
+	emptied := state.Emptied()
+	for _, account := range scanned {
+		if emptied[account.Address] {
+			display.logf(RPC.VerbosityNormal, "Account %s was emptied by a previous run but holds new assets, sweeping it again\n", account.Address.Hex())
+			delete(emptied, account.Address)
+		}
+	}
+	var skipped []string
+	for address := range emptied {
+		skipped = append(skipped, address.Hex())
+	}
+	sort.Strings(skipped)
+	for _, address := range skipped {
+		display.logf(RPC.VerbosityVerbose, "Skipping: %s, already emptied by a previous run\n", address)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+//chainlistEntry is one chain of the chains.json published by chainlist.org and ethereum-lists/chains
+type chainlistEntry struct {
+	ShortName      string   `json:"shortName"`
+	ChainID        int64    `json:"chainId"`
+	RPC            []string `json:"rpc"`
+	NativeCurrency struct {
+		Symbol   string `json:"symbol"`
+		Decimals int    `json:"decimals"`
+	} `json:"nativeCurrency"`
+	Explorers []struct {
+		URL string `json:"url"`
+	} `json:"explorers"`
+}
+
+//merge the chains of a chainlist file over the built-in registry, the file is either chainlist.org's chains.json
+//array or a map of names to chain presets written like the chains setting, a preset is validated along with the chains
+//that use it
+func loadChainlist(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	presets := make(map[string]chainProfile)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var entries []chainlistEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		for _, entry := range entries {
+			if entry.ShortName == "" {
+				continue
+			}
+			presets[strings.ToLower(entry.ShortName)] = entry.preset()
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&presets); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	for name, preset := range presets {
+		if preset.Chain != "" {
+			return fmt.Errorf("%s: %s can't set chain, presets don't inherit from each other", path, name)
+		}
+		chainRegistry[name] = preset
+	}
+	return nil
+}
+
+func (self chainlistEntry) preset() chainProfile {
+	preset := chainProfile{ChainID: self.ChainID, Symbol: self.NativeCurrency.Symbol, Decimals: self.NativeCurrency.Decimals}
+	//the first public node, entries needing an api key have it as a ${...} template
+	for _, url := range self.RPC {
+		if (strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "wss://")) && !strings.Contains(url, "${") {
+			preset.NodeURL = url
+			break
+		}
+	}
+	if len(self.Explorers) > 0 {
+		preset.Explorer = strings.TrimSuffix(self.Explorers[0].URL, "/") + "/tx/{hash}"
+	}
+	return preset
+}
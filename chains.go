@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"walletMigrate/Accounts"
+)
+
+//chainProfile is one named entry of the chains setting
+type chainProfile struct {
+	NodeURL       string            `json:"node_url"`       //rpc url of a node on this chain
+	ChainID       int64             `json:"chain_id"`       //the run stops if the node is on a different chain (0 skips the check)
+	Fee           feeSettings       `json:"fee"`            //overrides the top level fee settings on this chain
+	Explorer      string            `json:"explorer"`       //prefix for transaction links e.g. https://etherscan.io/tx/ or a template with {hash}
+	BroadcastURLs []string          `json:"broadcast_urls"` //more nodes or public broadcast services each raw transaction is also sent to
+	BeaconURL     string            `json:"beacon_url"`     //beacon node checked for validators withdrawing to the source addresses
+	Nonces        map[string]uint64 `json:"nonces"`         //starting nonce of these addresses on this chain
+	Homestead     bool              `json:"homestead"`      //sign without a chain id for old chains that reject EIP-155 signatures
+	Chain         string            `json:"chain"`          //registry preset the unset fields are taken from (default: the entry's name if it is one)
+	Symbol        string            `json:"symbol"`         //native currency symbol
+	Decimals      int               `json:"decimals"`       //native currency decimals (default 18)
+	Multicall     string            `json:"multicall"`      //multicall contract address
+	name          string
+}
+
+//the chains this run should migrate, only is the name given with -chain (empty runs every chain),
+//the top level node_url (or chain preset) is a single unnamed chain so older settings keep working
+func (self settings) selectChains(only string) ([]chainProfile, error) {
+	if len(self.Chains) == 0 {
+		if only != "" {
+			return nil, fmt.Errorf("-chain %s was given but the settings have no chains", only)
+		}
+		chain, err := chainProfile{NodeURL: self.NodeURL, Fee: self.Fee, BroadcastURLs: self.BroadcastURLs, BeaconURL: self.BeaconURL, Nonces: self.Nonces, Chain: self.Chain}.withPreset("")
+		if err != nil {
+			return nil, err
+		}
+		return []chainProfile{chain.withDefaults()}, nil
+	}
+
+	var names []string
+	for name := range self.Chains {
+		if only == "" || name == only {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("-chain %s is not one of the configured chains", only)
+	}
+	sort.Strings(names)
+
+	chains := make([]chainProfile, 0)
+	for _, name := range names {
+		//the chain's own settings win over the top level ones, which win over the preset
+		chain := self.Chains[name]
+		if chain.Fee.Strategy == "" {
+			chain.Fee.Strategy = self.Fee.Strategy
+		}
+		if chain.Fee.Multiplier == 0 {
+			chain.Fee.Multiplier = self.Fee.Multiplier
+		}
+		if chain.Fee.MinGwei == 0 {
+			chain.Fee.MinGwei = self.Fee.MinGwei
+		}
+		if chain.Fee.DustMinGwei == 0 {
+			chain.Fee.DustMinGwei = self.Fee.DustMinGwei
+		}
+		if chain.Fee.Percentile == 0 {
+			chain.Fee.Percentile = self.Fee.Percentile
+		}
+		if chain.Fee.HistoryBlocks == 0 {
+			chain.Fee.HistoryBlocks = self.Fee.HistoryBlocks
+		}
+		if chain.Fee.RepricePercent == 0 {
+			chain.Fee.RepricePercent = self.Fee.RepricePercent
+		}
+		chain, err := chain.withPreset(name)
+		if err != nil {
+			return nil, fmt.Errorf("chains.%s: %v", name, err)
+		}
+		chain.name = name
+		chains = append(chains, chain.withDefaults())
+	}
+	return chains, nil
+}
+
+func (self chainProfile) withDefaults() chainProfile {
+	if self.Fee.Strategy == "" {
+		self.Fee.Strategy = "suggested"
+	}
+	if self.Decimals == 0 {
+		self.Decimals = 18
+	}
+	if self.Symbol == "" {
+		self.Symbol = "ETH"
+	}
+	return self
+}
+
+func (self chainProfile) currency() Accounts.Currency {
+	return Accounts.Currency{Symbol: self.Symbol, Decimals: self.Decimals}
+}
+
+func (self chainProfile) validate(field string) []error {
+	var errs []error
+	self, err := self.withPreset(strings.TrimPrefix(field, "chains."))
+	if err != nil {
+		return []error{fmt.Errorf("%s: %v", field, err)}
+	}
+	if err := validateNodeURL(field+".node_url", self.NodeURL); err != nil {
+		errs = append(errs, err)
+	}
+	if self.ChainID < 0 {
+		errs = append(errs, fmt.Errorf("%s.chain_id %d can't be negative", field, self.ChainID))
+	}
+	if self.Decimals < 0 || self.Decimals > 36 {
+		errs = append(errs, fmt.Errorf("%s.decimals %d is out of range, expected 0 to 36", field, self.Decimals))
+	}
+	errs = append(errs, self.Fee.validate(field+".fee")...)
+	errs = append(errs, validateBroadcastURLs(field+".broadcast_urls", self.BroadcastURLs)...)
+	errs = append(errs, validateBeaconURL(field+".beacon_url", self.BeaconURL)...)
+	errs = append(errs, validateNonces(field+".nonces", self.Nonces)...)
+	return errs
+}
+
+//state, retry and other per chain files get the chain name added before the extension so chains never share nonces
+func (self chainProfile) file(path string) string {
+	if self.name == "" || path == "" {
+		return path
+	}
+	extension := filepath.Ext(path)
+	return strings.TrimSuffix(path, extension) + "." + self.name + extension
+}
+
+//link to a transaction on the chain's explorer, or just the (possibly truncated) hash
+func (self chainProfile) txLink(hash string) string {
+	if self.Explorer == "" {
+		return display.hex(hash)
+	}
+	if strings.Contains(self.Explorer, "{hash}") {
+		return strings.Replace(self.Explorer, "{hash}", hash, 1)
+	}
+	return self.Explorer + hash
+}
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"walletMigrate/Accounts"
+	"walletMigrate/Errors"
+	"walletMigrate/RPC"
+)
+
+//stuck transactions are replaced at this multiple of the chosen gas price, or higher when the transaction being
+//replaced is known and needs more to be outbid (see replacementFees)
+const clearPriceBump = 2
+
+//the fees a pending transaction offered, a replacement has to outbid both
+type pendingFees struct {
+	Hash   common.Hash
+	TipCap *big.Int
+	FeeCap *big.Int
+}
+
+//the fees of the pending transactions of the address by nonce, from the node's pool or else from the state file when
+//this tool sent them.  A nonce found in neither is replaced at the clear price alone
+func (self broadcaster) originals(address common.Address, first uint64, pending uint64) map[uint64]pendingFees {
+	originals := make(map[uint64]pendingFees)
+	pool, err := self.client.GetPoolTransactions(address)
+	if err != nil {
+		display.logf(RPC.VerbosityVerbose, "The node doesn't serve txpool_contentFrom, replacing transactions of %s without their fees: %v\n", address.Hex(), err)
+	}
+	for _, transaction := range pool {
+		originals[transaction.Nonce] = pendingFees{Hash: transaction.Hash, TipCap: transaction.TipCap, FeeCap: transaction.FeeCap}
+	}
+	for nonce := first; nonce < pending; nonce++ {
+		if _, inPool := originals[nonce]; inPool {
+			continue
+		}
+		recorded, found := self.state.Latest(address, nonce)
+		if !found {
+			continue
+		}
+		signedTx, err := recorded.Decode()
+		if err != nil {
+			Errors.Log(Errors.FileError, "M8", err)
+			continue
+		}
+		originals[nonce] = pendingFees{Hash: signedTx.Hash(), TipCap: signedTx.GasTipCap(), FeeCap: signedTx.GasFeeCap()}
+	}
+	return originals
+}
+
+//replace every pending transaction of the accounts with a 0 value transfer to itself so a clean migration can start
+//from the last mined nonce, the same as cancelling each one in a wallet
+func (self broadcaster) clearQueues(gasPrice *big.Int, accounts []Accounts.Account) int {
+	queued := self.client.GetQueuedAccounts(accounts)
+	if len(queued) == 0 {
+		display.logf(RPC.VerbosityNormal, "No account has pending transactions\n")
+		return exitNothingToDo
+	}
+	price := new(big.Int).Mul(gasPrice, big.NewInt(clearPriceBump))
+
+	var transactions []RPC.TransactionWithOriginator
+	replaces := make(map[common.Hash]common.Hash)
+	failed := 0
+	for _, entry := range queued {
+		account := entry.Account
+		count := entry.Pending - account.Nonce
+		originals := self.originals(account.Address, account.Nonce, entry.Pending)
+		var replacements []RPC.TransactionWithOriginator
+		cost := new(big.Int)
+		for nonce := account.Nonce; nonce < entry.Pending; nonce++ {
+			original, known := originals[nonce]
+			tip, feeCap := replacementFees(price, original.TipCap, original.FeeCap)
+			signedTx, err := account.SignTxWithFees(nonce, account.Address, big.NewInt(0), account.TransferGas, tip, feeCap, nil)
+			if err != nil {
+				Errors.Log(Errors.SignError, "M12", err)
+				failed++
+				continue
+			}
+			if known {
+				replaces[signedTx.Hash()] = original.Hash
+			}
+			cost.Add(cost, new(big.Int).Mul(feeCap, new(big.Int).SetUint64(account.TransferGas)))
+			replacements = append(replacements, RPC.TransactionWithOriginator{Address: account.Address, SignedTx: signedTx})
+		}
+		if account.Balance == nil || account.Balance.Cmp(cost) < 0 {
+			fmt.Println(display.paint(colorRed, fmt.Sprintf("WARNING: %s can't pay %s to replace its %d pending transactions, fund it and run clear again", account.Address.Hex(), display.currency.Format(cost), count)))
+			failed++
+			continue
+		}
+		display.logf(RPC.VerbosityNormal, "Clearing: %s, nonces %d to %d\n", account.Address.Hex(), account.Nonce, entry.Pending-1)
+		transactions = append(transactions, replacements...)
+	}
+	if !self.simulate {
+		for _, transaction := range transactions {
+			if original, known := replaces[transaction.SignedTx.Hash()]; known {
+				if err := self.audit.Replacement(transaction.Address, transaction.SignedTx, original); err != nil {
+					Errors.Log(Errors.FileError, "M21", err)
+				}
+			}
+		}
+	}
+	sendFailures := self.sendTransactions("clear", transactions)
+	if self.simulate {
+		failed += sendFailures
+	} else {
+		for hash, original := range replaces {
+			self.state.SetReplaces(hash, original)
+		}
+		receipts := self.client.GetReceipts(transactions)
+		self.recordReceipts(transactions, receipts)
+		failed += countFailed(transactions, receipts)
+	}
+
+	switch {
+	case failed > 0:
+		return exitWithFailures
+	case len(transactions) == 0:
+		return exitNothingToDo
+	default:
+		return exitCompleted
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"walletMigrate/Accounts"
+)
+
+//leave out accounts with code, sweeping with the raw key is wrong for a contract (a counterfactual Safe or an old proxy at
+//a derived address) since the key doesn't control it, an EIP-7702 delegated account is still controlled by its key
+//but the delegate runs on every transfer it receives (sweeper delegations forward gas funding straight out) so it is
+//only migrated when allowed
+func skipContracts(accounts []Accounts.Account, allowDelegated bool) []Accounts.Account {
+	kept := make([]Accounts.Account, 0, len(accounts))
+	report := table{header: []string{"Address", "Code", "Action"}}
+	for _, account := range accounts {
+		if len(account.Code) == 0 {
+			kept = append(kept, account)
+			continue
+		}
+		if delegate, ok := account.Delegate(); ok {
+			if allowDelegated {
+				report.add(colorYellow, display.hex(account.Address.Hex()), "EIP-7702 delegation to "+display.hex(delegate.Hex()), "migrated, allow_delegated_accounts is set")
+				kept = append(kept, account)
+			} else {
+				report.add(colorRed, display.hex(account.Address.Hex()), "EIP-7702 delegation to "+display.hex(delegate.Hex()), "skipped, set allow_delegated_accounts to migrate it")
+			}
+			continue
+		}
+		report.add(colorRed, display.hex(account.Address.Hex()), fmt.Sprintf("contract, %d bytes", len(account.Code)), "skipped, move its assets with the contract's own wallet")
+	}
+	if len(report.rows) > 0 {
+		fmt.Println("WARNING: these source addresses have code, their assets can't be swept with the key alone")
+		report.print(display)
+	}
+	return kept
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//list where each source account sent its tokens most often before any of its keys sign, a wallet that always paid
+//the same exchange or cold wallet should be recognizable, one that paid addresses nobody knows may not be the wallet it
+//is taken to be.  The run's destinations are marked
+func reportCounterparties(client RPC.Client, accounts []Accounts.Account, top int, destinations []split) {
+	ours := make(map[common.Address]bool)
+	for _, destination := range destinations {
+		ours[destination.address] = true
+	}
+	for _, account := range accounts {
+		counterparties, err := client.GetCounterparties(account.Address)
+		if err != nil {
+			display.logf(RPC.VerbosityNormal, "The transfer history of %s couldn't be read: %v\n", account.Address.Hex(), err)
+			continue
+		}
+		if len(counterparties) == 0 {
+			display.logf(RPC.VerbosityVerbose, "%s never sent a token\n", account.Address.Hex())
+			continue
+		}
+		display.logf(RPC.VerbosityNormal, "%s sent tokens to %d addresses, the most used:\n", account.Address.Hex(), len(counterparties))
+		report := table{indent: "\t", header: []string{"Counterparty", "Transfers", "Tokens", "Last Block"}}
+		for i, counterparty := range counterparties {
+			if i == top {
+				break
+			}
+			address, color := display.hex(counterparty.Address.Hex()), ""
+			if ours[counterparty.Address] {
+				address, color = address+" (destination)", colorCyan
+			}
+			report.add(color, address, fmt.Sprintf("%d", counterparty.Transfers), fmt.Sprintf("%d", counterparty.Tokens), fmt.Sprintf("%d", counterparty.LastBlock))
+		}
+		if display.verbosity > RPC.VerbosityQuiet {
+			report.print(display)
+			fmt.Println()
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"walletMigrate/Plan"
+	"walletMigrate/State"
+)
+
+//where the dashboard command serves its page unless api.dashboard_listen says otherwise
+const defaultDashboardListen = "127.0.0.1:8648"
+
+//the lines of a job's output the page shows
+const dashboardOutputLines = 400
+
+//dashboard is the dashboard command's page: it scans the chain with the server's settings, shows the plan and, once
+//the plan was reviewed, executes it and follows its transactions in the state file
+type dashboard struct {
+	in      settings
+	chain   chainProfile
+	jobs    *jobQueue
+	token   string //generated at start and only given out in the printed url
+	lock    sync.Mutex
+	scan    string //the scan shown, the latest
+	execute string //the execute of its plan
+}
+
+//dashboardState is what the page polls
+type dashboardState struct {
+	Chain     string         `json:"chain,omitempty"`
+	Approvers bool           `json:"approvers"` //the plan must be approved before it is executed
+	Scan      *dashboardJob  `json:"scan,omitempty"`
+	Plan      *dashboardPlan `json:"plan,omitempty"`
+	PlanError string         `json:"plan_error,omitempty"` //why a finished scan has no plan
+	Execute   *dashboardJob  `json:"execute,omitempty"`
+}
+
+type dashboardJob struct {
+	job
+	Output []string `json:"output"` //the last lines it printed
+}
+
+//dashboardPlan is the plan of the scan with values formatted in the chain's currency and the status each transaction
+//has in the state file
+type dashboardPlan struct {
+	Path         string                 `json:"path"`
+	Hash         string                 `json:"hash"`
+	Block        uint64                 `json:"block"`
+	Created      time.Time              `json:"created"`
+	GasPrice     string                 `json:"gas_price"`
+	Approved     string                 `json:"approved,omitempty"` //the approver whose approval is kept with the plan
+	Unapproved   string                 `json:"unapproved,omitempty"`
+	Total        string                 `json:"total"`    //the value of every transaction
+	MaxFees      string                 `json:"max_fees"` //the most the transactions can pay for gas
+	Accounts     []dashboardAccount     `json:"accounts"`
+	Transactions []dashboardTransaction `json:"transactions"`
+}
+
+type dashboardAccount struct {
+	Address string `json:"address"`
+	Nonce   uint64 `json:"nonce"`
+	Balance string `json:"balance"`
+	Tokens  int    `json:"tokens"`
+	Funder  bool   `json:"funder,omitempty"`
+}
+
+type dashboardTransaction struct {
+	Phase  string `json:"phase"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Nonce  uint64 `json:"nonce"`
+	Value  string `json:"value"`
+	MaxFee string `json:"max_fee"`
+	TxHash string `json:"tx_hash"` //the last one sent for the nonce, a replacement's once the plan's was replaced
+	Link   string `json:"link"`
+	Status string `json:"status"` //planned until the execute sends it
+}
+
+//executeRequest is the body of POST /api/execute, the plan the page showed so a newer one is never executed unseen
+type executeRequest struct {
+	Scan     string `json:"scan"`
+	PlanHash string `json:"plan_hash"`
+}
+
+//pick up the latest scan of the chain and its execute when the jobs directory already has them
+func (self *dashboard) pick() {
+	for _, listed := range self.jobs.list() {
+		switch {
+		case listed.Command == "migrate" && listed.Simulate && listed.Settings == "" && listed.Chain == self.chain.name:
+			self.scan, self.execute = listed.ID, ""
+		case listed.Command == "execute" && listed.Previous != "" && listed.Previous == self.scan:
+			self.execute = listed.ID
+		}
+	}
+}
+
+func (self *dashboard) state() dashboardState {
+	self.lock.Lock()
+	scanID, executeID := self.scan, self.execute
+	self.lock.Unlock()
+	current := dashboardState{Chain: self.chain.name, Approvers: len(self.in.Approvers) > 0}
+	scan, found := self.jobs.get(scanID)
+	if !found {
+		return current
+	}
+	current.Scan = dashboardJobOf(scan)
+	if executed, found := self.jobs.get(executeID); found {
+		current.Execute = dashboardJobOf(executed)
+	}
+	if scan.State != jobFinished {
+		return current
+	}
+	plan, err := Plan.Read(scan.Plan)
+	if err != nil {
+		current.PlanError = fmt.Sprintf("the scan wrote no plan (exit code %d): %v", scan.ExitCode, err)
+		return current
+	}
+	current.Plan = self.describe(scan.Plan, plan)
+	return current
+}
+
+func dashboardJobOf(found job) *dashboardJob {
+	output := found.output
+	if len(output) > dashboardOutputLines {
+		output = output[len(output)-dashboardOutputLines:]
+	}
+	return &dashboardJob{job: found, Output: append([]string{}, output...)}
+}
+
+func (self *dashboard) describe(path string, plan *Plan.Plan) *dashboardPlan {
+	currency := self.chain.currency()
+	amount := func(wei string) *big.Int {
+		value, ok := new(big.Int).SetString(wei, 10)
+		if !ok {
+			return big.NewInt(0)
+		}
+		return value
+	}
+	described := &dashboardPlan{Path: path, Hash: plan.Hash, Block: plan.Block, Created: plan.Created, GasPrice: currency.FormatGasPrice(amount(plan.GasPrice))}
+	if len(self.in.Approvers) > 0 {
+		if approver, err := Plan.VerifyApproval(path, plan, self.in.approvers()); err != nil {
+			described.Unapproved = err.Error()
+		} else {
+			described.Approved = approver.Hex()
+		}
+	}
+	for _, account := range plan.Accounts {
+		described.Accounts = append(described.Accounts, dashboardAccount{Address: account.Address, Nonce: account.Nonce, Balance: currency.Format(amount(account.Balance)), Tokens: len(account.Tokens), Funder: account.Funder})
+	}
+	//a state file the execute is writing can't always be read, its transactions show as planned until the next poll
+	recorded, err := State.Load(self.chain.file(self.in.StateFile))
+	if err != nil {
+		recorded = &State.State{}
+	}
+	total, fees := big.NewInt(0), big.NewInt(0)
+	for _, planned := range plan.Transactions {
+		value, maxFee := amount(planned.Value), new(big.Int).Mul(new(big.Int).SetUint64(planned.Gas), amount(planned.GasFeeCap))
+		total.Add(total, value)
+		fees.Add(fees, maxFee)
+		entry := dashboardTransaction{Phase: planned.Phase, From: planned.From, To: planned.To, Nonce: planned.Nonce, Value: currency.Format(value), MaxFee: currency.Format(maxFee), TxHash: planned.TxHash, Status: "planned"}
+		for _, sent := range recorded.Transactions {
+			if sent.Nonce == planned.Nonce && strings.EqualFold(sent.From, planned.From) {
+				entry.TxHash, entry.Status = sent.TxHash, sent.Status
+			}
+		}
+		if self.chain.Explorer != "" {
+			entry.Link = self.chain.txLink(entry.TxHash)
+		}
+		described.Transactions = append(described.Transactions, entry)
+	}
+	described.Total, described.MaxFees = currency.Format(total), currency.Format(fees)
+	return described
+}
+
+//queue a new scan, unless one is still running
+func (self *dashboard) rescan() (job, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, id := range []string{self.scan, self.execute} {
+		if busy, found := self.jobs.get(id); found && busy.State != jobFinished {
+			return job{}, fmt.Errorf("the %s %s is still %s", busy.Command, busy.ID, busy.State)
+		}
+	}
+	started, err := self.jobs.scan(self.chain.name, "")
+	if err != nil {
+		return job{}, err
+	}
+	self.scan, self.execute = started.ID, ""
+	return started, nil
+}
+
+//queue the execute of the plan the page showed, only once per scan and only while that is still the plan
+func (self *dashboard) run(request executeRequest) (job, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if request.Scan != self.scan {
+		return job{}, fmt.Errorf("scan %s is no longer the latest, review the plan of %s", request.Scan, self.scan)
+	}
+	if self.execute != "" {
+		return job{}, fmt.Errorf("the plan of scan %s was already executed by %s", self.scan, self.execute)
+	}
+	scan, found := self.jobs.get(self.scan)
+	if !found || scan.State != jobFinished {
+		return job{}, fmt.Errorf("scan %s hasn't finished", self.scan)
+	}
+	plan, err := Plan.Read(scan.Plan)
+	if err != nil {
+		return job{}, fmt.Errorf("scan %s has no plan: %v", self.scan, err)
+	}
+	if plan.Hash != request.PlanHash {
+		return job{}, fmt.Errorf("the plan is now %s, not the reviewed %s", plan.Hash, request.PlanHash)
+	}
+	if len(self.in.Approvers) > 0 {
+		if _, err := Plan.VerifyApproval(scan.Plan, plan, self.in.approvers()); err != nil {
+			return job{}, err
+		}
+	}
+	started, err := self.jobs.followUp("execute", self.scan)
+	if err != nil {
+		return job{}, err
+	}
+	self.execute = started.ID
+	return started, nil
+}
+
+//the page is served to GET /?token=, the api it polls to requests carrying the token in the X-Dashboard-Token header
+//so no other page the browser has open can drive it:
+//  GET  /api/state      the latest scan, its plan and execute
+//  POST /api/scan       queue a new scan
+//  POST /api/execute    execute the reviewed plan
+func (self *dashboard) handler() http.Handler {
+	authorized := func(offered string) bool {
+		return subtle.ConstantTimeCompare([]byte(offered), []byte(self.token)) == 1
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/" || !authorized(request.URL.Query().Get("token")) {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writer.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		writer.Header().Set("Referrer-Policy", "no-referrer")
+		fmt.Fprint(writer, dashboardPage)
+	})
+	mux.HandleFunc("/api/", func(writer http.ResponseWriter, request *http.Request) {
+		if !authorized(request.Header.Get("X-Dashboard-Token")) {
+			respondError(writer, http.StatusUnauthorized, fmt.Errorf("the dashboard's token is required"))
+			return
+		}
+		switch {
+		case request.URL.Path == "/api/state" && request.Method == http.MethodGet:
+			respond(writer, http.StatusOK, self.state())
+		case request.URL.Path == "/api/scan" && request.Method == http.MethodPost:
+			started, err := self.rescan()
+			if err != nil {
+				respondError(writer, http.StatusConflict, err)
+				return
+			}
+			respond(writer, http.StatusCreated, started)
+		case request.URL.Path == "/api/execute" && request.Method == http.MethodPost:
+			var body executeRequest
+			if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, 1<<20)).Decode(&body); err != nil {
+				respondError(writer, http.StatusBadRequest, err)
+				return
+			}
+			started, err := self.run(body)
+			if err != nil {
+				respondError(writer, http.StatusConflict, err)
+				return
+			}
+			respond(writer, http.StatusCreated, started)
+		default:
+			respondError(writer, http.StatusNotFound, fmt.Errorf("%s %s is not an endpoint", request.Method, request.URL.Path))
+		}
+	})
+	return mux
+}
+
+//the dashboard command: serve the page on this machine until interrupted, scans and executes run as jobs with the
+//settings and overrides the dashboard was started with
+func serveDashboard(in settings, settingsArg string, overrides []string, onlyChain string, status *runStatus) int {
+	name, err := in.jobChain(onlyChain)
+	if err != nil {
+		status.abort(err)
+	}
+	chains, err := in.selectChains(name)
+	if err != nil {
+		status.abort(err)
+	}
+	listen, dir := in.API.DashboardListen, in.API.JobsDir
+	if listen == "" {
+		listen = defaultDashboardListen
+	}
+	if dir == "" {
+		dir = defaultJobsDir
+	}
+	jobs, err := newJobQueue(settingsArg, overrides, dir)
+	if err != nil {
+		status.abort(err)
+	}
+	defer jobs.unlock()
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		status.abort(err)
+	}
+	page := &dashboard{in: in, chain: chains[0], jobs: jobs, token: hex.EncodeToString(random)}
+	page.pick()
+	server := &http.Server{Addr: listen, Handler: page.handler()}
+	stopped := make(chan os.Signal, 1)
+	signal.Notify(stopped, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stopped
+		server.Shutdown(context.Background())
+	}()
+	fmt.Printf("Open http://%s/?token=%s in a browser on this machine, interrupt to stop\n", listen, page.token)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		status.abort(err)
+	}
+	return exitCompleted
+}
+
+//the page polls the state every two seconds and draws it with textContent only, nothing a node or token contract
+//answered is ever parsed as html
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Wallet Migration</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 0.5em 0 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; font-family: monospace; text-align: left; }
+th { background: #f3f3f3; font-family: sans-serif; }
+pre { background: #111; color: #ddd; padding: 1em; max-height: 20em; overflow: auto; }
+button { font-size: 1em; padding: 0.4em 1em; }
+#execute { font-size: 1.6em; padding: 0.6em 2em; background: #b00; color: #fff; border: none; border-radius: 0.3em; }
+#execute:disabled { background: #ccc; }
+.status-planned { color: #777; } .status-sent, .status-pending { color: #b80; } .status-mined { color: #080; }
+.status-failed, .status-reverted, .status-dropped { color: #b00; font-weight: bold; } .status-replaced { color: #777; }
+#error { color: #b00; font-weight: bold; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Wallet Migration <span id="chain"></span></h1>
+<p id="error"></p>
+<h2>1. Scan</h2>
+<p>The scan is a simulated run: it reads the accounts and signs the transactions of the migration into a plan without sending anything.</p>
+<p><button id="scan">Scan again</button> <span id="scan-state"></span></p>
+<pre id="scan-output"></pre>
+<div id="plan" hidden>
+<h2>2. Review</h2>
+<p>Plan <code id="plan-hash"></code> of block <span id="plan-block"></span>, gas price <span id="plan-gas-price"></span>: <span id="plan-count"></span> transactions moving <b id="plan-total"></b> with at most <b id="plan-fees"></b> of fees.</p>
+<p id="approval"></p>
+<h3>Accounts</h3>
+<table><thead><tr><th>Address</th><th>Nonce</th><th>Balance</th><th>Tokens</th></tr></thead><tbody id="accounts"></tbody></table>
+<h3>Transactions</h3>
+<table><thead><tr><th>Phase</th><th>From</th><th>To</th><th>Nonce</th><th>Value</th><th>Max fee</th><th>Hash</th><th>Status</th></tr></thead><tbody id="transactions"></tbody></table>
+<h2>3. Execute</h2>
+<p><label><input type="checkbox" id="reviewed"> I reviewed the simulated plan above and every destination is mine</label></p>
+<p><button id="execute" disabled>Execute</button> <span id="execute-state"></span></p>
+<pre id="execute-output" hidden></pre>
+</div>
+<p id="plan-error"></p>
+<script>
+"use strict";
+const token = new URLSearchParams(location.search).get("token");
+let current = null, reviewedHash = null;
+
+async function call(method, path, body) {
+	const response = await fetch(path, {method: method, headers: {"X-Dashboard-Token": token, "Content-Type": "application/json"}, body: body && JSON.stringify(body)});
+	const answer = await response.json();
+	if (!response.ok) {
+		throw new Error(answer.errors.join("\n"));
+	}
+	return answer;
+}
+
+function text(id, value) {
+	document.getElementById(id).textContent = value;
+}
+
+function row(body, cells, statusClass) {
+	const tr = document.createElement("tr");
+	cells.forEach(function(value, i) {
+		const td = document.createElement("td");
+		if (value instanceof Node) {
+			td.appendChild(value);
+		} else {
+			td.textContent = value;
+		}
+		if (statusClass && i === cells.length - 1) {
+			td.className = "status-" + value;
+		}
+		tr.appendChild(td);
+	});
+	body.appendChild(tr);
+}
+
+function describe(job) {
+	if (job.state !== "finished") {
+		return job.id + " " + job.state;
+	}
+	return job.id + " finished with exit code " + job.exit_code;
+}
+
+function output(id, job) {
+	const pre = document.getElementById(id);
+	const follow = pre.scrollTop + pre.clientHeight >= pre.scrollHeight - 5;
+	pre.hidden = false;
+	pre.textContent = job.output.join("\n");
+	if (follow) {
+		pre.scrollTop = pre.scrollHeight;
+	}
+}
+
+function draw(state) {
+	current = state;
+	text("chain", state.chain ? "on " + state.chain : "");
+	const scanning = state.scan && state.scan.state !== "finished";
+	const executing = state.execute && state.execute.state !== "finished";
+	document.getElementById("scan").disabled = scanning || executing;
+	text("scan-state", state.scan ? describe(state.scan) : "no scan yet");
+	if (state.scan) {
+		output("scan-output", state.scan);
+	}
+	text("plan-error", state.plan_error || "");
+	const plan = state.plan;
+	document.getElementById("plan").hidden = !plan;
+	if (!plan) {
+		return;
+	}
+	if (reviewedHash !== plan.hash) {
+		document.getElementById("reviewed").checked = false;
+	}
+	text("plan-hash", plan.hash);
+	text("plan-block", plan.block);
+	text("plan-gas-price", plan.gas_price);
+	text("plan-count", plan.transactions ? plan.transactions.length : 0);
+	text("plan-total", plan.total);
+	text("plan-fees", plan.max_fees);
+	let approval = "";
+	if (state.approvers) {
+		approval = plan.approved ? "Approved by " + plan.approved : "Not approved, execute is refused until one of the approvers signs it: walletMigrate -approve-plan " + plan.path + " -approval-key file (" + plan.unapproved + ")";
+	}
+	text("approval", approval);
+	const accounts = document.getElementById("accounts");
+	accounts.textContent = "";
+	(plan.accounts || []).forEach(function(account) {
+		row(accounts, [account.address + (account.funder ? " (funder)" : ""), account.nonce, account.balance, account.tokens]);
+	});
+	const transactions = document.getElementById("transactions");
+	transactions.textContent = "";
+	(plan.transactions || []).forEach(function(transaction) {
+		let hash = transaction.tx_hash;
+		if (transaction.link) {
+			hash = document.createElement("a");
+			hash.href = transaction.link;
+			hash.rel = "noreferrer";
+			hash.textContent = transaction.tx_hash;
+		}
+		row(transactions, [transaction.phase, transaction.from, transaction.to, transaction.nonce, transaction.value, transaction.max_fee, hash, transaction.status], true);
+	});
+	const reviewed = document.getElementById("reviewed");
+	reviewed.disabled = !!state.execute;
+	document.getElementById("execute").disabled = !!state.execute || !reviewed.checked || (state.approvers && !plan.approved);
+	text("execute-state", state.execute ? describe(state.execute) : "");
+	if (state.execute) {
+		output("execute-output", state.execute);
+	} else {
+		document.getElementById("execute-output").hidden = true;
+	}
+}
+
+async function poll() {
+	try {
+		draw(await call("GET", "/api/state"));
+		text("error", "");
+	} catch (err) {
+		text("error", err.message);
+	}
+}
+
+document.getElementById("scan").onclick = async function() {
+	try {
+		await call("POST", "/api/scan");
+		await poll();
+	} catch (err) {
+		text("error", err.message);
+	}
+};
+
+document.getElementById("reviewed").onchange = function() {
+	reviewedHash = this.checked && current && current.plan ? current.plan.hash : null;
+	if (current) {
+		draw(current);
+	}
+};
+
+document.getElementById("execute").onclick = async function() {
+	const plan = current.plan;
+	if (!confirm("Broadcast the " + plan.transactions.length + " transactions of plan " + plan.hash + " moving " + plan.total + "? This can't be undone.")) {
+		return;
+	}
+	try {
+		await call("POST", "/api/execute", {scan: current.scan.id, plan_hash: plan.hash});
+		await poll();
+	} catch (err) {
+		text("error", err.message);
+	}
+};
+
+poll();
+setInterval(poll, 2000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"math/big"
+	"sort"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+	"walletMigrate/State"
+)
+
+//destination is one of several addresses the migrated assets are split across
+type destination struct {
+	Address string `json:"address"`
+	Weight  int64  `json:"weight"` //share relative to the other destinations, e.g. 70 and 30
+}
+
+//split is a parsed destination, a single destination_address is one split with all the weight
+type split struct {
+	address common.Address
+	weight  int64
+}
+
+//the configured destinations, an extended public key's first receiving address stands in for all of its addresses
+func (self settings) splits() ([]split, error) {
+	switch {
+	case self.DestinationAddress != "":
+		return []split{{address: common.HexToAddress(self.DestinationAddress), weight: 1}}, nil
+	case self.DestinationXpub != "":
+		address, err := Accounts.DeriveReceivingAddress(self.DestinationXpub, 0)
+		return []split{{address: address, weight: 1}}, err
+	}
+	splits := make([]split, 0, len(self.Destinations))
+	for _, destination := range self.Destinations {
+		splits = append(splits, split{address: common.HexToAddress(destination.Address), weight: destination.Weight})
+	}
+	return splits, nil
+}
+
+//route decides where the assets of each account go
+type route struct {
+	splits      []split //shared by every account unless destinations are rotated
+	splitTokens bool
+	rotated     map[common.Address]common.Address //the single destination of each account when rotating
+	byToken     map[common.Address]common.Address //tokens sent somewhere else than the destinations, by contract
+}
+
+//when rotating, each account gets a destination of its own so the migration doesn't link every old address to one new
+//address on chain, the assignments are kept in the state file so a re-run sends an account's leftovers to the same place
+func newRoute(in settings, splits []split, state *State.State, accounts []Accounts.Account) (route, error) {
+	result := route{splits: splits, splitTokens: in.SplitTokens, rotated: make(map[common.Address]common.Address), byToken: make(map[common.Address]common.Address)}
+	for contract, to := range in.TokenDestinations {
+		result.byToken[common.HexToAddress(contract)] = common.HexToAddress(to)
+	}
+	if !in.RotateDestinations && in.DestinationXpub == "" {
+		return result, nil
+	}
+
+	used := make(map[common.Address]bool)
+	for _, to := range state.Routes {
+		used[common.HexToAddress(to)] = true
+	}
+	var fresh []common.Address
+	for _, split := range splits {
+		if !used[split.address] {
+			fresh = append(fresh, split.address)
+		}
+	}
+	//assign in address order so the same accounts always get the same destinations
+	sorted := make([]Accounts.Account, len(accounts))
+	copy(sorted, accounts)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Address.Hex() < sorted[j].Address.Hex()
+	})
+
+	index, reused := uint32(0), 0
+	for _, account := range sorted {
+		if to, found := state.Route(account.Address); found {
+			result.rotated[account.Address] = to
+			continue
+		}
+		var to common.Address
+		switch {
+		case in.DestinationXpub != "":
+			for {
+				address, err := Accounts.DeriveReceivingAddress(in.DestinationXpub, index)
+				if err != nil {
+					return result, err
+				}
+				index++
+				if !used[address] {
+					to = address
+					break
+				}
+			}
+		case len(fresh) > 0:
+			to, fresh = fresh[0], fresh[1:]
+		default:
+			//more accounts than destinations, some destinations have to take a second account
+			to = splits[reused%len(splits)].address
+			reused++
+		}
+		used[to] = true
+		state.SetRoute(account.Address, to)
+		result.rotated[account.Address] = to
+	}
+	if reused > 0 {
+		fmt.Printf("WARNING: %d accounts share a destination with another account, add more destinations (or use destination_xpub) to keep every account unlinked\n", reused)
+	}
+	return result, nil
+}
+
+//the destinations of the account's final eth sweep
+func (self route) balances(account common.Address) []split {
+	if to, found := self.rotated[account]; found {
+		return []split{{address: to, weight: 1}}
+	}
+	return self.splits
+}
+
+//the destinations of one of the account's tokens, a token with its own entry in token_destinations goes there whole,
+//others are only split when split_tokens is set
+func (self route) tokens(account common.Address, contract common.Address) []split {
+	if to, found := self.byToken[contract]; found {
+		return []split{{address: to, weight: 1}}
+	}
+	splits := self.balances(account)
+	if !self.splitTokens {
+		return splits[:1]
+	}
+	return splits
+}
+
+//the destination recorded in the state file and used to check that tokens can be received
+func (self route) primary() common.Address {
+	return self.splits[0].address
+}
+
+func (self route) contains(address common.Address) bool {
+	for _, split := range self.splits {
+		if split.address == address {
+			return true
+		}
+	}
+	for _, to := range self.rotated {
+		if to == address {
+			return true
+		}
+	}
+	for _, to := range self.byToken {
+		if to == address {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSplit(splits []split, address common.Address) bool {
+	for _, split := range splits {
+		if split.address == address {
+			return true
+		}
+	}
+	return false
+}
+
+//divide the amount by weight, the last split takes whatever rounding leaves over so nothing is left behind
+func splitAmount(amount *big.Int, splits []split) []*big.Int {
+	total := int64(0)
+	for _, split := range splits {
+		total += split.weight
+	}
+	amounts := make([]*big.Int, len(splits))
+	remaining := new(big.Int).Set(amount)
+	for i, split := range splits {
+		if i == len(splits)-1 {
+			amounts[i] = remaining
+			break
+		}
+		amounts[i] = new(big.Int).Div(new(big.Int).Mul(amount, big.NewInt(split.weight)), big.NewInt(total))
+		remaining.Sub(remaining, amounts[i])
+	}
+	return amounts
+}
+
+//each split token needs one transfer per destination so the gas the scan reserved for one transfer is multiplied
+func reserveSplitGas(accounts []Accounts.Account, routes route) {
+	for x := range accounts {
+		for _, token := range accounts[x].Tokens {
+			parts := len(routes.tokens(accounts[x].Address, token.Contract))
+			if token.TokenID == nil && token.Unsupported == "" {
+				accounts[x].TotalAssetTransfer.Add(accounts[x].TotalAssetTransfer, new(big.Int).SetUint64(token.GasLimit*uint64(parts-1)))
+			}
+		}
+	}
+}
+
+//get the transactions sweeping the balance above the reserve across the destinations, when the balance can't cover a
+//transfer to each of them (or a share would be 0) the dust goes to the first destination in a single transaction instead
+func getBalanceTxs(splits []split, reserve *big.Int, gasPrice *big.Int, account Accounts.Account) []*types.Transaction {
+	if reserve.Sign() > 0 {
+		if account.Balance.Cmp(reserve) <= 0 {
+			display.logf(RPC.VerbosityVerbose, "Skipping: %s balance %s wei is within the %s wei reserve\n", account.Address.Hex(), account.Balance, reserve)
+			return nil
+		}
+		account.Balance = new(big.Int).Sub(account.Balance, reserve)
+	}
+	if len(splits) > 1 {
+		transferCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(account.TransferGas*uint64(len(splits))))
+		totalAmountToTransfer := new(big.Int).Sub(account.Balance, transferCost)
+		display.logf(RPC.VerbosityDebug, "gas math: %s balance %s wei - %d transfers cost %s wei (%s wei gas price) = %s wei\n", account.Address.Hex(), account.Balance, len(splits), transferCost, gasPrice, totalAmountToTransfer)
+		if totalAmountToTransfer.Sign() > 0 {
+			amounts := splitAmount(totalAmountToTransfer, splits)
+			transactions := make([]*types.Transaction, 0, len(splits))
+			for i, split := range splits {
+				if amounts[i].Sign() == 0 {
+					break
+				}
+				signedTx, err := account.SignTx(account.Nonce+uint64(i), split.address, amounts[i], account.TransferGas, gasPrice, nil)
+				if err != nil {
+					log.Fatal(err)
+				}
+				transactions = append(transactions, signedTx)
+			}
+			if len(transactions) == len(splits) {
+				return transactions
+			}
+		}
+	}
+	signedTx := getBalanceTx(splits[0].address, gasPrice, account)
+	if signedTx == nil {
+		return nil
+	}
+	return []*types.Transaction{signedTx}
+}
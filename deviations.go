@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"sort"
+	"walletMigrate/RPC"
+)
+
+//compare what actually happened during a live run against the plan a simulated run would have produced
+//and print every deviation (reverted, unmined, unplanned or missing txs, changed amounts and higher fees),
+//returns the number of transactions that reverted or were not mined
+func printDeviations(client RPC.Client, plan []RPC.TransactionWithOriginator, executed []RPC.TransactionWithOriginator, receipts map[common.Hash]*types.Receipt) int {
+	//transactions are matched on sender and nonce since amounts (and therefore hashes) can legitimately change
+	key := func(transaction RPC.TransactionWithOriginator) string {
+		return fmt.Sprintf("%s/%d", transaction.Address.Hex(), transaction.SignedTx.Nonce())
+	}
+	planned := make(map[string]RPC.TransactionWithOriginator)
+	for _, transaction := range plan {
+		planned[key(transaction)] = transaction
+	}
+
+	failed := 0
+	deviations := table{header: []string{"Deviation", "From", "Nonce", "TxHash", "Planned", "Actual"}}
+	add := func(color string, deviation string, transaction RPC.TransactionWithOriginator, expected string, actual string) {
+		deviations.add(color, deviation, display.hex(transaction.Address.Hex()), fmt.Sprintf("%d", transaction.SignedTx.Nonce()), display.hex(transaction.SignedTx.Hash().Hex()), expected, actual)
+	}
+
+	for _, transaction := range executed {
+		expected, isPlanned := planned[key(transaction)]
+		delete(planned, key(transaction))
+		receipt := receipts[transaction.SignedTx.Hash()]
+
+		if !isPlanned {
+			add(colorYellow, "unplanned", transaction, "-", describeTx(transaction.SignedTx))
+		}
+		if receipt == nil {
+			failed++
+			add(colorRed, "not mined", transaction, "mined", "no receipt")
+			continue
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			failed++
+			add(colorRed, "reverted", transaction, "success", fmt.Sprintf("reverted, gas used %d/%d", receipt.GasUsed, transaction.SignedTx.Gas()))
+		} else if receipt.GasUsed >= transaction.SignedTx.Gas() && transaction.SignedTx.Gas() > 21000 {
+			add(colorYellow, "gas limit reached", transaction, fmt.Sprintf("< %d gas", transaction.SignedTx.Gas()), fmt.Sprintf("%d gas", receipt.GasUsed))
+		}
+		if !isPlanned {
+			continue
+		}
+
+		if *expected.SignedTx.To() != *transaction.SignedTx.To() {
+			add(colorYellow, "changed recipient", transaction, display.hex(expected.SignedTx.To().Hex()), display.hex(transaction.SignedTx.To().Hex()))
+		}
+		if expected.SignedTx.Value().Cmp(transaction.SignedTx.Value()) != 0 {
+			add(colorYellow, "changed amount", transaction, display.currency.Format(expected.SignedTx.Value()), display.currency.Format(transaction.SignedTx.Value()))
+		}
+		if string(expected.SignedTx.Data()) != string(transaction.SignedTx.Data()) {
+			add(colorYellow, "changed data", transaction, fmt.Sprintf("%d bytes", len(expected.SignedTx.Data())), fmt.Sprintf("%d bytes", len(transaction.SignedTx.Data())))
+		}
+		//the plan assumes the whole gas limit is used at the planned cap, what was paid is the price the block took
+		//for the gas actually used
+		plannedFee := new(big.Int).Mul(expected.SignedTx.GasFeeCap(), new(big.Int).SetUint64(expected.SignedTx.Gas()))
+		paid := client.EffectiveGasPrice(transaction.SignedTx, receipt)
+		if paid == nil {
+			continue
+		}
+		actualFee := new(big.Int).Mul(paid, new(big.Int).SetUint64(receipt.GasUsed))
+		if actualFee.Cmp(plannedFee) > 0 {
+			add(colorYellow, "higher gas", transaction, display.currency.Format(plannedFee), display.currency.Format(actualFee))
+		}
+	}
+
+	//anything left in the plan was never signed during the live run
+	var missing []RPC.TransactionWithOriginator
+	for _, transaction := range planned {
+		missing = append(missing, transaction)
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return key(missing[i]) < key(missing[j])
+	})
+	for _, transaction := range missing {
+		add(colorRed, "not executed", transaction, describeTx(transaction.SignedTx), "-")
+	}
+
+	fmt.Println()
+	if len(deviations.rows) == 0 {
+		fmt.Println(display.paint(colorGreen, fmt.Sprintf("All %d transactions matched the simulated plan", len(executed))))
+		return failed
+	}
+	fmt.Println(display.paint(colorBold, fmt.Sprintf("%d deviations from the simulated plan:", len(deviations.rows))))
+	deviations.print(display)
+	return failed
+}
+
+func describeTx(transaction *types.Transaction) string {
+	return fmt.Sprintf("%s to %s", display.currency.Format(transaction.Value()), display.hex(transaction.To().Hex()))
+}
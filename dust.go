@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/params"
+	"math/big"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//minValueSettings set the value an account needs to be worth migrating, in ETH or in USD at the price feed's rate
+type minValueSettings struct {
+	Eth json.Number `json:"eth"`
+	Usd json.Number `json:"usd"`
+}
+
+func (self minValueSettings) validate(field string) []error {
+	var errs []error
+	if self.Eth != "" && self.Usd != "" {
+		errs = append(errs, fmt.Errorf("%s can set either eth or usd, not both", field))
+	}
+	for name, value := range map[string]json.Number{"eth": self.Eth, "usd": self.Usd} {
+		if value == "" {
+			continue
+		}
+		if amount, ok := new(big.Rat).SetString(value.String()); !ok || amount.Sign() < 0 {
+			errs = append(errs, fmt.Errorf("%s.%s %q is not a non-negative amount", field, name, value))
+		}
+	}
+	return errs
+}
+
+//the threshold in wei, a usd threshold is converted at the current ETH price
+func (self minValueSettings) threshold(client RPC.Client) (*big.Int, error) {
+	var eth *big.Rat
+	switch {
+	case self.Eth != "":
+		eth, _ = new(big.Rat).SetString(self.Eth.String())
+	case self.Usd != "":
+		usd, _ := new(big.Rat).SetString(self.Usd.String())
+		price, err := client.GetEthUsdPrice()
+		if err != nil {
+			return nil, fmt.Errorf("min_account_value.usd needs the ETH price: %v", err)
+		}
+		display.logf(RPC.VerbosityVerbose, "ETH price: %s USD\n", price.FloatString(2))
+		eth = usd.Quo(usd, price)
+	default:
+		return new(big.Int), nil
+	}
+	wei := eth.Mul(eth, new(big.Rat).SetInt(big.NewInt(params.Ether)))
+	return new(big.Int).Quo(wei.Num(), wei.Denom()), nil
+}
+
+//leave out accounts whose ETH balance is below the threshold so they get no gas and no sweep, token prices aren't known
+//so an account holding anything that would be transferred is always kept
+func dropDust(accounts []Accounts.Account, threshold *big.Int) []Accounts.Account {
+	if threshold.Sign() == 0 {
+		return accounts
+	}
+	kept := make([]Accounts.Account, 0, len(accounts))
+	for _, account := range accounts {
+		if account.Balance.Cmp(threshold) < 0 && !holdsTransferableTokens(account) {
+			display.logf(RPC.VerbosityNormal, "Skipping: %s balance %s is below min_account_value\n", account.Address.Hex(), display.currency.Format(account.Balance))
+			continue
+		}
+		kept = append(kept, account)
+	}
+	return kept
+}
+
+func holdsTransferableTokens(account Accounts.Account) bool {
+	for _, token := range account.Tokens {
+		if token.Unsupported == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"math/big"
+	"sort"
+	"walletMigrate/Accounts"
+	"walletMigrate/Errors"
+	"walletMigrate/RPC"
+)
+
+//the USD value of a whole balance of the token, nil when its price or decimals aren't known
+func tokenUsdValue(token Accounts.Token, price *big.Rat) *big.Rat {
+	if price == nil || token.DecimalsUnknown || token.TokenID != nil {
+		return nil
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(token.Decimals)), nil)
+	return new(big.Rat).Mul(new(big.Rat).SetFrac(token.Balance, scale), price)
+}
+
+//USD prices of the tokens held by the accounts, tokens without a Chainlink feed are left out
+func tokenUsdPrices(client RPC.Client, accounts []Accounts.Account) map[common.Address]*big.Rat {
+	prices := make(map[common.Address]*big.Rat)
+	missing := make(map[common.Address]bool)
+	for _, account := range accounts {
+		for _, token := range account.Tokens {
+			if token.TokenID != nil || token.Unsupported != "" || prices[token.Contract] != nil || missing[token.Contract] {
+				continue
+			}
+			price, err := client.GetTokenUsdPrice(token.Contract)
+			if err != nil {
+				display.logf(RPC.VerbosityVerbose, "No USD price for %s %s: %v\n", token.Symbol, token.Contract.Hex(), err)
+				missing[token.Contract] = true
+				continue
+			}
+			prices[token.Contract] = price
+		}
+	}
+	return prices
+}
+
+//leave tokens behind whose transfer would cost more than the percentage of their value so gas isn't spent rescuing
+//worthless balances, tokens without a price are always moved
+func skipCostlyTransfers(client RPC.Client, accounts []Accounts.Account, gasPrice *big.Int, percent float64) error {
+	if percent == 0 {
+		return nil
+	}
+	ethPrice, err := client.GetEthUsdPrice()
+	if err != nil {
+		return fmt.Errorf("max_fee_percent needs the ETH price: %v", err)
+	}
+	prices := tokenUsdPrices(client, accounts)
+	limit := new(big.Rat).SetFloat64(percent / 100)
+	for x := range accounts {
+		for y := range accounts[x].Tokens {
+			token := &accounts[x].Tokens[y]
+			if token.Unsupported != "" {
+				continue
+			}
+			value := tokenUsdValue(*token, prices[token.Contract])
+			if value == nil {
+				continue
+			}
+			fee := new(big.Rat).SetFrac(new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(token.GasLimit)), big.NewInt(params.Ether))
+			fee.Mul(fee, ethPrice)
+			if fee.Cmp(new(big.Rat).Mul(value, limit)) <= 0 {
+				continue
+			}
+			display.logf(RPC.VerbosityNormal, "Skipped: %s, Token Address: %s, the transfer costs $%s for $%s of %s\n", accounts[x].Address.Hex(), token.Contract.Hex(), fee.FloatString(2), value.FloatString(2), token.Symbol)
+			token.Unsupported = fmt.Sprintf("the transfer costs more than %v%% of its value", percent)
+			accounts[x].TotalAssetTransfer.Sub(accounts[x].TotalAssetTransfer, new(big.Int).SetUint64(token.GasLimit))
+			token.GasLimit = 0
+		}
+	}
+	return nil
+}
+
+//when the accounts (and the funder) together can't pay for every transfer, keep the most valuable tokens across all
+//accounts and leave the rest behind, instead of each account moving its largest raw balances until its gas runs out.
+//Priced tokens go first by USD value, then tokens without a price (and collectibles) in their scanned order
+func prioritizeByValue(client RPC.Client, accounts []Accounts.Account, funder *Accounts.Account, gasPrice *big.Int) {
+	budget := new(big.Int)
+	for _, account := range accounts {
+		budget.Add(budget, account.Balance)
+	}
+	if funder != nil {
+		budget.Add(budget, funder.Balance)
+	}
+	type candidate struct {
+		x, y  int
+		value *big.Rat
+	}
+	var candidates []candidate
+	for x := range accounts {
+		for y, token := range accounts[x].Tokens {
+			if token.Unsupported == "" {
+				candidates = append(candidates, candidate{x: x, y: y})
+			}
+		}
+	}
+
+	//the cost of moving the tokens in order, an account that can't pay for its own transfers also needs a gas transfer
+	plan := func(accept func(candidate, *big.Int) bool) {
+		remaining := new(big.Int).Set(budget)
+		spent := make(map[int]*big.Int)
+		funded := make(map[int]bool)
+		for _, c := range candidates {
+			token := accounts[c.x].Tokens[c.y]
+			gas := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(token.GasLimit))
+			if spent[c.x] == nil {
+				spent[c.x] = new(big.Int)
+			}
+			cost := new(big.Int).Set(gas)
+			needsFunding := !funded[c.x] && accounts[c.x].Balance.Cmp(new(big.Int).Add(spent[c.x], gas)) < 0
+			if needsFunding {
+				cost.Add(cost, new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(accounts[c.x].TransferGas)))
+			}
+			if !accept(c, new(big.Int).Sub(remaining, cost)) {
+				continue
+			}
+			remaining.Sub(remaining, cost)
+			spent[c.x].Add(spent[c.x], gas)
+			funded[c.x] = funded[c.x] || needsFunding
+		}
+	}
+	affordable := true
+	plan(func(c candidate, left *big.Int) bool {
+		affordable = affordable && left.Sign() >= 0
+		return true
+	})
+	if affordable {
+		return
+	}
+
+	prices := tokenUsdPrices(client, accounts)
+	for i := range candidates {
+		candidates[i].value = tokenUsdValue(accounts[candidates[i].x].Tokens[candidates[i].y], prices[accounts[candidates[i].x].Tokens[candidates[i].y].Contract])
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		switch {
+		case candidates[i].value == nil:
+			return false
+		case candidates[j].value == nil:
+			return true
+		}
+		return candidates[i].value.Cmp(candidates[j].value) > 0
+	})
+
+	deferred := 0
+	plan(func(c candidate, left *big.Int) bool {
+		if left.Sign() >= 0 {
+			return true
+		}
+		token := &accounts[c.x].Tokens[c.y]
+		display.logf(RPC.VerbosityNormal, "Skipped: %s, Token Address: %s, not enough gas to move every token and more valuable ones go first\n", accounts[c.x].Address.Hex(), token.Contract.Hex())
+		token.Unsupported = "not enough gas, more valuable tokens are moved first"
+		Errors.Record(Errors.InsufficientGas, "M16", fmt.Errorf("%s can't pay to move token %s", accounts[c.x].Address.Hex(), token.Contract.Hex()))
+		accounts[c.x].TotalAssetTransfer.Sub(accounts[c.x].TotalAssetTransfer, new(big.Int).SetUint64(token.GasLimit))
+		token.GasLimit = 0
+		deferred++
+		return false
+	})
+	fmt.Printf("WARNING: the accounts hold %s, not enough to move every token at this gas price, %d lower value tokens are left behind\n", display.currency.Format(budget), deferred)
+}
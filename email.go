@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+	"walletMigrate/Errors"
+	"walletMigrate/Redaction"
+)
+
+//how long the mail server gets to take a message, the run waits for it before exiting
+const emailTimeout = time.Minute
+
+//emailSettings send the final report of a run, and with alerts each failure as it happens, to operators who aren't
+//watching its output
+type emailSettings struct {
+	SMTP     string   `json:"smtp"`     //host:port of the mail server, port 465 is spoken over tls, others are upgraded with STARTTLS
+	Username string   `json:"username"` //login, none when the server takes mail without
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Alerts   bool     `json:"alerts"` //also send an email whenever transactions revert or fail to send
+}
+
+var mailer = emailSettings{}
+
+func (self emailSettings) validate(field string) []error {
+	var errs []error
+	if self.SMTP == "" {
+		if self.Alerts || len(self.To) > 0 {
+			errs = append(errs, fmt.Errorf("%s.smtp is required to send email", field))
+		}
+		return errs
+	}
+	if _, _, err := net.SplitHostPort(self.SMTP); err != nil {
+		errs = append(errs, fmt.Errorf("%s.smtp %q is not a host:port address", field, self.SMTP))
+	}
+	if _, err := mail.ParseAddress(self.From); err != nil {
+		errs = append(errs, fmt.Errorf("%s.from %q is not an email address", field, self.From))
+	}
+	if len(self.To) == 0 {
+		errs = append(errs, fmt.Errorf("%s.to needs at least one address", field))
+	}
+	for _, to := range self.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			errs = append(errs, fmt.Errorf("%s.to %q is not an email address", field, to))
+		}
+	}
+	if (self.Username == "") != (self.Password == "") {
+		errs = append(errs, fmt.Errorf("%s.username and %s.password are required together", field, field))
+	}
+	return errs
+}
+
+//report emails the outcome of the run and every failure it recorded
+func (self emailSettings) report(command string, status *runStatus) {
+	if self.SMTP == "" {
+		return
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "walletMigrate %s %s (exit code %d)\n\n", command, status.Status, status.ExitCode)
+	fmt.Fprintf(&body, "Simulated:    %t\n", status.Simulate)
+	fmt.Fprintf(&body, "Started:      %s\n", status.Started.Format(time.RFC3339))
+	fmt.Fprintf(&body, "Finished:     %s\n", status.now().Format(time.RFC3339))
+	fmt.Fprintf(&body, "Accounts:     %d\n", status.Accounts)
+	fmt.Fprintf(&body, "Transactions: %d\n", status.Transactions)
+	fmt.Fprintf(&body, "Failed:       %d\n", status.Failed)
+	if status.Error != "" {
+		fmt.Fprintf(&body, "Error:        %s\n", status.Error)
+	}
+	if failures := Errors.Recorded(); len(failures) > 0 {
+		fmt.Fprintf(&body, "\nFailures:\n")
+		for _, failure := range failures {
+			fmt.Fprintf(&body, "ERROR(%s) %s: %v\n", failure.Code, failure.Category, failure)
+		}
+	}
+	self.send(fmt.Sprintf("walletMigrate %s %s", command, status.Status), body.String())
+}
+
+//alert emails a failure right away when alerts are on, the final report lists it again
+func (self emailSettings) alert(subject string, format string, args ...interface{}) {
+	if self.SMTP == "" || !self.Alerts {
+		return
+	}
+	self.send(subject, fmt.Sprintf(format, args...)+"\n")
+}
+
+//send the message or print why it couldn't be, a run never fails over its email
+func (self emailSettings) send(subject string, body string) {
+	if err := self.deliver(subject, body); err != nil {
+		fmt.Fprintln(os.Stderr, "WARNING: the email couldn't be sent:", err)
+	}
+}
+
+func (self emailSettings) deliver(subject string, body string) error {
+	host, port, err := net.SplitHostPort(self.SMTP)
+	if err != nil {
+		return err
+	}
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	var connection net.Conn
+	if port == "465" {
+		connection, err = tls.DialWithDialer(dialer, "tcp", self.SMTP, &tls.Config{ServerName: host})
+	} else {
+		connection, err = dialer.Dial("tcp", self.SMTP)
+	}
+	if err != nil {
+		return err
+	}
+	connection.SetDeadline(time.Now().Add(emailTimeout))
+	client, err := smtp.NewClient(connection, host)
+	if err != nil {
+		connection.Close()
+		return err
+	}
+	defer client.Close()
+	if port != "465" {
+		if upgrade, _ := client.Extension("STARTTLS"); upgrade {
+			if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return err
+			}
+		}
+	}
+	if self.Username != "" {
+		//smtp.PlainAuth refuses to send the password in the clear to anything but localhost
+		if err := client.Auth(smtp.PlainAuth("", self.Username, self.Password, host)); err != nil {
+			return err
+		}
+	}
+	from, _ := mail.ParseAddress(self.From)
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	var recipients []string
+	for _, to := range self.To {
+		recipient, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return err
+		}
+		recipients = append(recipients, recipient.String())
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+	if hostname != "" {
+		subject += " on " + hostname
+	}
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + strings.Join(recipients, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+	//the body is redacted like everything else the run prints
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(Redaction.String(body), "\n", "\r\n")
+	if _, err := writer.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"walletMigrate/Encryption"
+)
+
+//encryptionSettings encrypt the files that map the old addresses to the new ones (state file, retry queue, plan file
+//and rpc recording) so they can be kept or shared without revealing which wallets belong together
+type encryptionSettings struct {
+	Tool       string   `json:"tool"`       //age (default) or gpg, run from the PATH
+	Recipients []string `json:"recipients"` //age public keys (age1...) or gpg key ids the files are encrypted to
+	Identity   string   `json:"identity"`   //age identity file that decrypts them again, gpg uses its keyring
+}
+
+func (self encryptionSettings) validate(field string) []error {
+	var errs []error
+	if len(self.Recipients) == 0 {
+		if self.Tool != "" || self.Identity != "" {
+			errs = append(errs, fmt.Errorf("%s.recipients is required to encrypt", field))
+		}
+		return errs
+	}
+	tool := self.Tool
+	if tool == "" {
+		tool = "age"
+	}
+	if !contains(Encryption.Tools, tool) {
+		errs = append(errs, fmt.Errorf("%s.tool %q is not supported, expected one of %v", field, self.Tool, Encryption.Tools))
+		return errs
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		errs = append(errs, fmt.Errorf("%s.tool %s is not installed: %v", field, tool, err))
+	}
+	for i, recipient := range self.Recipients {
+		if tool == "age" && !strings.HasPrefix(recipient, "age1") && !strings.HasPrefix(recipient, "ssh-") {
+			errs = append(errs, fmt.Errorf("%s.recipients[%d] %q is not an age public key (age1...) or ssh public key", field, i, recipient))
+		}
+	}
+	//the state file and retry queue are read back by the next run
+	if tool == "age" && self.Identity == "" {
+		errs = append(errs, fmt.Errorf("%s.identity is required with age, the next run has to decrypt the state file", field))
+	}
+	return errs
+}
+
+func (self encryptionSettings) configure() {
+	if len(self.Recipients) > 0 {
+		Encryption.Configure(self.Tool, self.Recipients, self.Identity)
+	}
+}
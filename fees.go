@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/params"
+	"math/big"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//raise the lowest gas price a balance too small for the run's gas price is swept at to dust_min_gwei
+func (self feeSettings) applyDustFloor(accounts []Accounts.Account) {
+	if self.DustMinGwei == 0 {
+		return
+	}
+	floor, _ := new(big.Float).Mul(big.NewFloat(self.DustMinGwei), big.NewFloat(params.GWei)).Int(nil)
+	for i := range accounts {
+		if accounts[i].MinGasPrice == nil || accounts[i].MinGasPrice.Cmp(floor) < 0 {
+			accounts[i].MinGasPrice = floor
+		}
+	}
+}
+
+//the gas price every transaction of the run pays, from the strategy times the multiplier and raised to the chain's
+//minimum and the min_gwei floor so nothing sits unmined below what validators accept
+func (self feeSettings) gasPrice(client RPC.Client) (*big.Int, error) {
+	var gasPrice *big.Int
+	switch self.Strategy {
+	case "gas_station":
+		price, err := client.GetGasStationPrice()
+		if err != nil {
+			return nil, fmt.Errorf("fee.strategy gas_station: %v", err)
+		}
+		gasPrice, _ = new(big.Float).Mul(new(big.Float).SetInt(price), big.NewFloat(self.Multiplier)).Int(nil)
+		display.logf(RPC.VerbosityDebug, "gas price: gas station %s wei x %v = %s wei\n", price, self.Multiplier, gasPrice)
+	case "fee_history":
+		percentile, blocks := self.Percentile, self.HistoryBlocks
+		if percentile == 0 {
+			percentile = defaultFeePercentile
+		}
+		if blocks == 0 {
+			blocks = defaultFeeHistoryBlocks
+		}
+		price, err := client.GetFeeHistoryPrice(blocks, percentile)
+		if err != nil {
+			return nil, fmt.Errorf("fee.strategy fee_history: %v", err)
+		}
+		gasPrice, _ = new(big.Float).Mul(new(big.Float).SetInt(price), big.NewFloat(self.Multiplier)).Int(nil)
+		display.logf(RPC.VerbosityDebug, "gas price: fee history %s wei x %v = %s wei\n", price, self.Multiplier, gasPrice)
+	default:
+		gasPrice = client.GetGasPrice(self.Multiplier) //multiply the suggested gas price by x times
+	}
+
+	floor := client.MinimumGasPrice()
+	if self.MinGwei > 0 {
+		minimum, _ := new(big.Float).Mul(big.NewFloat(self.MinGwei), big.NewFloat(params.GWei)).Int(nil)
+		if minimum.Cmp(floor) > 0 {
+			floor = minimum
+		}
+	}
+	if gasPrice.Cmp(floor) < 0 {
+		display.logf(RPC.VerbosityNormal, "Raising the gas price from %s to the chain's minimum of %s\n", display.currency.FormatGasPrice(gasPrice), display.currency.FormatGasPrice(floor))
+		gasPrice = floor
+	}
+	return gasPrice, nil
+}
+
+//nodes only accept a replacement whose tip and fee cap are both at least this percentage above the transaction it
+//replaces (geth's txpool.pricebump), bumping only the fee cap of a type-2 transaction is rejected as underpriced
+const replacementBumpPercent = 10
+
+//the tip and fee cap of a transaction replacing one that paid tipCap and feeCap: the price chosen for the run, each
+//raised where needed to clear the bump over the original
+func replacementFees(price *big.Int, tipCap *big.Int, feeCap *big.Int) (*big.Int, *big.Int) {
+	bump := func(value *big.Int) *big.Int {
+		bumped := new(big.Int).Mul(value, big.NewInt(100+replacementBumpPercent))
+		bumped.Add(bumped, big.NewInt(99)) //round up so the bump is never a wei short
+		return bumped.Div(bumped, big.NewInt(100))
+	}
+	tip, limit := new(big.Int).Set(price), new(big.Int).Set(price)
+	if tipCap != nil && bump(tipCap).Cmp(tip) > 0 {
+		tip = bump(tipCap)
+	}
+	if feeCap != nil && bump(feeCap).Cmp(limit) > 0 {
+		limit = bump(feeCap)
+	}
+	if tip.Cmp(limit) > 0 {
+		limit.Set(tip) //the tip can never be above the fee cap
+	}
+	return tip, limit
+}
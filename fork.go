@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+	"walletMigrate/RPC"
+)
+
+//forkSettings select the local fork the fork backend rehearses on
+type forkSettings struct {
+	URL     string `json:"url"`     //a fork that is already running (anvil --fork-url ...), otherwise one is launched
+	Command string `json:"command"` //what is launched from the chain's node_url: anvil (default) or hardhat
+	Port    int    `json:"port"`    //port of the launched fork (default 8545)
+}
+
+var forkCommands = []string{"anvil", "hardhat"}
+
+func (self forkSettings) validate(field string) []error {
+	var errs []error
+	if self.URL != "" {
+		if err := validateNodeURL(field+".url", self.URL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if self.Command != "" && !contains(forkCommands, self.Command) {
+		errs = append(errs, fmt.Errorf("%s.command %q is not supported, expected one of %v", field, self.Command, forkCommands))
+	}
+	if self.Port < 0 || self.Port > 65535 {
+		errs = append(errs, fmt.Errorf("%s.port %d is out of range", field, self.Port))
+	}
+	return errs
+}
+
+//the url of the fork to run on, launching anvil (or hardhat) forked from nodeURL when no running fork is set.  stop
+//ends the launched fork and does nothing for one that was already running
+func (self forkSettings) start(nodeURL string) (url string, stop func(), err error) {
+	if self.URL != "" {
+		return self.URL, func() {}, nil
+	}
+	port := self.Port
+	if port == 0 {
+		port = 8545
+	}
+	var command *exec.Cmd
+	switch self.Command {
+	case "hardhat":
+		command = exec.Command("npx", "hardhat", "node", "--fork", nodeURL, "--port", strconv.Itoa(port))
+	default:
+		command = exec.Command("anvil", "--fork-url", nodeURL, "--port", strconv.Itoa(port), "--silent")
+	}
+	if err := command.Start(); err != nil {
+		return "", nil, fmt.Errorf("fork: can't launch %s: %v", command.Path, err)
+	}
+	stop = func() {
+		command.Process.Kill()
+		command.Wait()
+	}
+
+	url = fmt.Sprintf("http://127.0.0.1:%d", port)
+	display.logf(RPC.VerbosityNormal, "Launched a fork of the chain at %s, waiting for it to answer\n", url)
+	//the fork downloads state lazily, it only has to come up
+	for deadline := time.Now().Add(60 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+		if _, err := RPC.NewClient(url).GetChainID(); err == nil {
+			return url, stop, nil
+		}
+	}
+	stop()
+	return "", nil, fmt.Errorf("fork: %s didn't answer at %s within 60 seconds", command.Path, url)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"math/big"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//gasTankSettings is an account kept only to pay the gas of short accounts
+type gasTankSettings struct {
+	PrivateKey string      `json:"private_key"` //key of the funded gas tank account
+	MaxEth     json.Number `json:"max_eth"`     //the most it spends in a run, fees of its transfers included (default its whole balance)
+}
+
+func (self gasTankSettings) validate(field string) []error {
+	var errs []error
+	if self.PrivateKey == "" {
+		if self.MaxEth != "" {
+			errs = append(errs, fmt.Errorf("%s.max_eth needs %s.private_key", field, field))
+		}
+		return errs
+	}
+	if err := Accounts.ValidatePrivateKey(self.PrivateKey); err != nil {
+		errs = append(errs, fmt.Errorf("%s.private_key %v", field, err))
+	}
+	if _, err := self.cap(); err != nil {
+		errs = append(errs, fmt.Errorf("%s.%v", field, err))
+	}
+	return errs
+}
+
+//the most the tank may spend in wei, nil without a cap
+func (self gasTankSettings) cap() (*big.Int, error) {
+	if self.MaxEth == "" {
+		return nil, nil
+	}
+	eth, ok := new(big.Rat).SetString(self.MaxEth.String())
+	if !ok || eth.Sign() <= 0 {
+		return nil, fmt.Errorf("max_eth %q is not a positive amount of ETH", self.MaxEth)
+	}
+	wei := eth.Mul(eth, new(big.Rat).SetInt(big.NewInt(params.Ether)))
+	if !wei.IsInt() {
+		return nil, fmt.Errorf("max_eth %q has more than 18 decimals", self.MaxEth)
+	}
+	return wei.Num(), nil
+}
+
+//the account outside the migration that pays the gas of short accounts (the gas tank or the destination), nil when
+//the sources fund each other
+func (self settings) gasFunder(client RPC.Client, chain chainProfile) (*Accounts.Account, error) {
+	key, field := self.DestinationPrivateKey, "destination_private_key"
+	if self.GasTank.PrivateKey != "" {
+		key, field = self.GasTank.PrivateKey, "gas_tank.private_key"
+	}
+	if key == "" {
+		return nil, nil
+	}
+	account, err := Accounts.FromPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s %v", field, err)
+	}
+	//the funder may have transactions of its own waiting, gas transfers go after them
+	account = client.GetBalances([]Accounts.Account{account}, true)[0]
+	account.Homestead = chain.Homestead
+	display.logf(RPC.VerbosityNormal, "Gas for short accounts is paid by %s, balance %s\n", account.Address.Hex(), display.currency.Format(account.Balance))
+
+	//planning with no more than the cap keeps the tank's spending under it
+	limit, err := self.GasTank.cap()
+	if err != nil {
+		return nil, err
+	}
+	if limit != nil && account.Balance.Cmp(limit) > 0 {
+		display.logf(RPC.VerbosityNormal, "At most %s of it is spent (gas_tank.max_eth)\n", display.currency.Format(limit))
+		account.Balance = limit
+	}
+	return &account, nil
+}
+
+//report exactly what the funder gives each account and what its transfers cost
+func printSubsidies(funder *Accounts.Account, transactions []RPC.TransactionWithOriginator) {
+	received := make(map[common.Address]*big.Int)
+	var order []common.Address
+	total, fees := new(big.Int), new(big.Int)
+	for _, transaction := range transactions {
+		if transaction.Address != funder.Address {
+			continue
+		}
+		to := *transaction.SignedTx.To()
+		if _, ok := received[to]; !ok {
+			received[to] = new(big.Int)
+			order = append(order, to)
+		}
+		received[to].Add(received[to], transaction.SignedTx.Value())
+		total.Add(total, transaction.SignedTx.Value())
+		fees.Add(fees, new(big.Int).Mul(transaction.SignedTx.GasPrice(), new(big.Int).SetUint64(transaction.SignedTx.Gas())))
+	}
+	if len(order) == 0 {
+		return
+	}
+	report := table{header: []string{"Account", "Gas Subsidy"}}
+	for _, to := range order {
+		report.add(colorCyan, display.hex(to.Hex()), display.currency.Format(received[to]))
+	}
+	fmt.Printf("Gas subsidies from %s:\n", funder.Address.Hex())
+	report.print(display)
+	fmt.Printf("Total %s to %d accounts plus at most %s in fees\n", display.currency.Format(total), len(order), display.currency.Format(fees))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"io/ioutil"
+	"os"
+	"walletMigrate/RPC"
+)
+
+const defaultGasFile = "token_gas.json"
+
+//the scan pads every estimate by 1.7x, the margin over what a contract's transfers were seen to use shrinks towards
+//this as more of them are mined
+const learnedGasMargin = 1.1
+
+//the ERC-20 transfer(address,uint256) selector, the scan looks up what the transfers of a token used under it
+var transferSelector = [4]byte{0xa9, 0x05, 0x9c, 0xbb}
+
+//what the calls to one method of a contract are seen to use, the transfers of one token are the same call from every
+//account
+type gasKey struct {
+	contract common.Address
+	method   [4]byte
+}
+
+type gasSamples struct {
+	Count int    `json:"count"`
+	Most  uint64 `json:"most_gas_used"`
+}
+
+//gasUsage keeps the gas the mined contract calls used, by contract and method, across runs in the gas_file
+type gasUsage map[gasKey]gasSamples
+
+//the gas_file holds the samples by contract and then by method selector in hex
+type gasFile map[common.Address]map[string]gasSamples
+
+//load the gas used by the calls earlier runs mined, none when the file doesn't exist yet
+func loadGasUsage(path string) (gasUsage, error) {
+	usage := make(gasUsage)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return usage, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file gasFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for contract, methods := range file {
+		for method, samples := range methods {
+			key := gasKey{contract: contract}
+			if selector, err := hex.DecodeString(method); err == nil && len(selector) == 4 {
+				copy(key.method[:], selector)
+				usage[key] = samples
+			}
+		}
+	}
+	return usage, nil
+}
+
+//save the gas used for the next runs, write then rename so an interrupted save never loses what was learned before
+func (self gasUsage) save(path string) error {
+	file := make(gasFile)
+	for key, samples := range self {
+		if file[key.contract] == nil {
+			file[key.contract] = make(map[string]gasSamples)
+		}
+		file[key.contract][hex.EncodeToString(key.method[:])] = samples
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func callKey(transaction *types.Transaction) (gasKey, bool) {
+	if transaction.To() == nil || len(transaction.Data()) < 4 {
+		return gasKey{}, false
+	}
+	key := gasKey{contract: *transaction.To()}
+	copy(key.method[:], transaction.Data()[:4])
+	return key, true
+}
+
+//observe the gas a mined call used, a reverted one tells nothing about what it needs to succeed
+func (self gasUsage) observe(transaction *types.Transaction, receipt *types.Receipt) {
+	key, ok := callKey(transaction)
+	if !ok || receipt == nil || receipt.Status != types.ReceiptStatusSuccessful {
+		return
+	}
+	samples := self[key]
+	samples.Count++
+	if receipt.GasUsed > samples.Most {
+		samples.Most = receipt.GasUsed
+	}
+	self[key] = samples
+}
+
+//the gas limit the call needs by what the same calls used so far, false when none were mined
+func (self gasUsage) limit(transaction *types.Transaction) (uint64, bool) {
+	key, ok := callKey(transaction)
+	if !ok {
+		return 0, false
+	}
+	return self.limitOf(key)
+}
+
+//the most any of the calls used with a margin of 1.7x after the first, tightening to learnedGasMargin as more are mined
+func (self gasUsage) limitOf(key gasKey) (uint64, bool) {
+	samples := self[key]
+	if samples.Count == 0 {
+		return 0, false
+	}
+	margin := 1 + 0.7/float64(samples.Count)
+	if margin < learnedGasMargin {
+		margin = learnedGasMargin
+	}
+	return uint64(float64(samples.Most) * margin), true
+}
+
+//the gas limits of the token transfers mined so far by contract, for the scan to use instead of estimating them
+func (self gasUsage) transferLimits() map[common.Address]uint64 {
+	limits := make(map[common.Address]uint64)
+	for key := range self {
+		if key.method != transferSelector {
+			continue
+		}
+		if limit, ok := self.limitOf(key); ok {
+			limits[key.contract] = limit
+		}
+	}
+	display.logf(RPC.VerbosityDebug, "gas limits learned by earlier runs: %d tokens\n", len(limits))
+	return limits
+}
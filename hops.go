@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sort"
+	"strings"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+	"walletMigrate/State"
+)
+
+//hopSettings sends everything through intermediate addresses before the destinations so the old and new wallets
+//aren't linked by a direct transfer
+type hopSettings struct {
+	Mnemonic string `json:"mnemonic"` //fresh seed phrase the intermediate addresses are derived from
+	Count    int    `json:"count"`    //intermediate addresses between each account and its destinations (0 sends directly)
+}
+
+func (self hopSettings) validate(field string, in settings) []error {
+	var errs []error
+	if self.Count < 0 || self.Count > 5 {
+		errs = append(errs, fmt.Errorf("%s.count %d is out of range, expected 0 to 5", field, self.Count))
+	}
+	if self.Count == 0 {
+		return errs
+	}
+	if err := Accounts.ValidateMnemonic(self.Mnemonic); err != nil {
+		errs = append(errs, fmt.Errorf("%s.mnemonic %v", field, err))
+	}
+	for i, mnemonic := range in.Mnemonics {
+		if strings.TrimSpace(mnemonic.Phrase) == strings.TrimSpace(self.Mnemonic) {
+			errs = append(errs, fmt.Errorf("%s.mnemonic is also mnemonics[%d], the intermediate addresses must come from a fresh seed phrase", field, i))
+		}
+	}
+	if !in.migrates("eth") {
+		errs = append(errs, fmt.Errorf("%s needs the eth asset class, the intermediate addresses pay their fees from the swept ETH", field))
+	}
+	return errs
+}
+
+//the intermediate addresses of every account, hop h of the account given address index i is m/44'/60'/0'/{h}/{i} of
+//the hop mnemonic, the index is kept in the state file so a re-run sends an account's leftovers through the same hops
+func (self hopSettings) derive(state *State.State, accounts []Accounts.Account) (map[common.Address][]Accounts.Account, error) {
+	hops := make(map[common.Address][]Accounts.Account)
+	if self.Count == 0 {
+		return hops, nil
+	}
+	next := uint32(0)
+	for _, index := range state.HopIndexes {
+		if index >= next {
+			next = index + 1
+		}
+	}
+	//assign in address order so the same accounts always get the same hops
+	sorted := make([]Accounts.Account, len(accounts))
+	copy(sorted, accounts)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Address.Hex() < sorted[j].Address.Hex()
+	})
+	for _, account := range sorted {
+		index, found := state.HopIndex(account.Address)
+		if !found {
+			index = next
+			next++
+			state.SetHopIndex(account.Address, index)
+		}
+		for hop := 0; hop < self.Count; hop++ {
+			intermediate, err := Accounts.DeriveAccount(self.Mnemonic, fmt.Sprintf("m/44'/60'/0'/%d/%d", hop, index))
+			if err != nil {
+				return nil, err
+			}
+			hops[account.Address] = append(hops[account.Address], intermediate)
+		}
+	}
+	return hops, nil
+}
+
+//a route sending each account (or the hop before) whole to its next hop, token_destinations and splits only apply
+//on the way out of the last hop
+func hopRoute(routes route, hops map[common.Address][]Accounts.Account, level int) route {
+	next := route{splits: routes.splits, rotated: make(map[common.Address]common.Address), byToken: make(map[common.Address]common.Address)}
+	for source, chain := range hops {
+		from := source
+		if level > 0 {
+			from = chain[level-1].Address
+		}
+		next.rotated[from] = chain[level].Address
+	}
+	return next
+}
+
+//the route out of the last hop, each last hop goes where its account would have gone
+func lastHopRoute(routes route, hops map[common.Address][]Accounts.Account) route {
+	last := route{splits: routes.splits, splitTokens: routes.splitTokens, rotated: make(map[common.Address]common.Address), byToken: routes.byToken}
+	for source, chain := range hops {
+		if to, found := routes.rotated[source]; found {
+			last.rotated[chain[len(chain)-1].Address] = to
+		}
+	}
+	return last
+}
+
+//the accounts sending through hops in address order, ranging over the map would print and forward them in a different
+//order on every run
+func hopSources(hops map[common.Address][]Accounts.Account) []common.Address {
+	sources := make([]common.Address, 0, len(hops))
+	for source := range hops {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Hex() < sources[j].Hex()
+	})
+	return sources
+}
+
+func printHops(hops map[common.Address][]Accounts.Account) {
+	report := table{header: []string{"Account", "Intermediate Addresses"}}
+	for _, source := range hopSources(hops) {
+		chain := hops[source]
+		var addresses []string
+		for _, hop := range chain {
+			addresses = append(addresses, display.hex(hop.Address.Hex()))
+		}
+		report.add(colorCyan, display.hex(source.Hex()), strings.Join(addresses, " -> "))
+	}
+	fmt.Println("Assets are sent through these intermediate addresses before the destinations:")
+	report.print(display)
+}
+
+//move whatever arrived at each level of hops on to the next one and finally to the destinations, the hops pay their
+//own fees from the ETH their own chain swept into them, returns the number of failed transactions
+func (self broadcaster) forwardHops(routes route, hops map[common.Address][]Accounts.Account, count int, gasPrice *big.Int, gasLimit int64) int {
+	failed := 0
+	for level := 0; level < count; level++ {
+		next := lastHopRoute(routes, hops)
+		if level+1 < count {
+			next = hopRoute(routes, hops, level+1)
+		}
+		var intermediates []Accounts.Account
+		for _, source := range hopSources(hops) {
+			intermediate := hops[source][level]
+			intermediate.Homestead = self.chain.Homestead
+			intermediates = append(intermediates, intermediate)
+		}
+		display.logf(RPC.VerbosityNormal, "Forwarding from %d intermediate addresses (hop %d of %d)\n", len(intermediates), level+1, count)
+		scanned := self.client.GetUsedAccounts(intermediates, routes.primary(), false, gasLimit)
+
+		//each hop pays its fees from what its own chain sent it, gas from another account's hop would link the two
+		//chains on chain, a hop left short keeps its tokens and they are reported as any other underfunded account's
+		var updated []Accounts.Account
+		for _, account := range scanned {
+			own, _ := transferGas(gasPrice, big.NewInt(0), nil, []Accounts.Account{account}, nil)
+			updated = append(updated, own...)
+		}
+		var executed []RPC.TransactionWithOriginator
+		tokenTransactions := transferTokens(self.client, true, next, gasPrice, updated, make([]RPC.TransactionWithOriginator, 0))
+		self.sendTransactions("token", tokenTransactions)
+		executed = append(executed, tokenTransactions...)
+		balanceTransactions := transferBalances(self.client, next, big.NewInt(0), gasPrice, updated, false, executed, make([]RPC.TransactionWithOriginator, 0))
+		self.sendTransactions("balance", balanceTransactions)
+		executed = append(executed, balanceTransactions...)
+		receipts := self.client.GetReceipts(executed)
+		self.recordReceipts(executed, receipts)
+		failed += countFailed(executed, receipts)
+	}
+	return failed
+}
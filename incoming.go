@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"time"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//how often the pending pool is checked again while waiting for incoming transfers
+const incomingPollInterval = 15 * time.Second
+
+//warn about transfers to the source addresses still waiting to be mined, a deposit landing after the sweep would be
+//stranded at an address about to be abandoned, with wait set the scan is held back until they are mined or it runs out
+func awaitIncoming(client RPC.Client, accounts []Accounts.Account, wait int) {
+	addresses := make(map[common.Address]bool)
+	for _, account := range accounts {
+		addresses[account.Address] = true
+	}
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for {
+		incoming, err := client.GetPendingIncoming(addresses)
+		if err != nil {
+			//plenty of providers don't serve the pending block, the migration doesn't depend on it
+			display.logf(RPC.VerbosityVerbose, "Could not check the pending pool for incoming transfers: %v\n", err)
+			return
+		}
+		if len(incoming) == 0 {
+			return
+		}
+		printIncoming(incoming)
+		if !time.Now().Before(deadline) {
+			if wait > 0 {
+				fmt.Println(display.paint(colorRed, "WARNING: gave up waiting, these transfers will arrive after the sweep, run the migration again once they are mined"))
+			} else {
+				fmt.Println(display.paint(colorRed, "WARNING: these transfers will arrive after the sweep, set wait_for_incoming or run the migration again once they are mined"))
+			}
+			return
+		}
+		display.logf(RPC.VerbosityNormal, "Waiting for %d incoming transfers to be mined, %s left\n", len(incoming), time.Until(deadline).Round(time.Second))
+		time.Sleep(incomingPollInterval)
+	}
+}
+
+func printIncoming(incoming []RPC.IncomingTransfer) {
+	report := table{header: []string{"To", "From", "Asset", "Amount", "Transaction"}}
+	for _, transfer := range incoming {
+		if transfer.Token == nil {
+			report.add(colorYellow, display.hex(transfer.To.Hex()), display.hex(transfer.From.Hex()), display.currency.Symbol, display.currency.Format(transfer.Value), display.hex(transfer.Hash.Hex()))
+		} else {
+			report.add(colorYellow, display.hex(transfer.To.Hex()), display.hex(transfer.From.Hex()), display.hex(transfer.Token.Hex()), transfer.Value.String(), display.hex(transfer.Hash.Hex()))
+		}
+	}
+	fmt.Println(display.paint(colorYellow, "Pending transfers to source addresses:"))
+	report.print(display)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"walletMigrate/Accounts"
+	"walletMigrate/Errors"
+	"walletMigrate/RPC"
+)
+
+//rebuild the balance each account sweeps from what the earlier phases actually cost instead of what they were planned
+//to cost.  The confirmed balance already includes the refunds of mined transactions (gas used below the gas limit),
+//the transactions that are still in flight hold back their value and their full fee since the sweep is only mined
+//after them.  The planned and paid fee of every account is printed so refunds and overruns can be checked
+func settledBalances(client RPC.Client, accounts []Accounts.Account, earlier []RPC.TransactionWithOriginator) []Accounts.Account {
+	receipts := client.GetReceipts(earlier)
+	planned := make(map[common.Address]*big.Int)
+	paid := make(map[common.Address]*big.Int)
+	unmined := make(map[common.Address]*big.Int) //the planned fees of the transactions still in flight
+	inFlight := make(map[common.Address]*big.Int)
+	for _, transaction := range earlier {
+		tx := transaction.SignedTx
+		if planned[transaction.Address] == nil {
+			planned[transaction.Address], paid[transaction.Address] = new(big.Int), new(big.Int)
+			unmined[transaction.Address], inFlight[transaction.Address] = new(big.Int), new(big.Int)
+		}
+		fee := new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(tx.Gas()))
+		planned[transaction.Address].Add(planned[transaction.Address], fee)
+		receipt := receipts[tx.Hash()]
+		if receipt == nil {
+			unmined[transaction.Address].Add(unmined[transaction.Address], fee)
+			inFlight[transaction.Address].Add(inFlight[transaction.Address], fee)
+			inFlight[transaction.Address].Add(inFlight[transaction.Address], tx.Value())
+			continue
+		}
+		paid[transaction.Address].Add(paid[transaction.Address], new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(receipt.GasUsed)))
+	}
+
+	report := table{header: []string{"Address", "Planned Fees", "Paid Fees", "Refunded", "In Flight", "Sweepable"}}
+	for x := range accounts {
+		balance, err := client.GetBalance(accounts[x].Address)
+		if err != nil {
+			Errors.Log(Errors.RPCError, "M14", err)
+			continue
+		}
+		held := inFlight[accounts[x].Address]
+		if held != nil {
+			balance.Sub(balance, held)
+		}
+		if balance.Sign() < 0 {
+			balance.SetInt64(0)
+		}
+		accounts[x].Balance.Set(balance)
+		if held == nil {
+			continue
+		}
+		address := accounts[x].Address
+		refunded := new(big.Int).Sub(planned[address], paid[address])
+		refunded.Sub(refunded, unmined[address])
+		color := ""
+		if held.Sign() > 0 {
+			color = colorYellow
+		}
+		report.add(color, display.hex(address.Hex()), display.currency.Format(planned[address]), display.currency.Format(paid[address]), display.currency.Format(refunded), display.currency.Format(held), display.currency.Format(balance))
+	}
+	if display.verbosity >= RPC.VerbosityVerbose && len(report.rows) > 0 {
+		report.print(display)
+	}
+	return accounts
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+	"walletMigrate/Encryption"
+	"walletMigrate/Errors"
+)
+
+//the states of a job
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobFinished = "finished"
+)
+
+//the files of a job's directory, the rest are written by its run
+const (
+	jobFile         = "job.json"
+	jobOutputFile   = "output.log"
+	jobSettingsFile = "settings.json"
+	jobsLockFile    = "server.lock" //in the jobs directory, holds the pid of the server using it
+)
+
+//job is a run of this program the api servers start for their clients: a scan is a simulated migration writing its
+//plan to the job's directory, an execute broadcasts the plan of an earlier migration.  A job submitted with settings
+//of its own runs in its directory so the state file, audit log and retry queue it names are kept there
+type job struct {
+	ID       string     `json:"id"`
+	Command  string     `json:"command"` //migrate, retry, clear, status or execute
+	Chain    string     `json:"chain,omitempty"`
+	Assets   string     `json:"assets,omitempty"`   //comma separated asset classes the run is limited to
+	Simulate bool       `json:"simulate,omitempty"` //a scan, simulated whatever the settings say
+	Settings string     `json:"settings,omitempty"` //the job's own settings file instead of the server's
+	Plan     string     `json:"plan"`               //the plan file the run writes or the execute broadcasts
+	Previous string     `json:"previous,omitempty"` //the earlier job whose settings and directory the run shares
+	State    string     `json:"state"`
+	ExitCode int        `json:"exit_code"` //see Exit Codes, set once finished
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"` //unset until the job finished
+	output   []string
+	updated  chan struct{} //closed and replaced whenever the job prints a line or changes state
+}
+
+//jobQueue runs its jobs one at a time in the order they were added, runs share the state file, the audit log and the
+//nonces of the same accounts so they can't overlap.  Every job is kept in its directory and the queue is loaded
+//from them again when the server restarts
+type jobQueue struct {
+	settingsArg string   //the settings argument the server was started with, passed on to every run
+	overrides   []string //the server's -set overrides
+	dir         string   //each job keeps its plan, status file and output in a directory of its own here
+	lock        sync.Mutex
+	jobs        map[string]*job
+	pending     []*job        //queued jobs in order, guarded by lock
+	wake        chan struct{} //signalled when a job is queued
+}
+
+func newJobQueue(settingsArg string, overrides []string, dir string) (*jobQueue, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	//the serve, grpc and dashboard commands each run a queue, two on the same directory would run the same jobs twice
+	if err := lockJobsDir(dir); err != nil {
+		return nil, err
+	}
+	queue := &jobQueue{settingsArg: settingsArg, overrides: overrides, dir: dir, jobs: make(map[string]*job), wake: make(chan struct{}, 1)}
+	queued, err := queue.load()
+	if err != nil {
+		queue.unlock()
+		return nil, err
+	}
+	queue.pending = queued
+	go queue.consume()
+	return queue, nil
+}
+
+//take the jobs directory for this server, a lock left by a server that is no longer running is taken over
+func lockJobsDir(dir string) error {
+	path := filepath.Join(dir, jobsLockFile)
+	for attempt := 0; ; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}
+		if !os.IsExist(err) || attempt > 0 {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var pid int
+		if _, err := fmt.Sscan(string(data), &pid); err == nil && processRunning(pid) {
+			return fmt.Errorf("%s is used by another server (pid %d), give each server a jobs_dir of its own", dir, pid)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+}
+
+//whether a process with the pid is running, signal 0 only checks it exists and windows can't send it
+func processRunning(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true //FindProcess fails there for a process that is gone
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+//release the jobs directory for the next server
+func (self *jobQueue) unlock() {
+	if err := os.Remove(filepath.Join(self.dir, jobsLockFile)); err != nil && !os.IsNotExist(err) {
+		Errors.Log(Errors.FileError, "M20", err)
+	}
+}
+
+//run the queued jobs one at a time for as long as the server runs
+func (self *jobQueue) consume() {
+	for {
+		self.lock.Lock()
+		if len(self.pending) == 0 {
+			self.lock.Unlock()
+			<-self.wake
+			continue
+		}
+		next := self.pending[0]
+		self.pending = self.pending[1:]
+		self.lock.Unlock()
+		self.run(next)
+	}
+}
+
+//load the jobs of an earlier server and return the ones still queued in order, a job that was running when it
+//stopped was cut off and is finished as aborted
+func (self *jobQueue) load() ([]*job, error) {
+	directories, err := ioutil.ReadDir(self.dir)
+	if err != nil {
+		return nil, err
+	}
+	var queued []*job
+	for _, directory := range directories {
+		if !directory.IsDir() {
+			continue //the lock file
+		}
+		path := filepath.Join(self.dir, directory.Name(), jobFile)
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		loaded := &job{updated: make(chan struct{})}
+		if err := json.Unmarshal(data, loaded); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if output, err := ioutil.ReadFile(self.file(loaded, jobOutputFile)); err == nil {
+			lines := bufio.NewScanner(bytes.NewReader(output))
+			lines.Buffer(make([]byte, 64*1024), 16*1024*1024)
+			for lines.Scan() {
+				line, err := Encryption.DecryptLine(lines.Bytes())
+				if err != nil {
+					loaded.output = append(loaded.output, "ERROR: "+err.Error())
+					break
+				}
+				loaded.output = append(loaded.output, string(line))
+			}
+		}
+		switch loaded.State {
+		case jobRunning:
+			loaded.output = append(loaded.output, "ERROR: the server stopped while the job was running")
+			finished := time.Now().UTC()
+			loaded.State, loaded.ExitCode, loaded.Finished = jobFinished, exitAborted, &finished
+			if err := self.save(loaded); err != nil {
+				return nil, err
+			}
+		case jobQueued:
+			queued = append(queued, loaded)
+		}
+		self.jobs[loaded.ID] = loaded
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].Created.Before(queued[j].Created) })
+	return queued, nil
+}
+
+//scan queues a simulated migration of chain (the only chain when empty) with the server's settings that writes a plan
+func (self *jobQueue) scan(chain string, assets string) (job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return job{}, err
+	}
+	return self.add(&job{ID: id, Command: "migrate", Chain: chain, Assets: assets, Simulate: true}, nil)
+}
+
+//submit queues a run of command with the settings it was submitted with, kept in the job's directory
+func (self *jobQueue) submit(command string, chain string, assets string, settingsData []byte) (job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return job{}, err
+	}
+	return self.add(&job{ID: id, Command: command, Chain: chain, Assets: assets, Settings: filepath.Join(self.dir, id, jobSettingsFile)}, settingsData)
+}
+
+//followUp queues command with the settings and in the directory of an earlier job: retrying its failures, clearing
+//or reporting on its transactions, or executing the plan it wrote
+func (self *jobQueue) followUp(command string, previousID string) (job, error) {
+	previous, found := self.get(previousID)
+	switch {
+	case !found:
+		return job{}, fmt.Errorf("there is no job %s", previousID)
+	case previous.State != jobFinished:
+		return job{}, fmt.Errorf("job %s is still %s", previousID, previous.State)
+	case command == "execute" && previous.Command != "migrate":
+		return job{}, fmt.Errorf("job %s is not a migration, it has no plan", previousID)
+	}
+	if _, err := os.Stat(previous.Plan); command == "execute" && err != nil {
+		return job{}, fmt.Errorf("job %s wrote no plan (exit code %d)", previousID, previous.ExitCode)
+	}
+	id, err := newJobID()
+	if err != nil {
+		return job{}, err
+	}
+	return self.add(&job{ID: id, Command: command, Chain: previous.Chain, Settings: previous.Settings, Plan: previous.Plan, Previous: previousID}, nil)
+}
+
+//add the job to the queue, with the settings it was submitted with when it has its own
+func (self *jobQueue) add(added *job, settingsData []byte) (job, error) {
+	if err := os.MkdirAll(filepath.Join(self.dir, added.ID), 0700); err != nil {
+		return job{}, err
+	}
+	if settingsData != nil {
+		if err := ioutil.WriteFile(added.Settings, settingsData, 0600); err != nil {
+			return job{}, err
+		}
+	}
+	if added.Plan == "" {
+		added.Plan = chainProfile{name: added.Chain}.file(self.file(added, "plan.json"))
+	}
+	added.State, added.Created, added.updated = jobQueued, time.Now().UTC(), make(chan struct{})
+	if err := self.save(added); err != nil {
+		return job{}, err
+	}
+	self.lock.Lock()
+	self.jobs[added.ID] = added
+	self.pending = append(self.pending, added)
+	self.lock.Unlock()
+	select {
+	case self.wake <- struct{}{}:
+	default: //the consumer was already woken and finds this job too
+	}
+	return *added, nil
+}
+
+//keep the job in its directory, it is written again whenever its state changes
+func (self *jobQueue) save(saved *job) error {
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(self.file(saved, jobFile), data, 0600)
+}
+
+//the path of a file in the job's directory
+func (self *jobQueue) file(owner *job, name string) string {
+	return filepath.Join(self.dir, owner.ID, name)
+}
+
+//get a copy of the job, safe to read while it runs
+func (self *jobQueue) get(id string) (job, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	found, ok := self.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *found, true
+}
+
+//list copies of every job, oldest first
+func (self *jobQueue) list() []job {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	jobs := make([]job, 0, len(self.jobs))
+	for _, listed := range self.jobs {
+		jobs = append(jobs, *listed)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs
+}
+
+//follow calls send with each line the job printed from line from on and the job as it was then, until the job
+//finished or done is closed.  send is last called with an empty line once the job finished
+func (self *jobQueue) follow(id string, from int, done <-chan struct{}, send func(line string, current job) error) error {
+	for {
+		self.lock.Lock()
+		followed, ok := self.jobs[id]
+		if !ok {
+			self.lock.Unlock()
+			return fmt.Errorf("there is no job %s", id)
+		}
+		current, lines, updated := *followed, followed.output[from:], followed.updated
+		self.lock.Unlock()
+		for _, line := range lines {
+			if err := send(line, current); err != nil {
+				return err
+			}
+		}
+		from += len(lines)
+		if current.State == jobFinished {
+			return send("", current)
+		}
+		select {
+		case <-updated:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+//update the job under the lock and wake its followers
+func (self *jobQueue) update(updated *job, change func()) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	change()
+	close(updated.updated)
+	updated.updated = make(chan struct{})
+}
+
+//run the job as a child process of this program, its output is kept line by line in the job's output file
+func (self *jobQueue) run(next *job) {
+	self.update(next, func() { next.State = jobRunning })
+	self.saveOrLog(next)
+	output, err := os.OpenFile(self.file(next, jobOutputFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		Errors.Log(Errors.FileError, "M20", err)
+		output = nil
+	}
+	printLine := func(line string) {
+		self.update(next, func() { next.output = append(next.output, line) })
+		if output != nil {
+			//encrypted line by line like the audit log, a line that can't be is left out rather than kept in the clear
+			encrypted, err := Encryption.EncryptLine([]byte(line))
+			if err != nil {
+				Errors.Log(Errors.FileError, "M20", err)
+				return
+			}
+			fmt.Fprintln(output, string(encrypted))
+		}
+	}
+	code := exitAborted
+	child, err := self.start(next)
+	if err != nil {
+		printLine("ERROR: " + err.Error())
+	} else {
+		lines := bufio.NewScanner(child.stdout)
+		lines.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for lines.Scan() {
+			printLine(lines.Text())
+		}
+		//a line too long to keep mustn't leave the run blocked on a full pipe
+		io.Copy(ioutil.Discard, child.stdout)
+		code = child.wait()
+	}
+	if output != nil {
+		output.Close()
+	}
+	self.update(next, func() {
+		finished := time.Now().UTC()
+		next.State, next.ExitCode, next.Finished = jobFinished, code, &finished
+	})
+	self.saveOrLog(next)
+}
+
+func (self *jobQueue) saveOrLog(saved *job) {
+	if err := self.save(saved); err != nil {
+		Errors.Log(Errors.FileError, "M20", err)
+	}
+}
+
+type childRun struct {
+	stdout io.Reader
+	wait   func() int
+}
+
+func (self *jobQueue) start(next *job) (*childRun, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	settingsArg := next.Settings
+	if settingsArg == "" {
+		settingsArg = self.settingsArg
+		for _, override := range self.overrides {
+			args = append(args, "-set", override)
+		}
+	}
+	args = append(args, "-set", "status_file="+self.file(next, "status.json"))
+	if next.Chain != "" {
+		args = append(args, "-chain", next.Chain)
+	}
+	if next.Assets != "" {
+		args = append(args, "-assets", next.Assets)
+	}
+	if next.Simulate {
+		args = append(args, "-set", "simulate=true")
+	}
+	//the run names the plan file after the chain like every other file, it is given the name without the chain
+	args = append(args, "-set", "plan_file="+filepath.Join(self.dir, workingJobID(next), "plan.json"), next.Command)
+	if settingsArg != "" {
+		args = append(args, settingsArg)
+	}
+	reader, writer := io.Pipe()
+	command := exec.Command(executable, args...)
+	command.Stdout, command.Stderr = writer, writer
+	if next.Settings != "" {
+		//the files the settings name are kept with the job, a follow up shares those of the job it follows
+		command.Dir = filepath.Join(self.dir, workingJobID(next))
+	}
+	if err := command.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan int, 1)
+	go func() {
+		err := command.Wait()
+		writer.Close()
+		code := exitCompleted
+		if exit, ok := err.(*exec.ExitError); ok {
+			code = exit.ExitCode()
+		} else if err != nil {
+			code = exitAborted
+		}
+		done <- code
+	}()
+	return &childRun{stdout: reader, wait: func() int { return <-done }}, nil
+}
+
+//the job whose directory the run works in: its own, or that of the earlier job it follows up on
+func workingJobID(next *job) string {
+	if next.Previous != "" {
+		return next.Previous
+	}
+	return next.ID
+}
+
+func newJobID() (string, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(random), nil
+}
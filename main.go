@@ -3,180 +3,1095 @@ package main
 import (
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"golang.org/x/crypto/sha3"
 	"log"
 	"math/big"
 	"os"
 	"sort"
+	"strings"
+	"time"
 	"walletMigrate/Accounts"
+	"walletMigrate/Audit"
+	"walletMigrate/Encryption"
+	"walletMigrate/Errors"
+	"walletMigrate/Plan"
 	"walletMigrate/RPC"
+	"walletMigrate/Redaction"
+	"walletMigrate/State"
 )
 
+var commands = []string{"migrate", "retry", "clear", "status", "execute", "sign-server", "grpc", "serve", "dashboard"}
+
+//settingOverrides collects the repeatable -set flag
+type settingOverrides []string
+
+func (self *settingOverrides) String() string {
+	return strings.Join(*self, ", ")
+}
+
+func (self *settingOverrides) Set(value string) error {
+	*self = append(*self, value)
+	return nil
+}
+
 type settings struct {
-	NodeURL            string   `json:"node_url"`                 //your infura access url
-	DestinationAddress string   `json:"destination_address"`      //the address to consolidate the funds too
-	Mnemonics          []string `json:"mnemonics"`                //seed phrases to generate accounts to consolidate
-	PrivateKeys        []string `json:"private_keys"`             //private keys to single accounts
-	GasPriceMultiplier float64  `json:"gas_price_multiplier"`     //multiplier for the suggested gas price
-	Simulate           bool     `json:"simulate"`                 //do nothing but print out the tx details of what would be done
-	NumberOfAccounts   int      `json:"number_of_accounts"`       //for mnemonic phrases this is the number of accounts squared that will be generated
-	PendingNonce       bool     `json:"pending_nonce"`            //should begin process with pending nonce (any pending tx must complete before liquidation can occur)
-	TransferGasLimit   int64    `json:"token_transfer_gas_limit"` //override calculated token transfer gas limits
+	Version                  int                     `json:"version"`                     //settings schema version, older versions are upgraded when loaded
+	NodeURL                  string                  `json:"node_url"`                    //your infura access url
+	ChainlistFile            string                  `json:"chainlist_file"`              //more chain presets merged over the built-in ones
+	Chain                    string                  `json:"chain"`                       //registry preset of the chain, e.g. base, fills in anything node_url and the rest leave unset
+	BeaconURL                string                  `json:"beacon_url"`                  //beacon node checked for validators withdrawing to the source addresses
+	BroadcastURLs            []string                `json:"broadcast_urls"`              //more nodes or broadcast services each raw transaction is also sent to
+	DestinationAddress       string                  `json:"destination_address"`         //the address to consolidate the funds too
+	Destinations             []destination           `json:"destinations"`                //weighted addresses to split the funds across instead of the single destination_address
+	SplitTokens              bool                    `json:"split_tokens"`                //split tokens across the destinations too, otherwise they all go to the first destination
+	TokenDestinations        map[string]string       `json:"token_destinations"`          //token contract to the address that receives it instead of the destinations
+	RotateDestinations       bool                    `json:"rotate_destinations"`         //give each account one of the destinations to itself instead of splitting
+	DestinationXpub          string                  `json:"destination_xpub"`            //rotate through receiving addresses derived from this extended public key
+	Mnemonics                []mnemonicSetting       `json:"mnemonics"`                   //seed phrases to generate accounts to consolidate
+	TargetAddresses          []string                `json:"target_addresses"`            //only migrate these addresses, wherever they are found in the derivation grid
+	ExcludeAddresses         []string                `json:"exclude_addresses"`           //derived addresses left alone, neither funded with gas nor swept
+	DestinationPrivateKey    string                  `json:"destination_private_key"`     //pay the gas of short accounts from the destination instead of other accounts
+	GasTank                  gasTankSettings         `json:"gas_tank"`                    //an account kept only to pay the gas of short accounts
+	PrivateKeys              []string                `json:"private_keys"`                //private keys to single accounts
+	ExtendedKeys             []extendedKeySetting    `json:"extended_keys"`               //account level xprv (signed for) or xpub (watch-only) keys to generate accounts from
+	BrainWallets             []string                `json:"brain_wallets"`               //passphrases whose keccak256 hash is the key, only with allow_brain_wallets
+	AllowBrainWallets        bool                    `json:"allow_brain_wallets"`         //accept brain_wallets, whose keys anyone can guess
+	Fee                      feeSettings             `json:"fee"`                         //how gas prices are chosen
+	Simulate                 bool                    `json:"simulate"`                    //do nothing but print out the tx details of what would be done
+	Backend                  string                  `json:"backend"`                     //node (default) sends to the network, simulated or fork rehearse the whole run on a local chain
+	Fork                     forkSettings            `json:"fork"`                        //the local fork the fork backend runs on
+	NumberOfAccounts         int                     `json:"number_of_accounts"`          //for mnemonic phrases this is the default number of change values and address indexes (so accounts squared) that will be generated
+	NumberOfHardenedAccounts int                     `json:"number_of_hardened_accounts"` //for mnemonic phrases this is the number of hardened account' values (m/44'/60'/N') that will be generated
+	Nonces                   map[string]uint64       `json:"nonces"`                      //starting nonce of these addresses, overrides what the node reports
+	PendingNonce             bool                    `json:"pending_nonce"`               //should begin process with pending nonce (any pending tx must complete before liquidation can occur)
+	TransferGasLimit         int64                   `json:"token_transfer_gas_limit"`    //override calculated token transfer gas limits
+	KeepWei                  json.Number             `json:"keep_wei"`                    //wei left in every account after the final sweep
+	KeepEth                  json.Number             `json:"keep_eth"`                    //the same reserve in ETH, e.g. 0.01
+	Assets                   []string                `json:"assets"`                      //only migrate these asset classes (eth, tokens, nfts), default all
+	MaxFeePercent            float64                 `json:"max_fee_percent"`             //leave tokens behind whose transfer costs more than this percentage of their USD value
+	MinAccountValue          minValueSettings        `json:"min_account_value"`           //accounts worth less are left alone
+	AllowDelegatedAccounts   bool                    `json:"allow_delegated_accounts"`    //migrate accounts with an EIP-7702 delegation instead of skipping them
+	WaitForIncoming          int                     `json:"wait_for_incoming"`           //seconds to wait for pending transfers to the source addresses to be mined before the scan
+	SweeperCheckBlocks       uint64                  `json:"sweeper_check_blocks"`        //recent blocks searched for sweeper bots on the source addresses (default 50)
+	NoSweeperCheck           bool                    `json:"no_sweeper_check"`            //skip the sweeper bot check
+	Counterparties           int                     `json:"counterparties"`              //list the addresses each account sent tokens to most often, this many per account
+	AllowReplay              bool                    `json:"allow_replay"`                //run even when configured chains share a chain id
+	Hops                     hopSettings             `json:"hops"`                        //send everything through intermediate addresses before the destinations
+	Privacy                  privacySettings         `json:"privacy"`                     //randomized ordering and delays between broadcasts
+	Schedule                 scheduleSettings        `json:"schedule"`                    //broadcast only within a daily window and not after a deadline
+	Throttle                 throttleSettings        `json:"throttle"`                    //broadcast at most this many transactions a block or a minute
+	MaxInFlight              int                     `json:"max_in_flight"`               //pipeline each account's token transfers and sweep, keeping at most this many unmined at once
+	NoBalanceRefresh         bool                    `json:"no_balance_refresh"`          //sign token transfers with the balances read during the scan instead of reading them again
+	NoColor                  bool                    `json:"no_color"`                    //disable colored output (also disabled when NO_COLOR is set or output is not a terminal)
+	TruncateHex              int                     `json:"truncate_hex"`                //shorten addresses and hashes to this many hex characters on each side (0 prints them in full)
+	Notify                   bool                    `json:"notify"`                      //show a desktop notification when a phase is done, transactions revert and the run finishes
+	Email                    emailSettings           `json:"email"`                       //email the final report, and with alerts each failure, through this mail server
+	Paging                   pagingSettings          `json:"paging"`                      //page an on-call operator through PagerDuty or Opsgenie when transactions revert or stall and when the run is aborted
+	StatusFile               string                  `json:"status_file"`                 //write the outcome of the run as json to this file
+	RecordRPC                string                  `json:"record_rpc"`                  //keep every answer of the node in this file so the run can be replayed offline
+	ReplayRPC                string                  `json:"replay_rpc"`                  //answer the node's requests from a record_rpc file instead of the node
+	PlanFile                 string                  `json:"plan_file"`                   //simulated runs write their signed transactions here for the execute command
+	PlanMaxAge               uint64                  `json:"plan_max_age"`                //blocks after which the execute command refuses a plan (0 for no limit)
+	Approvers                []string                `json:"approvers"`                   //addresses of the keys one of which must approve a plan before it is executed
+	Encryption               encryptionSettings      `json:"encryption"`                  //encrypt the state file, retry queue, plan and recording to these recipients
+	Signer                   signerSettings          `json:"signer"`                      //keep the keys on a sign-server and plan without them
+	API                      apiSettings             `json:"api"`                         //let other programs drive migrations through the grpc and serve commands and people through the dashboard
+	FixedTime                string                  `json:"fixed_time"`                  //RFC 3339 time written to the status file instead of the clock so two dry runs can be diffed
+	AuditLog                 string                  `json:"audit_log"`                   //append every broadcast transaction and its receipt to this hash chained file
+	RetryQueue               string                  `json:"retry_queue"`                 //where failed transactions are queued for the retry command (default retry_queue.json)
+	StateFile                string                  `json:"state_file"`                  //record of every broadcast transaction used to make re-runs skip completed work (default migration_state.json)
+	GasFile                  string                  `json:"gas_file"`                    //gas used by the token transfers of earlier runs, used instead of estimating them again (default token_gas.json)
+	OwnershipProofs          string                  `json:"ownership_proofs"`            //write a message signed by every source account authorizing the migration to this file
+	Chains                   map[string]chainProfile `json:"chains"`                      //named chains to migrate instead of the single node_url, selected with -chain
 }
 
 func main() {
-	args := os.Args[1:]
-	if len(args) != 1 {
+	verbose := flag.Bool("v", false, "verbose output, includes skipped tokens and per account scan results")
+	debug := flag.Bool("vv", false, "debug output, includes raw RPC interactions and gas math")
+	quiet := flag.Bool("quiet", false, "only print transactions and errors")
+	flag.BoolVar(quiet, "q", false, "shorthand for -quiet")
+	verifyAudit := flag.String("verify-audit", "", "verify the hash chain of an audit log file and exit")
+	approvePlan := flag.String("approve-plan", "", "approve a plan file for the execute command with the key in -approval-key and exit")
+	approvalKey := flag.String("approval-key", "", "file holding the hex private key -approve-plan signs with")
+	identity := flag.String("identity", "", "age identity file that decrypts an encrypted plan for -approve-plan or audit log for -verify-audit")
+	onlyChain := flag.String("chain", "", "only migrate the named entry of the chains setting (default migrates every chain)")
+	assets := flag.String("assets", "", "only migrate these comma separated asset classes: "+strings.Join(assetClasses, ", ")+" (overrides the assets setting)")
+	backend := flag.String("backend", "", "where transactions are executed: "+strings.Join(backends, ", ")+" (overrides the backend setting)")
+	var overrides settingOverrides
+	flag.Var(&overrides, "set", "override a setting, e.g. -set fee.multiplier=2 or -set simulate=true (repeatable)")
+	flag.Parse()
+	if *assets != "" {
+		selected, _ := json.Marshal(strings.Split(*assets, ","))
+		overrides = append(overrides, "assets="+string(selected))
+	}
+	if *backend != "" {
+		overrides = append(overrides, "backend="+*backend)
+	}
+
+	if *verifyAudit != "" {
+		Encryption.Configure("age", nil, *identity)
+		last, err := Audit.Verify(*verifyAudit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			os.Exit(exitAborted)
+		}
+		fmt.Println("Audit log is intact, last entry hash:", last)
 		return
 	}
+	if *approvePlan != "" {
+		Encryption.Configure("age", nil, *identity)
+		approval, err := approve(*approvePlan, *approvalKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			os.Exit(exitAborted)
+		}
+		fmt.Printf("Plan %s approved by %s, the approval was written to %s\n", approval.PlanHash, approval.Approver, Plan.ApprovalPath(*approvePlan))
+		return
+	}
+
+	//an optional command (migrate is the default) followed by optional settings, without settings
+	//only the default settings files are used
+	args := flag.Args()
+	command := "migrate"
+	if len(args) > 0 && contains(commands, args[0]) {
+		command, args = args[0], args[1:]
+	}
+	settingsArg := ""
+	if len(args) == 1 {
+		settingsArg = args[0]
+	}
+	if len(args) > 1 {
+		fmt.Fprintf(os.Stderr, "usage: walletMigrate [flags] [%s] [settings.json|settings.yaml|settings.toml|'{...}']\n", strings.Join(commands, "|"))
+		flag.PrintDefaults()
+		os.Exit(exitAborted)
+	}
 
-	in := settings{}
-	err := json.Unmarshal([]byte(args[0]), &in)
+	in, warnings, err := loadSettings(settingsArg, overrides)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, "ERROR: invalid settings:", err)
+		os.Exit(exitAborted)
 	}
-	if in.NodeURL == "" || !common.IsHexAddress(in.DestinationAddress) || (len(in.Mnemonics) == 0 && len(in.PrivateKeys) == 0) {
-		return
+	in.registerSecrets()
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "WARNING:", warning)
+	}
+	if in.ChainlistFile != "" {
+		if err := loadChainlist(in.ChainlistFile); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR: invalid chainlist_file:", err)
+			os.Exit(exitAborted)
+		}
+	}
+	status := newRunStatus(in.StatusFile, in.Simulate, in.FixedTime)
+	validate := in.validate
+	if command == "serve" {
+		validate = in.validateServer
+	}
+	if errs := validate(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, "ERROR: invalid settings:", err)
+		}
+		status.abort(fmt.Errorf("%d invalid settings", len(errs)))
 	}
+	in.Privacy.seed()
+	in.Encryption.configure()
 	if in.NumberOfAccounts == 0 {
 		in.NumberOfAccounts = 3 //default to 3 accounts if not set in input settings
 	}
+	if in.NumberOfHardenedAccounts == 0 {
+		in.NumberOfHardenedAccounts = 1 //only m/44'/60'/0' unless asked to scan further
+	}
+	if in.Fee.Multiplier == 0 {
+		in.Fee.Multiplier = 1 //pay the suggested gas price if no multiplier is set
+	}
+	if in.SweeperCheckBlocks == 0 {
+		in.SweeperCheckBlocks = 50 //about ten minutes of mainnet blocks
+	}
+	if in.RetryQueue == "" {
+		in.RetryQueue = defaultRetryQueue
+	}
+	if in.StateFile == "" {
+		in.StateFile = defaultStateFile
+	}
+	if in.GasFile == "" {
+		in.GasFile = defaultGasFile
+	}
 
-	client := RPC.NewClient(in.NodeURL)
-	gasPrice := client.GetGasPrice(in.GasPriceMultiplier) //multiply the suggested gas price by x times
-	allAccounts := client.GetUsedAccounts(Accounts.GetAccounts(in.Mnemonics, in.PrivateKeys, in.NumberOfAccounts), in.PendingNonce, in.TransferGasLimit)
+	audit, err := Audit.Open(in.AuditLog)
+	if err != nil {
+		status.abort(err)
+	}
 
-	for _, account := range allAccounts {
-		fmt.Printf("Address: %s, Nonce: %4d, Token Transfer Gas Needed: %.8f ETH, Balance: %.8f ETH\n", account.Address.Hex(), account.Nonce, Accounts.Eth(account.TotalAssetTransferPrice(gasPrice)), Accounts.Eth(account.Balance))
-		for _, token := range account.Tokens {
-			fmt.Printf("\tContract Address: %s, Gas Needed: %.8f ETH, Balance(%6v): %.8f\n", token.Contract.Hex(), Accounts.Eth(token.TotalTransferPrice(gasPrice)), token.Symbol, token.DecimalBalance())
+	verbosity := RPC.VerbosityNormal
+	switch {
+	case *quiet:
+		verbosity = RPC.VerbosityQuiet
+	case *debug:
+		verbosity = RPC.VerbosityDebug
+	case *verbose:
+		verbosity = RPC.VerbosityVerbose
+	}
+	display = newPrinter(in.NoColor, in.TruncateHex, verbosity)
+	//after the printer looked at the terminal, stdout is a pipe from here on
+	if err := Redaction.Install(); err != nil {
+		status.abort(err)
+	}
+	status.onExit(func() {
+		if last := audit.Last(); last != "" {
+			display.logf(RPC.VerbosityNormal, "The audit log %s ends with entry %s\n", in.AuditLog, last)
 		}
-		fmt.Println()
+	})
+	desktop = newNotifier(in.Notify)
+	status.onExit(func() {
+		summary := fmt.Sprintf("%d accounts, %d transactions, %d failed", status.Accounts, status.Transactions, status.Failed)
+		if status.Error != "" {
+			summary = status.Error
+		}
+		desktop.notify("walletMigrate "+command+" "+status.Status, "%s", summary)
+	})
+	mailer = in.Email
+	status.onExit(func() { mailer.report(command, status) })
+	oncall = newPager(in.Paging, status.Started)
+	status.onExit(func() {
+		if status.ExitCode == exitAborted {
+			oncall.page("aborted", true, "walletMigrate %s was aborted: %s", command, status.Error)
+		}
+	})
+	switch command {
+	case "sign-server":
+		status.finish(serveSigner(in, audit, status))
+	case "grpc":
+		status.finish(serveGRPC(in, settingsArg, overrides, status))
+	case "serve":
+		status.finish(serveREST(in, settingsArg, overrides, status))
+	case "dashboard":
+		status.finish(serveDashboard(in, settingsArg, overrides, *onlyChain, status))
+	}
+	chains, err := in.selectChains(*onlyChain)
+	if err != nil {
+		status.abort(err)
 	}
 
-	updatedAccounts, gasTransactions := transferGas(gasPrice, allAccounts, make([]RPC.TransactionWithOriginator, 0))
-	sendTransactions(client, gasTransactions, in.Simulate)
+	if in.ReplayRPC == "" { //replays don't reach the nodes
+		if err := auditChainIDs(chains, in.AllowReplay); err != nil {
+			status.abort(err)
+		}
+	}
+
+	code := exitNothingToDo
+	for _, chain := range chains {
+		if chain.name != "" {
+			fmt.Println(display.paint(colorBold, fmt.Sprintf("=== %s ===", chain.name)))
+		}
+		run := migrate
+		switch command {
+		case "status":
+			run = reportProgress
+		case "execute":
+			run = executePlan
+		}
+		switch run(command, in, chain, audit, status) {
+		case exitWithFailures:
+			code = exitWithFailures
+		case exitCompleted:
+			if code == exitNothingToDo {
+				code = exitCompleted
+			}
+		}
+	}
+	status.finish(code)
+}
 
-	tokenTransactions := transferTokens(common.HexToAddress(in.DestinationAddress), gasPrice, updatedAccounts, make([]RPC.TransactionWithOriginator, 0))
-	sendTransactions(client, tokenTransactions, in.Simulate)
+//run the migration on a single chain and return its exit code
+func migrate(command string, in settings, chain chainProfile, audit *Audit.Log, status *runStatus) int {
+	display.currency = chain.currency()
+	if in.Backend == "fork" {
+		nodeURL, stop, err := in.Fork.start(chain.NodeURL)
+		if err != nil {
+			status.abort(err)
+		}
+		defer stop()
+		chain.NodeURL, chain.BroadcastURLs = nodeURL, nil
+	}
+	if in.ReplayRPC != "" {
+		chain.BroadcastURLs = nil
+	}
+	client, err := connect(in, chain, status)
+	if err != nil {
+		status.abort(err)
+	}
+	client.Verbosity = display.verbosity
+	if err := client.AddBroadcastEndpoints(chain.BroadcastURLs); err != nil {
+		status.abort(err)
+	}
+	chainID, err := client.GetChainID()
+	if err != nil {
+		status.abort(err)
+	}
+	if chain.ChainID != 0 && in.Backend != "fork" && chainID.Cmp(big.NewInt(chain.ChainID)) != 0 { //hardhat forks run as 31337
+		status.abort(fmt.Errorf("chains.%s expects chain id %d but %s is on chain %s", chain.name, chain.ChainID, chain.NodeURL, chainID))
+	}
 
-	if in.Simulate && len(tokenTransactions) > 0 {
-		fmt.Println("\nThese transactions might change based on gas left in accounts after token transactions are actually mined:")
+	state, err := State.Load(chain.file(in.StateFile))
+	if err != nil {
+		status.abort(err)
+	}
+	gasUsed, err := loadGasUsage(chain.file(in.GasFile))
+	if err != nil {
+		status.abort(fmt.Errorf("gas_file %s: %v", chain.file(in.GasFile), err))
+	}
+	client.KnownGas = gasUsed.transferLimits()
+	if in.Backend == "simulated" && command == "clear" {
+		//clear replaces transactions in the node's pool, the simulated chain only starts after the scan
+		status.abort(fmt.Errorf("the clear command can't be rehearsed on the simulated backend, use the fork backend"))
+	}
+	if len(in.Approvers) > 0 && !in.Simulate && !in.rehearsal() {
+		status.abort(fmt.Errorf("approvers are set, live transactions are only broadcast by the execute command from an approved plan_file"))
+	}
+	if in.rehearsal() {
+		state.Detach()
+		audit, in.Simulate = nil, false
+		fmt.Println(display.paint(colorBold, fmt.Sprintf("Rehearsal on the %s backend, the state file, audit log and retry queue are left untouched", in.Backend)))
+	}
+	run := broadcaster{client: client, audit: audit, state: state, simulate: in.Simulate, chain: chain, chainID: chainID, privacy: in.Privacy, schedule: in.Schedule, throttle: newThrottle(in.Throttle), maxInFlight: in.MaxInFlight}
+	//a previous run's transactions must be settled before planning or a still pending gas transfer would be sent again
+	destinations, err := in.splits()
+	if err != nil {
+		status.abort(err)
+	}
+	if command != "clear" {
+		run.settlePrevious(destinations[0].address)
+	}
+
+	gasPrice, err := chain.Fee.gasPrice(client)
+	if err != nil {
+		status.abort(err)
+	}
+	accounts, err := in.accounts()
+	if err != nil {
+		status.abort(err)
+	}
+	if len(in.BrainWallets) > 0 {
+		fmt.Println(display.paint(colorRed, "WARNING: brain wallet keys are the keccak256 hash of a passphrase, bots hash every passphrase they can find or guess and sweep what arrives within seconds.  Gas sent to them is likely swept before their tokens move, when sweeper bots are reported below move the assets with a private bundle (e.g. Flashbots) instead, and never use these addresses again"))
+	}
+	accounts = excludeAccounts(targetAccounts(accounts, in.TargetAddresses), in.ExcludeAddresses)
+	if command == "retry" {
+		queue, err := readRetryQueue(chain.file(in.RetryQueue))
+		if err != nil {
+			status.abort(err)
+		}
+		display.logf(RPC.VerbosityNormal, "Retrying %d failed transactions from %s\n", len(queue), chain.file(in.RetryQueue))
+		accounts = retryAccounts(accounts, queue)
+		//re-plan from the last mined nonce so failed transactions still sitting in the pool are replaced rather than duplicated
+		in.PendingNonce = false
+		gasPrice = run.retryGasPrice(gasPrice, accounts)
+	}
+	for i := range accounts {
+		accounts[i].Homestead = chain.Homestead
+	}
+	if command == "clear" {
+		return run.clearQueues(gasPrice, accounts)
+	}
+	if chain.BeaconURL != "" {
+		reportWithdrawalAddresses(chain.BeaconURL, accounts)
+	}
+	if !in.NoSweeperCheck {
+		detectSweepers(client, accounts, in.SweeperCheckBlocks)
+	}
+	awaitIncoming(client, accounts, in.WaitForIncoming)
+	allAccounts := client.GetUsedAccounts(accounts, destinations[0].address, in.PendingNonce, in.TransferGasLimit)
+	status.UsedEmpty = append(status.UsedEmpty, reportUsedAccounts(accounts, allAccounts)...)
+	status.Manual = append(status.Manual, manualTokens(allAccounts)...)
+	reportPassphrases(accounts)
+	reserve, err := in.reserve()
+	if err != nil {
+		status.abort(err)
+	}
+	accountForPool(client, allAccounts, state)
+	overrideNonces(allAccounts, chain.Nonces)
+	threshold, err := in.MinAccountValue.threshold(client)
+	if err != nil {
+		status.abort(err)
+	}
+	allAccounts = dropDust(in.selectAssets(skipContracts(allAccounts, in.AllowDelegatedAccounts)), threshold)
+	if err := skipCostlyTransfers(client, allAccounts, gasPrice, in.MaxFeePercent); err != nil {
+		status.abort(err)
+	}
+	funder, err := in.gasFunder(client, chain)
+	if err != nil {
+		status.abort(err)
+	}
+	prioritizeByValue(client, allAccounts, funder, gasPrice)
+	chain.Fee.applyDustFloor(allAccounts)
+	routes, err := newRoute(in, destinations, state, allAccounts)
+	if err != nil {
+		status.abort(err)
+	}
+	hops, err := in.Hops.derive(state, allAccounts)
+	if err != nil {
+		status.abort(err)
+	}
+	if in.Backend == "simulated" {
+		client = rehearse(client, &run, gasPrice, allAccounts, funder)
+	}
+	sourceRoutes := routes
+	if in.Hops.Count > 0 {
+		sourceRoutes = hopRoute(routes, hops, 0)
+		if display.verbosity > RPC.VerbosityQuiet {
+			printHops(hops)
+		}
+	}
+	if in.SplitTokens && in.Hops.Count == 0 {
+		reserveSplitGas(allAccounts, sourceRoutes)
+	}
+	in.Privacy.shuffleAccounts(allAccounts)
+	reportEmptied(allAccounts, state)
+	if in.Counterparties > 0 {
+		reportCounterparties(client, allAccounts, in.Counterparties, destinations)
+	}
+
+	status.Accounts += len(allAccounts)
+	if len(allAccounts) == 0 {
+		display.logf(RPC.VerbosityNormal, "No accounts with assets to migrate were found\n")
+		return exitNothingToDo
+	}
+
+	if display.verbosity > RPC.VerbosityQuiet {
+		printAccounts(allAccounts, gasPrice)
+	}
+	allAccounts = dropWatchOnly(allAccounts)
+	if len(allAccounts) == 0 {
+		return exitNothingToDo
+	}
+	if in.OwnershipProofs != "" {
+		if err := writeOwnershipProofs(chain.file(in.OwnershipProofs), allAccounts, destinations, status.now()); err != nil {
+			Errors.Log(Errors.FileError, "M24", err)
+		}
+	}
+
+	var plan []RPC.TransactionWithOriginator
+	var before []holding
+	if !in.Simulate {
+		before = takeSnapshot(allAccounts)
+		plan = planMigration(client, sourceRoutes, funder, in.migrates("eth"), reserve, gasPrice, allAccounts)
+	}
+
+	var starting map[common.Address]*big.Int
+	var written *Plan.Plan
+	if in.Simulate {
+		starting = startingBalances(allAccounts)
+		if in.PlanFile != "" {
+			written, err = newPlan(client, chainID, gasPrice, allAccounts, funder)
+			if err != nil {
+				status.abort(err)
+			}
+		}
+	}
+
+	failed := 0
+	updatedAccounts, gasTransactions := transferGas(gasPrice, reserve, funder, allAccounts, make([]RPC.TransactionWithOriginator, 0))
+	if funder != nil && display.verbosity > RPC.VerbosityQuiet {
+		printSubsidies(funder, gasTransactions)
+	}
+	run.repricer = newRepricer(chain.Fee, updatedAccounts, funder, gasUsed)
+	failed += run.sendTransactions("gas", gasTransactions)
+
+	tokenTransactions := transferTokens(client, !in.Simulate && !in.NoBalanceRefresh, sourceRoutes, gasPrice, updatedAccounts, make([]RPC.TransactionWithOriginator, 0))
+	//taken when the sweeps are planned, transactions re-priced as they were sent replace the ones planned
+	earlier := func() []RPC.TransactionWithOriginator {
+		return append(append([]RPC.TransactionWithOriginator{}, gasTransactions...), tokenTransactions...)
+	}
+	var balanceEmptyingTransactions []RPC.TransactionWithOriginator
+	if in.MaxInFlight > 0 && !in.Simulate {
+		var follow func(common.Address) []RPC.TransactionWithOriginator
+		if in.migrates("eth") {
+			//each account is swept as soon as its own token transfers are mined, from the balance they left
+			follow = func(address common.Address) []RPC.TransactionWithOriginator {
+				for _, account := range updatedAccounts {
+					if account.Address == address {
+						return transferBalances(client, sourceRoutes, reserve, gasPrice, []Accounts.Account{account}, false, earlier(), make([]RPC.TransactionWithOriginator, 0))
+					}
+				}
+				return nil
+			}
+		}
+		var addresses []common.Address
+		for _, account := range updatedAccounts {
+			addresses = append(addresses, account.Address)
+		}
+		var sendFailures int
+		sendFailures, balanceEmptyingTransactions = run.pipeline(addresses, tokenTransactions, follow)
+		failed += sendFailures
+	} else {
+		failed += run.sendTransactions("token", tokenTransactions)
+
+		if in.Simulate && len(tokenTransactions) > 0 && display.verbosity > RPC.VerbosityQuiet {
+			fmt.Println("\nThese transactions might change based on gas left in accounts after token transactions are actually mined:")
+		}
+		if in.migrates("eth") {
+			balanceEmptyingTransactions = transferBalances(client, sourceRoutes, reserve, gasPrice, updatedAccounts, in.Simulate, earlier(), make([]RPC.TransactionWithOriginator, 0))
+			failed += run.sendTransactions("balance", balanceEmptyingTransactions)
+		}
+	}
+
+	transactions := len(gasTransactions) + len(tokenTransactions) + len(balanceEmptyingTransactions)
+	if in.Simulate && display.verbosity > RPC.VerbosityQuiet {
+		var planned []RPC.TransactionWithOriginator
+		planned = append(planned, gasTransactions...)
+		planned = append(planned, tokenTransactions...)
+		planned = append(planned, balanceEmptyingTransactions...)
+		printProjection(starting, allAccounts, sourceRoutes, gasPrice, planned)
+	}
+	if written != nil {
+		for _, phase := range []struct {
+			name         string
+			transactions []RPC.TransactionWithOriginator
+		}{{"gas", gasTransactions}, {"token", tokenTransactions}, {"balance", balanceEmptyingTransactions}} {
+			if err := addToPlan(written, phase.name, phase.transactions); err != nil {
+				status.abort(err)
+			}
+		}
+		if err := Plan.Write(chain.file(in.PlanFile), written); err != nil {
+			Errors.Log(Errors.FileError, "M18", err)
+		} else {
+			if err := audit.PlanWritten(written.Hash); err != nil {
+				Errors.Log(Errors.FileError, "M21", err)
+			}
+			fmt.Printf("The plan was written to %s, run the execute command to broadcast it\n", chain.file(in.PlanFile))
+		}
+	}
+	status.Transactions += transactions
+	if !in.Simulate {
+		var executed []RPC.TransactionWithOriginator
+		executed = append(executed, gasTransactions...)
+		executed = append(executed, tokenTransactions...)
+		executed = append(executed, balanceEmptyingTransactions...)
+		receipts := client.GetReceipts(executed)
+		run.recordReceipts(executed, receipts)
+		//transactions that failed to send are never mined so the receipts give the complete count of failures
+		failed = printDeviations(client, plan, executed, receipts)
+		printReconciliation(before, refreshSnapshot(client, before), sourceRoutes, executed, receipts)
+		if in.Hops.Count > 0 {
+			failed += run.forwardHops(routes, hops, in.Hops.Count, gasPrice, in.TransferGasLimit)
+		}
+
+		var failures []retryEntry
+		failures = append(failures, collectFailures("gas", gasTransactions, receipts)...)
+		failures = append(failures, collectFailures("token", tokenTransactions, receipts)...)
+		failures = append(failures, collectFailures("balance", balanceEmptyingTransactions, receipts)...)
+		if !in.rehearsal() { //a rehearsal's failures are never retried on the network
+			err = writeRetryQueue(chain.file(in.RetryQueue), failures)
+			if err != nil {
+				Errors.Log(Errors.FileError, "M6", err)
+			} else if len(failures) > 0 {
+				fmt.Printf("%d failed transactions were queued in %s, run the retry command to re-plan them\n", len(failures), chain.file(in.RetryQueue))
+			}
+			if err := gasUsed.save(chain.file(in.GasFile)); err != nil {
+				Errors.Log(Errors.FileError, "M23", err)
+			}
+		}
 	}
-	balanceEmptyingTransactions := transferBalances(client, common.HexToAddress(in.DestinationAddress), gasPrice, updatedAccounts, in.Simulate, make([]RPC.TransactionWithOriginator, 0))
-	sendTransactions(client, balanceEmptyingTransactions, in.Simulate)
+	status.Failed += failed
+
+	switch {
+	case failed > 0:
+		return exitWithFailures
+	case transactions == 0:
+		return exitNothingToDo
+	default:
+		return exitCompleted
+	}
+}
+
+//the tokens the scan found but no transaction can move, listed in the status file and at the end of the run so they
+//aren't taken for migrated or for one more skipped token
+func manualTokens(accounts []Accounts.Account) []manualToken {
+	var manual []manualToken
+	for _, account := range accounts {
+		for _, token := range account.Tokens {
+			if token.Manual {
+				manual = append(manual, manualToken{Account: account.Address.Hex(), Contract: token.Contract.Hex(), Symbol: token.Symbol, Balance: token.Balance.String()})
+			}
+		}
+	}
+	return manual
+}
+
+//confirm the addresses the mnemonics are expected to derive were derived before anything is scanned or built, one
+//that wasn't means a wrong seed phrase or passphrase or a derivation grid too small to reach it
+func (self settings) verifyExpected(accounts []Accounts.Account) error {
+	derived := make(map[common.Address]Accounts.Account)
+	for _, account := range accounts {
+		derived[account.Address] = account
+	}
+	paths := table{header: []string{"Expected Address", "Derivation Path"}}
+	missing := 0
+	for i, mnemonic := range self.Mnemonics {
+		for _, expected := range mnemonic.Expected {
+			address := common.HexToAddress(expected)
+			account, ok := derived[address]
+			if !ok {
+				paths.add(colorRed, display.hex(address.Hex()), fmt.Sprintf("not derived from mnemonics[%d]", i))
+				missing++
+				continue
+			}
+			paths.add("", display.hex(address.Hex()), account.Path)
+		}
+	}
+	if len(paths.rows) == 0 {
+		return nil
+	}
+	if display.verbosity > RPC.VerbosityQuiet || missing > 0 {
+		paths.print(display)
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d expected addresses were not derived, check the seed phrases and passphrases or widen the derivation grid", missing)
+	}
+	return nil
 }
 
-func sendTransactions(client RPC.Client, transactions []RPC.TransactionWithOriginator, simulate bool) {
-	for _, transaction := range transactions {
-		fmt.Printf("From: %s, Nonce: %4d, To: %s, Gas Limit: %6d, Gas Price: %.2f Gwei, Value: %.8f ETH, TxHash: %s, Data: 0x%s \n", transaction.Address.Hex(), transaction.SignedTx.Nonce(), transaction.SignedTx.To().Hex(), transaction.SignedTx.Gas(), Accounts.Gwei(transaction.SignedTx.GasPrice()), Accounts.Eth(transaction.SignedTx.Value()), transaction.SignedTx.Hash().Hex(), hex.EncodeToString(transaction.SignedTx.Data()))
-		if simulate {
+//keep only the expected addresses and confirm where each was derived, so nothing else in the grid is scanned or touched
+func targetAccounts(accounts []Accounts.Account, targets []string) []Accounts.Account {
+	if len(targets) == 0 {
+		return accounts
+	}
+	found := make(map[common.Address]Accounts.Account)
+	for _, account := range accounts {
+		found[account.Address] = account
+	}
+	kept := make([]Accounts.Account, 0, len(targets))
+	paths := table{header: []string{"Target Address", "Derivation Path"}}
+	missing := 0
+	for _, target := range targets {
+		account, ok := found[common.HexToAddress(target)]
+		if !ok {
+			paths.add(colorRed, display.hex(common.HexToAddress(target).Hex()), "not found")
+			missing++
 			continue
 		}
-		err := client.SendTx(transaction.SignedTx)
-		if err != nil {
-			log.Println("ERROR(M1):", err)
+		path := account.Path
+		if path == "" {
+			path = "private key"
+		}
+		paths.add("", display.hex(account.Address.Hex()), path)
+		kept = append(kept, account)
+		delete(found, account.Address) //a target listed twice is only migrated once
+	}
+	if display.verbosity > RPC.VerbosityQuiet {
+		paths.print(display)
+	}
+	if missing > 0 {
+		fmt.Printf("WARNING: %d target addresses were not derived, widen the mnemonic derivation grid or check the seed phrase\n", missing)
+	}
+	return kept
+}
+
+//list the accounts that sent a transaction or received a token but the scan found nothing to migrate in, so which
+//derived addresses were ever used can be checked against the wallet's history and nothing is taken to be missed
+func reportUsedAccounts(scanned []Accounts.Account, migrated []Accounts.Account) []string {
+	assets := make(map[common.Address]bool)
+	for _, account := range migrated {
+		assets[account.Address] = true
+	}
+	used := table{header: []string{"Used Address", "Derivation Path", "Nonce", "Balance"}}
+	var addresses []string
+	for _, account := range scanned {
+		if !account.Used || assets[account.Address] {
 			continue
 		}
+		path := account.Path
+		if path == "" {
+			path = "private key"
+		}
+		used.add("", display.hex(account.Address.Hex()), path, fmt.Sprintf("%d", account.Nonce), display.currency.Format(account.Balance))
+		addresses = append(addresses, account.Address.Hex())
 	}
-	if !simulate {
-		client.AwaitTransactions(transactions) //await transactions here
+	if len(addresses) > 0 && display.verbosity > RPC.VerbosityQuiet {
+		display.logf(RPC.VerbosityNormal, "%d accounts were used before but are left out of the migration:\n", len(addresses))
+		used.print(display)
+		fmt.Println()
 	}
+	return addresses
 }
 
-func transferGas(gasPrice *big.Int, accounts []Accounts.Account, transactions []RPC.TransactionWithOriginator) ([]Accounts.Account, []RPC.TransactionWithOriginator) {
-	var negatives []Accounts.Account
-	var positives []Accounts.Account
-	//separate accounts based on whether they have enough balance to pay the gas to transfer all their assets out
-	for i := range accounts {
-		if accounts[i].TotalAssetTransferPrice(gasPrice).Cmp(accounts[i].Balance) > 0 {
-			negatives = append(negatives, accounts[i])
-			accounts[i].Available.Sub(accounts[i].Balance, accounts[i].TotalAssetTransferPrice(gasPrice))
-		} else {
-			accounts[i].Available.Sub(accounts[i].Balance, accounts[i].TotalAssetTransferPrice(gasPrice))
-			positives = append(positives, accounts[i])
+//tell which of a mnemonic's passphrase candidates derived accounts with on-chain history, by position since the
+//passphrases are secrets.  The one the wallet was used with has history, a mistyped one derives untouched addresses
+func reportPassphrases(scanned []Accounts.Account) {
+	derived := make(map[string]int)
+	used := make(map[string]int)
+	var candidates []string
+	for _, account := range scanned {
+		if account.Candidate == "" {
+			continue
+		}
+		if derived[account.Candidate] == 0 {
+			candidates = append(candidates, account.Candidate)
 		}
+		derived[account.Candidate]++
+		if account.Used {
+			used[account.Candidate]++
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	sort.Strings(candidates)
+	report := table{header: []string{"Passphrase Candidate", "Accounts", "Used"}}
+	for _, candidate := range candidates {
+		color := ""
+		if used[candidate] > 0 {
+			color = colorGreen
+		}
+		report.add(color, candidate, fmt.Sprintf("%d", derived[candidate]), fmt.Sprintf("%d", used[candidate]))
+	}
+	if display.verbosity > RPC.VerbosityQuiet {
+		report.print(display)
+		fmt.Println()
+	}
+	if len(used) == 0 {
+		fmt.Println(display.paint(colorYellow, "WARNING: no passphrase candidate derived an account that was ever used, the passphrase may be none of them or the derivation grid too small"))
 	}
+}
 
-	//sort positives with highest balance first
-	sort.Slice(positives, func(i, j int) bool {
-		return positives[i].Available.Cmp(positives[j].Available) >= 0
-	})
-	//sort negatives with the least 'need' first in order to empty as many accounts as possible
-	sort.Slice(negatives, func(i, j int) bool {
-		return negatives[i].Available.Cmp(negatives[j].Available) <= 0
-	})
+//leave out the accounts of extended public keys once their assets and gas are printed, nothing can be signed for them
+func dropWatchOnly(accounts []Accounts.Account) []Accounts.Account {
+	kept := make([]Accounts.Account, 0, len(accounts))
+	for _, account := range accounts {
+		if !account.WatchOnly {
+			kept = append(kept, account)
+		}
+	}
+	if watched := len(accounts) - len(kept); watched > 0 {
+		display.logf(RPC.VerbosityNormal, "%d watch-only accounts of an xpub are planned above, migrate them with their xprv or seed phrase\n", watched)
+	}
+	return kept
+}
 
-	//this is the amount it will cost any of the positive accounts just to transfer any gas to a deficient account, each transfer
-	transferCost := new(big.Int).Mul(gasPrice, big.NewInt(int64(21000)))
-	for x := range negatives {
-		for y := range positives {
-			totalAmountNeeded := negatives[x].TotalAssetTransferPrice(gasPrice)
+//start the listed accounts at a known nonce when the node's view is wrong (a stuck pool or recently dropped transactions)
+func overrideNonces(accounts []Accounts.Account, nonces map[string]uint64) {
+	if len(nonces) == 0 {
+		return
+	}
+	overrides := make(map[common.Address]uint64)
+	for address, nonce := range nonces {
+		overrides[common.HexToAddress(address)] = nonce
+	}
+	for i := range accounts {
+		if nonce, ok := overrides[accounts[i].Address]; ok {
+			display.logf(RPC.VerbosityNormal, "Nonce override: %s starts at nonce %d, the node reported %d\n", accounts[i].Address.Hex(), nonce, accounts[i].Nonce)
+			accounts[i].Nonce = nonce
+		}
+	}
+}
 
-			//the amount the positive account needs to give up to the negative account PLUS the cost to transfer it
-			totalAmountNeededToTransfer := new(big.Int).Add(totalAmountNeeded, transferCost)
+//leave out the blocklisted accounts before the scan so nothing is planned for them
+func excludeAccounts(accounts []Accounts.Account, excluded []string) []Accounts.Account {
+	if len(excluded) == 0 {
+		return accounts
+	}
+	blocked := make(map[common.Address]bool)
+	for _, address := range excluded {
+		blocked[common.HexToAddress(address)] = true
+	}
+	kept := make([]Accounts.Account, 0, len(accounts))
+	for _, account := range accounts {
+		if blocked[account.Address] {
+			display.logf(RPC.VerbosityNormal, "Skipping: %s, listed in exclude_addresses\n", account.Address.Hex())
+			continue
+		}
+		kept = append(kept, account)
+	}
+	return kept
+}
+
+//build the transactions a simulated run would produce, using copies of the accounts so the live run is unaffected
+func planMigration(client RPC.Client, routes route, funder *Accounts.Account, sweep bool, reserve *big.Int, gasPrice *big.Int, accounts []Accounts.Account) []RPC.TransactionWithOriginator {
+	copies := make([]Accounts.Account, len(accounts))
+	for i := range accounts {
+		copies[i] = accounts[i].Copy()
+	}
+	if funder != nil {
+		funderCopy := funder.Copy()
+		funder = &funderCopy
+	}
+	updatedAccounts, plan := transferGas(gasPrice, reserve, funder, copies, make([]RPC.TransactionWithOriginator, 0))
+	plan = transferTokens(client, false, routes, gasPrice, updatedAccounts, plan)
+	if !sweep {
+		return plan
+	}
+	for _, account := range updatedAccounts {
+		for _, signedTx := range getBalanceTxs(routes.balances(account.Address), reserve, gasPrice, account) {
+			plan = append(plan, RPC.TransactionWithOriginator{Address: account.Address, SignedTx: signedTx})
+		}
+	}
+	return plan
+}
 
-			//excess value that the positive account will have left after transferring to the negative account
-			availableAfterTransfer := new(big.Int).Sub(positives[y].Available, totalAmountNeededToTransfer)
+func printAccounts(accounts []Accounts.Account, gasPrice *big.Int) {
+	for _, account := range accounts {
+		summary := table{header: []string{"Address", "Nonce", "Token Transfer Gas Needed", "Balance"}}
+		summary.add(colorCyan, display.hex(account.Address.Hex()), fmt.Sprintf("%d", account.Nonce), display.currency.Format(account.TotalAssetTransferPrice(gasPrice)), display.currency.Format(account.Balance))
+		summary.print(display)
+		if len(account.Tokens) > 0 {
+			tokens := table{indent: "\t", header: []string{"Contract Address", "Symbol", "Gas Needed", "Balance", "Base Units"}}
+			for _, token := range account.Tokens {
+				if token.Unsupported != "" {
+					reason := "not transferred: " + token.Unsupported
+					if token.Manual {
+						reason = "needs manual action: " + token.Unsupported
+					}
+					tokens.add(colorYellow, display.hex(token.Contract.Hex()), token.Symbol, reason, token.DecimalBalance(), token.Balance.String())
+					continue
+				}
+				needed := display.currency.Format(token.TotalTransferPrice(gasPrice))
+				if token.GasSimulated {
+					needed += " (simulated)"
+				}
+				tokens.add("", display.hex(token.Contract.Hex()), token.Symbol, needed, token.DecimalBalance(), token.Balance.String())
+			}
+			tokens.print(display)
+		}
+		fmt.Println()
+	}
+}
 
-			//this account does not have enough to transfer all the negative account needs
-			if availableAfterTransfer.Sign() < 0 {
-				//figure out how much this account can give
-				totalAmountNeeded.Sub(positives[y].Available, transferCost)
-				availableAfterTransfer = big.NewInt(0) //this account is going to transfer everything except what it needs
+//send (or just print when simulating) the transactions and return how many failed to send
+func (self broadcaster) sendTransactions(phase string, transactions []RPC.TransactionWithOriginator) int {
+	if len(transactions) == 0 {
+		return 0
+	}
+	failed := 0
+	order := self.privacy.shuffleTransactions(transactions)
+	sent := table{header: sentHeader}
+	for i := range order {
+		planned := order[i].SignedTx.Hash()
+		if !self.broadcast(phase, &order[i], i > 0, &sent) {
+			failed++
+		}
+		if order[i].SignedTx.Hash() != planned {
+			//re-priced, the caller's transactions hold what was sent so it is what gets awaited and recorded
+			for j := range transactions {
+				if transactions[j].SignedTx.Hash() == planned {
+					transactions[j] = order[i]
+				}
 			}
+		}
+	}
+	sent.print(display)
+	if !self.simulate {
+		self.saveState()
+		stop := oncall.watch("%d %s transactions%s", len(transactions), phase, onChain(self.chain))
+		self.await(transactions) //re-priced transactions were copied back, so these are the ones sent
+		stop()
+		desktop.notify(fmt.Sprintf("walletMigrate %s phase done", phase), "%d of %d transactions sent%s", len(transactions)-failed, len(transactions), onChain(self.chain))
+		if failed > 0 {
+			mailer.alert("walletMigrate transactions failed to send", "%d of the %d %s transactions failed to send%s, see the run's output", failed, len(transactions), phase, onChain(self.chain))
+		}
+	}
+	return failed
+}
 
-			//this account has something to transfer to the negative account
-			if availableAfterTransfer.Sign() >= 0 {
-				//create, sign and add a transaction to the gas transfer transactions that will be returned
-				tx := types.NewTransaction(positives[y].Nonce, negatives[x].Address, totalAmountNeeded, 21000, gasPrice, nil)
-				signedTx, err := types.SignTx(tx, types.NewEIP155Signer(positives[y].ChainId), positives[y].PrivateKey)
+var sentHeader = []string{"Status", "From", "Nonce", "To", "Gas Limit", "Gas Price", "Value", "TxHash", "Data"}
+
+//send one transaction (unless simulating) and add it to the sent table, delay waits the privacy delay first.  A
+//transaction re-priced before it is sent is replaced by the one sent.  Returns false when it was refused, held back by
+//the schedule or failed to send
+func (self broadcaster) broadcast(phase string, transaction *RPC.TransactionWithOriginator, delay bool, sent *table) bool {
+	ok := true
+	status, color := "simulated", colorYellow
+	if err := verifyReplayProtection(transaction.SignedTx, self.chainID, self.chain.Homestead); err != nil {
+		Errors.Log(Errors.SignError, "M11", err)
+		status, color, ok = "refused", colorRed, false
+	} else {
+		if err := self.audit.Planned(phase, transaction.Address, transaction.SignedTx); err != nil {
+			Errors.Log(Errors.FileError, "M21", err)
+		}
+		if !self.simulate {
+			if wait := self.privacy.delay(); delay && wait > 0 {
+				display.logf(RPC.VerbosityVerbose, "Waiting %s before the next broadcast\n", wait.Round(time.Second))
+				time.Sleep(wait)
+			}
+			self.throttle.wait(self.client)
+			if self.schedule.hold() {
+				if repriced, ok := self.repricer.reprice(phase, self.client, *transaction); ok {
+					if err := self.audit.Repriced(phase, transaction.Address, repriced.SignedTx, transaction.SignedTx.Hash()); err != nil {
+						Errors.Log(Errors.FileError, "M21", err)
+					}
+					*transaction = repriced
+				}
+				status, color = "sent", colorGreen
+				err := self.client.SendTx(transaction.SignedTx)
 				if err != nil {
-					log.Fatal(err)
+					Errors.Log(Errors.RPCError, "M1", err)
+					status, color, ok = "failed", colorRed, false
 				}
+				//a nonce this tool already sent a transaction with is a replacement, linked so the winner can be followed
+				original, replacing := self.state.Latest(transaction.Address, transaction.SignedTx.Nonce())
+				self.state.Record(phase, transaction.Address, transaction.SignedTx, err)
+				if replacing && err == nil && !strings.EqualFold(original.TxHash, transaction.SignedTx.Hash().Hex()) {
+					self.state.SetReplaces(transaction.SignedTx.Hash(), common.HexToHash(original.TxHash))
+				}
+				err = self.audit.Broadcast(transaction.Address, transaction.SignedTx, err)
+				if err != nil {
+					Errors.Log(Errors.FileError, "M4", err)
+				}
+			} else {
+				status, color, ok = "held", colorRed, false
+			}
+		}
+	}
+	sent.add(color, status, display.hex(transaction.Address.Hex()), fmt.Sprintf("%d", transaction.SignedTx.Nonce()), display.hex(transaction.SignedTx.To().Hex()), fmt.Sprintf("%d", transaction.SignedTx.Gas()), display.currency.FormatGasPrice(transaction.SignedTx.GasPrice()), display.currency.Format(transaction.SignedTx.Value()), self.chain.txLink(transaction.SignedTx.Hash().Hex()), display.hex("0x"+hex.EncodeToString(transaction.SignedTx.Data())))
+	return ok
+}
 
-				//update the positive balance (even though the tx has not occurred) this will be used in the next iterations of this method to transfer to other negative accounts
-				positives[y].Balance.Sub(positives[y].Available, totalAmountNeededToTransfer) //subtract the total cost from the positive accounts balance
-				positives[y].Nonce += 1                                                       //each outgoing transaction increases the nonce
-				negatives[x].Balance.Add(negatives[x].Balance, totalAmountNeeded)             //the negative account now has some gas
-				transactions = append(transactions, RPC.TransactionWithOriginator{Address: positives[y].Address, SignedTx: signedTx})
+//plan the gas transfers that let every account pay for moving its assets out.  Each short account gets its deficit
+//from the account that covers it with the least to spare, so bigger balances stay whole for bigger deficits, and is
+//only funded by several accounts when none covers it alone, keeping the number of funding transactions (and fees) down.
+// With a funder (an account outside the migration) it pays every deficit and the source balances are left intact.  The
+//reserve (keep_wei/keep_eth) is never given away, a source account keeps it after funding others as it does after its sweep
+func transferGas(gasPrice *big.Int, reserve *big.Int, funder *Accounts.Account, accounts []Accounts.Account, transactions []RPC.TransactionWithOriginator) ([]Accounts.Account, []RPC.TransactionWithOriginator) {
+	pool := accounts
+	if funder != nil {
+		pool = append(accounts[:len(accounts):len(accounts)], *funder)
+	}
+	var needy, donors []int
+	//separate accounts based on whether they have enough balance to pay the gas to transfer all their assets out
+	for i := range pool {
+		pool[i].Available.Sub(pool[i].Balance, pool[i].TotalAssetTransferPrice(gasPrice))
+		switch {
+		case i == len(accounts):
+			donors = append(donors, i)
+		case pool[i].Available.Sign() < 0:
+			needy = append(needy, i)
+		default:
+			pool[i].Available.Sub(pool[i].Available, reserve)
+			if funder == nil {
+				donors = append(donors, i)
+			}
+		}
+	}
+	//fund the accounts needing the least first in order to empty as many accounts as possible
+	sort.SliceStable(needy, func(i, j int) bool {
+		return pool[needy[i]].Available.Cmp(pool[needy[j]].Available) > 0
+	})
 
-				//continually keep recursing, sorting and transferring balance until there are no negative accounts left
-				//OR there are no positive accounts with any gas left to give (i.e. we did the best we could)
-				return transferGas(gasPrice, append(negatives, positives...), transactions)
+	for _, x := range needy {
+		need := new(big.Int).Neg(pool[x].Available)
+		for need.Sign() > 0 {
+			y := gasDonor(gasPrice, pool, donors, need)
+			if y < 0 {
+				break //no account has any gas left to give, we did the best we could
+			}
+			//the cost to the donor of sending anything at all, on top of the amount it gives
+			transferCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(pool[y].TransferGas))
+			amount := new(big.Int).Sub(pool[y].Available, transferCost)
+			if amount.Cmp(need) > 0 {
+				amount.Set(need)
 			}
+			display.logf(RPC.VerbosityDebug, "gas math: %s needs %s wei, %s has %s wei available and gives %s wei (+%s wei transfer cost)\n", pool[x].Address.Hex(), need, pool[y].Address.Hex(), pool[y].Available, amount, transferCost)
+
+			signedTx, err := pool[y].SignTx(pool[y].Nonce, pool[x].Address, amount, pool[y].TransferGas, gasPrice, nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			transactions = append(transactions, RPC.TransactionWithOriginator{Address: pool[y].Address, SignedTx: signedTx})
+
+			//update the balances (even though the tx has not occurred) so later deficits are planned with what is left
+			spent := new(big.Int).Add(amount, transferCost)
+			pool[y].Balance.Sub(pool[y].Balance, spent)
+			pool[y].Available.Sub(pool[y].Available, spent)
+			pool[y].Nonce += 1 //each outgoing transaction increases the nonce
+			pool[x].Balance.Add(pool[x].Balance, amount)
+			pool[x].Available.Add(pool[x].Available, amount)
+			need.Sub(need, amount)
 		}
 	}
 
+	if funder != nil {
+		*funder = pool[len(accounts)]
+	}
 	return accounts, transactions
 }
 
-func transferTokens(destinationAddress common.Address, gasPrice *big.Int, accounts []Accounts.Account, transactions []RPC.TransactionWithOriginator) []RPC.TransactionWithOriginator {
-	hash := sha3.NewLegacyKeccak256()
-	hash.Write([]byte("transfer(address,uint256)"))
-	methodID := hash.Sum(nil)[:4]
+//the donor that covers the whole need with the least left over, or the one with the most to give when none covers it
+//alone, -1 when none can pay for a transfer
+func gasDonor(gasPrice *big.Int, accounts []Accounts.Account, donors []int, need *big.Int) int {
+	best, largest := -1, -1
+	var bestSpare, largestSpare *big.Int
+	for _, y := range donors {
+		spare := new(big.Int).Sub(accounts[y].Available, new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(accounts[y].TransferGas)))
+		if spare.Sign() <= 0 {
+			continue
+		}
+		if spare.Cmp(need) >= 0 && (best < 0 || spare.Cmp(bestSpare) < 0) {
+			best, bestSpare = y, spare
+		}
+		if largest < 0 || spare.Cmp(largestSpare) > 0 {
+			largest, largestSpare = y, spare
+		}
+	}
+	if best >= 0 {
+		return best
+	}
+	return largest
+}
+
+//when refresh is set each token balance is read again right before signing, interest bearing and rebasing tokens and
+//deposits that arrived since the scan would otherwise leave part of the balance behind, tokens are split across the
+//destinations by weight while collectibles always go to the first one
+func transferTokens(client RPC.Client, refresh bool, routes route, gasPrice *big.Int, accounts []Accounts.Account, transactions []RPC.TransactionWithOriginator) []RPC.TransactionWithOriginator {
 	for x := range accounts {
-		//sort tokens by greatest balance so we get the most tokens out in case we run out of gas
-		sort.Slice(accounts[x].Tokens, func(i, j int) bool {
-			return accounts[x].Tokens[i].Balance.Cmp(accounts[x].Tokens[j].Balance) >= 0
+		//sort tokens by greatest balance so we get the most tokens out in case we run out of gas, equal balances in
+		//contract order so two runs plan the same transfers
+		sort.SliceStable(accounts[x].Tokens, func(i, j int) bool {
+			if compared := accounts[x].Tokens[i].Balance.Cmp(accounts[x].Tokens[j].Balance); compared != 0 {
+				return compared > 0
+			}
+			return accounts[x].Tokens[i].Contract.Hex() < accounts[x].Tokens[j].Contract.Hex()
 		})
 		for y := range accounts[x].Tokens {
+			if accounts[x].Tokens[y].Unsupported != "" {
+				continue
+			}
 			transferCost := new(big.Int).Mul(gasPrice, big.NewInt(int64(accounts[x].Tokens[y].GasLimit)))
 			//does this account have enough gas to perform this transfer (if we ran out of ETH to transfer for gas we may not be able to get out all tokens)
-			if accounts[x].Balance.Cmp(transferCost) >= 0 {
-				var data []byte //build the transfer signature to transfer these tokens
-				data = append(data, methodID...)
-				data = append(data, destinationAddress.Hash().Bytes()...)
-				data = append(data, common.LeftPadBytes(accounts[x].Tokens[y].Balance.Bytes(), 32)...)
-
-				//call the token contract (sending 0 eth) but with data transferring all the tokens to the new address
-				tx := types.NewTransaction(accounts[x].Nonce, accounts[x].Tokens[y].Contract, big.NewInt(0), accounts[x].Tokens[y].GasLimit, gasPrice, data)
-				signedTx, err := types.SignTx(tx, types.NewEIP155Signer(accounts[x].ChainId), accounts[x].PrivateKey)
+			if accounts[x].Balance.Cmp(transferCost) < 0 {
+				Errors.Record(Errors.InsufficientGas, "M16", fmt.Errorf("%s can't pay %s to move token %s", accounts[x].Address.Hex(), transferCost, accounts[x].Tokens[y].Contract.Hex()))
+				continue
+			}
+			if refresh && accounts[x].Tokens[y].TokenID == nil {
+				balance, err := client.GetTokenBalance(accounts[x].Tokens[y].Contract, accounts[x].Address)
 				if err != nil {
-					log.Println("ERROR(M2):", err)
+					Errors.Log(Errors.RPCError, "M9", err) //keep the scanned balance
+				} else if balance.Sign() == 0 {
+					display.logf(RPC.VerbosityNormal, "Skipped: %s, Token Address: %s, balance is now 0\n", accounts[x].Address.Hex(), accounts[x].Tokens[y].Contract.Hex())
+					continue
+				} else {
+					if balance.Cmp(accounts[x].Tokens[y].Balance) != 0 {
+						display.logf(RPC.VerbosityVerbose, "Refreshed: %s, Token Address: %s, balance %s -> %s\n", accounts[x].Address.Hex(), accounts[x].Tokens[y].Contract.Hex(), accounts[x].Tokens[y].Balance, balance)
+					}
+					accounts[x].Tokens[y].Balance = balance
+				}
+			}
+
+			parts := routes.tokens(accounts[x].Address, accounts[x].Tokens[y].Contract)
+			if accounts[x].Tokens[y].TokenID != nil {
+				parts = parts[:1]
+			}
+			amounts := splitAmount(accounts[x].Tokens[y].Balance, parts)
+			for i, part := range parts {
+				if amounts[i].Sign() == 0 || accounts[x].Balance.Cmp(transferCost) < 0 {
+					continue
+				}
+				token := accounts[x].Tokens[y]
+				token.Balance = amounts[i]
+
+				//call the token contract (sending 0 eth) transferring all the tokens to the new address
+				signedTx, err := client.SignTokenTransfer(accounts[x], token, part.address, gasPrice)
+				if err != nil {
+					Errors.Log(Errors.SignError, "M2", err)
 					continue
 				}
 				accounts[x].Nonce += 1
@@ -189,14 +1104,15 @@ func transferTokens(destinationAddress common.Address, gasPrice *big.Int, accoun
 	return transactions
 }
 
-//all previous pending tx should be mined before calling so we know the correct total balance to transfer out
-func transferBalances(client RPC.Client, destinationAddress common.Address, gasPrice *big.Int, accounts []Accounts.Account, simulate bool, transactions []RPC.TransactionWithOriginator) []RPC.TransactionWithOriginator {
+//the balance to transfer out is rebuilt from the receipts of the earlier gas and token transactions, any of them still
+//in flight are held back from it.  A simulated run has no receipts and plans with every earlier transaction paying its
+//full gas limit, so the live sweep can only be larger by the refunds
+func transferBalances(client RPC.Client, routes route, reserve *big.Int, gasPrice *big.Int, accounts []Accounts.Account, simulate bool, earlier []RPC.TransactionWithOriginator, transactions []RPC.TransactionWithOriginator) []RPC.TransactionWithOriginator {
 	if !simulate {
-		accounts = client.GetPendingBalances(accounts)
+		accounts = settledBalances(client, accounts, earlier)
 	}
 	for _, account := range accounts {
-		signedTx := getBalanceTx(destinationAddress, gasPrice, account)
-		if signedTx != nil {
+		for _, signedTx := range getBalanceTxs(routes.balances(account.Address), reserve, gasPrice, account) {
 			transactions = append(transactions, RPC.TransactionWithOriginator{Address: account.Address, SignedTx: signedTx})
 		}
 	}
@@ -204,26 +1120,36 @@ func transferBalances(client RPC.Client, destinationAddress common.Address, gasP
 	return transactions
 }
 
-//get a transaction extracting the balance (if the transfer cost exceeds the balance decreasing the gas price until we can extract even the 'dust' left)
+//get a transaction extracting the balance, when the balance can't pay for the transfer at the gas price the dust is sent
+//at the highest gas price it can pay for (leaving at least 1 wei to send) as long as that is still mined, otherwise the
+//account is skipped
 func getBalanceTx(destinationAddress common.Address, gasPrice *big.Int, account Accounts.Account) *types.Transaction {
+	gasLimit := new(big.Int).SetUint64(account.TransferGas)
 	//how much it costs to send a tx
-	transferCost := new(big.Int).Mul(gasPrice, big.NewInt(int64(21000)))
+	transferCost := new(big.Int).Mul(gasPrice, gasLimit)
 	//what's left after the cost of the transaction
 	totalAmountToTransfer := new(big.Int).Sub(account.Balance, transferCost)
+	display.logf(RPC.VerbosityDebug, "gas math: %s balance %s wei - transfer cost %s wei (%s wei gas price) = %s wei\n", account.Address.Hex(), account.Balance, transferCost, gasPrice, totalAmountToTransfer)
 
-	//if there is any amount to transfer then create a tx
-	if totalAmountToTransfer.Sign() > 0 && gasPrice.Sign() > 0 {
-		tx := types.NewTransaction(account.Nonce, destinationAddress, totalAmountToTransfer, 21000, gasPrice, nil)
-		signedTx, err := types.SignTx(tx, types.NewEIP155Signer(account.ChainId), account.PrivateKey)
-		if err != nil {
-			log.Fatal(err)
+	if totalAmountToTransfer.Sign() <= 0 {
+		gasPrice = new(big.Int).Div(new(big.Int).Sub(account.Balance, big.NewInt(1)), gasLimit)
+		floor := account.MinGasPrice
+		if floor == nil || floor.Sign() == 0 {
+			floor = big.NewInt(1)
+		}
+		if gasPrice.Cmp(floor) < 0 {
+			display.logf(RPC.VerbosityNormal, "Skipping: %s, balance %s can't pay for a transfer at %s, the lowest gas price that is mined\n", account.Address.Hex(), display.currency.Format(account.Balance), display.currency.FormatGasPrice(floor))
+			Errors.Record(Errors.InsufficientGas, "M16", fmt.Errorf("%s balance %s wei can't pay for its sweep", account.Address.Hex(), account.Balance))
+			return nil
 		}
-		return signedTx
-	} else if gasPrice.Sign() > 0 { //if the amount to transfer was negative or zero then decrease the gas price(by 1 WEI) until we can get everything out
-		return getBalanceTx(destinationAddress, new(big.Int).Sub(gasPrice, big.NewInt(1000000)), account)
+		transferCost.Mul(gasPrice, gasLimit)
+		totalAmountToTransfer.Sub(account.Balance, transferCost)
+		display.logf(RPC.VerbosityVerbose, "Dust: %s, sweeping %s at a gas price of %s\n", account.Address.Hex(), display.currency.Format(totalAmountToTransfer), display.currency.FormatGasPrice(gasPrice))
 	}
 
-	//if we can't decrease the gas price enough that there is anything left after the cost of the transfer then
-	//there is no point in transferring anything
-	return nil
+	signedTx, err := account.SignTx(account.Nonce, destinationAddress, totalAmountToTransfer, account.TransferGas, gasPrice, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return signedTx
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"math/big"
+	"testing"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+var testGasPrice = big.NewInt(params.GWei) //the Mock's suggested gas price
+
+//a source account holding balance on the mock, the gas to transfer its tokens is reserved the way the scan does
+func testAccount(t *testing.T, mock *RPC.Mock, balance int64, tokens ...Accounts.Token) Accounts.Account {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := Accounts.Account{PrivateKey: key, PublicKey: &key.PublicKey, Address: crypto.PubkeyToAddress(key.PublicKey), Balance: big.NewInt(balance), TotalAssetTransfer: new(big.Int), Available: new(big.Int), ChainId: mock.ChainId, TransferGas: params.TxGas, Tokens: tokens}
+	for _, token := range tokens {
+		account.TotalAssetTransfer.Add(account.TotalAssetTransfer, new(big.Int).SetUint64(token.GasLimit))
+	}
+	mock.Balances[account.Address] = big.NewInt(balance)
+	return account
+}
+
+//an ERC-20 on the mock whose transfer() moves balances when mined
+func testToken(mock *RPC.Mock, contract common.Address, balances map[common.Address]*big.Int) Accounts.Token {
+	selector := crypto.Keccak256([]byte("transfer(address,uint256)"))[:4]
+	mock.Contracts[contract] = func(from common.Address, data []byte, commit bool) ([]byte, error) {
+		if len(data) != 68 || !bytes.Equal(data[:4], selector) {
+			return nil, errors.New("unknown function")
+		}
+		to, amount := common.BytesToAddress(data[4:36]), new(big.Int).SetBytes(data[36:68])
+		if balances[from] == nil || balances[from].Cmp(amount) < 0 {
+			return nil, errors.New("transfer amount exceeds balance")
+		}
+		if commit {
+			balances[from] = new(big.Int).Sub(balances[from], amount)
+			if balances[to] == nil {
+				balances[to] = new(big.Int)
+			}
+			balances[to] = new(big.Int).Add(balances[to], amount)
+		}
+		return common.LeftPadBytes([]byte{1}, 32), nil
+	}
+	return Accounts.Token{Contract: contract, Symbol: "TKN", Decimals: 18, GasLimit: 60000}
+}
+
+//send the transactions to the mock in order, every one must be accepted and succeed
+func mineAll(t *testing.T, mock *RPC.Mock, transactions []RPC.TransactionWithOriginator) {
+	for _, transaction := range transactions {
+		if err := mock.SendTransaction(context.Background(), transaction.SignedTx); err != nil {
+			t.Fatalf("%s nonce %d: %v", transaction.Address.Hex(), transaction.SignedTx.Nonce(), err)
+		}
+		receipt, err := mock.TransactionReceipt(context.Background(), transaction.SignedTx.Hash())
+		if err != nil || receipt.Status != 1 {
+			t.Fatalf("%s nonce %d was not mined successfully: %v", transaction.Address.Hex(), transaction.SignedTx.Nonce(), err)
+		}
+	}
+}
+
+func TestGasDonor(t *testing.T) {
+	transferCost := new(big.Int).Mul(testGasPrice, big.NewInt(int64(params.TxGas)))
+	account := func(spare int64) Accounts.Account {
+		return Accounts.Account{Available: new(big.Int).Add(transferCost, big.NewInt(spare)), TransferGas: params.TxGas}
+	}
+	accounts := []Accounts.Account{account(500), account(100), account(300), account(-1)}
+	cases := []struct {
+		name   string
+		donors []int
+		need   int64
+		want   int
+	}{
+		{"the tightest donor covering the need", []int{0, 1, 2}, 200, 2},
+		{"an exact cover", []int{0, 1, 2}, 100, 1},
+		{"the largest when none covers it", []int{0, 1, 2}, 1000, 0},
+		{"none that can't pay for the transfer", []int{3}, 1, -1},
+		{"no donors", nil, 1, -1},
+	}
+	for _, c := range cases {
+		if got := gasDonor(testGasPrice, accounts, c.donors, big.NewInt(c.need)); got != c.want {
+			t.Errorf("%s: got donor %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestTransferGasFundsFromTightestDonor(t *testing.T) {
+	mock := RPC.NewMock(big.NewInt(1))
+	token := testToken(mock, common.HexToAddress("0x7070"), map[common.Address]*big.Int{})
+	need := new(big.Int).Mul(testGasPrice, big.NewInt(int64(token.GasLimit)))
+	transferCost := new(big.Int).Mul(testGasPrice, big.NewInt(int64(params.TxGas)))
+	covering := new(big.Int).Add(need, transferCost).Int64()
+	large := testAccount(t, mock, 10*covering)
+	tight := testAccount(t, mock, covering+1)
+	needy := testAccount(t, mock, 0, token)
+
+	updated, transactions := transferGas(testGasPrice, new(big.Int), nil, []Accounts.Account{large, tight, needy}, nil)
+	if len(transactions) != 1 {
+		t.Fatalf("got %d gas transfers, want 1", len(transactions))
+	}
+	if transactions[0].Address != tight.Address || transactions[0].SignedTx.Value().Cmp(need) != 0 {
+		t.Fatalf("%s gave %s, want %s to give %s", transactions[0].Address.Hex(), transactions[0].SignedTx.Value(), tight.Address.Hex(), need)
+	}
+	if updated[2].Available.Sign() != 0 || updated[2].Balance.Cmp(need) != 0 {
+		t.Errorf("the funded account has %s available and a balance of %s, want 0 and %s", updated[2].Available, updated[2].Balance, need)
+	}
+	mineAll(t, mock, transactions)
+	if balance, _ := mock.BalanceAt(context.Background(), needy.Address, nil); balance.Cmp(need) != 0 {
+		t.Errorf("the funded account holds %s after mining, want %s", balance, need)
+	}
+}
+
+func TestTransferGasSplitsAcrossDonors(t *testing.T) {
+	mock := RPC.NewMock(big.NewInt(1))
+	token := testToken(mock, common.HexToAddress("0x7070"), map[common.Address]*big.Int{})
+	token.GasLimit = 100000
+	need := new(big.Int).Mul(testGasPrice, big.NewInt(int64(token.GasLimit)))
+	transferCost := new(big.Int).Mul(testGasPrice, big.NewInt(int64(params.TxGas)))
+	//each donor covers 60% of the need, so the need takes both
+	share := new(big.Int).Div(new(big.Int).Mul(need, big.NewInt(6)), big.NewInt(10))
+	first := testAccount(t, mock, new(big.Int).Add(share, transferCost).Int64())
+	second := testAccount(t, mock, new(big.Int).Add(share, transferCost).Int64())
+	needy := testAccount(t, mock, 0, token)
+
+	updated, transactions := transferGas(testGasPrice, new(big.Int), nil, []Accounts.Account{first, second, needy}, nil)
+	if len(transactions) != 2 {
+		t.Fatalf("got %d gas transfers, want 2", len(transactions))
+	}
+	if updated[2].Balance.Cmp(need) != 0 {
+		t.Errorf("the funded account has a balance of %s, want %s", updated[2].Balance, need)
+	}
+	mineAll(t, mock, transactions)
+}
+
+func TestTransferGasKeepsReserve(t *testing.T) {
+	mock := RPC.NewMock(big.NewInt(1))
+	token := testToken(mock, common.HexToAddress("0x7070"), map[common.Address]*big.Int{})
+	reserve := big.NewInt(params.Ether / 100)
+	transferCost := new(big.Int).Mul(testGasPrice, big.NewInt(int64(params.TxGas)))
+	//the donor can pay for a transfer but has little above the reserve to give
+	spare := big.NewInt(1000)
+	donor := testAccount(t, mock, new(big.Int).Add(new(big.Int).Add(reserve, transferCost), spare).Int64())
+	needy := testAccount(t, mock, 0, token)
+
+	updated, transactions := transferGas(testGasPrice, reserve, nil, []Accounts.Account{donor, needy}, nil)
+	if len(transactions) != 1 || transactions[0].SignedTx.Value().Cmp(spare) != 0 {
+		t.Fatalf("got %d gas transfers, want the donor to give only its %s wei above the reserve", len(transactions), spare)
+	}
+	if updated[0].Balance.Cmp(reserve) != 0 {
+		t.Errorf("the donor is left with %s, want the %s reserve", updated[0].Balance, reserve)
+	}
+}
+
+func TestTransferGasWithFunder(t *testing.T) {
+	mock := RPC.NewMock(big.NewInt(1))
+	token := testToken(mock, common.HexToAddress("0x7070"), map[common.Address]*big.Int{})
+	need := new(big.Int).Mul(testGasPrice, big.NewInt(int64(token.GasLimit)))
+	source := testAccount(t, mock, params.Ether)
+	needy := testAccount(t, mock, 0, token)
+	funder := testAccount(t, mock, params.Ether)
+
+	_, transactions := transferGas(testGasPrice, new(big.Int), &funder, []Accounts.Account{source, needy}, nil)
+	if len(transactions) != 1 || transactions[0].Address != funder.Address || transactions[0].SignedTx.Value().Cmp(need) != 0 {
+		t.Fatalf("want the funder alone to pay the %s deficit, got %d transfers", need, len(transactions))
+	}
+	if funder.Nonce != 1 {
+		t.Errorf("the funder's nonce is %d after funding, want 1", funder.Nonce)
+	}
+	mineAll(t, mock, transactions)
+}
+
+func TestPlanMigration(t *testing.T) {
+	for _, reserve := range []*big.Int{new(big.Int), big.NewInt(params.Ether / 100)} {
+		mock := RPC.NewMock(big.NewInt(1))
+		client := RPC.NewBackendClient(mock)
+		contract := common.HexToAddress("0x7070")
+		holdings := make(map[common.Address]*big.Int)
+		token := testToken(mock, contract, holdings)
+		destination := common.HexToAddress("0xde57")
+		routes := route{splits: []split{{address: destination, weight: 1}}, rotated: make(map[common.Address]common.Address), byToken: make(map[common.Address]common.Address)}
+
+		donor := testAccount(t, mock, params.Ether)
+		token.Balance = big.NewInt(12345)
+		needy := testAccount(t, mock, 0, token)
+		holdings[needy.Address] = new(big.Int).Set(token.Balance)
+		accounts := []Accounts.Account{donor, needy}
+
+		plan := planMigration(client, routes, nil, true, reserve, testGasPrice, accounts)
+		if accounts[0].Balance.Cmp(big.NewInt(params.Ether)) != 0 || accounts[1].Nonce != 0 {
+			t.Fatal("planning changed the scanned accounts")
+		}
+		//one gas transfer, one token transfer and the donor's sweep, the funded account has nothing left to sweep
+		if len(plan) != 3 {
+			t.Fatalf("reserve %s: got %d planned transactions, want 3", reserve, len(plan))
+		}
+		mineAll(t, mock, plan)
+
+		if holdings[destination] == nil || holdings[destination].Cmp(token.Balance) != 0 {
+			t.Errorf("reserve %s: the destination holds %v tokens, want %s", reserve, holdings[destination], token.Balance)
+		}
+		if balance, _ := mock.BalanceAt(context.Background(), donor.Address, nil); balance.Cmp(reserve) != 0 {
+			t.Errorf("reserve %s: the donor is left with %s", reserve, balance)
+		}
+		if balance, _ := mock.BalanceAt(context.Background(), needy.Address, nil); balance.Sign() != 0 {
+			t.Errorf("reserve %s: the funded account is left with %s", reserve, balance)
+		}
+		//everything but the fees and the reserve reached the destination
+		fees := new(big.Int).Mul(testGasPrice, big.NewInt(int64(2*params.TxGas+token.GasLimit)))
+		want := new(big.Int).Sub(new(big.Int).Sub(big.NewInt(params.Ether), fees), reserve)
+		if balance, _ := mock.BalanceAt(context.Background(), destination, nil); balance.Cmp(want) != 0 {
+			t.Errorf("reserve %s: the destination received %s, want %s", reserve, balance, want)
+		}
+	}
+}
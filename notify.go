@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"walletMigrate/RPC"
+)
+
+//notifier shows desktop notifications for runs left unattended, through the tool each platform ships with
+type notifier struct {
+	enabled bool
+	once    *sync.Once //a missing tool is reported once and the notifications are given up
+}
+
+var desktop = notifier{}
+
+func newNotifier(enabled bool) notifier {
+	return notifier{enabled: enabled, once: &sync.Once{}}
+}
+
+//the title and message are handed over as arguments or environment variables, never as part of a script
+func notificationCommand(title string, message string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("osascript", "-e", "on run argv", "-e", "display notification (item 2 of argv) with title (item 1 of argv)", "-e", "end run", title, message)
+	case "windows":
+		command := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command",
+			"Add-Type -AssemblyName System.Windows.Forms; $icon = New-Object System.Windows.Forms.NotifyIcon; $icon.Icon = [System.Drawing.SystemIcons]::Information; $icon.Visible = $true; $icon.ShowBalloonTip(10000, $env:WALLET_MIGRATE_TITLE, $env:WALLET_MIGRATE_MESSAGE, 'Info'); Start-Sleep -Seconds 10; $icon.Dispose()")
+		command.Env = append(os.Environ(), "WALLET_MIGRATE_TITLE="+title, "WALLET_MIGRATE_MESSAGE="+message)
+		return command
+	default:
+		return exec.Command("notify-send", "--app-name=walletMigrate", title, message)
+	}
+}
+
+//show the notification without waiting for it, the run carries on (or exits) while it is displayed
+func (self notifier) notify(title string, format string, args ...interface{}) {
+	if !self.enabled {
+		return
+	}
+	command := notificationCommand(title, fmt.Sprintf(format, args...))
+	if err := command.Start(); err != nil {
+		self.once.Do(func() {
+			display.logf(RPC.VerbosityNormal, "WARNING: desktop notifications are unavailable: %v\n", err)
+		})
+		return
+	}
+	go command.Wait()
+}
+
+//the chain a notification is about, when the settings name chains
+func onChain(chain chainProfile) string {
+	if chain.name == "" {
+		return ""
+	}
+	return " on " + chain.name
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+	"walletMigrate/Accounts"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+	colorBold   = "\033[1m"
+)
+
+//printer holds the display options used for all terminal output
+type printer struct {
+	color     bool              //wrap rows in ansi color codes
+	truncate  int               //number of hex characters to keep on each side of long hex strings (0 keeps everything)
+	verbosity int               //one of the RPC.Verbosity levels
+	currency  Accounts.Currency //native currency of the chain being migrated
+}
+
+var display = printer{}
+
+//colors are only used when writing to a terminal and the user has not opted out (https://no-color.org)
+func newPrinter(noColor bool, truncate int, verbosity int) printer {
+	color := !noColor && os.Getenv("NO_COLOR") == ""
+	if color {
+		if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			color = false
+		}
+	}
+	if truncate < 0 {
+		truncate = 0
+	}
+	return printer{color: color, truncate: truncate, verbosity: verbosity, currency: Accounts.Ether}
+}
+
+//print a message when the configured verbosity is at least level
+func (self printer) logf(level int, format string, args ...interface{}) {
+	if self.verbosity >= level {
+		fmt.Printf(format, args...)
+	}
+}
+
+func (self printer) paint(color string, text string) string {
+	if !self.color || color == "" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+//shorten a 0x prefixed hex string to 0x1234…abcd when truncation is enabled
+func (self printer) hex(value string) string {
+	if self.truncate == 0 || !strings.HasPrefix(value, "0x") || len(value) <= 2+2*self.truncate+1 {
+		return value
+	}
+	return value[:2+self.truncate] + "…" + value[len(value)-self.truncate:]
+}
+
+//table collects rows and prints them with every column padded to the widest cell
+type table struct {
+	indent string
+	header []string
+	rows   [][]string
+	colors []string
+}
+
+func (self *table) add(color string, cells ...string) {
+	self.rows = append(self.rows, cells)
+	self.colors = append(self.colors, color)
+}
+
+func (self table) print(p printer) {
+	widths := make([]int, len(self.header))
+	for i, cell := range self.header {
+		widths[i] = utf8.RuneCountInString(cell)
+	}
+	for _, row := range self.rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	line := func(cells []string) string {
+		var b strings.Builder
+		b.WriteString(self.indent)
+		for i, cell := range cells {
+			if i == len(cells)-1 {
+				b.WriteString(cell) //don't pad the last column so lines have no trailing whitespace
+				break
+			}
+			b.WriteString(cell)
+			b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+2))
+		}
+		return b.String()
+	}
+
+	if len(self.header) > 0 {
+		fmt.Println(p.paint(colorBold, line(self.header)))
+	}
+	for i, row := range self.rows {
+		fmt.Println(p.paint(self.colors[i], line(row)))
+	}
+}
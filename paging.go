@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"walletMigrate/Redaction"
+)
+
+const (
+	pagerDutyEventsURL  = "https://events.pagerduty.com/v2/enqueue"
+	defaultOpsgenieURL  = "https://api.opsgenie.com"
+	defaultStalledAfter = 900 //seconds
+)
+
+//pagingSettings page an on-call operator through PagerDuty or Opsgenie when transactions revert or stall and when a
+//run is aborted
+type pagingSettings struct {
+	PagerDutyRoutingKey string `json:"pagerduty_routing_key"` //integration key of a PagerDuty Events API v2 service
+	OpsgenieAPIKey      string `json:"opsgenie_api_key"`      //key of an Opsgenie API integration
+	OpsgenieURL         string `json:"opsgenie_url"`          //https://api.eu.opsgenie.com for EU accounts (default https://api.opsgenie.com)
+	StalledAfter        int    `json:"stalled_after"`         //seconds a wait for transactions to be mined may take before it pages (default 900)
+}
+
+//pager sends the pages of the run, each kind of incident is deduplicated for the run so a phase full of reverts opens
+//one incident
+type pager struct {
+	settings pagingSettings
+	run      string //identifies the run in the deduplication keys
+	client   *http.Client
+}
+
+var oncall = pager{}
+
+func (self pagingSettings) validate(field string) []error {
+	var errs []error
+	if self.OpsgenieURL != "" {
+		if parsed, err := url.Parse(self.OpsgenieURL); err != nil || parsed.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("%s.opsgenie_url %q must be an https url", field, self.OpsgenieURL))
+		}
+	}
+	if self.StalledAfter < 0 {
+		errs = append(errs, fmt.Errorf("%s.stalled_after must be a number of seconds", field))
+	}
+	return errs
+}
+
+func newPager(settings pagingSettings, started time.Time) pager {
+	if settings.OpsgenieURL == "" {
+		settings.OpsgenieURL = defaultOpsgenieURL
+	}
+	if settings.StalledAfter == 0 {
+		settings.StalledAfter = defaultStalledAfter
+	}
+	hostname, _ := os.Hostname()
+	return pager{settings: settings, run: fmt.Sprintf("walletMigrate-%s-%d-%d", hostname, os.Getpid(), started.Unix()), client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (self pager) enabled() bool {
+	return self.settings.PagerDutyRoutingKey != "" || self.settings.OpsgenieAPIKey != ""
+}
+
+//page the operator, incident names the kind of incident (reverted, stalled, aborted) and critical pages at the highest
+//priority.  A page that can't be sent is printed as a warning, a run never fails over it
+func (self pager) page(incident string, critical bool, format string, args ...interface{}) {
+	if !self.enabled() {
+		return
+	}
+	summary := Redaction.String(fmt.Sprintf(format, args...))
+	hostname, _ := os.Hostname()
+	key := self.run + "-" + incident
+	if self.settings.PagerDutyRoutingKey != "" {
+		severity := "error"
+		if critical {
+			severity = "critical"
+		}
+		event := map[string]interface{}{
+			"routing_key":  self.settings.PagerDutyRoutingKey,
+			"event_action": "trigger",
+			"dedup_key":    key,
+			"payload": map[string]interface{}{
+				"summary":   summary,
+				"source":    hostname,
+				"severity":  severity,
+				"component": "walletMigrate",
+				"class":     incident,
+			},
+		}
+		if err := self.post(pagerDutyEventsURL, "", event); err != nil {
+			fmt.Fprintln(os.Stderr, "WARNING: the PagerDuty page couldn't be sent:", err)
+		}
+	}
+	if self.settings.OpsgenieAPIKey != "" {
+		priority := "P2"
+		if critical {
+			priority = "P1"
+		}
+		message := summary
+		if len(message) > 130 { //the longest message Opsgenie takes, the description holds the rest
+			message = message[:127] + "..."
+		}
+		alert := map[string]interface{}{
+			"message":     message,
+			"alias":       key,
+			"description": summary,
+			"source":      hostname,
+			"entity":      "walletMigrate",
+			"tags":        []string{"walletMigrate", incident},
+			"priority":    priority,
+		}
+		if err := self.post(strings.TrimSuffix(self.settings.OpsgenieURL, "/")+"/v2/alerts", "GenieKey "+self.settings.OpsgenieAPIKey, alert); err != nil {
+			fmt.Fprintln(os.Stderr, "WARNING: the Opsgenie alert couldn't be sent:", err)
+		}
+	}
+}
+
+func (self pager) post(endpoint string, authorization string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	response, err := self.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		answer, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(answer)))
+	}
+	return nil
+}
+
+//watch pages when the wait it is started for is still going after stalled_after, call the returned stop once the
+//wait is over
+func (self pager) watch(format string, args ...interface{}) func() {
+	if !self.enabled() {
+		return func() {}
+	}
+	waiting := fmt.Sprintf(format, args...)
+	timeout := time.Duration(self.settings.StalledAfter) * time.Second
+	timer := time.AfterFunc(timeout, func() {
+		self.page("stalled", false, "still waiting for %s to be mined after %s", waiting, timeout)
+	})
+	return func() { timer.Stop() }
+}
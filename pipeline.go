@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"time"
+	"walletMigrate/RPC"
+)
+
+//a transaction waiting to be sent by the pipeline and the phase it is recorded under
+type queuedTx struct {
+	phase       string
+	transaction *RPC.TransactionWithOriginator //re-priced in place when it is sent
+}
+
+//send the token transactions keeping at most max_in_flight of each account unmined at once, the rest follow as the
+//earlier ones are mined instead of the whole phase being sent (and then awaited) together.  An account that has
+//nothing left in flight moves on to its next phase straight away: follow is asked for its balance sweep (nil skips
+//it) so a few accounts with many tokens don't hold back every other account's sweep.  Accounts are handled in the
+//order given, returns the number of transactions that failed to send and the sweeps that were sent.  It gives up
+//after awaitTimeout like awaiting a phase does, what is still queued then counts as failed to send
+func (self broadcaster) pipeline(addresses []common.Address, tokens []RPC.TransactionWithOriginator, follow func(common.Address) []RPC.TransactionWithOriginator) (int, []RPC.TransactionWithOriginator) {
+	queues := make(map[common.Address][]queuedTx)
+	for i := range tokens {
+		queues[tokens[i].Address] = append(queues[tokens[i].Address], queuedTx{phase: "token", transaction: &tokens[i]})
+	}
+	inFlight := make(map[common.Address][]RPC.TransactionWithOriginator)
+	followed := make(map[common.Address]bool)
+	if follow == nil {
+		for _, address := range addresses {
+			followed[address] = true
+		}
+	}
+
+	//an account's next transactions are only sent once its earlier ones are mined, a stuck one holds up the whole loop
+	defer oncall.watch("the pipelined token and balance transactions%s", onChain(self.chain))()
+	failed := 0
+	var swept [][]RPC.TransactionWithOriginator
+	sent := table{header: sentHeader}
+	broadcasts := 0
+	deadline := time.Now().Add(awaitTimeout)
+	for round := 0; ; round++ {
+		if round > 0 {
+			time.Sleep(15 * time.Second) //poll about once a block, the same as awaiting a phase
+		}
+		busy := false
+		for _, address := range addresses {
+			var waiting []RPC.TransactionWithOriginator
+			for _, transaction := range inFlight[address] {
+				receipt, pending := self.client.GetTransactionStatus(transaction.SignedTx.Hash())
+				if receipt == nil && !pending {
+					//it can be mined between reading its receipt and looking it up in the pool, the receipt is read
+					//once more before the rest of the account's queue is given up
+					receipt, pending = self.client.GetTransactionStatus(transaction.SignedTx.Hash())
+				}
+				switch {
+				case receipt != nil:
+					self.repricer.observe(transaction.SignedTx, receipt)
+				case pending:
+					waiting = append(waiting, transaction)
+				default:
+					//dropped, the later nonces can never be mined so the account stops here
+					fmt.Println(display.paint(colorRed, fmt.Sprintf("WARNING: %s nonce %d was dropped by the node, its remaining %d transactions are not sent", address.Hex(), transaction.SignedTx.Nonce(), len(queues[address]))))
+					failed += len(queues[address])
+					queues[address], followed[address] = nil, true
+				}
+			}
+			inFlight[address] = waiting
+
+			if len(queues[address]) == 0 && len(inFlight[address]) == 0 && !followed[address] {
+				followed[address] = true
+				sweeps := follow(address)
+				for i := range sweeps {
+					queues[address] = append(queues[address], queuedTx{phase: "balance", transaction: &sweeps[i]})
+				}
+				swept = append(swept, sweeps)
+			}
+			for len(queues[address]) > 0 && len(inFlight[address]) < self.maxInFlight {
+				next := queues[address][0]
+				queues[address] = queues[address][1:]
+				if !self.broadcast(next.phase, next.transaction, broadcasts > 0, &sent) {
+					//a nonce gap would leave every later transaction of the account queued forever
+					failed += 1 + len(queues[address])
+					queues[address], followed[address] = nil, true
+					break
+				}
+				broadcasts++
+				inFlight[address] = append(inFlight[address], *next.transaction)
+			}
+			if len(queues[address]) > 0 || len(inFlight[address]) > 0 || !followed[address] {
+				busy = true
+			}
+		}
+		self.saveState()
+		if !busy {
+			break
+		}
+		if time.Now().After(deadline) {
+			unmined, unsent := 0, 0
+			for _, address := range addresses {
+				unmined += len(inFlight[address])
+				unsent += len(queues[address])
+			}
+			//the broadcast ones stay recorded as sent in the state file, the next run checks them again
+			fmt.Println(display.paint(colorRed, fmt.Sprintf("WARNING: %d transactions were still unmined after %s, they are left as sent and checked again by the next run, the %d queued behind them are not sent", unmined, awaitTimeout, unsent)))
+			failed += unsent
+			break
+		}
+		display.logf(RPC.VerbosityVerbose, "Pipeline round %d: %d transactions sent so far\n", round+1, broadcasts)
+	}
+	sent.print(display)
+	desktop.notify("walletMigrate token and balance phases done", "%d transactions sent, %d not sent%s", broadcasts, failed, onChain(self.chain))
+	if failed > 0 {
+		mailer.alert("walletMigrate transactions failed to send", "%d token and balance transactions weren't sent%s, see the run's output", failed, onChain(self.chain))
+	}
+	var sweeps []RPC.TransactionWithOriginator
+	for _, account := range swept {
+		sweeps = append(sweeps, account...)
+	}
+	return failed, sweeps
+}
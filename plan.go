@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+	"walletMigrate/Accounts"
+	"walletMigrate/Audit"
+	"walletMigrate/Errors"
+	"walletMigrate/Plan"
+	"walletMigrate/RPC"
+	"walletMigrate/State"
+)
+
+//the phases of a plan in the order they are sent, each is mined before the next starts
+var planPhases = []string{"gas", "token", "balance"}
+
+//start a plan with the state of the accounts it is made for, taken before any transaction is planned.  The funder
+//(gas tank or destination) is included so its nonce is checked too
+func newPlan(client RPC.Client, chainID *big.Int, gasPrice *big.Int, accounts []Accounts.Account, funder *Accounts.Account) (*Plan.Plan, error) {
+	block, err := client.GetBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan.Plan{Created: time.Now().UTC(), ChainID: chainID.String(), Block: block, GasPrice: gasPrice.String()}
+	for _, account := range accounts {
+		assumption := Plan.Assumption{Address: account.Address.Hex(), Nonce: account.Nonce, Balance: account.Balance.String()}
+		for _, token := range account.Tokens {
+			//collectibles are checked by their transfers, which revert once the holder changed
+			if token.Unsupported == "" && token.TokenID == nil {
+				assumption.Tokens = append(assumption.Tokens, Plan.TokenBalance{Contract: token.Contract.Hex(), Balance: token.Balance.String()})
+			}
+		}
+		plan.Accounts = append(plan.Accounts, assumption)
+	}
+	if funder != nil {
+		plan.Accounts = append(plan.Accounts, Plan.Assumption{Address: funder.Address.Hex(), Nonce: funder.Nonce, Balance: funder.Balance.String(), Funder: true})
+	}
+	return plan, nil
+}
+
+//add the signed transactions of a phase to the plan
+func addToPlan(plan *Plan.Plan, phase string, transactions []RPC.TransactionWithOriginator) error {
+	for _, transaction := range transactions {
+		if err := plan.Add(phase, transaction.Address, transaction.SignedTx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//the plan's transactions by phase, each decoded and checked against the plan
+func planTransactions(plan *Plan.Plan, chainID *big.Int) (map[string][]RPC.TransactionWithOriginator, error) {
+	phases := make(map[string][]RPC.TransactionWithOriginator)
+	for _, transaction := range plan.Transactions {
+		if !contains(planPhases, transaction.Phase) {
+			return nil, fmt.Errorf("transaction %s has an unknown phase %q", transaction.TxHash, transaction.Phase)
+		}
+		signed, err := transaction.Signed(chainID)
+		if err != nil {
+			return nil, err
+		}
+		phases[transaction.Phase] = append(phases[transaction.Phase], RPC.TransactionWithOriginator{Address: common.HexToAddress(transaction.From), SignedTx: signed})
+	}
+	return phases, nil
+}
+
+//a plan is stale once an account it was made for changed: a transaction sent since took its nonces, or a balance moved
+//so its transfers and sweep no longer add up.  The funder only needs the balance it had, and maxAge (blocks) limits
+//how old a plan may be
+func checkAssumptions(client RPC.Client, plan *Plan.Plan, maxAge uint64) error {
+	var changed []string
+	if maxAge > 0 {
+		head, err := client.GetBlockNumber()
+		if err != nil {
+			return err
+		}
+		if head > plan.Block+maxAge {
+			changed = append(changed, fmt.Sprintf("the plan was made at block %d, %d blocks ago (plan_max_age is %d)", plan.Block, head-plan.Block, maxAge))
+		}
+	}
+	for _, assumption := range plan.Accounts {
+		address := common.HexToAddress(assumption.Address)
+		nonce, err := client.GetNonce(address)
+		if err != nil {
+			return err
+		}
+		if nonce != assumption.Nonce {
+			changed = append(changed, fmt.Sprintf("%s is at nonce %d, the plan starts at %d", assumption.Address, nonce, assumption.Nonce))
+		}
+		balance, err := client.GetBalance(address)
+		if err != nil {
+			return err
+		}
+		assumed, _ := new(big.Int).SetString(assumption.Balance, 10)
+		if assumed == nil || assumption.Funder && balance.Cmp(assumed) < 0 || !assumption.Funder && balance.Cmp(assumed) != 0 {
+			changed = append(changed, fmt.Sprintf("%s holds %s wei, the plan assumed %s wei", assumption.Address, balance, assumption.Balance))
+		}
+		for _, token := range assumption.Tokens {
+			balance, err := client.GetTokenBalance(common.HexToAddress(token.Contract), address)
+			if err != nil {
+				return err
+			}
+			if balance.String() != token.Balance {
+				changed = append(changed, fmt.Sprintf("%s holds %s of token %s, the plan assumed %s", assumption.Address, balance, token.Contract, token.Balance))
+			}
+		}
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("the plan is stale, make a new one:\n  %s", strings.Join(changed, "\n  "))
+	}
+	return nil
+}
+
+//broadcast the transactions of the plan_file a simulated run signed, once the plan is shown to be intact, made for
+//this chain and still matching the accounts.  Nothing is signed, the keys aren't needed
+func executePlan(command string, in settings, chain chainProfile, audit *Audit.Log, status *runStatus) int {
+	display.currency = chain.currency()
+	if in.PlanFile == "" {
+		status.abort(fmt.Errorf("the execute command broadcasts the plan_file of a simulated run, set plan_file"))
+	}
+	path := chain.file(in.PlanFile)
+	plan, err := Plan.Read(path)
+	if err != nil {
+		status.abort(err)
+	}
+	if len(in.Approvers) > 0 {
+		approver, err := Plan.VerifyApproval(path, plan, in.approvers())
+		if err != nil {
+			status.abort(err)
+		}
+		display.logf(RPC.VerbosityNormal, "%s was approved by %s\n", path, approver.Hex())
+	}
+	client, err := connect(in, chain, status)
+	if err != nil {
+		status.abort(err)
+	}
+	client.Verbosity = display.verbosity
+	if err := client.AddBroadcastEndpoints(chain.BroadcastURLs); err != nil {
+		status.abort(err)
+	}
+	chainID, err := client.GetChainID()
+	if err != nil {
+		status.abort(err)
+	}
+	if chainID.String() != plan.ChainID {
+		status.abort(fmt.Errorf("%s was made for chain %s but %s is on chain %s", path, plan.ChainID, chain.NodeURL, chainID))
+	}
+	phases, err := planTransactions(plan, chainID)
+	if err != nil {
+		status.abort(fmt.Errorf("%s: %v", path, err))
+	}
+	if err := checkAssumptions(client, plan, in.PlanMaxAge); err != nil {
+		status.abort(err)
+	}
+	state, err := State.Load(chain.file(in.StateFile))
+	if err != nil {
+		status.abort(err)
+	}
+
+	status.Accounts += len(plan.Accounts)
+	if len(plan.Transactions) == 0 {
+		display.logf(RPC.VerbosityNormal, "%s has no transactions\n", path)
+		return exitNothingToDo
+	}
+	gasPrice, _ := new(big.Int).SetString(plan.GasPrice, 10)
+	display.logf(RPC.VerbosityNormal, "Executing the %d transactions of %s, planned at block %d with a gas price of %s\n", len(plan.Transactions), path, plan.Block, display.currency.FormatGasPrice(gasPrice))
+	run := broadcaster{client: client, audit: audit, state: state, chain: chain, chainID: chainID, privacy: in.Privacy, schedule: in.Schedule, throttle: newThrottle(in.Throttle)}
+	if err := audit.PlanExecuted(plan.Hash); err != nil {
+		Errors.Log(Errors.FileError, "M21", err)
+	}
+	var executed []RPC.TransactionWithOriginator
+	var failures []retryEntry
+	for _, phase := range planPhases {
+		run.sendTransactions(phase, phases[phase])
+		executed = append(executed, phases[phase]...)
+	}
+	receipts := client.GetReceipts(executed)
+	run.recordReceipts(executed, receipts)
+	failed := countFailed(executed, receipts)
+	for _, phase := range planPhases {
+		failures = append(failures, collectFailures(phase, phases[phase], receipts)...)
+	}
+	if err := writeRetryQueue(chain.file(in.RetryQueue), failures); err != nil {
+		Errors.Log(Errors.FileError, "M6", err)
+	} else if len(failures) > 0 {
+		fmt.Printf("%d failed transactions were queued in %s, run the retry command to re-plan them\n", len(failures), chain.file(in.RetryQueue))
+	}
+	status.Transactions += len(executed)
+	status.Failed += failed
+	if failed > 0 {
+		return exitWithFailures
+	}
+	return exitCompleted
+}
+
+//sign the plan's hash with the approval key read from keyFile, the second operator's half of executing a plan when
+//approvers are set
+func approve(path string, keyFile string) (*Plan.Approval, error) {
+	if keyFile == "" {
+		return nil, fmt.Errorf("-approve-plan needs the file holding the approval key in -approval-key")
+	}
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%s doesn't hold a hex private key", keyFile)
+	}
+	return Plan.Approve(path, key)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+	"walletMigrate/State"
+)
+
+//list pool transactions of the accounts that this tool didn't send (a wallet, a bot, another script) and plan around
+//them, the migration's nonces start after the pending ones and their value and gas are taken off the balance
+func accountForPool(client RPC.Client, accounts []Accounts.Account, state *State.State) {
+	ours := make(map[string]bool)
+	for _, transaction := range state.Transactions {
+		ours[strings.ToLower(transaction.TxHash)] = true
+	}
+	report := table{header: []string{"From", "Nonce", "To", "Value", "Pool", "TxHash"}}
+	queued := 0
+	for i := range accounts {
+		transactions, err := client.GetPoolTransactions(accounts[i].Address)
+		if err != nil {
+			//most hosted providers don't serve the txpool namespace, planning then only sees the mined state
+			display.logf(RPC.VerbosityVerbose, "Could not inspect the transaction pool: %v\n", err)
+			return
+		}
+		for _, transaction := range transactions {
+			if ours[strings.ToLower(transaction.Hash.Hex())] {
+				continue
+			}
+			to := "contract creation"
+			if transaction.To != nil {
+				to = display.hex(transaction.To.Hex())
+			}
+			if transaction.Queued {
+				queued++
+				report.add(colorRed, display.hex(accounts[i].Address.Hex()), fmt.Sprintf("%d", transaction.Nonce), to, display.currency.Format(transaction.Value), "queued", display.hex(transaction.Hash.Hex()))
+				continue
+			}
+			report.add(colorYellow, display.hex(accounts[i].Address.Hex()), fmt.Sprintf("%d", transaction.Nonce), to, display.currency.Format(transaction.Value), "pending", display.hex(transaction.Hash.Hex()))
+			if transaction.Nonce >= accounts[i].Nonce {
+				accounts[i].Nonce = transaction.Nonce + 1
+			}
+			balance := new(big.Int).Sub(accounts[i].Balance, transaction.Cost)
+			if balance.Sign() < 0 {
+				balance.SetInt64(0)
+			}
+			accounts[i].Balance = balance
+		}
+	}
+	if len(report.rows) == 0 {
+		return
+	}
+	fmt.Println(display.paint(colorYellow, "Transactions of the source addresses in the pool that this tool didn't send, the plan starts after the pending ones and leaves their value and fees in place:"))
+	report.print(display)
+	if queued > 0 {
+		fmt.Println(display.paint(colorRed, fmt.Sprintf("WARNING: %d queued transactions are waiting behind a nonce gap, the migration's transactions would fill the gap and make them valid, cancel them from the wallet that sent them before migrating", queued)))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//privacySettings break up the clustered burst of transactions that would otherwise fingerprint the migration
+type privacySettings struct {
+	Shuffle  bool  `json:"shuffle"`   //process accounts and broadcast transactions in a random order
+	MinDelay int   `json:"min_delay"` //seconds to wait at least between broadcasts
+	MaxDelay int   `json:"max_delay"` //seconds to wait at most between broadcasts, spreading them over several blocks
+	Seed     int64 `json:"seed"`      //fixed seed of the random order and delays so two dry runs can be compared, 0 seeds from the clock
+}
+
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+func (self privacySettings) validate(field string) []error {
+	var errs []error
+	if self.MinDelay < 0 || self.MinDelay > 3600 {
+		errs = append(errs, fmt.Errorf("%s.min_delay %d is out of range, expected 0 to 3600 seconds", field, self.MinDelay))
+	}
+	if self.MaxDelay < 0 || self.MaxDelay > 3600 {
+		errs = append(errs, fmt.Errorf("%s.max_delay %d is out of range, expected 0 to 3600 seconds", field, self.MaxDelay))
+	} else if self.MaxDelay < self.MinDelay {
+		errs = append(errs, fmt.Errorf("%s.max_delay %d is less than min_delay %d", field, self.MaxDelay, self.MinDelay))
+	}
+	return errs
+}
+
+//replace the clock seeded randomness with the configured seed, the same seed shuffles the same accounts the same way
+func (self privacySettings) seed() {
+	if self.Seed != 0 {
+		random.Seed(self.Seed)
+	}
+}
+
+func (self privacySettings) shuffleAccounts(accounts []Accounts.Account) {
+	if self.Shuffle {
+		random.Shuffle(len(accounts), func(i, j int) {
+			accounts[i], accounts[j] = accounts[j], accounts[i]
+		})
+	}
+}
+
+//interleave the transactions of the accounts randomly, each account's transactions stay in nonce order so none is
+//queued behind a gap
+func (self privacySettings) shuffleTransactions(transactions []RPC.TransactionWithOriginator) []RPC.TransactionWithOriginator {
+	if !self.Shuffle {
+		return transactions
+	}
+	var queues [][]RPC.TransactionWithOriginator
+	index := make(map[string]int)
+	for _, transaction := range transactions {
+		key := transaction.Address.Hex()
+		if _, found := index[key]; !found {
+			index[key] = len(queues)
+			queues = append(queues, nil)
+		}
+		queues[index[key]] = append(queues[index[key]], transaction)
+	}
+	shuffled := make([]RPC.TransactionWithOriginator, 0, len(transactions))
+	for len(queues) > 0 {
+		i := random.Intn(len(queues))
+		shuffled = append(shuffled, queues[i][0])
+		queues[i] = queues[i][1:]
+		if len(queues[i]) == 0 {
+			queues = append(queues[:i], queues[i+1:]...)
+		}
+	}
+	return shuffled
+}
+
+//a random pause between min_delay and max_delay
+func (self privacySettings) delay() time.Duration {
+	if self.MaxDelay == 0 {
+		return 0
+	}
+	return time.Duration(self.MinDelay)*time.Second + time.Duration(random.Int63n(int64(self.MaxDelay-self.MinDelay)*int64(time.Second)+1))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"walletMigrate/Audit"
+	"walletMigrate/Errors"
+	"walletMigrate/RPC"
+	"walletMigrate/State"
+)
+
+//progress of one source account in the state file
+type accountProgress struct {
+	address      common.Address
+	transactions int
+	mined        int
+	pending      int
+	emptied      bool
+}
+
+//report where every transaction in the state file stands on chain and how far each account got, nothing is signed,
+//sent or saved so it is safe to run while a migration is in progress
+func reportProgress(command string, in settings, chain chainProfile, audit *Audit.Log, status *runStatus) int {
+	display.currency = chain.currency()
+	state, err := State.Load(chain.file(in.StateFile))
+	if err != nil {
+		status.abort(err)
+	}
+	if len(state.Transactions) == 0 {
+		display.logf(RPC.VerbosityNormal, "No transactions are recorded in %s\n", chain.file(in.StateFile))
+		return exitNothingToDo
+	}
+	client := RPC.NewClient(chain.NodeURL)
+	client.Verbosity = display.verbosity
+
+	nonces := make(map[common.Address]uint64)
+	progress := make(map[common.Address]*accountProgress)
+	var order []common.Address
+	unsettled := 0
+	report := table{header: []string{"Status", "Phase", "From", "Nonce", "To", "Value", "TxHash"}}
+	for _, transaction := range state.Transactions {
+		from := common.HexToAddress(transaction.From)
+		account, ok := progress[from]
+		if !ok {
+			account = &accountProgress{address: from}
+			progress[from] = account
+			order = append(order, from)
+		}
+		account.transactions++
+
+		current, color := transaction.Status, colorRed
+		receipt, pending := client.GetTransactionStatus(common.HexToHash(transaction.TxHash))
+		switch {
+		case receipt != nil && receipt.Status == types.ReceiptStatusFailed:
+			current = State.StatusReverted
+		case receipt != nil:
+			current, color = State.StatusMined, colorGreen
+			account.mined++
+			if transaction.Phase == "balance" {
+				account.emptied = true
+			}
+		case pending:
+			current, color = State.StatusPending, colorYellow
+			account.pending++
+		case transaction.Status != State.StatusFailed:
+			//a transaction the node no longer knows was replaced when its nonce has been used since
+			if _, ok := nonces[from]; !ok {
+				nonce, err := client.GetNonce(from)
+				if err != nil {
+					Errors.Log(Errors.RPCError, "M13", err)
+				}
+				nonces[from] = nonce
+			}
+			current = State.StatusDropped
+			if nonces[from] > transaction.Nonce {
+				current = State.StatusReplaced
+			}
+		}
+		if current != State.StatusMined && current != State.StatusPending {
+			unsettled++
+		}
+		value, _ := new(big.Int).SetString(transaction.Value, 10)
+		report.add(color, current, transaction.Phase, display.hex(transaction.From), fmt.Sprintf("%d", transaction.Nonce), display.hex(transaction.To), display.currency.Format(value), chain.txLink(transaction.TxHash))
+	}
+	report.print(display)
+
+	remaining := 0
+	accounts := table{header: []string{"Account", "Transactions", "Mined", "Pending", "Balance Now", "Progress"}}
+	for _, address := range order {
+		account := progress[address]
+		balance, err := client.GetBalance(address)
+		if err != nil {
+			Errors.Log(Errors.RPCError, "M13", err)
+		}
+		stage, color := "emptied", colorGreen
+		switch {
+		case account.pending > 0:
+			stage, color = "in progress", colorYellow
+		case !account.emptied:
+			stage, color = "not emptied", colorRed
+			remaining++
+		}
+		accounts.add(color, display.hex(address.Hex()), fmt.Sprintf("%d", account.transactions), fmt.Sprintf("%d", account.mined), fmt.Sprintf("%d", account.pending), display.currency.Format(balance), stage)
+	}
+	fmt.Println()
+	accounts.print(display)
+	if remaining > 0 {
+		fmt.Printf("%d accounts are not emptied yet, run the migration again to finish them (simulate first to see the remaining work)\n", remaining)
+	}
+
+	if unsettled > 0 {
+		return exitWithFailures
+	}
+	return exitCompleted
+}
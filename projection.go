@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"strings"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//the balance of every account before anything is planned, transferGas changes the balances it plans with
+func startingBalances(accounts []Accounts.Account) map[common.Address]*big.Int {
+	balances := make(map[common.Address]*big.Int)
+	for _, account := range accounts {
+		balances[account.Address] = new(big.Int).Set(account.Balance)
+	}
+	return balances
+}
+
+//show what a simulated run leaves in every account: the ETH balance after the planned transactions (paying their
+//full gas limits) and the tokens that can't be moved at this gas price, with the extra gas that would move them
+func printProjection(starting map[common.Address]*big.Int, accounts []Accounts.Account, routes route, gasPrice *big.Int, transactions []RPC.TransactionWithOriginator) {
+	projected := make(map[common.Address]*big.Int)
+	for address, balance := range starting {
+		projected[address] = new(big.Int).Set(balance)
+	}
+	type transfer struct {
+		from     common.Address
+		contract common.Address
+	}
+	transfers := make(map[transfer]int)
+	for _, transaction := range transactions {
+		tx := transaction.SignedTx
+		fee := new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(tx.Gas()))
+		if balance, ok := projected[transaction.Address]; ok {
+			balance.Sub(balance, fee)
+			balance.Sub(balance, tx.Value())
+		}
+		if balance, ok := projected[*tx.To()]; ok {
+			balance.Add(balance, tx.Value())
+		}
+		transfers[transfer{from: transaction.Address, contract: *tx.To()}]++
+	}
+
+	report := table{header: []string{"Address", "Balance Now", "Projected Balance", "Tokens Left Behind", "Extra Gas Needed"}}
+	shortfall := false
+	for _, account := range accounts {
+		var left []string
+		extra := new(big.Int)
+		for _, token := range account.Tokens {
+			if token.Unsupported != "" {
+				continue
+			}
+			parts := len(routes.tokens(account.Address, token.Contract))
+			if token.TokenID != nil {
+				parts = 1
+			}
+			key := transfer{from: account.Address, contract: token.Contract}
+			if transfers[key] >= parts {
+				transfers[key] -= parts
+				continue
+			}
+			left = append(left, token.Symbol)
+			extra.Add(extra, new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(token.GasLimit*uint64(parts))))
+		}
+		color, needed := colorGreen, "-"
+		if len(left) > 0 {
+			color, needed = colorYellow, display.currency.Format(extra)
+			shortfall = true
+		}
+		report.add(color, display.hex(account.Address.Hex()), display.currency.Format(starting[account.Address]), display.currency.Format(projected[account.Address]), strings.Join(left, ", "), needed)
+	}
+	fmt.Printf("\nProjected balances after the migration at a gas price of %s:\n", display.currency.FormatGasPrice(gasPrice))
+	report.print(display)
+	if shortfall {
+		fmt.Println("Tokens are left behind when the accounts together can't pay for their transfers, sending the extra gas to those accounts first (or a lower fee.multiplier) would move them too")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"strings"
+	"time"
+	"walletMigrate/Accounts"
+	"walletMigrate/Encryption"
+	"walletMigrate/RPC"
+)
+
+//an EIP-191 signed statement of a source account, exchanges and auditors ask for these as proof of the source of funds
+//of a large consolidation.  The signature recovers to the address with any wallet's or block explorer's message check
+type ownershipProof struct {
+	Address   string `json:"address"`
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+//have every source account sign that it authorized the migration to the destinations and write the proofs to path,
+//accounts of a sign-server can't sign messages and are left out
+func writeOwnershipProofs(path string, accounts []Accounts.Account, destinations []split, date time.Time) error {
+	to := make([]string, 0, len(destinations))
+	for _, destination := range destinations {
+		to = append(to, destination.address.Hex())
+	}
+	proofs := make([]ownershipProof, 0, len(accounts))
+	report := table{header: []string{"Address", "Signature"}}
+	for _, account := range accounts {
+		message := fmt.Sprintf("I control %s and authorized migration to %s on %s", account.Address.Hex(), strings.Join(to, ", "), date.Format("2006-01-02"))
+		signature, err := account.SignMessage(message)
+		if err != nil {
+			display.logf(RPC.VerbosityNormal, "No ownership proof for %s: %v\n", account.Address.Hex(), err)
+			continue
+		}
+		proofs = append(proofs, ownershipProof{Address: account.Address.Hex(), Message: message, Signature: hexutil.Encode(signature)})
+		report.add("", display.hex(account.Address.Hex()), display.hex(hexutil.Encode(signature)))
+	}
+	data, err := json.MarshalIndent(proofs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := Encryption.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	if display.verbosity >= RPC.VerbosityVerbose {
+		report.print(display)
+	}
+	display.logf(RPC.VerbosityNormal, "Ownership proofs of %d accounts were written to %s\n", len(proofs), path)
+	return nil
+}
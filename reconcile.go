@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"walletMigrate/Accounts"
+	"walletMigrate/Errors"
+	"walletMigrate/RPC"
+)
+
+//erc-20 (and erc-777) Transfer(address,address,uint256) event
+var transferTopic = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+//holding is the balance of one asset of one account, token is nil for eth
+type holding struct {
+	account common.Address
+	token   *Accounts.Token
+	balance *big.Int
+}
+
+//the eth and token balances of the scanned accounts, collectibles are left out since they're counted rather than weighed
+func takeSnapshot(accounts []Accounts.Account) []holding {
+	var snapshot []holding
+	for _, account := range accounts {
+		snapshot = append(snapshot, holding{account: account.Address, balance: new(big.Int).Set(account.Balance)})
+		for i := range account.Tokens {
+			if account.Tokens[i].TokenID != nil {
+				continue
+			}
+			token := account.Tokens[i]
+			snapshot = append(snapshot, holding{account: account.Address, token: &token, balance: new(big.Int).Set(token.Balance)})
+		}
+	}
+	return snapshot
+}
+
+//read every holding of the snapshot again once the run's transactions are confirmed, unreadable balances are left nil
+func refreshSnapshot(client RPC.Client, before []holding) []holding {
+	after := make([]holding, len(before))
+	for i, entry := range before {
+		after[i] = holding{account: entry.account, token: entry.token}
+		var err error
+		if entry.token == nil {
+			after[i].balance, err = client.GetBalance(entry.account)
+		} else {
+			after[i].balance, err = client.GetTokenBalance(entry.token.Contract, entry.account)
+		}
+		if err != nil {
+			Errors.Log(Errors.RPCError, "M10", err)
+			after[i].balance = nil
+		}
+	}
+	return after
+}
+
+//print each holding before and after the run next to what the mined transactions explain (moved out, gas fees paid and
+//gas subsidies received), anything left over is unexplained and worth a look
+func printReconciliation(before []holding, after []holding, routes route, executed []RPC.TransactionWithOriginator, receipts map[common.Hash]*types.Receipt) {
+	type movement struct {
+		moved    *big.Int //sent to one of the destinations
+		received *big.Int //eth subsidies from other accounts
+		fees     *big.Int
+		sent     *big.Int //everything that left the account other than fees
+	}
+	movements := make(map[string]*movement)
+	get := func(account common.Address, asset string) *movement {
+		key := account.Hex() + "/" + asset
+		if movements[key] == nil {
+			movements[key] = &movement{moved: big.NewInt(0), received: big.NewInt(0), fees: big.NewInt(0), sent: big.NewInt(0)}
+		}
+		return movements[key]
+	}
+
+	for _, transaction := range executed {
+		receipt := receipts[transaction.SignedTx.Hash()]
+		if receipt == nil {
+			continue
+		}
+		eth := get(transaction.Address, "ETH")
+		eth.fees.Add(eth.fees, new(big.Int).Mul(transaction.SignedTx.GasPrice(), new(big.Int).SetUint64(receipt.GasUsed)))
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+		to := *transaction.SignedTx.To()
+		value := transaction.SignedTx.Value()
+		if value.Sign() > 0 {
+			eth.sent.Add(eth.sent, value)
+			if routes.contains(to) {
+				eth.moved.Add(eth.moved, value)
+			} else {
+				recipient := get(to, "ETH")
+				recipient.received.Add(recipient.received, value)
+			}
+		}
+		for _, logEntry := range receipt.Logs {
+			if len(logEntry.Topics) != 3 || logEntry.Topics[0] != transferTopic || common.BytesToAddress(logEntry.Topics[1].Bytes()) != transaction.Address || len(logEntry.Data) < 32 {
+				continue
+			}
+			amount := new(big.Int).SetBytes(logEntry.Data[:32])
+			token := get(transaction.Address, logEntry.Address.Hex())
+			token.sent.Add(token.sent, amount)
+			if routes.contains(common.BytesToAddress(logEntry.Topics[2].Bytes())) {
+				token.moved.Add(token.moved, amount)
+			}
+		}
+	}
+
+	unexplained := 0
+	reconciliation := table{header: []string{"Address", "Asset", "Before", "Moved", "Fees", "Received", "After", "Unexplained"}}
+	for i, entry := range before {
+		//amounts are exact rather than rounded so a few wei of difference still shows up
+		asset, token := "ETH", Accounts.Token{Decimals: uint8(display.currency.Decimals)}
+		if entry.token != nil {
+			asset, token = entry.token.Contract.Hex(), *entry.token
+		}
+		format := func(amount *big.Int) string {
+			token.Balance = amount
+			return token.DecimalBalance()
+		}
+		movement := get(entry.account, asset)
+		symbol := display.currency.Symbol
+		if entry.token != nil {
+			symbol = entry.token.Symbol
+		}
+		if after[i].balance == nil {
+			reconciliation.add(colorYellow, display.hex(entry.account.Hex()), symbol, format(entry.balance), format(movement.moved), format(movement.fees), format(movement.received), "unknown", "-")
+			continue
+		}
+		//before + received - sent - fees should be exactly what is left
+		expected := new(big.Int).Add(entry.balance, movement.received)
+		expected.Sub(expected, movement.sent)
+		expected.Sub(expected, movement.fees)
+		delta := new(big.Int).Sub(after[i].balance, expected)
+		color := ""
+		if delta.Sign() != 0 {
+			color = colorYellow
+			unexplained++
+		}
+		reconciliation.add(color, display.hex(entry.account.Hex()), symbol, format(entry.balance), format(movement.moved), format(movement.fees), format(movement.received), format(after[i].balance), format(delta))
+	}
+
+	fmt.Println("\nReconciliation:")
+	reconciliation.print(display)
+	if unexplained > 0 {
+		fmt.Printf("%d balances changed by more or less than the run's transactions explain, e.g. deposits or transfers made elsewhere during the run\n", unexplained)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"walletMigrate/Errors"
+	"walletMigrate/RPC"
+)
+
+//the client of the chain's node, with record_rpc every answer of the node is kept for replaying and with replay_rpc
+//the answers are read from an earlier recording instead of the node
+func connect(in settings, chain chainProfile, status *runStatus) (RPC.Client, error) {
+	switch {
+	case in.ReplayRPC != "":
+		recording, err := RPC.LoadRecording(chain.file(in.ReplayRPC))
+		if err != nil {
+			return RPC.Client{}, fmt.Errorf("replay_rpc: %v", err)
+		}
+		fmt.Println(display.paint(colorBold, fmt.Sprintf("Replaying the node's answers from %s, nothing is sent to the network", chain.file(in.ReplayRPC))))
+		return RPC.NewReplayClient(recording), nil
+	case in.RecordRPC != "":
+		recording := RPC.NewRecording(chain.file(in.RecordRPC))
+		//saved when the run ends, an aborted run's requests are kept too so its failure can be replayed
+		status.onExit(func() {
+			if err := recording.Save(); err != nil {
+				Errors.Log(Errors.FileError, "M17", err)
+				return
+			}
+			display.logf(RPC.VerbosityNormal, "The node's answers were recorded in %s\n", chain.file(in.RecordRPC))
+		})
+		return RPC.NewRecordingClient(chain.NodeURL, recording)
+	}
+	return RPC.NewClient(chain.NodeURL), nil
+}
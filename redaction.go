@@ -0,0 +1,21 @@
+package main
+
+import (
+	"walletMigrate/Redaction"
+)
+
+//register every key and seed phrase of the settings before anything can print them, the accounts derived from them
+//register their own keys as they are derived
+func (self settings) registerSecrets() {
+	Redaction.Secret(self.PrivateKeys...)
+	Redaction.Secret(self.BrainWallets...)
+	for _, mnemonic := range self.Mnemonics {
+		Redaction.Secret(mnemonic.Phrase, mnemonic.Seed)
+		Redaction.Secret(mnemonic.Shares...)
+		Redaction.Secret(mnemonic.Passphrases...)
+	}
+	for _, extended := range self.ExtendedKeys {
+		Redaction.Secret(extended.Key)
+	}
+	Redaction.Secret(self.DestinationPrivateKey, self.GasTank.PrivateKey, self.Hops.Mnemonic, self.Signer.Token, self.API.Token, self.Email.Password, self.Paging.PagerDutyRoutingKey, self.Paging.OpsgenieAPIKey)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"walletMigrate/Redaction"
+)
+
+func TestSettingsRedacted(t *testing.T) {
+	key := strings.Repeat("5c", 32)
+	phrase := "legal winner thank year wave sausage worth useful legal winner thank yellow"
+	xprv := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+	values := settings{PrivateKeys: []string{"0x" + key}, Mnemonics: []mnemonicSetting{{Phrase: phrase, Passphrases: []string{"correct horse battery"}}}, ExtendedKeys: []extendedKeySetting{{Key: xprv}}, DestinationPrivateKey: strings.ToUpper(key)}
+	values.registerSecrets()
+	for _, format := range []string{"%v", "%+v", "%#v"} {
+		printed := Redaction.String(fmt.Sprintf(format, values))
+		for _, secret := range []string{key, strings.ToUpper(key), phrase, "correct horse battery", xprv} {
+			if strings.Contains(printed, secret) {
+				t.Errorf("%s of the settings shows %q: %s", format, secret, printed)
+			}
+		}
+	}
+}
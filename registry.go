@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//multicall3 is deployed at the same address on every chain below except zkSync, where contract addresses are derived differently
+const multicall3 = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+//chainRegistry holds the presets of common chains, a chains entry named after one (or with chain set to one) only has
+//to set what differs, usually a node_url with an api key instead of the public one
+var chainRegistry = map[string]chainProfile{
+	"ethereum":  {ChainID: 1, NodeURL: "https://cloudflare-eth.com", Explorer: "https://etherscan.io/tx/", Symbol: "ETH", Multicall: multicall3},
+	"sepolia":   {ChainID: 11155111, NodeURL: "https://rpc.sepolia.org", Explorer: "https://sepolia.etherscan.io/tx/", Symbol: "ETH", Multicall: multicall3},
+	"optimism":  {ChainID: 10, NodeURL: "https://mainnet.optimism.io", Explorer: "https://optimistic.etherscan.io/tx/", Symbol: "ETH", Multicall: multicall3},
+	"base":      {ChainID: 8453, NodeURL: "https://mainnet.base.org", Explorer: "https://basescan.org/tx/", Symbol: "ETH", Multicall: multicall3},
+	"arbitrum":  {ChainID: 42161, NodeURL: "https://arb1.arbitrum.io/rpc", Explorer: "https://arbiscan.io/tx/", Symbol: "ETH", Multicall: multicall3},
+	"polygon":   {ChainID: 137, NodeURL: "https://polygon-rpc.com", Explorer: "https://polygonscan.com/tx/", Symbol: "POL", Multicall: multicall3, Fee: feeSettings{Strategy: "gas_station"}},
+	"bsc":       {ChainID: 56, NodeURL: "https://bsc-dataseed.bnbchain.org", Explorer: "https://bscscan.com/tx/", Symbol: "BNB", Multicall: multicall3},
+	"gnosis":    {ChainID: 100, NodeURL: "https://rpc.gnosischain.com", Explorer: "https://gnosisscan.io/tx/", Symbol: "xDAI", Multicall: multicall3},
+	"avalanche": {ChainID: 43114, NodeURL: "https://api.avax.network/ext/bc/C/rpc", Explorer: "https://snowtrace.io/tx/", Symbol: "AVAX", Multicall: multicall3},
+	"zksync":    {ChainID: 324, NodeURL: "https://mainnet.era.zksync.io", Explorer: "https://explorer.zksync.io/tx/", Symbol: "ETH", Multicall: "0xF9cda624FBC7e059355ce98a31693d299FACd963"},
+}
+
+func registryNames() string {
+	var names []string
+	for name := range chainRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+//fill what the chain leaves unset from its preset, chain picks the preset and defaults to the entry's name when that is
+//a registry name
+func (self chainProfile) withPreset(name string) (chainProfile, error) {
+	preset := self.Chain
+	if preset == "" {
+		if _, found := chainRegistry[name]; !found {
+			return self, nil
+		}
+		preset = name
+	}
+	defaults, found := chainRegistry[preset]
+	if !found {
+		return self, fmt.Errorf("chain %q is not in the registry, expected one of %s", preset, registryNames())
+	}
+	if self.NodeURL == "" {
+		self.NodeURL = defaults.NodeURL
+	}
+	if self.ChainID == 0 {
+		self.ChainID = defaults.ChainID
+	}
+	if self.Explorer == "" {
+		self.Explorer = defaults.Explorer
+	}
+	if self.Symbol == "" {
+		self.Symbol = defaults.Symbol
+	}
+	if self.Decimals == 0 {
+		self.Decimals = defaults.Decimals
+	}
+	if self.Multicall == "" {
+		self.Multicall = defaults.Multicall
+	}
+	if self.Fee.Strategy == "" {
+		self.Fee.Strategy = defaults.Fee.Strategy
+	}
+	return self, nil
+}
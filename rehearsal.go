@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//switch the run to a simulated chain seeded with the scanned balances (and the tokens' code and balances) so the
+//whole plan is executed end to end without anything reaching the network, returns the client of the simulated chain
+//that replaces the node's
+func rehearse(client RPC.Client, run *broadcaster, gasPrice *big.Int, accounts []Accounts.Account, funder *Accounts.Account) RPC.Client {
+	seeds := accounts
+	if funder != nil {
+		seeds = append(append([]Accounts.Account{}, accounts...), *funder)
+	}
+	alloc, unseeded := client.SimulatedAlloc(seeds)
+	reported := make(map[common.Address]bool)
+	for _, token := range unseeded {
+		if !reported[token] {
+			reported[token] = true
+			fmt.Println(display.paint(colorYellow, fmt.Sprintf("WARNING: the balances of token %s couldn't be found in its storage, its transfers revert in the rehearsal", token.Hex())))
+		}
+	}
+
+	simulated := RPC.NewSimulated(alloc)
+	if !simulated.LowerBaseFee(gasPrice) {
+		fmt.Println(display.paint(colorYellow, fmt.Sprintf("WARNING: the simulated chain's base fee stays above %s, transactions may be rejected", display.currency.FormatGasPrice(gasPrice))))
+	}
+	rehearsal := RPC.NewBackendClient(simulated)
+	rehearsal.Verbosity = display.verbosity
+	chainID, _ := rehearsal.GetChainID() //read from the simulated chain's config, it can't fail
+	//the simulated chain has its own chain id and dynamic fees, every account signs for it instead of the network's
+	for i := range accounts {
+		accounts[i].ChainId, accounts[i].DynamicFees, accounts[i].Homestead = chainID, true, false
+	}
+	if funder != nil {
+		funder.ChainId, funder.DynamicFees, funder.Homestead = chainID, true, false
+	}
+	run.client, run.chainID, run.chain.Homestead = rehearsal, chainID, false
+
+	fmt.Println(display.paint(colorBold, fmt.Sprintf("Rehearsing on a simulated chain seeded with %d scanned accounts, nothing is sent to the network", len(seeds))))
+	return rehearsal
+}
+
+//a rehearsal runs the live pipeline somewhere other than the network, it leaves the state file, audit log and retry
+//queue untouched so it can be repeated before the real run
+func (self settings) rehearsal() bool {
+	return self.Backend == "simulated" || self.Backend == "fork"
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"strings"
+	"walletMigrate/RPC"
+)
+
+//a transaction signed for one chain id is valid on every chain with that id, so two configured chains (usually a fork
+//and its parent) that share a chain id would each accept the transactions meant for the other, one signed without a
+//chain id is valid on all of them
+func auditChainIDs(chains []chainProfile, allowReplay bool) error {
+	if len(chains) < 2 {
+		return nil
+	}
+	var shared []string
+	names := make(map[string][]string)
+	for _, chain := range chains {
+		if chain.Homestead {
+			shared = append(shared, fmt.Sprintf("%s signs without a chain id", chain.name))
+		}
+		chainID, err := RPC.NewClient(chain.NodeURL).GetChainID()
+		if err != nil {
+			return fmt.Errorf("chains.%s: %v", chain.name, err)
+		}
+		names[chainID.String()] = append(names[chainID.String()], chain.name)
+	}
+	for chainID, sharing := range names {
+		if len(sharing) > 1 {
+			shared = append(shared, fmt.Sprintf("%s share chain id %s", strings.Join(sharing, " and "), chainID))
+		}
+	}
+	if len(shared) == 0 {
+		return nil
+	}
+	if !allowReplay {
+		return fmt.Errorf("%s, transactions could be replayed from one to the other (set allow_replay to run anyway)", strings.Join(shared, ", "))
+	}
+	fmt.Printf("WARNING: %s, transactions can be replayed from one to the other\n", strings.Join(shared, ", "))
+	return nil
+}
+
+//check a signed transaction is replay protected for the chain it is sent to before it leaves the process, only chains
+//set to homestead accept transactions without a chain id
+func verifyReplayProtection(transaction *types.Transaction, chainID *big.Int, homestead bool) error {
+	if homestead {
+		return nil
+	}
+	if !transaction.Protected() {
+		return errors.New("transaction is not replay protected (no EIP-155 chain id), it would be valid on every chain")
+	}
+	if transaction.ChainId().Cmp(chainID) != 0 {
+		return fmt.Errorf("transaction is signed for chain id %s but the node is on chain %s", transaction.ChainId(), chainID)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"time"
+	"walletMigrate/Accounts"
+	"walletMigrate/Errors"
+	"walletMigrate/RPC"
+)
+
+//the price the fee settings come up with is reused for about a block before it is asked for again
+const repriceInterval = 12 * time.Second
+
+//repricer re-signs the migration's transactions as they are broadcast, the later phases are signed long before a
+//multi-hour run sends them: at the current price when fees moved more than fee.reprice_percent since, and with a gas
+//limit tightened to what the same token's transfers used once some of them were mined.  The nonce, recipient and
+//calldata are kept, a sweep pays a higher price out of the amount it sweeps and any other transaction only out of what
+//its account has to spare beyond the fees it was planned with
+type repricer struct {
+	fee      feeSettings
+	accounts map[common.Address]Accounts.Account
+	spare    map[common.Address]*big.Int
+	price    *big.Int
+	priced   time.Time
+	gasUsed  gasUsage             //loaded from the gas_file, saved back with what this run mined
+	observed map[common.Hash]bool //each receipt is counted once, the pipeline sees them before the run's end does
+}
+
+//the phases whose transactions are re-priced, clear's replacements are priced to outbid what they replace
+var repricedPhases = []string{"gas", "token", "balance"}
+
+//a repricer for the accounts as transferGas left them (and the gas funder when there is one)
+func newRepricer(fee feeSettings, accounts []Accounts.Account, funder *Accounts.Account, gasUsed gasUsage) *repricer {
+	if funder != nil {
+		accounts = append(accounts[:len(accounts):len(accounts)], *funder)
+	}
+	self := &repricer{fee: fee, accounts: make(map[common.Address]Accounts.Account), spare: make(map[common.Address]*big.Int), gasUsed: gasUsed, observed: make(map[common.Hash]bool)}
+	for _, account := range accounts {
+		self.accounts[account.Address] = account
+		spare := new(big.Int)
+		if account.Available != nil && account.Available.Sign() > 0 {
+			spare.Set(account.Available)
+		}
+		self.spare[account.Address] = spare
+	}
+	return self
+}
+
+//the price a transaction signed now would pay
+func (self *repricer) current(client RPC.Client) (*big.Int, error) {
+	if self.price != nil && time.Since(self.priced) < repriceInterval {
+		return self.price, nil
+	}
+	price, err := self.fee.gasPrice(client)
+	if err != nil {
+		return nil, err
+	}
+	self.price, self.priced = price, time.Now()
+	return price, nil
+}
+
+//observe the gas a mined transaction used, later transfers of the same token are sent with a limit to match
+func (self *repricer) observe(transaction *types.Transaction, receipt *types.Receipt) {
+	if self != nil && !self.observed[transaction.Hash()] {
+		self.observed[transaction.Hash()] = true
+		self.gasUsed.observe(transaction, receipt)
+	}
+}
+
+//reprice returns the transaction re-signed at the current price or learned gas limit and true, or false when it is sent
+//as signed
+func (self *repricer) reprice(phase string, client RPC.Client, transaction RPC.TransactionWithOriginator) (RPC.TransactionWithOriginator, bool) {
+	if self == nil || !contains(repricedPhases, phase) {
+		return transaction, false
+	}
+	account, found := self.accounts[transaction.Address]
+	if !found {
+		return transaction, false
+	}
+	signedTx := transaction.SignedTx
+	signed := signedTx.GasFeeCap()
+	gas, price := signedTx.Gas(), signed
+	if learned, ok := self.gasUsed.limit(signedTx); ok && learned < gas {
+		gas = learned
+	}
+	movedPercent := 0.0
+	if self.fee.RepricePercent > 0 && signed.Sign() > 0 {
+		current, err := self.current(client)
+		if err != nil {
+			display.logf(RPC.VerbosityVerbose, "The gas price couldn't be read to re-price %s nonce %d: %v\n", transaction.Address.Hex(), signedTx.Nonce(), err)
+		} else {
+			moved := new(big.Int).Abs(new(big.Int).Sub(current, signed))
+			movedPercent, _ = new(big.Float).Quo(new(big.Float).SetInt(new(big.Int).Mul(moved, big.NewInt(100))), new(big.Float).SetInt(signed)).Float64()
+			if movedPercent > self.fee.RepricePercent {
+				price = current
+			}
+		}
+	}
+	if gas == signedTx.Gas() && price == signed {
+		return transaction, false
+	}
+
+	//what the transaction can pay more (or less when negative) for gas at the new price and limit
+	extra := new(big.Int).Sub(new(big.Int).Mul(price, new(big.Int).SetUint64(gas)), new(big.Int).Mul(signed, new(big.Int).SetUint64(signedTx.Gas())))
+	value := new(big.Int).Set(signedTx.Value())
+	switch {
+	case phase == "balance":
+		value.Sub(value, extra)
+		if value.Sign() <= 0 {
+			display.logf(RPC.VerbosityVerbose, "%s nonce %d can't sweep anything at %s, it is sent at %s\n", transaction.Address.Hex(), signedTx.Nonce(), display.currency.FormatGasPrice(price), display.currency.FormatGasPrice(signed))
+			return transaction, false
+		}
+	case extra.Sign() > 0:
+		if self.spare[transaction.Address].Cmp(extra) < 0 {
+			display.logf(RPC.VerbosityVerbose, "%s can't spare %s to send nonce %d at %s, it is sent at %s\n", transaction.Address.Hex(), display.currency.Format(extra), signedTx.Nonce(), display.currency.FormatGasPrice(price), display.currency.FormatGasPrice(signed))
+			return transaction, false
+		}
+	}
+	repriced, err := account.SignTx(signedTx.Nonce(), *signedTx.To(), value, gas, price, signedTx.Data())
+	if err != nil {
+		Errors.Log(Errors.SignError, "M22", err)
+		return transaction, false
+	}
+	if phase != "balance" && extra.Sign() > 0 {
+		self.spare[transaction.Address].Sub(self.spare[transaction.Address], extra)
+	}
+	if price != signed {
+		display.logf(RPC.VerbosityNormal, "Re-priced: %s nonce %d from %s to %s, fees moved %.0f%% since it was signed\n", transaction.Address.Hex(), signedTx.Nonce(), display.currency.FormatGasPrice(signed), display.currency.FormatGasPrice(price), movedPercent)
+	}
+	if gas != signedTx.Gas() {
+		display.logf(RPC.VerbosityVerbose, "Gas limit: %s nonce %d lowered from %d to %d, by what the mined transfers of %s used\n", transaction.Address.Hex(), signedTx.Nonce(), signedTx.Gas(), gas, signedTx.To().Hex())
+	}
+	return RPC.TransactionWithOriginator{Address: transaction.Address, SignedTx: repriced}, true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"os"
+	"walletMigrate/Accounts"
+	"walletMigrate/Encryption"
+	"walletMigrate/RPC"
+)
+
+const defaultRetryQueue = "retry_queue.json"
+
+//retryEntry is a transaction that failed to broadcast, reverted or was never mined during a live run
+type retryEntry struct {
+	Phase  string `json:"phase"` //gas, token or balance
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Nonce  uint64 `json:"nonce"`
+	TxHash string `json:"tx_hash"`
+	Reason string `json:"reason"`
+}
+
+func collectFailures(phase string, transactions []RPC.TransactionWithOriginator, receipts map[common.Hash]*types.Receipt) []retryEntry {
+	var failures []retryEntry
+	for _, transaction := range transactions {
+		reason := ""
+		receipt := receipts[transaction.SignedTx.Hash()]
+		if receipt == nil {
+			reason = "not mined"
+		} else if receipt.Status == types.ReceiptStatusFailed {
+			reason = "reverted"
+		}
+		if reason != "" {
+			failures = append(failures, retryEntry{Phase: phase, From: transaction.Address.Hex(), To: transaction.SignedTx.To().Hex(), Nonce: transaction.SignedTx.Nonce(), TxHash: transaction.SignedTx.Hash().Hex(), Reason: reason})
+		}
+	}
+	return failures
+}
+
+//write the retry queue, an empty queue removes the file so a stale queue is never retried
+func writeRetryQueue(path string, entries []retryEntry) error {
+	if len(entries) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return Encryption.WriteFile(path, data, 0600)
+}
+
+func readRetryQueue(path string) ([]retryEntry, error) {
+	data, err := Encryption.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []retryEntry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+//the gas price of a retry, it re-plans from the mined nonce and a node only takes the new transactions in place of the
+//failed ones still in its pool when they outbid them (see replacementFees).  Every transaction of the run pays the same
+//price so the gas funding stays exact, it is raised to the highest replacement price any pooled nonce needs
+func (self broadcaster) retryGasPrice(gasPrice *big.Int, accounts []Accounts.Account) *big.Int {
+	price := gasPrice
+	for _, entry := range self.client.GetQueuedAccounts(accounts) {
+		for _, original := range self.originals(entry.Account.Address, entry.Account.Nonce, entry.Pending) {
+			//the tip and fee cap are both the gas price, the fee cap is never below the tip
+			if _, feeCap := replacementFees(gasPrice, original.TipCap, original.FeeCap); feeCap.Cmp(price) > 0 {
+				price = feeCap
+			}
+		}
+	}
+	if price.Cmp(gasPrice) > 0 {
+		display.logf(RPC.VerbosityNormal, "Raising the gas price from %s to %s to replace the failed transactions still in the pool\n", display.currency.FormatGasPrice(gasPrice), display.currency.FormatGasPrice(price))
+	}
+	return price
+}
+
+//keep only the accounts involved in a failed transaction, for failed gas transfers both the
+//sender and the deficient recipient are re-planned so the recipient can still be funded
+func retryAccounts(accounts []Accounts.Account, entries []retryEntry) []Accounts.Account {
+	addresses := make(map[common.Address]bool)
+	for _, entry := range entries {
+		addresses[common.HexToAddress(entry.From)] = true
+		if entry.Phase == "gas" {
+			addresses[common.HexToAddress(entry.To)] = true
+		}
+	}
+	retry := make([]Accounts.Account, 0)
+	for _, account := range accounts {
+		if addresses[account.Address] {
+			retry = append(retry, account)
+		}
+	}
+	return retry
+}
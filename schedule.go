@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"walletMigrate/RPC"
+)
+
+//scheduleSettings keep a live run's broadcasts to quiet hours and stop them at a deadline, transactions already sent
+//are still awaited and their receipts recorded
+type scheduleSettings struct {
+	Window   string `json:"window"`   //UTC hours broadcasts are made in, e.g. 02:00-06:00 (22:00-04:00 spans midnight)
+	Deadline string `json:"deadline"` //RFC 3339 time after which nothing more is broadcast
+}
+
+//the deadline is reported once, every transaction after it is held back the same way
+var pastDeadline sync.Once
+
+func (self scheduleSettings) validate(field string) []error {
+	var errs []error
+	if self.Window != "" {
+		if _, _, err := self.window(); err != nil {
+			errs = append(errs, fmt.Errorf("%s.window %q: %v", field, self.Window, err))
+		}
+	}
+	if self.Deadline != "" {
+		if _, err := time.Parse(time.RFC3339, self.Deadline); err != nil {
+			errs = append(errs, fmt.Errorf("%s.deadline %q is not an RFC 3339 time like 2024-01-01T06:00:00Z", field, self.Deadline))
+		}
+	}
+	return errs
+}
+
+//the window's start and end as times of day
+func (self scheduleSettings) window() (time.Duration, time.Duration, error) {
+	bounds := strings.Split(self.Window, "-")
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("expected start-end in UTC like 02:00-06:00")
+	}
+	var times [2]time.Duration
+	for i, bound := range bounds {
+		clock, err := time.Parse("15:04", strings.TrimSpace(bound))
+		if err != nil {
+			return 0, 0, fmt.Errorf("%q is not a time like 02:00", bound)
+		}
+		times[i] = time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+	}
+	if times[0] == times[1] {
+		return 0, 0, fmt.Errorf("the window starts and ends at the same time")
+	}
+	return times[0], times[1], nil
+}
+
+//opens returns when the window is next open from now on, now itself while it is open
+func (self scheduleSettings) opens(now time.Time) time.Time {
+	if self.Window == "" {
+		return now
+	}
+	start, end, _ := self.window()
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	clock := now.Sub(midnight)
+	open := clock >= start && clock < end
+	if start > end { //spans midnight
+		open = clock >= start || clock < end
+	}
+	switch {
+	case open:
+		return now
+	case clock < start:
+		return midnight.Add(start)
+	default:
+		return midnight.Add(24 * time.Hour).Add(start)
+	}
+}
+
+//hold waits until the window is open and returns whether the transaction may still be broadcast, false once the
+//deadline passed (or will have by the time the window opens)
+func (self scheduleSettings) hold() bool {
+	now := time.Now().UTC()
+	opens := self.opens(now)
+	if self.Deadline != "" {
+		deadline, _ := time.Parse(time.RFC3339, self.Deadline)
+		if !opens.Before(deadline) {
+			pastDeadline.Do(func() {
+				fmt.Println(display.paint(colorRed, fmt.Sprintf("WARNING: the deadline %s has passed (or comes before the broadcast window opens again), no more transactions are broadcast, those already sent are still awaited", deadline.UTC().Format(time.RFC3339))))
+			})
+			return false
+		}
+	}
+	if opens.After(now) {
+		display.logf(RPC.VerbosityNormal, "Outside the broadcast window %s UTC, waiting until %s\n", self.Window, opens.Format(time.RFC3339))
+		time.Sleep(opens.Sub(now))
+	}
+	return true
+}
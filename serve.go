@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+//where the serve command listens unless api.listen says otherwise
+const defaultRESTListen = "127.0.0.1:8647"
+
+//the commands a job can be submitted for, execute only follows up on an earlier migration
+var jobCommands = []string{"migrate", "retry", "clear", "status", "execute"}
+
+//submitRequest is the body of POST /jobs
+type submitRequest struct {
+	Command  string          `json:"command"`  //one of jobCommands, migrate when empty
+	Settings json.RawMessage `json:"settings"` //the job's settings, layered over the server's
+	Previous string          `json:"previous"` //run with the settings and in the directory of this earlier job instead
+	Chain    string          `json:"chain"`    //the chain to migrate, required when the settings have several
+	Assets   string          `json:"assets"`   //comma separated asset classes to limit the run to, like -assets
+}
+
+//the serve command's settings only hold what every job shares (nodes, fees, destinations), each job brings its keys
+func (self settings) validateServer() []error {
+	errs := self.API.validate("api")
+	keys := []struct {
+		field string
+		set   bool
+	}{
+		{"mnemonics", len(self.Mnemonics) > 0},
+		{"private_keys", len(self.PrivateKeys) > 0},
+		{"extended_keys", len(self.ExtendedKeys) > 0},
+		{"brain_wallets", len(self.BrainWallets) > 0},
+		{"destination_private_key", self.DestinationPrivateKey != ""},
+		{"gas_tank.private_key", self.GasTank.PrivateKey != ""},
+		{"hops.mnemonic", self.Hops.Mnemonic != ""},
+		{"signer.url", self.Signer.URL != ""},
+	}
+	for _, key := range keys {
+		if key.set {
+			errs = append(errs, fmt.Errorf("%s can't be set for the serve command, every job brings its own keys", key.field))
+		}
+	}
+	return errs
+}
+
+//jobSettings layers a submitted job's settings over the server's and checks them the way a run would, it returns the
+//merged settings written to the job's directory for its run
+func jobSettings(settingsArg string, overrides []string, submitted json.RawMessage, chain string) ([]byte, string, []error) {
+	if !strings.HasPrefix(strings.TrimSpace(string(submitted)), "{") {
+		return nil, "", []error{fmt.Errorf("settings must be a json object")}
+	}
+	merged, _, err := mergeSettingsLayers(settingsArg, overrides)
+	if err != nil {
+		return nil, "", []error{err}
+	}
+	layer, _, err := loadSettingsLayer(string(submitted))
+	if err != nil {
+		return nil, "", []error{err}
+	}
+	mergeSettings(merged, layer)
+	delete(merged, "api") //the server's token stays with the server
+	in, err := decodeSettings(merged)
+	if err != nil {
+		return nil, "", []error{err}
+	}
+	in.registerSecrets()
+	if errs := in.validate(); len(errs) > 0 {
+		return nil, "", errs
+	}
+	chain, err = in.jobChain(chain)
+	if err != nil {
+		return nil, "", []error{err}
+	}
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return nil, "", []error{err}
+	}
+	return data, chain, nil
+}
+
+//restHandler serves the job queue:
+//  POST /jobs                      submit a job, answers the queued job
+//  GET  /jobs                      every job, oldest first
+//  GET  /jobs/{id}                 the job and its state
+//  GET  /jobs/{id}/files           the reports in the job's directory: output.log, status.json, plan and whatever the
+//                                  settings name (state file, audit log, retry queue)
+//  GET  /jobs/{id}/files/{name}    download one of them
+func restHandler(jobs *jobQueue, settingsArg string, overrides []string, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			respond(writer, http.StatusOK, jobs.list())
+		case http.MethodPost:
+			var body submitRequest
+			if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, 1<<20)).Decode(&body); err != nil {
+				respondError(writer, http.StatusBadRequest, err)
+				return
+			}
+			if body.Command == "" {
+				body.Command = "migrate"
+			}
+			if !contains(jobCommands, body.Command) {
+				respondError(writer, http.StatusBadRequest, fmt.Errorf("command %q is not one of %s", body.Command, strings.Join(jobCommands, ", ")))
+				return
+			}
+			if body.Assets != "" {
+				if errs := validateAssets(strings.Split(body.Assets, ",")); len(errs) > 0 {
+					respondError(writer, http.StatusBadRequest, errs...)
+					return
+				}
+			}
+			if body.Previous != "" {
+				if len(body.Settings) > 0 || body.Chain != "" || body.Assets != "" {
+					respondError(writer, http.StatusBadRequest, fmt.Errorf("a job following up on %s runs with its settings, chain and assets", body.Previous))
+					return
+				}
+				queued, err := jobs.followUp(body.Command, body.Previous)
+				if err != nil {
+					respondError(writer, http.StatusConflict, err)
+					return
+				}
+				respond(writer, http.StatusCreated, queued)
+				return
+			}
+			if body.Command == "execute" {
+				respondError(writer, http.StatusBadRequest, fmt.Errorf("execute broadcasts the plan of an earlier migration, set previous to its job"))
+				return
+			}
+			data, chain, errs := jobSettings(settingsArg, overrides, body.Settings, body.Chain)
+			if len(errs) > 0 {
+				respondError(writer, http.StatusBadRequest, errs...)
+				return
+			}
+			queued, err := jobs.submit(body.Command, chain, body.Assets, data)
+			if err != nil {
+				respondError(writer, http.StatusInternalServerError, err)
+				return
+			}
+			respond(writer, http.StatusCreated, queued)
+		default:
+			respondError(writer, http.StatusMethodNotAllowed, fmt.Errorf("GET or POST only"))
+		}
+	})
+	mux.HandleFunc("/jobs/", func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet {
+			respondError(writer, http.StatusMethodNotAllowed, fmt.Errorf("GET only"))
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(request.URL.Path, "/jobs/"), "/")
+		found, ok := jobs.get(parts[0])
+		if !ok {
+			respondError(writer, http.StatusNotFound, fmt.Errorf("there is no job %s", parts[0]))
+			return
+		}
+		switch {
+		case len(parts) == 1:
+			respond(writer, http.StatusOK, found)
+		case len(parts) == 2 && parts[1] == "files":
+			entries, err := ioutil.ReadDir(filepath.Join(jobs.dir, found.ID))
+			if err != nil {
+				respondError(writer, http.StatusInternalServerError, err)
+				return
+			}
+			names := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				if !entry.IsDir() && entry.Name() != jobSettingsFile {
+					names = append(names, entry.Name())
+				}
+			}
+			respond(writer, http.StatusOK, names)
+		case len(parts) == 3 && parts[1] == "files":
+			//the settings hold the job's keys and are never served
+			if parts[2] == jobSettingsFile || parts[2] != filepath.Base(parts[2]) || strings.HasPrefix(parts[2], ".") {
+				respondError(writer, http.StatusNotFound, fmt.Errorf("job %s has no file %s", found.ID, parts[2]))
+				return
+			}
+			path := filepath.Join(jobs.dir, found.ID, parts[2])
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				respondError(writer, http.StatusNotFound, fmt.Errorf("job %s has no file %s", found.ID, parts[2]))
+				return
+			}
+			http.ServeFile(writer, request, path)
+		default:
+			respondError(writer, http.StatusNotFound, fmt.Errorf("%s is not an endpoint", request.URL.Path))
+		}
+	})
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(request.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			respondError(writer, http.StatusUnauthorized, fmt.Errorf("a valid bearer token is required"))
+			return
+		}
+		mux.ServeHTTP(writer, request)
+	})
+}
+
+func respond(writer http.ResponseWriter, status int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(body)
+}
+
+func respondError(writer http.ResponseWriter, status int, errs ...error) {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	respond(writer, status, map[string][]string{"errors": messages})
+}
+
+//the serve command: serve the rest api until interrupted, the jobs still queued when it stops run once it is started
+//again
+func serveREST(in settings, settingsArg string, overrides []string, status *runStatus) int {
+	if len(in.API.Token) < 16 {
+		status.abort(fmt.Errorf("the serve command needs an api.token of at least 16 characters"))
+	}
+	listen, dir := in.API.Listen, in.API.JobsDir
+	if listen == "" {
+		listen = defaultRESTListen
+	}
+	if dir == "" {
+		dir = defaultJobsDir
+	}
+	jobs, err := newJobQueue(settingsArg, overrides, dir)
+	if err != nil {
+		status.abort(err)
+	}
+	defer jobs.unlock()
+	server := &http.Server{Addr: listen, Handler: restHandler(jobs, settingsArg, overrides, in.API.Token)}
+	stopped := make(chan os.Signal, 1)
+	signal.Notify(stopped, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stopped
+		server.Shutdown(context.Background())
+	}()
+	scheme := "http"
+	if in.API.TLSCert != "" {
+		scheme = "https"
+	}
+	fmt.Printf("Serving the job api at %s://%s with %d jobs kept in %s, interrupt to stop\n", scheme, listen, len(jobs.list()), jobs.dir)
+	if in.API.TLSCert != "" {
+		err = server.ListenAndServeTLS(in.API.TLSCert, in.API.TLSKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		status.abort(err)
+	}
+	return exitCompleted
+}
@@ -0,0 +1,885 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"walletMigrate/Accounts"
+)
+
+//feeSettings choose the gas price of every transaction
+type feeSettings struct {
+	Strategy       string  `json:"strategy"`        //suggested: the node's suggested gas price, gas_station: the chain's gas station fast price, fee_history: a percentile of the recent blocks' fees, all times the multiplier
+	Multiplier     float64 `json:"multiplier"`      //multiplier for the price the strategy comes up with
+	MinGwei        float64 `json:"min_gwei"`        //never pay less than this gas price
+	DustMinGwei    float64 `json:"dust_min_gwei"`   //a balance too small to sweep at the gas price is swept at no less than this
+	Percentile     float64 `json:"percentile"`      //fee_history: the percentile of the fees paid in the recent blocks (default 60)
+	HistoryBlocks  int     `json:"history_blocks"`  //fee_history: how many of the latest blocks are looked at (default 100)
+	RepricePercent float64 `json:"reprice_percent"` //re-sign a transaction at the current price when it is broadcast if fees moved more than this since it was signed, 0 never does
+}
+
+var feeStrategies = []string{"suggested", "gas_station", "fee_history"}
+
+const (
+	defaultFeePercentile    = 60
+	defaultFeeHistoryBlocks = 100
+)
+
+//where transactions are executed, see rehearse
+var backends = []string{"node", "simulated", "fork"}
+
+func (self feeSettings) validate(field string) []error {
+	var errs []error
+	if self.Strategy != "" && !contains(feeStrategies, self.Strategy) {
+		errs = append(errs, fmt.Errorf("%s.strategy %q is not supported, expected one of %s", field, self.Strategy, strings.Join(feeStrategies, ", ")))
+	}
+	if self.Multiplier < 0 || self.Multiplier > 10 {
+		errs = append(errs, fmt.Errorf("%s.multiplier %v is out of range, expected a value above 0 and at most 10", field, self.Multiplier))
+	}
+	if self.MinGwei < 0 || self.MinGwei > 100000 {
+		errs = append(errs, fmt.Errorf("%s.min_gwei %v is out of range, expected 0 to 100000", field, self.MinGwei))
+	}
+	if self.DustMinGwei < 0 || self.DustMinGwei > 100000 {
+		errs = append(errs, fmt.Errorf("%s.dust_min_gwei %v is out of range, expected 0 to 100000", field, self.DustMinGwei))
+	}
+	if self.Percentile < 0 || self.Percentile > 100 {
+		errs = append(errs, fmt.Errorf("%s.percentile %v is out of range, expected 0 to 100", field, self.Percentile))
+	}
+	if self.HistoryBlocks < 0 || self.HistoryBlocks > 1024 {
+		errs = append(errs, fmt.Errorf("%s.history_blocks %d is out of range, expected 1 to 1024 (the most nodes return)", field, self.HistoryBlocks))
+	}
+	if self.RepricePercent < 0 || self.RepricePercent > 100 {
+		errs = append(errs, fmt.Errorf("%s.reprice_percent %v is out of range, expected 0 to 100", field, self.RepricePercent))
+	}
+	return errs
+}
+
+var settingsFormats = []string{".json", ".yaml", ".yml", ".toml"}
+
+//the default settings files that exist, lowest precedence first: the user's config directory then the working directory
+func defaultSettingsFiles() []string {
+	var files []string
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, findSettingsFile(filepath.Join(home, ".config", "walletmigrate", "config"))...)
+	}
+	return append(files, findSettingsFile("walletmigrate")...)
+}
+
+func findSettingsFile(base string) []string {
+	for _, extension := range settingsFormats {
+		if _, err := os.Stat(base + extension); err == nil {
+			return []string{base + extension}
+		}
+	}
+	return nil
+}
+
+//load the layered settings: the default settings files, then the settings argument (inline json or the path to
+//a json, yaml or toml file) and finally the -set overrides, each layer replaces the values set by the ones before it.
+//Layers written for an older version are upgraded and a warning is returned for each deprecated field
+func loadSettings(arg string, overrides []string) (settings, []string, error) {
+	merged, warnings, err := mergeSettingsLayers(arg, overrides)
+	if err != nil {
+		return settings{}, nil, err
+	}
+	in, err := decodeSettings(merged)
+	return in, warnings, err
+}
+
+//the layers of loadSettings merged but not yet decoded
+func mergeSettingsLayers(arg string, overrides []string) (map[string]interface{}, []string, error) {
+	sources := defaultSettingsFiles()
+	if arg != "" {
+		sources = append(sources, arg)
+	}
+	if len(sources) == 0 {
+		return nil, nil, errors.New("no settings given and no walletmigrate.json/.yaml/.toml in the working directory or ~/.config/walletmigrate/config.json/.yaml/.toml")
+	}
+
+	var warnings []string
+	merged := make(map[string]interface{})
+	for _, source := range sources {
+		layer, layerWarnings, err := loadSettingsLayer(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, warning := range layerWarnings {
+			warnings = append(warnings, settingsSourceName(source)+": "+warning)
+		}
+		mergeSettings(merged, layer)
+	}
+	for _, override := range overrides {
+		err := overrideSetting(merged, override)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return merged, warnings, nil
+}
+
+//decode merged settings layers into settings, expanding environment variables
+func decodeSettings(merged map[string]interface{}) (settings, error) {
+	in := settings{}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return in, err
+	}
+	data, err = expandEnv(data)
+	if err != nil {
+		return in, err
+	}
+
+	//every format is converted to json so the json tags on settings are the only field names to maintain
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields() //catch misspelled settings instead of silently ignoring them
+	err = decoder.Decode(&in)
+	return in, err
+}
+
+func loadSettingsLayer(source string) (map[string]interface{}, []string, error) {
+	data := []byte(source)
+	format := ".json"
+	if !strings.HasPrefix(strings.TrimSpace(source), "{") {
+		var err error
+		data, err = ioutil.ReadFile(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		format = strings.ToLower(filepath.Ext(source))
+	}
+
+	var err error
+	switch format {
+	case ".yaml", ".yml":
+		data, err = yamlToJSON(data)
+	case ".toml":
+		data, err = tomlToJSON(data)
+	case ".json", "":
+	default:
+		return nil, nil, fmt.Errorf("unsupported settings file format %s, use .json, .yaml, .yml or .toml", format)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", settingsSourceName(source), err)
+	}
+
+	//each layer is upgraded on its own since layers can be written for different versions
+	data, warnings, err := upgradeSettings(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", settingsSourceName(source), err)
+	}
+	var values map[string]interface{}
+	err = unmarshalSettings(data, &values)
+	return values, warnings, err
+}
+
+//inline settings are never echoed since they can contain keys
+func settingsSourceName(source string) string {
+	if strings.HasPrefix(strings.TrimSpace(source), "{") {
+		return "settings argument"
+	}
+	return source
+}
+
+//merge layer into merged, objects are merged key by key while any other value (including lists) is replaced
+func mergeSettings(merged map[string]interface{}, layer map[string]interface{}) {
+	for key, value := range layer {
+		existing, isObject := merged[key].(map[string]interface{})
+		object, replacingObject := value.(map[string]interface{})
+		if isObject && replacingObject {
+			mergeSettings(existing, object)
+			continue
+		}
+		merged[key] = value
+	}
+}
+
+//apply a -set path=value override, the path is dot separated (fee.multiplier, chains.polygon.node_url) and
+//the value is parsed as json when possible (2, true, ["a","b"]) and used as a plain string otherwise
+func overrideSetting(merged map[string]interface{}, override string) error {
+	parts := strings.SplitN(override, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("-set %q must look like path=value", override)
+	}
+	var value interface{}
+	if err := unmarshalSettings([]byte(parts[1]), &value); err != nil {
+		value = parts[1]
+	}
+
+	path := strings.Split(parts[0], ".")
+	object := merged
+	for _, key := range path[:len(path)-1] {
+		child, ok := object[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			object[key] = child
+		}
+		object = child
+	}
+	object[path[len(path)-1]] = value
+	return nil
+}
+
+//mnemonicSetting is either a plain seed phrase or an object with the phrase (or the seed derived from one, or SLIP-39
+//shares) and its own derivation path grid so one deep wallet doesn't force a huge scan on every other seed
+type mnemonicSetting struct {
+	Phrase      string   `json:"phrase"`
+	Seed        string   `json:"seed"`               //hex BIP-32 seed instead of the phrase
+	Shares      []string `json:"shares"`             //SLIP-39 shares (e.g. a Trezor Shamir backup) instead of the phrase
+	Passphrases []string `json:"passphrases"`        //candidate passphrases, the accounts of each are derived and scanned
+	Expected    []string `json:"expected_addresses"` //addresses the grid must derive, the run stops before the scan otherwise
+	Accounts    int      `json:"accounts"`           //hardened account values to scan, defaults to number_of_hardened_accounts
+	Changes     int      `json:"changes"`            //change values to scan, defaults to number_of_accounts
+	Indexes     int      `json:"indexes"`            //address indexes to scan for each change value, defaults to number_of_accounts
+	StartIndex  int      `json:"start_index"`        //first address index to scan, defaults to 0
+	EndIndex    *int     `json:"end_index"`          //last address index to scan (inclusive), an alternative to indexes
+}
+
+//the number of address indexes to scan, zero when neither indexes nor end_index is set
+func (self mnemonicSetting) indexCount() int {
+	if self.EndIndex != nil {
+		return *self.EndIndex - self.StartIndex + 1
+	}
+	return self.Indexes
+}
+
+func (self *mnemonicSetting) UnmarshalJSON(data []byte) error {
+	var phrase string
+	if err := json.Unmarshal(data, &phrase); err == nil {
+		*self = mnemonicSetting{Phrase: phrase}
+		return nil
+	}
+	//decode into a type without this method, strictly since unknown fields aren't caught inside a custom unmarshaler
+	type object mnemonicSetting
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*object)(self))
+}
+
+//extendedKeySetting is either a plain xprv or xpub or an object with the key and its own change/index grid, the key is
+//of an account (m/44'/60'/account') so there is no hardened level left to scan
+type extendedKeySetting struct {
+	Key        string `json:"key"`
+	Changes    int    `json:"changes"`     //change values to scan, defaults to number_of_accounts
+	Indexes    int    `json:"indexes"`     //address indexes to scan for each change value, defaults to number_of_accounts
+	StartIndex int    `json:"start_index"` //first address index to scan, defaults to 0
+}
+
+func (self *extendedKeySetting) UnmarshalJSON(data []byte) error {
+	var key string
+	if err := json.Unmarshal(data, &key); err == nil {
+		*self = extendedKeySetting{Key: key}
+		return nil
+	}
+	type object extendedKeySetting
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*object)(self))
+}
+
+//the extended keys with number_of_accounts filled in wherever a key doesn't set its own grid
+func (self settings) extendedKeys() []Accounts.ExtendedKey {
+	extendedKeys := make([]Accounts.ExtendedKey, 0)
+	for _, extended := range self.ExtendedKeys {
+		grid := Accounts.ExtendedKey{Key: extended.Key, Changes: extended.Changes, Indexes: extended.Indexes, FirstIndex: extended.StartIndex}
+		if grid.Changes == 0 {
+			grid.Changes = self.NumberOfAccounts
+		}
+		if grid.Indexes == 0 {
+			grid.Indexes = self.NumberOfAccounts
+		}
+		extendedKeys = append(extendedKeys, grid)
+	}
+	return extendedKeys
+}
+
+//the mnemonics with number_of_hardened_accounts and number_of_accounts filled in wherever a mnemonic doesn't set its own grid
+func (self settings) mnemonics() []Accounts.Mnemonic {
+	mnemonics := make([]Accounts.Mnemonic, 0)
+	for _, mnemonic := range self.Mnemonics {
+		grid := Accounts.Mnemonic{Phrase: mnemonic.Phrase, Seed: mnemonic.Seed, Shares: mnemonic.Shares, Passphrases: mnemonic.Passphrases, Accounts: mnemonic.Accounts, Changes: mnemonic.Changes, Indexes: mnemonic.indexCount(), FirstIndex: mnemonic.StartIndex}
+		if grid.Accounts == 0 {
+			grid.Accounts = self.NumberOfHardenedAccounts
+		}
+		if grid.Changes == 0 {
+			grid.Changes = self.NumberOfAccounts
+		}
+		if grid.Indexes == 0 {
+			grid.Indexes = self.NumberOfAccounts
+		}
+		mnemonics = append(mnemonics, grid)
+	}
+	return mnemonics
+}
+
+//the wei each account keeps after the final sweep, from keep_wei or keep_eth (validate rejects anything else)
+func (self settings) reserve() (*big.Int, error) {
+	switch {
+	case self.KeepWei != "" && self.KeepEth != "":
+		return nil, errors.New("set either keep_wei or keep_eth, not both")
+	case self.KeepWei != "":
+		wei, ok := new(big.Int).SetString(self.KeepWei.String(), 10)
+		if !ok || wei.Sign() < 0 {
+			return nil, fmt.Errorf("keep_wei %q is not a whole, non-negative number of wei", self.KeepWei)
+		}
+		return wei, nil
+	case self.KeepEth != "":
+		eth, ok := new(big.Rat).SetString(self.KeepEth.String())
+		if !ok || eth.Sign() < 0 {
+			return nil, fmt.Errorf("keep_eth %q is not a non-negative amount of ETH", self.KeepEth)
+		}
+		wei := eth.Mul(eth, new(big.Rat).SetInt(big.NewInt(params.Ether)))
+		if !wei.IsInt() {
+			return nil, fmt.Errorf("keep_eth %q has more than 18 decimals", self.KeepEth)
+		}
+		return wei.Num(), nil
+	}
+	return new(big.Int), nil
+}
+
+//validate every field and return an error naming each invalid entry, keys and mnemonics are only referred to by position
+func (self settings) validate() []error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch {
+	case self.NodeURL == "" && self.Chain == "" && len(self.Chains) == 0:
+		invalid("node_url, chain or chains is required")
+	case (self.NodeURL != "" || self.Chain != "") && len(self.Chains) > 0:
+		invalid("node_url and chain can't be used together with chains, move them into one of the chains")
+	default:
+		if self.Chain != "" {
+			if _, found := chainRegistry[self.Chain]; !found {
+				invalid("chain %q is not in the registry, expected one of %s", self.Chain, registryNames())
+			}
+		}
+		if self.NodeURL != "" {
+			if err := validateNodeURL("node_url", self.NodeURL); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(self.BroadcastURLs) > 0 && len(self.Chains) > 0 {
+		invalid("broadcast_urls can't be used together with chains, move it into the chain the endpoints are on")
+	}
+	errs = append(errs, validateBroadcastURLs("broadcast_urls", self.BroadcastURLs)...)
+	if self.BeaconURL != "" && len(self.Chains) > 0 {
+		invalid("beacon_url can't be used together with chains, move it into the chain the beacon node belongs to")
+	}
+	errs = append(errs, validateBeaconURL("beacon_url", self.BeaconURL)...)
+	if len(self.Nonces) > 0 && len(self.Chains) > 0 {
+		invalid("nonces can't be used together with chains, move it into the chain the nonces are on")
+	}
+	errs = append(errs, validateNonces("nonces", self.Nonces)...)
+	for name, chain := range self.Chains {
+		errs = append(errs, chain.validate("chains."+name)...)
+	}
+
+	configured := 0
+	for _, set := range []bool{self.DestinationAddress != "", len(self.Destinations) > 0, self.DestinationXpub != ""} {
+		if set {
+			configured++
+		}
+	}
+	switch {
+	case configured == 0:
+		invalid("destination_address, destinations or destination_xpub is required")
+	case configured > 1:
+		invalid("only one of destination_address, destinations or destination_xpub can be used")
+	case self.DestinationAddress != "":
+		if err := validateAddress("destination_address", self.DestinationAddress); err != nil {
+			errs = append(errs, err)
+		}
+	case self.DestinationXpub != "":
+		if err := Accounts.ValidateExtendedPublicKey(self.DestinationXpub); err != nil {
+			invalid("destination_xpub %v", err)
+		}
+	}
+	seen := make(map[common.Address]bool)
+	for i, destination := range self.Destinations {
+		if err := validateAddress(fmt.Sprintf("destinations[%d].address", i), destination.Address); err != nil {
+			errs = append(errs, err)
+		} else if seen[common.HexToAddress(destination.Address)] {
+			invalid("destinations[%d].address %s is listed more than once", i, destination.Address)
+		}
+		seen[common.HexToAddress(destination.Address)] = true
+		if destination.Weight < 0 || destination.Weight > 1000000 || (destination.Weight == 0 && !self.RotateDestinations) {
+			invalid("destinations[%d].weight %d is out of range, expected 1 to 1000000", i, destination.Weight)
+		}
+	}
+	if self.SplitTokens && len(self.Destinations) < 2 {
+		invalid("split_tokens needs at least two destinations")
+	}
+	if self.RotateDestinations && len(self.Destinations) < 2 && self.DestinationXpub == "" {
+		invalid("rotate_destinations needs at least two destinations or a destination_xpub")
+	}
+	if self.SplitTokens && (self.RotateDestinations || self.DestinationXpub != "") {
+		invalid("split_tokens can't be used when destinations are rotated, each account already has a single destination")
+	}
+	for contract, to := range self.TokenDestinations {
+		if err := validateAddress("token_destinations key", contract); err != nil {
+			errs = append(errs, err)
+		}
+		if err := validateAddress(fmt.Sprintf("token_destinations[%s]", contract), to); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch {
+	case self.Signer.URL != "" && (len(self.Mnemonics) > 0 || len(self.PrivateKeys) > 0 || len(self.ExtendedKeys) > 0 || len(self.BrainWallets) > 0):
+		invalid("signer.url can't be used together with mnemonics, private_keys, extended_keys or brain_wallets, the sign-server holds the keys")
+	case self.Signer.URL == "" && len(self.Mnemonics) == 0 && len(self.PrivateKeys) == 0 && len(self.ExtendedKeys) == 0 && len(self.BrainWallets) == 0:
+		invalid("at least one entry in mnemonics, private_keys, extended_keys or brain_wallets is required")
+	}
+	if len(self.BrainWallets) > 0 && !self.AllowBrainWallets {
+		invalid("brain_wallets needs allow_brain_wallets set to true, anyone can guess the keys of brain wallets and bots sweep them")
+	}
+	for i, passphrase := range self.BrainWallets {
+		if passphrase == "" {
+			invalid("brain_wallets[%d] is empty", i)
+		}
+	}
+	for i, extended := range self.ExtendedKeys {
+		private, err := Accounts.ValidateExtendedKey(extended.Key)
+		if err != nil {
+			invalid("extended_keys[%d] %v", i, err)
+		} else if !private && !self.Simulate {
+			invalid("extended_keys[%d] is an xpub, its accounts are watch-only and can only be planned with simulate", i)
+		}
+		if extended.Changes < 0 || extended.Changes > 1000 {
+			invalid("extended_keys[%d].changes %d is out of range, expected 1 to 1000", i, extended.Changes)
+		}
+		if extended.Indexes < 0 || extended.Indexes > 10000 {
+			invalid("extended_keys[%d].indexes %d is out of range, expected 1 to 10000", i, extended.Indexes)
+		}
+		if extended.StartIndex < 0 || extended.StartIndex+extended.Indexes-1 > math.MaxInt32 {
+			invalid("extended_keys[%d].start_index %d is out of range, expected 0 to %d", i, extended.StartIndex, math.MaxInt32)
+		}
+	}
+	for i, mnemonic := range self.Mnemonics {
+		switch {
+		case mnemonic.Phrase != "" && mnemonic.Seed != "", mnemonic.Phrase != "" && len(mnemonic.Shares) > 0, mnemonic.Seed != "" && len(mnemonic.Shares) > 0:
+			invalid("mnemonics[%d] can set only one of phrase, seed or shares", i)
+		case len(mnemonic.Shares) > 0:
+			if err := Accounts.ValidateSLIP39(mnemonic.Shares); err != nil {
+				invalid("mnemonics[%d].shares %v", i, err)
+			}
+		case mnemonic.Seed != "":
+			if err := Accounts.ValidateSeed(mnemonic.Seed); err != nil {
+				invalid("mnemonics[%d].seed %v", i, err)
+			}
+			if len(mnemonic.Passphrases) > 0 {
+				invalid("mnemonics[%d].passphrases can't be used with a seed, the passphrase is already part of it", i)
+			}
+		default:
+			if err := Accounts.ValidateMnemonic(mnemonic.Phrase); err != nil {
+				invalid("mnemonics[%d] %v", i, err)
+			}
+		}
+		if mnemonic.Accounts < 0 || mnemonic.Accounts > 100 {
+			invalid("mnemonics[%d].accounts %d is out of range, expected 1 to 100", i, mnemonic.Accounts)
+		}
+		if mnemonic.Changes < 0 || mnemonic.Changes > 1000 {
+			invalid("mnemonics[%d].changes %d is out of range, expected 1 to 1000", i, mnemonic.Changes)
+		}
+		if mnemonic.Indexes < 0 || mnemonic.Indexes > 10000 {
+			invalid("mnemonics[%d].indexes %d is out of range, expected 1 to 10000", i, mnemonic.Indexes)
+		}
+		if mnemonic.StartIndex < 0 || mnemonic.StartIndex > math.MaxInt32 {
+			invalid("mnemonics[%d].start_index %d is out of range, expected 0 to %d", i, mnemonic.StartIndex, math.MaxInt32)
+		}
+		if mnemonic.EndIndex != nil {
+			switch {
+			case mnemonic.Indexes != 0:
+				invalid("mnemonics[%d] can't set both indexes and end_index", i)
+			case *mnemonic.EndIndex < mnemonic.StartIndex || *mnemonic.EndIndex > math.MaxInt32:
+				invalid("mnemonics[%d].end_index %d is out of range, expected start_index (%d) to %d", i, *mnemonic.EndIndex, mnemonic.StartIndex, math.MaxInt32)
+			case mnemonic.indexCount() > 10000:
+				invalid("mnemonics[%d] start_index to end_index covers %d indexes, expected at most 10000", i, mnemonic.indexCount())
+			}
+		}
+		for j, address := range mnemonic.Expected {
+			if err := validateAddress(fmt.Sprintf("mnemonics[%d].expected_addresses[%d]", i, j), address); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if mnemonic.EndIndex == nil && mnemonic.StartIndex+mnemonic.Indexes-1 > math.MaxInt32 {
+			invalid("mnemonics[%d] start_index plus indexes runs past the last address index %d", i, math.MaxInt32)
+		}
+	}
+	for i, address := range self.TargetAddresses {
+		if err := validateAddress(fmt.Sprintf("target_addresses[%d]", i), address); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i, address := range self.ExcludeAddresses {
+		if err := validateAddress(fmt.Sprintf("exclude_addresses[%d]", i), address); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if self.DestinationPrivateKey != "" {
+		funder, err := Accounts.FromPrivateKey(self.DestinationPrivateKey)
+		if err != nil {
+			invalid("destination_private_key %v", err)
+		} else if splits, err := self.splits(); err == nil && !containsSplit(splits, funder.Address) {
+			invalid("destination_private_key is the key of %s, which is not one of the destinations", funder.Address.Hex())
+		}
+	}
+	if self.DestinationPrivateKey != "" && self.GasTank.PrivateKey != "" {
+		invalid("set either destination_private_key or gas_tank, not both")
+	}
+	errs = append(errs, self.GasTank.validate("gas_tank")...)
+	for i, privateKey := range self.PrivateKeys {
+		if self.GasTank.PrivateKey != "" && strings.TrimPrefix(privateKey, "0x") == strings.TrimPrefix(self.GasTank.PrivateKey, "0x") {
+			invalid("private_keys[%d] is the gas_tank key, the tank would be swept with the other accounts", i)
+		}
+	}
+	for i, privateKey := range self.PrivateKeys {
+		if err := Accounts.ValidatePrivateKey(privateKey); err != nil {
+			invalid("private_keys[%d] %v", i, err)
+		}
+	}
+
+	errs = append(errs, self.Fee.validate("fee")...)
+	errs = append(errs, validateAssets(self.Assets)...)
+	errs = append(errs, self.MinAccountValue.validate("min_account_value")...)
+	errs = append(errs, self.Hops.validate("hops", self)...)
+	errs = append(errs, self.Privacy.validate("privacy")...)
+	errs = append(errs, self.Fork.validate("fork")...)
+	errs = append(errs, self.Encryption.validate("encryption")...)
+	errs = append(errs, self.Signer.validate("signer")...)
+	errs = append(errs, self.API.validate("api")...)
+	errs = append(errs, self.Email.validate("email")...)
+	errs = append(errs, self.Paging.validate("paging")...)
+	errs = append(errs, self.Schedule.validate("schedule")...)
+	errs = append(errs, self.Throttle.validate("throttle")...)
+	if _, err := self.reserve(); err != nil {
+		errs = append(errs, err)
+	}
+	if self.NumberOfAccounts < 0 || self.NumberOfAccounts > 100 {
+		invalid("number_of_accounts %d is out of range, expected 1 to 100 (the number of accounts scanned is this number squared)", self.NumberOfAccounts)
+	}
+	if self.NumberOfHardenedAccounts < 0 || self.NumberOfHardenedAccounts > 100 {
+		invalid("number_of_hardened_accounts %d is out of range, expected 1 to 100", self.NumberOfHardenedAccounts)
+	}
+	if self.TransferGasLimit != 0 && self.TransferGasLimit < 21000 {
+		invalid("token_transfer_gas_limit %d is below the 21000 gas every transaction needs", self.TransferGasLimit)
+	}
+	if self.SweeperCheckBlocks > 10000 {
+		invalid("sweeper_check_blocks %d is out of range, expected 1 to 10000", self.SweeperCheckBlocks)
+	}
+	if self.Counterparties < 0 || self.Counterparties > 100 {
+		invalid("counterparties %d is out of range, expected 0 to 100", self.Counterparties)
+	}
+	if self.MaxFeePercent < 0 || self.MaxFeePercent > 100 {
+		invalid("max_fee_percent %v is out of range, expected 0 to 100", self.MaxFeePercent)
+	}
+	if self.FixedTime != "" {
+		if _, err := time.Parse(time.RFC3339, self.FixedTime); err != nil {
+			invalid("fixed_time %q is not an RFC 3339 time, e.g. 2024-01-01T00:00:00Z", self.FixedTime)
+		}
+	}
+	for i, approver := range self.Approvers {
+		if err := validateAddress(fmt.Sprintf("approvers[%d]", i), approver); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(self.Approvers) > 0 && self.PlanFile == "" {
+		invalid("approvers approve a plan_file, set plan_file")
+	}
+	if self.PlanFile != "" && self.Hops.Count > 0 {
+		invalid("plan_file can't hold the forwards of hops, they are signed once the sweeps are mined")
+	}
+	if self.RecordRPC != "" && self.ReplayRPC != "" {
+		invalid("record_rpc and replay_rpc can't be used together")
+	}
+	if self.ReplayRPC != "" && (self.Backend == "fork" || !self.Simulate && self.Backend != "simulated") {
+		invalid("replay_rpc can only replay simulated runs and rehearsals on the simulated backend, transactions can't be sent to a recording")
+	}
+	if self.Backend != "" && !contains(backends, self.Backend) {
+		invalid("backend %q is not supported, expected one of %s", self.Backend, strings.Join(backends, ", "))
+	}
+	if self.MaxInFlight < 0 || self.MaxInFlight > 16 {
+		invalid("max_in_flight %d is out of range, expected 0 to 16 (nodes keep at most 16 executable transactions per account by default)", self.MaxInFlight)
+	}
+	if self.WaitForIncoming < 0 || self.WaitForIncoming > 86400 {
+		invalid("wait_for_incoming %d is out of range, expected 0 to 86400 seconds", self.WaitForIncoming)
+	}
+	if self.TruncateHex < 0 {
+		invalid("truncate_hex %d can't be negative", self.TruncateHex)
+	}
+	return errs
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+//replace ${ENV_VAR} references inside any string value with the environment variable so secrets
+//like api keys, private keys and mnemonics can stay out of the settings file, expanding the decoded
+//values (rather than the raw text) means an environment variable can never break the file's syntax
+func expandEnv(data []byte) ([]byte, error) {
+	var values interface{}
+	err := unmarshalSettings(data, &values)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	var expand func(value interface{}) interface{}
+	expand = func(value interface{}) interface{} {
+		switch typed := value.(type) {
+		case string:
+			return envReference.ReplaceAllStringFunc(typed, func(reference string) string {
+				name := envReference.FindStringSubmatch(reference)[1]
+				env, ok := os.LookupEnv(name)
+				if !ok {
+					missing = append(missing, name)
+				}
+				return env
+			})
+		case []interface{}:
+			for i := range typed {
+				typed[i] = expand(typed[i])
+			}
+		case map[string]interface{}:
+			for key := range typed {
+				typed[key] = expand(typed[key])
+			}
+		}
+		return value
+	}
+	values = expand(values)
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("settings reference environment variables that are not set: %s", strings.Join(missing, ", "))
+	}
+	return json.Marshal(values)
+}
+
+//decode settings json into interface{} values with numbers kept as json.Number, as float64 they would be rounded
+//(keep_wei 10000000000000001) or written back as 1e+21 when the layers are merged and decoded into settings
+func unmarshalSettings(data []byte, values interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(values); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+//a number as json writes it, yaml and toml numbers of this form are passed on as written
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+func yamlToJSON(data []byte) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	values, err := yamlValue(&document)
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	if _, ok := values.(map[string]interface{}); !ok {
+		return nil, errors.New("the yaml settings are not a mapping")
+	}
+	return json.Marshal(values)
+}
+
+//the value of a yaml node with its numbers kept as json.Number, decoded into interface{} an integer beyond int64 (a
+//keep_wei in wei) would become a rounded float64
+func yamlValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(node.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.SequenceNode:
+		values := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			value, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case yaml.MappingNode:
+		values := make(map[string]interface{})
+		var merged []map[string]interface{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, item := node.Content[i], node.Content[i+1]
+			value, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			if key.Tag != "!!merge" {
+				values[key.Value] = value
+				continue
+			}
+			//<<: *anchor or a list of them, the mapping's own keys win
+			switch merge := value.(type) {
+			case map[string]interface{}:
+				merged = append(merged, merge)
+			case []interface{}:
+				for _, entry := range merge {
+					if mapping, ok := entry.(map[string]interface{}); ok {
+						merged = append(merged, mapping)
+					}
+				}
+			}
+		}
+		for _, mapping := range merged {
+			for key, value := range mapping {
+				if _, set := values[key]; !set {
+					values[key] = value
+				}
+			}
+		}
+		return values, nil
+	}
+	if (node.Tag == "!!int" || node.Tag == "!!float") && jsonNumber.MatchString(node.Value) {
+		return json.Number(node.Value), nil
+	}
+	var value interface{}
+	err := node.Decode(&value)
+	return value, err
+}
+
+//a bare number as the value of a key = value line, toml integers end at int64 and its floats are float64 so the
+//number is swapped for a marked string before decoding and put back as written after
+var (
+	tomlNumber        = regexp.MustCompile(`^(\s*[A-Za-z0-9_\-."']+\s*=\s*)\+?([0-9][0-9_]*(?:\.[0-9][0-9_]*)?(?:[eE][+-]?[0-9][0-9_]*)?|-[0-9][0-9_]*(?:\.[0-9][0-9_]*)?(?:[eE][+-]?[0-9][0-9_]*)?)(\s*(?:#.*)?)$`)
+	tomlMultiline     = regexp.MustCompile(`"""|\'\'\'`)
+	tomlNumberMarker  = "\x00number:"
+	tomlMarkerEscaped = `\u0000number:`
+)
+
+func tomlToJSON(data []byte) ([]byte, error) {
+	lines := strings.Split(string(data), "\n")
+	inString := false
+	for i, line := range lines {
+		//a line inside a multi-line string is text, not a key
+		quotes := len(tomlMultiline.FindAllString(line, -1))
+		if !inString {
+			if match := tomlNumber.FindStringSubmatch(line); match != nil {
+				lines[i] = match[1] + `"` + tomlMarkerEscaped + strings.ReplaceAll(match[2], "_", "") + `"` + match[3]
+			}
+		}
+		if quotes%2 == 1 {
+			inString = !inString
+		}
+	}
+	var values map[string]interface{}
+	if err := toml.Unmarshal([]byte(strings.Join(lines, "\n")), &values); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tomlNumbers(values))
+}
+
+//put the marked numbers back as json.Number
+func tomlNumbers(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case string:
+		if strings.HasPrefix(typed, tomlNumberMarker) {
+			return json.Number(strings.TrimPrefix(typed, tomlNumberMarker))
+		}
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = tomlNumbers(item)
+		}
+	case []map[string]interface{}:
+		for _, item := range typed {
+			tomlNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = tomlNumbers(item)
+		}
+	}
+	return value
+}
+
+func validateAddress(field string, address string) error {
+	if address == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if !common.IsHexAddress(address) {
+		return fmt.Errorf("%s %q is not a 20 byte hex address", field, address)
+	}
+	//mixed case addresses carry an EIP-55 checksum, a mismatch usually means a typo
+	if hexPart := strings.TrimPrefix(address, "0x"); hexPart != strings.ToLower(hexPart) && hexPart != strings.ToUpper(hexPart) && common.HexToAddress(address).Hex() != address {
+		return fmt.Errorf("%s %q fails its EIP-55 checksum, expected %s", field, address, common.HexToAddress(address).Hex())
+	}
+	return nil
+}
+
+func validateBroadcastURLs(field string, urls []string) []error {
+	var errs []error
+	for i, broadcastURL := range urls {
+		if err := validateNodeURL(fmt.Sprintf("%s[%d]", field, i), broadcastURL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func validateNonces(field string, nonces map[string]uint64) []error {
+	var errs []error
+	for address := range nonces {
+		if err := validateAddress(fmt.Sprintf("%s[%s]", field, address), address); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func validateBeaconURL(field string, beaconURL string) []error {
+	if beaconURL == "" {
+		return nil
+	}
+	if parsed, err := url.Parse(beaconURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return []error{fmt.Errorf("%s %q is not an http or https url", field, beaconURL)}
+	}
+	return nil
+}
+
+func validateNodeURL(field string, nodeURL string) error {
+	if nodeURL == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	parsed, err := url.Parse(nodeURL)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid url: %v", field, err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "ws", "wss":
+	case "":
+		if !strings.HasSuffix(nodeURL, ".ipc") {
+			return fmt.Errorf("%s %q has no scheme, expected http://, https://, ws://, wss:// or the path to a .ipc file", field, nodeURL)
+		}
+	default:
+		return fmt.Errorf("%s scheme %q is not supported, expected http, https, ws or wss", field, parsed.Scheme)
+	}
+	return nil
+}
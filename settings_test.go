@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBigNumbersThroughYAMLAndTOML(t *testing.T) {
+	const wei = "340282366920938463463374607431768211457" //2^128 + 1
+	const eth = "0.100000000000000000000000001"
+	cases := []struct {
+		format  string
+		convert func([]byte) ([]byte, error)
+		data    string
+	}{
+		{"yaml", yamlToJSON, "keep_wei: " + wei + "\nkeep_eth: " + eth + "\nfee:\n  multiplier: 1.5\nnonces:\n  \"0xde57\": 7\n"},
+		{"toml", tomlToJSON, "keep_wei = " + wei + "\nkeep_eth = " + eth + " # the reserve\n\n[fee]\nmultiplier = 1.5\n\n[nonces]\n\"0xde57\" = 7\n"},
+	}
+	for _, c := range cases {
+		data, err := c.convert([]byte(c.data))
+		if err != nil {
+			t.Fatalf("%s: %v", c.format, err)
+		}
+		var values settings
+		if err := unmarshalSettings(data, &values); err != nil {
+			t.Fatalf("%s: %v in %s", c.format, err, data)
+		}
+		if values.KeepWei.String() != wei || values.KeepEth.String() != eth {
+			t.Errorf("%s: keep_wei %s and keep_eth %s, want %s and %s", c.format, values.KeepWei, values.KeepEth, wei, eth)
+		}
+		if values.Fee.Multiplier != 1.5 || values.Nonces["0xde57"] != 7 {
+			t.Errorf("%s: multiplier %v and nonce %d, want 1.5 and 7", c.format, values.Fee.Multiplier, values.Nonces["0xde57"])
+		}
+	}
+}
+
+func TestTOMLMultilineStringKeepsNumbers(t *testing.T) {
+	data, err := tomlToJSON([]byte("note = \"\"\"\nkeep_wei = 5\n\"\"\"\nkeep_wei = 6\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"keep_wei":6,"note":"keep_wei = 5\n"}` {
+		t.Errorf("got %s", data)
+	}
+}
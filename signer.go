@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"walletMigrate/Accounts"
+	"walletMigrate/Audit"
+	"walletMigrate/Errors"
+	"walletMigrate/RPC"
+)
+
+//where the sign-server command listens unless signer.listen says otherwise
+const defaultSignerListen = "127.0.0.1:8645"
+
+//signerSettings split the keys from the rest of the migration: the sign-server command serves the keys of the
+//settings' mnemonics and private keys, and a run with url set scans and plans without them, having the server sign
+type signerSettings struct {
+	URL     string `json:"url"`      //sign-server that signs for the accounts, mnemonics and private_keys are left out
+	Token   string `json:"token"`    //shared secret every request to the sign-server carries
+	Listen  string `json:"listen"`   //address the sign-server command listens on (default 127.0.0.1:8645)
+	TLSCert string `json:"tls_cert"` //certificate and key the sign-server serves https with
+	TLSKey  string `json:"tls_key"`
+}
+
+func (self signerSettings) validate(field string) []error {
+	var errs []error
+	if self.URL != "" {
+		parsed, err := url.Parse(self.URL)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s.url is not a valid url: %v", field, err))
+		case parsed.Scheme == "http" && !loopback(parsed.Hostname()):
+			errs = append(errs, fmt.Errorf("%s.url %s sends the token in the clear, use https for a sign-server on another host", field, self.URL))
+		case parsed.Scheme != "http" && parsed.Scheme != "https":
+			errs = append(errs, fmt.Errorf("%s.url scheme %q is not supported, expected http or https", field, parsed.Scheme))
+		}
+	}
+	if (self.URL != "" || self.Listen != "") && len(self.Token) < 16 {
+		errs = append(errs, fmt.Errorf("%s.token of at least 16 characters is required", field))
+	}
+	if (self.TLSCert == "") != (self.TLSKey == "") {
+		errs = append(errs, fmt.Errorf("%s.tls_cert and %s.tls_key are required together", field, field))
+	}
+	if self.Listen != "" {
+		if err := validateListen(field+".listen", self.Listen, self.TLSCert != "", field); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+//the accounts to migrate, derived from the keys or listed by the sign-server that holds them
+func (self settings) accounts() ([]Accounts.Account, error) {
+	if self.Signer.URL == "" {
+		accounts := Accounts.GetAccounts(self.mnemonics(), self.PrivateKeys, self.extendedKeys(), self.BrainWallets)
+		return accounts, self.verifyExpected(accounts)
+	}
+	accounts, err := Accounts.NewRemoteSigner(self.Signer.URL, self.Signer.Token).Accounts()
+	if err != nil {
+		return nil, err
+	}
+	display.logf(RPC.VerbosityNormal, "%d accounts are signed for by the sign-server at %s\n", len(accounts), self.Signer.URL)
+	return accounts, nil
+}
+
+//what the sign-server signs: transfers to the settings' destinations, token_destinations and first hops.  The server
+//never sees the state file, so rotated (destination_xpub) and hop addresses are taken up to one per account served
+func (self settings) signPolicy(accounts []Accounts.Account) (Accounts.SignPolicy, error) {
+	policy := Accounts.SignPolicy{Recipients: make(map[common.Address]bool)}
+	splits, err := self.splits()
+	if err != nil {
+		return policy, err
+	}
+	for _, split := range splits {
+		policy.Recipients[split.address] = true
+	}
+	for _, to := range self.TokenDestinations {
+		policy.Recipients[common.HexToAddress(to)] = true
+	}
+	for index := 0; index < len(accounts); index++ {
+		if self.DestinationXpub != "" {
+			address, err := Accounts.DeriveReceivingAddress(self.DestinationXpub, uint32(index))
+			if err != nil {
+				return policy, err
+			}
+			policy.Recipients[address] = true
+		}
+		if self.Hops.Count > 0 {
+			hop, err := Accounts.DeriveAccount(self.Hops.Mnemonic, fmt.Sprintf("m/44'/60'/0'/0/%d", index))
+			if err != nil {
+				return policy, err
+			}
+			policy.Recipients[hop.Address] = true
+		}
+	}
+	chains, err := self.selectChains("")
+	if err != nil {
+		return policy, err
+	}
+	for _, chain := range chains {
+		policy.Homestead = policy.Homestead || chain.Homestead
+	}
+	return policy, nil
+}
+
+//the sign-server command: serve the keys to runs planning elsewhere until interrupted.  Nothing is sent to a node,
+//each signed transaction is printed and appended to the audit log
+func serveSigner(in settings, audit *Audit.Log, status *runStatus) int {
+	if in.Signer.URL != "" {
+		status.abort(fmt.Errorf("the sign-server command signs with the settings' own keys, remove signer.url"))
+	}
+	if len(in.Signer.Token) < 16 {
+		status.abort(fmt.Errorf("the sign-server command needs a signer.token of at least 16 characters"))
+	}
+	listen := in.Signer.Listen
+	if listen == "" {
+		listen = defaultSignerListen
+	}
+	accounts := Accounts.GetAccounts(in.mnemonics(), in.PrivateKeys, in.extendedKeys(), in.BrainWallets)
+	policy, err := in.signPolicy(accounts)
+	if err != nil {
+		status.abort(err)
+	}
+	//requests are served concurrently, the count and audit log take one signature at a time
+	var lock sync.Mutex
+	signed := func(from common.Address, tx *types.Transaction) {
+		lock.Lock()
+		defer lock.Unlock()
+		status.Transactions++
+		to := "contract creation"
+		if tx.To() != nil {
+			to = display.hex(tx.To().Hex())
+		}
+		fmt.Printf("signed %s nonce %d to %s value %s wei on chain %s: %s\n", display.hex(from.Hex()), tx.Nonce(), to, tx.Value(), tx.ChainId(), display.hex(tx.Hash().Hex()))
+		if err := audit.Signed(from, tx); err != nil {
+			Errors.Log(Errors.FileError, "M19", err)
+		}
+	}
+	server := &http.Server{Addr: listen, Handler: Accounts.SignHandler(accounts, in.Signer.Token, policy, signed)}
+	stopped := make(chan os.Signal, 1)
+	signal.Notify(stopped, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stopped
+		server.Shutdown(context.Background())
+	}()
+	status.Accounts += len(accounts)
+	scheme := "http"
+	if in.Signer.TLSCert != "" {
+		scheme = "https"
+	}
+	fmt.Printf("Signing for %d accounts at %s://%s, interrupt to stop\n", len(accounts), scheme, listen)
+	if in.Signer.TLSCert != "" {
+		err = server.ListenAndServeTLS(in.Signer.TLSCert, in.Signer.TLSKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		status.abort(err)
+	}
+	if status.Transactions == 0 {
+		return exitNothingToDo
+	}
+	return exitCompleted
+}
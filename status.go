@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+	"walletMigrate/Errors"
+	"walletMigrate/Redaction"
+)
+
+//exit codes so wrappers and cron jobs can react to the outcome of a run
+const (
+	exitCompleted    = 0 //everything planned was sent (and mined when running live)
+	exitAborted      = 1 //invalid input or a fatal error stopped the run, log.Fatal also exits with 1
+	exitWithFailures = 2 //the run finished but some transactions failed to send, reverted or were not mined
+	exitNothingToDo  = 3 //no accounts with assets to migrate were found
+)
+
+//runStatus is written to the status_file setting when the run starts and again when it finishes,
+//a file still showing "running" after the process exited means it was aborted by a fatal error
+type runStatus struct {
+	Status       string                  `json:"status"`
+	ExitCode     int                     `json:"exit_code"`
+	Simulate     bool                    `json:"simulate"`
+	Started      time.Time               `json:"started"`
+	Finished     *time.Time              `json:"finished,omitempty"` //unset while the run is going
+	Accounts     int                     `json:"accounts"`
+	Transactions int                     `json:"transactions"`
+	Failed       int                     `json:"failed"`
+	UsedEmpty    []string                `json:"used_empty_accounts,omitempty"` //used before but nothing to migrate, see reportUsedAccounts
+	Manual       []manualToken           `json:"manual_action,omitempty"`       //tokens the run can't move, see manualTokens
+	Errors       map[Errors.Category]int `json:"errors,omitempty"`              //failures by category, see the Errors package
+	Error        string                  `json:"error,omitempty"`
+	path         string
+	fixed        time.Time //written as the start and finish times instead of the clock, see the fixed_time setting
+	exits        []func()
+}
+
+//a token whose transfer() returns false without reverting, it is left in its account for the user to move
+type manualToken struct {
+	Account  string `json:"account"`
+	Contract string `json:"contract"`
+	Symbol   string `json:"symbol,omitempty"`
+	Balance  string `json:"balance"` //in base units
+}
+
+//fixedTime is the time of the fixed_time setting, an invalid one is reported by validate and the clock is used
+func newRunStatus(path string, simulate bool, fixedTime string) *runStatus {
+	status := &runStatus{Status: "running", Simulate: simulate, path: path}
+	if fixedTime != "" {
+		status.fixed, _ = time.Parse(time.RFC3339, fixedTime)
+	}
+	status.Started = status.now()
+	status.write()
+	return status
+}
+
+func (self *runStatus) now() time.Time {
+	if !self.fixed.IsZero() {
+		return self.fixed.UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (self *runStatus) write() {
+	if self.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		Errors.Log(Errors.FileError, "S1", err)
+		return
+	}
+	//the error can quote anything, a node's reply or a setting
+	err = ioutil.WriteFile(self.path, []byte(Redaction.String(string(data))), 0600)
+	if err != nil {
+		Errors.Log(Errors.FileError, "S2", err)
+	}
+}
+
+//record the final outcome and exit with the matching exit code
+func (self *runStatus) finish(code int) {
+	self.ExitCode = code
+	switch code {
+	case exitCompleted:
+		self.Status = "completed"
+	case exitWithFailures:
+		self.Status = "completed with failures"
+	case exitNothingToDo:
+		self.Status = "nothing to do"
+	default:
+		self.Status = "aborted"
+	}
+	for _, action := range self.exits {
+		action()
+	}
+	finished := self.now()
+	self.Finished = &finished
+	self.Errors = Errors.Summary()
+	if len(self.Errors) > 0 {
+		var counts []string
+		for _, category := range Errors.Categories(self.Errors) {
+			counts = append(counts, fmt.Sprintf("%s %d", category, self.Errors[category]))
+		}
+		fmt.Fprintln(os.Stderr, "Failures by category:", strings.Join(counts, ", "))
+	}
+	if len(self.Manual) > 0 {
+		//never counted as a failure, nothing was sent for them, but they are not migrated either
+		fmt.Fprintf(os.Stderr, "%d tokens need manual action, their transfer() returns false: approve the destination and pull them with transferFrom or move them by hand\n", len(self.Manual))
+		for _, token := range self.Manual {
+			fmt.Fprintf(os.Stderr, "\t%s %s %s %s\n", token.Account, token.Contract, token.Symbol, token.Balance)
+		}
+	}
+	self.write()
+	Redaction.Flush()
+	os.Exit(code)
+}
+
+//run action when the run finishes or is aborted
+func (self *runStatus) onExit(action func()) {
+	self.exits = append(self.exits, action)
+}
+
+//stop the run, print the reason and record it in the status file
+func (self *runStatus) abort(err error) {
+	fmt.Fprintln(os.Stderr, "ERROR:", err)
+	self.Error = err.Error()
+	self.finish(exitAborted)
+}
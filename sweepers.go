@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//a drainer bot sends the funds out in the same or the next block after every deposit
+const sweeperReactionBlocks = 2
+
+//look for the pattern of a sweeper bot on the source addresses: ETH arriving and leaving again within a block or two,
+//a compromised key raced by a bot loses every gas transfer and token this tool sends in normal sequential transactions
+func detectSweepers(client RPC.Client, accounts []Accounts.Account, blocks uint64) {
+	addresses := make(map[common.Address]bool)
+	for _, account := range accounts {
+		addresses[account.Address] = true
+	}
+	display.logf(RPC.VerbosityNormal, "Checking the last %d blocks for sweeper bots on %d addresses\n", blocks, len(addresses))
+	transfers, err := client.GetRecentTransfers(addresses, blocks)
+	if err != nil {
+		fmt.Println(display.paint(colorRed, fmt.Sprintf("WARNING: could not check for sweeper bots: %v", err)))
+		return
+	}
+
+	//transfers are newest first, so for every deposit look back through the later outbound transfers of the address
+	report := table{header: []string{"Address", "Deposit", "Deposit Block", "Swept Out", "Sweep Block"}}
+	for i, deposit := range transfers {
+		if !addresses[deposit.To] || deposit.Value.Sign() == 0 {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			sweep := transfers[j]
+			if sweep.Block > deposit.Block+sweeperReactionBlocks {
+				break
+			}
+			if sweep.From == deposit.To && sweep.Hash != deposit.Hash {
+				report.add(colorRed, display.hex(deposit.To.Hex()), display.currency.Format(deposit.Value), fmt.Sprintf("%d", deposit.Block), display.currency.Format(sweep.Value), fmt.Sprintf("%d", sweep.Block))
+				break
+			}
+		}
+	}
+	if len(report.rows) == 0 {
+		display.logf(RPC.VerbosityVerbose, "No sweeper bot activity found\n")
+		return
+	}
+	fmt.Println(display.paint(colorRed, "WARNING: deposits to these source addresses were sent out again within a block or two, the pattern of a sweeper bot holding a compromised key.  The bot will race every gas transfer and token this tool sends one by one, don't run the migration with normal broadcasts: move the assets with a private bundle (e.g. Flashbots) that funds and empties each account in one block"))
+	report.print(display)
+}
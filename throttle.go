@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"walletMigrate/RPC"
+)
+
+//throttleSettings limit how fast a live run broadcasts, hundreds of transactions sent at once trip the spam filters of
+//providers and raise the fees of the migration's own later transactions
+type throttleSettings struct {
+	PerBlock  int `json:"per_block"`  //broadcast at most this many transactions before waiting for the next block
+	PerMinute int `json:"per_minute"` //broadcast at most this many transactions in any minute
+}
+
+func (self throttleSettings) validate(field string) []error {
+	var errs []error
+	if self.PerBlock < 0 {
+		errs = append(errs, fmt.Errorf("%s.per_block %d can't be negative", field, self.PerBlock))
+	}
+	if self.PerMinute < 0 {
+		errs = append(errs, fmt.Errorf("%s.per_minute %d can't be negative", field, self.PerMinute))
+	}
+	return errs
+}
+
+//throttle counts the broadcasts of the run against its settings, shared by every phase of a chain
+type throttle struct {
+	settings throttleSettings
+	block    uint64      //the head block when the broadcasts counted in inBlock were made
+	inBlock  int         //broadcasts made since block was the head
+	recent   []time.Time //broadcasts of the last minute
+}
+
+func newThrottle(settings throttleSettings) *throttle {
+	return &throttle{settings: settings}
+}
+
+//wait until another broadcast is allowed and count it
+func (self *throttle) wait(client RPC.Client) {
+	if self == nil {
+		return
+	}
+	if self.settings.PerMinute > 0 {
+		for len(self.recent) > 0 && time.Since(self.recent[0]) >= time.Minute {
+			self.recent = self.recent[1:]
+		}
+		if len(self.recent) >= self.settings.PerMinute {
+			wait := time.Minute - time.Since(self.recent[0])
+			display.logf(RPC.VerbosityVerbose, "Throttled to %d transactions a minute, waiting %s\n", self.settings.PerMinute, wait.Round(time.Second))
+			time.Sleep(wait)
+			self.recent = self.recent[1:]
+		}
+		self.recent = append(self.recent, time.Now())
+	}
+	if self.settings.PerBlock > 0 {
+		head := self.head(client)
+		if head != self.block {
+			self.block, self.inBlock = head, 0
+		}
+		if self.inBlock >= self.settings.PerBlock {
+			display.logf(RPC.VerbosityVerbose, "Throttled to %d transactions a block, waiting for the block after %d\n", self.settings.PerBlock, self.block)
+			for head == self.block {
+				time.Sleep(3 * time.Second)
+				head = self.head(client)
+			}
+			self.block, self.inBlock = head, 0
+		}
+		self.inBlock++
+	}
+}
+
+//the head block, a node that can't tell is given about a block's time and taken to have moved on
+func (self *throttle) head(client RPC.Client) uint64 {
+	number, err := client.GetBlockNumber()
+	if err != nil {
+		display.logf(RPC.VerbosityVerbose, "The head block couldn't be read to throttle the broadcasts: %v\n", err)
+		time.Sleep(12 * time.Second)
+		return self.block + 1
+	}
+	return number
+}
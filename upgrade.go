@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+//currentSettingsVersion is the settings schema this build reads, bump it and add an upgrade step
+//whenever a setting is renamed or restructured so existing settings files keep working
+const currentSettingsVersion = 2
+
+//settingsUpgrades[n] upgrades version n settings to version n+1 and returns a warning for each deprecated field it rewrote
+var settingsUpgrades = map[int]func(values map[string]interface{}) []string{
+	1: upgradeV1,
+}
+
+//upgrade settings without a version (version 1) or an older version to the current schema
+func upgradeSettings(data []byte) ([]byte, []string, error) {
+	var values map[string]interface{}
+	err := unmarshalSettings(data, &values)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := 1
+	if raw, ok := values["version"]; ok {
+		number, ok := raw.(json.Number)
+		if ok {
+			version, err = strconv.Atoi(number.String())
+		}
+		if !ok || err != nil || version < 1 {
+			return nil, nil, fmt.Errorf("version %v is not a valid settings version", raw)
+		}
+	}
+	if version > currentSettingsVersion {
+		return nil, nil, fmt.Errorf("settings version %d is newer than this build supports (%d), upgrade walletMigrate", version, currentSettingsVersion)
+	}
+
+	var warnings []string
+	for ; version < currentSettingsVersion; version++ {
+		warnings = append(warnings, settingsUpgrades[version](values)...)
+	}
+	values["version"] = currentSettingsVersion
+	if len(warnings) > 0 {
+		warnings = append(warnings, fmt.Sprintf("settings were upgraded to version %d, update the file to stop these warnings", currentSettingsVersion))
+	}
+
+	data, err = json.Marshal(values)
+	return data, warnings, err
+}
+
+//version 2 replaced gas_price_multiplier (and the per chain gas_strategy) with the fee settings
+func upgradeV1(values map[string]interface{}) []string {
+	var warnings []string
+	moveToFee := func(field string, object map[string]interface{}) {
+		fee, _ := object["fee"].(map[string]interface{})
+		if fee == nil {
+			fee = make(map[string]interface{})
+		}
+		if multiplier, ok := object["gas_price_multiplier"]; ok {
+			fee["multiplier"] = multiplier
+			delete(object, "gas_price_multiplier")
+			warnings = append(warnings, fmt.Sprintf("%sgas_price_multiplier is deprecated, use %sfee.multiplier", field, field))
+		}
+		if strategy, ok := object["gas_strategy"]; ok {
+			fee["strategy"] = strategy
+			delete(object, "gas_strategy")
+			warnings = append(warnings, fmt.Sprintf("%sgas_strategy is deprecated, use %sfee.strategy", field, field))
+		}
+		if len(fee) > 0 {
+			object["fee"] = fee
+		}
+	}
+
+	moveToFee("", values)
+	if chains, ok := values["chains"].(map[string]interface{}); ok {
+		var names []string
+		for name := range chains {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if chain, ok := chains[name].(map[string]interface{}); ok {
+				moveToFee("chains."+name+".", chain)
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"strings"
+	"walletMigrate/Accounts"
+	"walletMigrate/RPC"
+)
+
+//warn about source addresses that beacon chain validators withdraw to, once the keys are retired their rewards and
+//exits still arrive there, found for every derived address since an empty one can still receive withdrawals
+func reportWithdrawalAddresses(beaconURL string, accounts []Accounts.Account) {
+	addresses := make(map[common.Address]bool)
+	for _, account := range accounts {
+		addresses[account.Address] = true
+	}
+	display.logf(RPC.VerbosityNormal, "Checking %d addresses for validator withdrawals on %s\n", len(addresses), beaconURL)
+	found, err := RPC.FindWithdrawalValidators(beaconURL, addresses)
+	if err != nil {
+		fmt.Println(display.paint(colorRed, fmt.Sprintf("WARNING: could not check validator withdrawal addresses: %v", err)))
+		return
+	}
+	if len(found) == 0 {
+		display.logf(RPC.VerbosityNormal, "No validator withdraws to the source addresses\n")
+		return
+	}
+	report := table{header: []string{"Withdrawal Address", "Validators", "Index (Status)"}}
+	for _, account := range accounts {
+		if validators, ok := found[account.Address]; ok {
+			report.add(colorRed, display.hex(account.Address.Hex()), fmt.Sprintf("%d", len(validators)), strings.Join(validators, ", "))
+			delete(found, account.Address)
+		}
+	}
+	fmt.Println(display.paint(colorRed, "WARNING: validators withdraw to these source addresses, their rewards and exits keep arriving there after the migration.  Keep the keys or exit the validators before retiring the addresses (withdrawal credentials can't be changed once set)"))
+	report.print(display)
+}